@@ -0,0 +1,145 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/chenhailong/hong3/auth"
+	"github.com/chenhailong/hong3/logging"
+	"github.com/chenhailong/hong3/models"
+	"github.com/gin-gonic/gin"
+)
+
+// gin.Context 中保存认证信息的 key
+const (
+	contextUserKey  = "user"
+	contextTokenKey = "token"
+)
+
+// UpdateProfileRequest 修改资料请求
+type UpdateProfileRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// requireAuth 校验 token，并把当前用户放入上下文
+func (s *Server) requireAuth(c *gin.Context) {
+	token := extractToken(c)
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未提供token"})
+		return
+	}
+
+	user, err := s.store.ValidateToken(token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
+		return
+	}
+
+	c.Set(contextUserKey, user)
+	c.Set(contextTokenKey, token)
+	c.Next()
+}
+
+// currentUser 获取 requireAuth 放入上下文的用户
+func currentUser(c *gin.Context) *models.User {
+	return c.MustGet(contextUserKey).(*models.User)
+}
+
+// handleUpdateProfile 修改显示名称
+func (s *Server) handleUpdateProfile(c *gin.Context) {
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	user, err := s.store.UpdateName(currentUser(c).ID, req.Name)
+	if err != nil {
+		if err == auth.ErrInvalidName {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "修改失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"name":     user.Name,
+		},
+		"message": "修改成功",
+	})
+}
+
+// handleChangePassword 修改密码，其他会话会被注销
+func (s *Server) handleChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	user := currentUser(c)
+	ip := c.ClientIP()
+	throttle := s.store.Throttle()
+	if wait := throttle.CheckLogin(c.Request.Context(), ip, user.Username); wait > 0 {
+		tooManyAttempts(c, wait)
+		return
+	}
+
+	err := s.store.ChangePassword(user.ID, req.OldPassword, req.NewPassword, c.GetString(contextTokenKey))
+	if err != nil {
+		switch err {
+		case auth.ErrInvalidCredentials:
+			auth.Audit(c.Request.Context(), auth.AuditLoginFailed, "ip", ip, "user_id", user.ID, "reason", "password_change")
+			if wait := throttle.LoginFailed(c.Request.Context(), ip, user.Username); wait > 0 {
+				tooManyAttempts(c, wait)
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "原密码错误"})
+		case auth.ErrInvalidPassword:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			requestLog(c).Error("change password failed", logging.KeyUserID, user.ID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		}
+		return
+	}
+	auth.Audit(c.Request.Context(), auth.AuditPasswordChanged, "ip", ip, "user_id", user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "密码已修改，其他设备已退出登录"})
+}
+
+// handleDeleteAccount 注销账号
+func (s *Server) handleDeleteAccount(c *gin.Context) {
+	user := currentUser(c)
+	if err := s.store.DeleteAccount(user.ID); err != nil {
+		requestLog(c).Error("delete account failed", logging.KeyUserID, user.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注销账号失败"})
+		return
+	}
+	auth.Audit(c.Request.Context(), auth.AuditAccountDeleted, "ip", c.ClientIP(), "user_id", user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "账号已注销"})
+}
+
+// handleExportData 导出当前用户的全部数据
+func (s *Server) handleExportData(c *gin.Context) {
+	user := currentUser(c)
+	export, err := s.store.ExportUserData(user.ID, c.GetString(contextTokenKey))
+	if err != nil {
+		requestLog(c).Error("export user data failed", logging.KeyUserID, user.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="hong3-export.json"`)
+	c.JSON(http.StatusOK, export)
+}
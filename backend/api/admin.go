@@ -0,0 +1,142 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/chenhailong/hong3/auth"
+	"github.com/chenhailong/hong3/models"
+	"github.com/gin-gonic/gin"
+)
+
+// KickRequest 踢出玩家请求
+type KickRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// CloseRoomRequest 关闭房间请求
+type CloseRoomRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// AnnouncementRequest 服务器公告请求
+type AnnouncementRequest struct {
+	Message string `json:"message" binding:"required"`
+}
+
+// SetRoleRequest 修改用户角色请求
+type SetRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// requireRole 仅允许拥有指定角色（或更高角色）的用户访问（需在 requireAuth 之后使用）
+func (s *Server) requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentUser(c).HasRole(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "权限不足"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// handleAdminRooms 获取所有房间的完整状态
+func (s *Server) handleAdminRooms(c *gin.Context) {
+	c.JSON(http.StatusOK, s.hub.AdminRooms())
+}
+
+// handleAdminRoom 查看单个房间的对局（包含所有手牌）
+func (s *Server) handleAdminRoom(c *gin.Context) {
+	room, ok := s.hub.AdminRoom(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "房间不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, room)
+}
+
+// handleAdminKick 踢出玩家并断开连接
+func (s *Server) handleAdminKick(c *gin.Context) {
+	var req KickRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "被管理员移出"
+	}
+
+	if !s.hub.KickPlayer(c.Param("id"), req.Reason) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "玩家不在线"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已踢出玩家"})
+}
+
+// handleAdminCloseRoom 关闭房间
+func (s *Server) handleAdminCloseRoom(c *gin.Context) {
+	var req CloseRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "房间已被管理员关闭"
+	}
+
+	if !s.hub.CloseRoom(c.Param("id"), req.Reason) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "房间不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "房间已关闭"})
+}
+
+// handleAdminAnnounce 向所有在线玩家发送公告
+func (s *Server) handleAdminAnnounce(c *gin.Context) {
+	var req AnnouncementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	s.hub.Announce(req.Message)
+	c.JSON(http.StatusOK, gin.H{"message": "公告已发送"})
+}
+
+// handleAdminSetRole 修改用户角色
+func (s *Server) handleAdminSetRole(c *gin.Context) {
+	var req SetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	operator := currentUser(c)
+	if operator.ID == c.Param("id") && req.Role != models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能取消自己的管理员角色"})
+		return
+	}
+
+	user, err := s.store.SetRole(c.Param("id"), req.Role)
+	if err != nil {
+		switch err {
+		case auth.ErrInvalidRole:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case auth.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "修改角色失败"})
+		}
+		return
+	}
+	auth.Audit(c.Request.Context(), auth.AuditRoleChanged, "ip", c.ClientIP(), "operator_id", operator.ID, "user_id", user.ID, "role", user.Role)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"name":     user.Name,
+			"role":     user.Role,
+		},
+		"message": "角色已修改",
+	})
+}
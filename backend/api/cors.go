@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/chenhailong/hong3/config"
+	"github.com/gin-gonic/gin"
+)
+
+// originPolicy 来源白名单，REST 接口和 WebSocket 握手共用
+type originPolicy struct {
+	origins map[string]bool
+	any     bool
+
+	// 开发模式：允许 localhost 上任意端口的来源
+	devMode bool
+
+	// 可信的反向代理，只采用来自这些地址的 X-Forwarded-Proto
+	trustedProxies []*net.IPNet
+}
+
+// newOriginPolicy 根据配置创建来源白名单，trustedProxies 为 server.trusted_proxies
+func newOriginPolicy(cfg config.CORSConfig, trustedProxies []string) *originPolicy {
+	p := &originPolicy{origins: make(map[string]bool), devMode: cfg.DevMode}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			p.any = true
+			continue
+		}
+		p.origins[normalizeOrigin(origin)] = true
+	}
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			p.trustedProxies = append(p.trustedProxies, network)
+		}
+	}
+	return p
+}
+
+// allowed 判断请求的来源是否允许
+//
+// 不带 Origin 头的请求（非浏览器客户端）和同源请求（scheme 和 host 都相同）总是允许。
+func (p *originPolicy) allowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Scheme, p.scheme(r)) && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	if p.any || p.origins[normalizeOrigin(origin)] {
+		return true
+	}
+	return p.devMode && isLocalhost(u.Hostname())
+}
+
+// scheme 请求的 scheme：直接的 TLS 连接为 https，来自可信代理的请求以 X-Forwarded-Proto 为准
+func (p *originPolicy) scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" && p.fromTrustedProxy(r) {
+		proto, _, _ = strings.Cut(proto, ",")
+		return strings.ToLower(strings.TrimSpace(proto))
+	}
+	return "http"
+}
+
+// fromTrustedProxy 请求是否直接来自可信的反向代理
+func (p *originPolicy) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeOrigin 统一来源的格式：小写，去掉结尾的斜杠
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(origin), "/")
+}
+
+// isLocalhost 判断主机名是否为本机
+func isLocalhost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// cors 跨域访问中间件
+//
+// 允许的来源得到对应的 CORS 响应头；不允许的来源直接返回 403，不会执行后续的处理器。
+func (s *Server) cors(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	if origin == "" {
+		c.Next()
+		return
+	}
+	if !s.origins.allowed(c.Request) {
+		requestLog(c).Warn("cross-origin request rejected", "origin", origin)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "不允许的来源"})
+		return
+	}
+
+	cfg := s.config.CORS
+	header := c.Writer.Header()
+	header.Add("Vary", "Origin")
+	header.Set("Access-Control-Allow-Origin", origin)
+	if cfg.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	header.Set("Access-Control-Expose-Headers", requestIDHeader)
+
+	if c.Request.Method == http.MethodOptions {
+		header.Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+		header.Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+		if cfg.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	c.Next()
+}
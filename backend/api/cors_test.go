@@ -0,0 +1,52 @@
+package api
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chenhailong/hong3/config"
+)
+
+// TestOriginPolicySameOrigin 同源要求 scheme 和 host 都相同，X-Forwarded-Proto 只采用可信代理的
+func TestOriginPolicySameOrigin(t *testing.T) {
+	policy := newOriginPolicy(config.CORSConfig{}, []string{"172.28.0.10"})
+
+	tests := []struct {
+		name       string
+		origin     string
+		remoteAddr string
+		tls        bool
+		proto      string
+		want       bool
+	}{
+		{name: "no origin", want: true},
+		{name: "same scheme and host", origin: "http://hong3.test", want: true},
+		{name: "http page to https server", origin: "http://hong3.test", tls: true, want: false},
+		{name: "https page to https server", origin: "https://hong3.test", tls: true, want: true},
+		{name: "other host", origin: "http://evil.test", want: false},
+		{name: "https behind trusted proxy", origin: "https://hong3.test", remoteAddr: "172.28.0.10:4000", proto: "https", want: true},
+		{name: "http page behind trusted https proxy", origin: "http://hong3.test", remoteAddr: "172.28.0.10:4000", proto: "https", want: false},
+		{name: "forwarded proto from untrusted client", origin: "https://hong3.test", remoteAddr: "203.0.113.5:4000", proto: "https", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://hong3.test/api/rooms", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if got := policy.allowed(r); got != tt.want {
+				t.Errorf("allowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chenhailong/hong3/protocol"
+	"github.com/chenhailong/hong3/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+// sseKeepAlive 事件流没有新事件时发送注释行的间隔，避免代理断开空闲连接
+const sseKeepAlive = 15 * time.Second
+
+// GameActionRequest 准备或过牌请求，请求体可以省略
+type GameActionRequest struct {
+	ActionID string `json:"action_id,omitempty"` // 重试时使用同一个 action_id，动作不会重复执行
+}
+
+// PlayCardsRequest 出牌请求
+type PlayCardsRequest struct {
+	ActionID    string `json:"action_id,omitempty"`
+	CardIndices []int  `json:"card_indices" binding:"required"`
+}
+
+// gameSession 获取当前用户的 REST 会话，玩家ID和名称来自登录的用户
+func (s *Server) gameSession(c *gin.Context) *websocket.Session {
+	user := currentUser(c)
+	return s.hub.Session(user.ID, user.Name, user.Role, requestLog(c))
+}
+
+// handleGameCreateRoom 创建房间并加入
+func (s *Server) handleGameCreateRoom(c *gin.Context) {
+	roomID, err := s.gameSession(c).CreateRoom(c.Request.Context())
+	if err != nil {
+		gameError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"room_id": roomID})
+}
+
+// handleGameJoinRoom 加入房间
+func (s *Server) handleGameJoinRoom(c *gin.Context) {
+	room, err := s.gameSession(c).JoinRoom(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		gameError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"room": room})
+}
+
+// handleGameLeave 离开当前房间
+func (s *Server) handleGameLeave(c *gin.Context) {
+	if err := s.gameSession(c).LeaveRoom(); err != nil {
+		gameError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已离开房间"})
+}
+
+// handleGameState 获取房间状态和自己的游戏状态（游戏未开始时 game 为 null）
+func (s *Server) handleGameState(c *gin.Context) {
+	room, game, err := s.gameSession(c).State(c.Request.Context())
+	if err != nil {
+		gameError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"room": room, "game": game})
+}
+
+// handleGameReady 准备
+func (s *Server) handleGameReady(c *gin.Context) {
+	s.handleGameAction(c, protocol.ActionReady)
+}
+
+// handleGamePass 过牌
+func (s *Server) handleGamePass(c *gin.Context) {
+	s.handleGameAction(c, protocol.ActionPass)
+}
+
+// handleGameAction 执行不带参数的游戏动作
+func (s *Server) handleGameAction(c *gin.Context, action string) {
+	var req GameActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	s.act(c, &protocol.GameAction{ActionID: req.ActionID, Action: action})
+}
+
+// handleGamePlay 出牌
+func (s *Server) handleGamePlay(c *gin.Context) {
+	var req PlayCardsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	s.act(c, &protocol.GameAction{ActionID: req.ActionID, Action: protocol.ActionPlayCards, CardIndices: req.CardIndices})
+}
+
+// act 执行游戏动作并返回处理结果
+func (s *Server) act(c *gin.Context, action *protocol.GameAction) {
+	ack, err := s.gameSession(c).Act(c.Request.Context(), action)
+	if err != nil {
+		gameError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"action_id": ack.ActionID,
+		"action":    ack.Action,
+		"duplicate": ack.Duplicate,
+	})
+}
+
+// handleGameEvents 长轮询：返回 after 之后的事件，没有新事件时最多等待 timeout 秒
+func (s *Server) handleGameEvents(c *gin.Context) {
+	after, err := strconv.ParseUint(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "after 参数错误"})
+		return
+	}
+	wait := s.config.REST.MaxPollWait
+	if value := c.Query("timeout"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "timeout 参数错误"})
+			return
+		}
+		wait = min(wait, time.Duration(seconds)*time.Second)
+	}
+
+	ctx, cancel := s.streamContext(c, wait)
+	defer cancel()
+	batch, err := s.gameSession(c).Events(ctx, after)
+	if err != nil {
+		gameError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// handleGameEventStream 以 Server-Sent Events 推送事件
+//
+// 事件的 id 为事件ID，event 为消息类型，data 与 WebSocket 客户端收到的消息相同。
+// 重新连接时浏览器通过 Last-Event-ID 头带上最后收到的事件ID，也可以用 after 参数指定。
+// 部分事件已被淘汰时先发送 missed 事件，客户端应重新获取状态。
+func (s *Server) handleGameEventStream(c *gin.Context) {
+	cursor := c.GetHeader("Last-Event-ID")
+	if cursor == "" {
+		cursor = c.DefaultQuery("after", "0")
+	}
+	after, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "after 参数错误"})
+		return
+	}
+
+	session := s.gameSession(c)
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	for {
+		ctx, cancel := s.streamContext(c, sseKeepAlive)
+		batch, err := session.Events(ctx, after)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(c.Writer, "event: session_ended\ndata: %s\n\n", mustJSON(gin.H{"error": err.Error()}))
+			c.Writer.Flush()
+			return
+		}
+		if c.Request.Context().Err() != nil {
+			return
+		}
+
+		if batch.Missed {
+			fmt.Fprintf(c.Writer, "event: missed\ndata: %s\n\n", mustJSON(gin.H{"after": after}))
+		}
+		for _, e := range batch.Events {
+			fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+		}
+		if len(batch.Events) == 0 && !batch.Missed {
+			if s.streams.Err() != nil {
+				// 服务器正在关闭
+				return
+			}
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+		}
+		c.Writer.Flush()
+		after = batch.Next
+	}
+}
+
+// streamContext 请求的 context，最多持续 wait，服务器关闭时提前结束
+func (s *Server) streamContext(c *gin.Context, wait time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), wait)
+	stop := context.AfterFunc(s.streams, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// gameError 把会话返回的错误转换为 HTTP 响应
+func gameError(c *gin.Context, err error) {
+	var validationErr *protocol.ValidationError
+	var commandErr *websocket.CommandError
+	switch {
+	case errors.As(err, &validationErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Message, "field": validationErr.Field})
+	case errors.As(err, &commandErr):
+		c.JSON(http.StatusConflict, gin.H{"error": commandErr.Message})
+	case errors.Is(err, websocket.ErrSessionEnded):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, websocket.ErrReplyTimeout):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+	default:
+		requestLog(c).Error("game request failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "请求失败"})
+	}
+}
+
+// mustJSON 编码只包含基本类型的值
+func mustJSON(v any) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/chenhailong/hong3/logging"
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestLogger 为每个请求分配 request_id，并把带该字段的日志记录器放入请求 context
+func (s *Server) requestLogger(c *gin.Context) {
+	requestID := c.GetHeader(requestIDHeader)
+	if requestID == "" || len(requestID) > 64 {
+		requestID = newRequestID()
+	}
+	c.Header(requestIDHeader, requestID)
+
+	logger := s.logger.With(logging.KeyRequestID, requestID)
+	c.Request = c.Request.WithContext(logging.NewContext(c.Request.Context(), logger))
+
+	start := time.Now()
+	c.Next()
+
+	// 只记录路径，不记录查询参数（其中可能带有 token）
+	level := slog.LevelInfo
+	if c.Writer.Status() >= 500 {
+		level = slog.LevelError
+	}
+	logger.Log(c.Request.Context(), level, "http request",
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"status", c.Writer.Status(),
+		"duration", time.Since(start),
+		"ip", c.ClientIP(),
+	)
+}
+
+// requestLog 返回当前请求的日志记录器
+func requestLog(c *gin.Context) *slog.Logger {
+	return logging.FromContext(c.Request.Context())
+}
+
+// newRequestID 生成随机请求ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/chenhailong/hong3/metrics"
+	"github.com/chenhailong/hong3/models"
+	"github.com/gin-gonic/gin"
+)
+
+// requireMetricsAccess 仅允许 Prometheus（配置的 token）或管理员访问 /metrics
+func (s *Server) requireMetricsAccess(c *gin.Context) {
+	token := extractToken(c)
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未提供token"})
+		return
+	}
+
+	if metricsToken := s.config.Metrics.Token; metricsToken != "" {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(metricsToken)) == 1 {
+			c.Next()
+			return
+		}
+	}
+
+	user, err := s.store.ValidateToken(token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
+		return
+	}
+	if !user.HasRole(models.RoleAdmin) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "权限不足"})
+		return
+	}
+
+	c.Next()
+}
+
+// handleMetrics 输出 Prometheus 指标
+func (s *Server) handleMetrics(c *gin.Context) {
+	metrics.Handler().ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/chenhailong/hong3/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie 保存 OIDC 登录流程 state 的 cookie，把登录流程绑定到发起登录的浏览器
+const oidcStateCookie = "hong3_oidc_state"
+
+// oidcStateCookieMaxAge cookie 的有效时间（秒），与登录流程的有效时间一致
+const oidcStateCookieMaxAge = 10 * 60
+
+// handleOIDCLogin 跳转到身份提供方开始 OIDC 登录
+// 已登录用户携带 token 访问时，回调成功后会将外部身份关联到当前用户
+func (s *Server) handleOIDCLogin(c *gin.Context) {
+	provider := auth.GetOIDC()
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": auth.ErrOIDCDisabled.Error()})
+		return
+	}
+
+	linkUserID := ""
+	if token := extractToken(c); token != "" {
+		user, err := s.store.ValidateToken(token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
+			return
+		}
+		linkUserID = user.ID
+	}
+
+	authURL, state, err := s.store.StartOIDCLogin(provider, linkUserID)
+	if err != nil {
+		requestLog(c).Error("failed to start oidc login", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "OIDC登录失败"})
+		return
+	}
+
+	setOIDCStateCookie(c, provider, state, oidcStateCookieMaxAge)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// handleOIDCCallback 处理身份提供方的回调，签发 Hong3 token
+func (s *Server) handleOIDCCallback(c *gin.Context) {
+	provider := auth.GetOIDC()
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": auth.ErrOIDCDisabled.Error()})
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		requestLog(c).Warn("oidc login denied by provider", "error", errCode, "description", c.Query("error_description"))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "身份提供方拒绝了登录请求"})
+		return
+	}
+
+	// state 必须与发起登录的浏览器中保存的一致，防止把别人发起的登录流程交给受害者完成
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, provider, "", -1)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		requestLog(c).Warn("oidc callback state does not match browser")
+		c.JSON(http.StatusBadRequest, gin.H{"error": auth.ErrOIDCState.Error()})
+		return
+	}
+
+	ext, linkUserID, err := s.store.FinishOIDCLogin(c.Request.Context(), provider, state, c.Query("code"))
+	if err != nil {
+		requestLog(c).Warn("oidc callback failed", "error", err)
+		if err == auth.ErrOIDCState {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "OIDC登录失败"})
+		}
+		return
+	}
+
+	user, token, err := s.store.LoginWithIdentity(ext, linkUserID)
+	if err != nil {
+		requestLog(c).Error("oidc identity login failed", "issuer", ext.Issuer, "subject", ext.Subject, "error", err)
+		if err == auth.ErrIdentityLinked {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		}
+		return
+	}
+
+	auth.Audit(c.Request.Context(), auth.AuditOIDCLogin, "ip", c.ClientIP(), "user_id", user.ID, "issuer", ext.Issuer, "subject", ext.Subject, "linked", linkUserID != "")
+
+	// 配置了前端地址时，通过 URL fragment 把 token 交给前端
+	if frontendURL := provider.FrontendURL(); frontendURL != "" {
+		fragment := url.Values{}
+		fragment.Set("token", token)
+		c.Redirect(http.StatusFound, frontendURL+"#"+fragment.Encode())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token": token,
+		"user": gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"name":     user.Name,
+		},
+		"message": "登录成功",
+	})
+}
+
+// setOIDCStateCookie 设置（maxAge 为 -1 时删除）保存 state 的 cookie
+//
+// 身份提供方的回调是跨站的顶层跳转，SameSite 只能用 Lax；回调地址为 https 时只通过 https 发送。
+func setOIDCStateCookie(c *gin.Context, provider *auth.OIDCProvider, state string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := strings.HasPrefix(provider.RedirectURL(), "https://")
+	c.SetCookie(oidcStateCookie, state, maxAge, "/api/oidc", "", secure, true)
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/chenhailong/hong3/auth"
+	"github.com/chenhailong/hong3/auth/oidctest"
+	"github.com/chenhailong/hong3/config"
+)
+
+// useMockOIDC 启用指向本地模拟提供方的 OIDC 登录，测试结束后禁用
+func useMockOIDC(t *testing.T) *oidctest.Provider {
+	t.Helper()
+	mock, server := oidctest.NewServer("hong3", "secret")
+	t.Cleanup(server.Close)
+
+	provider, err := auth.NewOIDCProvider(context.Background(), config.OIDCConfig{
+		Enabled:      true,
+		Issuer:       server.URL,
+		ClientID:     "hong3",
+		ClientSecret: "secret",
+		RedirectURL:  "http://hong3.test/api/oidc/callback",
+		ProviderName: "mock",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.SetOIDC(provider)
+	t.Cleanup(func() { auth.SetOIDC(nil) })
+	return mock
+}
+
+// oidcCallback 访问登录接口并由模拟提供方授权，返回回调地址和浏览器保存的 state cookie
+func oidcCallback(t *testing.T, server *Server, token string) (string, *http.Cookie) {
+	t.Helper()
+	target := "/api/oidc/login"
+	if token != "" {
+		target += "?token=" + url.QueryEscape(token)
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body.String())
+	}
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("login: state cookie %+v, want HttpOnly SameSite=Lax", cookie)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d", resp.StatusCode)
+	}
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callback.Query().Get("state") != cookie.Value {
+		t.Fatalf("callback state %q does not match cookie %q", callback.Query().Get("state"), cookie.Value)
+	}
+	return callback.RequestURI(), cookie
+}
+
+// finishOIDC 以浏览器的 cookie 访问回调地址
+func finishOIDC(server *Server, callback string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	return w
+}
+
+// oidcLoginResult 回调返回的 token 和用户
+func oidcLoginResult(t *testing.T, w *httptest.ResponseRecorder) (string, string) {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback: status %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Token string `json:"token"`
+		User  struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Token == "" {
+		t.Fatal("callback returned no token")
+	}
+	return body.Token, body.User.ID
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	server, store := newTestServer(t)
+	mock := useMockOIDC(t)
+	mock.SetUser(oidctest.User{Subject: "oidc-new", PreferredUsername: "oidc_new", Name: "OIDC New"})
+
+	callback, cookie := oidcCallback(t, server, "")
+	token, userID := oidcLoginResult(t, finishOIDC(server, callback, cookie))
+
+	user, err := store.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != userID || user.Name != "OIDC New" {
+		t.Errorf("token user %+v, want new user %s named OIDC New", user, userID)
+	}
+
+	// 同一身份再次登录得到同一个用户
+	callback, cookie = oidcCallback(t, server, "")
+	if _, again := oidcLoginResult(t, finishOIDC(server, callback, cookie)); again != userID {
+		t.Errorf("second login user %s, want %s", again, userID)
+	}
+}
+
+func TestOIDCLoginLinksUser(t *testing.T) {
+	server, store := newTestServer(t)
+	mock := useMockOIDC(t)
+	mock.SetUser(oidctest.User{Subject: "oidc-link", PreferredUsername: "oidc_link", Name: "OIDC Link"})
+
+	if _, err := store.Register("oidc_owner", "password123", "Owner"); err != nil {
+		t.Fatal(err)
+	}
+	owner, ownerToken, err := store.Login("oidc_owner", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback, cookie := oidcCallback(t, server, ownerToken)
+	if _, userID := oidcLoginResult(t, finishOIDC(server, callback, cookie)); userID != owner.ID {
+		t.Fatalf("linked login user %s, want %s", userID, owner.ID)
+	}
+
+	// 之后不带 token 登录也进入关联的用户
+	callback, cookie = oidcCallback(t, server, "")
+	if _, userID := oidcLoginResult(t, finishOIDC(server, callback, cookie)); userID != owner.ID {
+		t.Errorf("login after link user %s, want %s", userID, owner.ID)
+	}
+}
+
+func TestOIDCCallbackRequiresBrowserState(t *testing.T) {
+	server, store := newTestServer(t)
+	useMockOIDC(t)
+
+	if _, err := store.Register("oidc_attacker", "password123", "Attacker"); err != nil {
+		t.Fatal(err)
+	}
+	_, attackerToken, err := store.Login("oidc_attacker", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 攻击者发起的关联流程交给没有 cookie 的受害者完成
+	callback, _ := oidcCallback(t, server, attackerToken)
+	if w := finishOIDC(server, callback, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("callback without cookie: status %d, want 400", w.Code)
+	}
+
+	// 受害者自己的 cookie 属于另一次登录流程
+	callback, _ = oidcCallback(t, server, attackerToken)
+	_, victimCookie := oidcCallback(t, server, "")
+	if w := finishOIDC(server, callback, victimCookie); w.Code != http.StatusBadRequest {
+		t.Errorf("callback with another flow's cookie: status %d, want 400", w.Code)
+	}
+}
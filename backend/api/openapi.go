@@ -0,0 +1,456 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/chenhailong/hong3/auth"
+	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/protocol"
+	"github.com/chenhailong/hong3/redis"
+	"github.com/chenhailong/hong3/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+// 响应体的结构，与处理函数返回的 JSON 一致（由 openapi_test.go 校验）
+
+// ErrorResponse 错误响应
+type ErrorResponse struct {
+	Error      string `json:"error"`
+	Field      string `json:"field,omitempty"`       // 不符合协议的字段（游戏动作）
+	RetryAfter int    `json:"retry_after,omitempty"` // 尝试次数过多时，多少秒后可以重试
+}
+
+// MessageResponse 只包含提示信息的响应
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// UserInfo 响应中的用户信息
+type UserInfo struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Role     string `json:"role,omitempty" enum:"player,moderator,admin"`
+}
+
+// UserResponse 包含用户信息的响应
+type UserResponse struct {
+	User    UserInfo `json:"user"`
+	Message string   `json:"message,omitempty"`
+}
+
+// LoginResponse 登录成功的响应
+type LoginResponse struct {
+	Token   string   `json:"token"`
+	User    UserInfo `json:"user"`
+	Message string   `json:"message"`
+}
+
+// HealthResponse 健康检查的响应
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// CreateRoomResponse 创建房间的响应
+type CreateRoomResponse struct {
+	RoomID string `json:"room_id"`
+}
+
+// JoinRoomResponse 加入房间的响应
+type JoinRoomResponse struct {
+	Room *protocol.RoomState `json:"room"`
+}
+
+// GameStateResponse 房间状态和自己的游戏状态，游戏未开始时 game 为 null
+type GameStateResponse struct {
+	Room *protocol.RoomState `json:"room"`
+	Game *protocol.GameState `json:"game"`
+}
+
+// ActionResponse 游戏动作的处理结果
+type ActionResponse struct {
+	ActionID  string `json:"action_id"`
+	Action    string `json:"action" enum:"ready,play_cards,pass"`
+	Duplicate bool   `json:"duplicate"` // 重复的请求，动作没有再次执行
+}
+
+// apiOperation 一个 REST 接口，用于生成 OpenAPI 文档
+type apiOperation struct {
+	method  string
+	path    string // gin 的路由格式，例如 /api/admin/rooms/:id
+	tag     string
+	summary string
+
+	// 需要的角色：空为不需要登录，models.RolePlayer 为任意登录用户
+	role string
+
+	request         any  // 请求体，nil 表示没有请求体
+	requestOptional bool // 请求体可以省略
+
+	query     []apiParam
+	headers   []apiParam
+	responses []apiResponse
+}
+
+// apiParam query 参数或请求头
+type apiParam struct {
+	name        string
+	typ         string // JSON Schema 类型
+	description string
+}
+
+// apiResponse 一种响应
+type apiResponse struct {
+	status      int
+	body        any    // 响应体，nil 表示没有响应体
+	contentType string // 为空时为 application/json
+}
+
+// reply 返回 JSON 响应体的响应
+func reply(status int, body any) apiResponse {
+	return apiResponse{status: status, body: body}
+}
+
+// failures 返回 ErrorResponse 的响应
+func failures(statuses ...int) []apiResponse {
+	responses := make([]apiResponse, 0, len(statuses))
+	for _, status := range statuses {
+		responses = append(responses, reply(status, ErrorResponse{}))
+	}
+	return responses
+}
+
+// responses 拼接响应列表
+func responses(first apiResponse, rest ...[]apiResponse) []apiResponse {
+	all := []apiResponse{first}
+	for _, r := range rest {
+		all = append(all, r...)
+	}
+	return all
+}
+
+// 游戏接口的通用错误：命令被拒绝、会话已结束和等待超时
+var gameFailures = failures(http.StatusConflict, http.StatusGone, http.StatusGatewayTimeout, http.StatusInternalServerError)
+
+// apiOperations 所有 REST 接口，与 setupRoutes 注册的路由一一对应
+var apiOperations = []apiOperation{
+	// 账号
+	{
+		method: http.MethodPost, path: "/api/register", tag: "account", summary: "注册",
+		request:   RegisterRequest{},
+		responses: responses(reply(http.StatusOK, UserResponse{}), failures(http.StatusBadRequest, http.StatusConflict, http.StatusTooManyRequests, http.StatusInternalServerError)),
+	},
+	{
+		method: http.MethodPost, path: "/api/login", tag: "account", summary: "登录，返回 token",
+		request:   LoginRequest{},
+		responses: responses(reply(http.StatusOK, LoginResponse{}), failures(http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusInternalServerError)),
+	},
+	{
+		method: http.MethodGet, path: "/api/oidc/login", tag: "account", summary: "跳转到身份提供方开始 OIDC 登录，携带 token 时关联到当前用户",
+		query:     []apiParam{{name: "token", typ: "string", description: "已登录用户的 token"}},
+		responses: responses(apiResponse{status: http.StatusFound}, failures(http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError)),
+	},
+	{
+		method: http.MethodGet, path: "/api/oidc/callback", tag: "account", summary: "身份提供方的回调，state 必须与登录时设置的 cookie 一致，配置了前端地址时跳转到前端",
+		query: []apiParam{
+			{name: "state", typ: "string"},
+			{name: "code", typ: "string"},
+			{name: "error", typ: "string", description: "身份提供方拒绝登录时的错误码"},
+		},
+		responses: responses(reply(http.StatusOK, LoginResponse{}),
+			[]apiResponse{{status: http.StatusFound}},
+			failures(http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError)),
+	},
+	{
+		method: http.MethodGet, path: "/api/me", tag: "account", summary: "当前用户信息", role: models.RolePlayer,
+		responses: responses(reply(http.StatusOK, UserResponse{})),
+	},
+	{
+		method: http.MethodPut, path: "/api/me", tag: "account", summary: "修改显示名称", role: models.RolePlayer,
+		request:   UpdateProfileRequest{},
+		responses: responses(reply(http.StatusOK, UserResponse{}), failures(http.StatusBadRequest, http.StatusInternalServerError)),
+	},
+	{
+		method: http.MethodPut, path: "/api/me/password", tag: "account", summary: "修改密码，其他会话会被注销", role: models.RolePlayer,
+		request:   ChangePasswordRequest{},
+		responses: responses(reply(http.StatusOK, MessageResponse{}), failures(http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusInternalServerError)),
+	},
+	{
+		method: http.MethodDelete, path: "/api/me", tag: "account", summary: "注销账号", role: models.RolePlayer,
+		responses: responses(reply(http.StatusOK, MessageResponse{}), failures(http.StatusInternalServerError)),
+	},
+	{
+		method: http.MethodGet, path: "/api/me/export", tag: "account", summary: "导出当前用户的全部数据", role: models.RolePlayer,
+		responses: responses(reply(http.StatusOK, auth.UserExport{}), failures(http.StatusInternalServerError)),
+	},
+
+	// 管理
+	{
+		method: http.MethodGet, path: "/api/admin/rooms", tag: "admin", summary: "所有房间的完整状态", role: models.RoleModerator,
+		responses: responses(reply(http.StatusOK, []map[string]interface{}{})),
+	},
+	{
+		method: http.MethodPost, path: "/api/admin/rooms/:id/close", tag: "admin", summary: "关闭房间", role: models.RoleModerator,
+		request: CloseRoomRequest{}, requestOptional: true,
+		responses: responses(reply(http.StatusOK, MessageResponse{}), failures(http.StatusBadRequest, http.StatusNotFound)),
+	},
+	{
+		method: http.MethodPost, path: "/api/admin/clients/:id/kick", tag: "admin", summary: "踢出玩家并断开连接", role: models.RoleModerator,
+		request: KickRequest{}, requestOptional: true,
+		responses: responses(reply(http.StatusOK, MessageResponse{}), failures(http.StatusBadRequest, http.StatusNotFound)),
+	},
+	{
+		method: http.MethodGet, path: "/api/admin/rooms/:id", tag: "admin", summary: "查看单个房间的对局（包含所有手牌）", role: models.RoleAdmin,
+		responses: responses(reply(http.StatusOK, map[string]interface{}{}), failures(http.StatusNotFound)),
+	},
+	{
+		method: http.MethodPost, path: "/api/admin/announcements", tag: "admin", summary: "向所有在线玩家发送公告", role: models.RoleAdmin,
+		request:   AnnouncementRequest{},
+		responses: responses(reply(http.StatusOK, MessageResponse{}), failures(http.StatusBadRequest)),
+	},
+	{
+		method: http.MethodPut, path: "/api/admin/users/:id/role", tag: "admin", summary: "修改用户角色", role: models.RoleAdmin,
+		request:   SetRoleRequest{},
+		responses: responses(reply(http.StatusOK, UserResponse{}), failures(http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError)),
+	},
+
+	// 游戏
+	{
+		method: http.MethodPost, path: "/api/game/rooms", tag: "game", summary: "创建房间并加入", role: models.RolePlayer,
+		responses: responses(reply(http.StatusCreated, CreateRoomResponse{}), gameFailures),
+	},
+	{
+		method: http.MethodPost, path: "/api/game/rooms/:id/join", tag: "game", summary: "加入房间（房间不存在时创建）", role: models.RolePlayer,
+		responses: responses(reply(http.StatusOK, JoinRoomResponse{}), gameFailures),
+	},
+	{
+		method: http.MethodPost, path: "/api/game/leave", tag: "game", summary: "离开当前房间", role: models.RolePlayer,
+		responses: responses(reply(http.StatusOK, MessageResponse{}), gameFailures),
+	},
+	{
+		method: http.MethodGet, path: "/api/game/state", tag: "game", summary: "房间状态和自己的游戏状态", role: models.RolePlayer,
+		responses: responses(reply(http.StatusOK, GameStateResponse{}), gameFailures),
+	},
+	{
+		method: http.MethodPost, path: "/api/game/ready", tag: "game", summary: "准备", role: models.RolePlayer,
+		request: GameActionRequest{}, requestOptional: true,
+		responses: responses(reply(http.StatusOK, ActionResponse{}), failures(http.StatusBadRequest), gameFailures),
+	},
+	{
+		method: http.MethodPost, path: "/api/game/play", tag: "game", summary: "出牌", role: models.RolePlayer,
+		request:   PlayCardsRequest{},
+		responses: responses(reply(http.StatusOK, ActionResponse{}), failures(http.StatusBadRequest), gameFailures),
+	},
+	{
+		method: http.MethodPost, path: "/api/game/pass", tag: "game", summary: "过牌", role: models.RolePlayer,
+		request: GameActionRequest{}, requestOptional: true,
+		responses: responses(reply(http.StatusOK, ActionResponse{}), failures(http.StatusBadRequest), gameFailures),
+	},
+	{
+		method: http.MethodGet, path: "/api/game/events", tag: "game", summary: "长轮询：返回 after 之后的事件，没有新事件时等待", role: models.RolePlayer,
+		query: []apiParam{
+			{name: "after", typ: "integer", description: "最后收到的事件ID"},
+			{name: "timeout", typ: "integer", description: "最多等待的秒数，不超过 rest.max_poll_wait"},
+		},
+		responses: responses(reply(http.StatusOK, websocket.EventBatch{}), failures(http.StatusBadRequest, http.StatusGone)),
+	},
+	{
+		method: http.MethodGet, path: "/api/game/events/stream", tag: "game", summary: "以 Server-Sent Events 推送事件", role: models.RolePlayer,
+		query:     []apiParam{{name: "after", typ: "integer", description: "最后收到的事件ID"}},
+		headers:   []apiParam{{name: "Last-Event-ID", typ: "string", description: "重新连接时最后收到的事件ID，优先于 after"}},
+		responses: responses(apiResponse{status: http.StatusOK, contentType: "text/event-stream"}, failures(http.StatusBadRequest)),
+	},
+
+	// 比赛
+	{
+		method: http.MethodGet, path: "/api/tournaments", tag: "tournament", summary: "比赛列表",
+		responses: responses(reply(http.StatusOK, []protocol.Tournament{})),
+	},
+	{
+		method: http.MethodGet, path: "/api/tournaments/:id", tag: "tournament", summary: "比赛的状态和实时积分榜",
+		responses: responses(reply(http.StatusOK, protocol.Tournament{}), failures(http.StatusNotFound)),
+	},
+	{
+		method: http.MethodPost, path: "/api/tournaments/:id/register", tag: "tournament", summary: "报名比赛", role: models.RolePlayer,
+		responses: responses(reply(http.StatusOK, protocol.Tournament{}), failures(http.StatusNotFound, http.StatusConflict)),
+	},
+	{
+		method: http.MethodPost, path: "/api/tournaments/:id/withdraw", tag: "tournament", summary: "退出尚未开始的比赛", role: models.RolePlayer,
+		responses: responses(reply(http.StatusOK, protocol.Tournament{}), failures(http.StatusNotFound, http.StatusConflict)),
+	},
+	{
+		method: http.MethodPost, path: "/api/tournaments", tag: "tournament", summary: "创建比赛", role: models.RoleModerator,
+		request:   CreateTournamentRequest{},
+		responses: responses(reply(http.StatusCreated, protocol.Tournament{}), failures(http.StatusBadRequest)),
+	},
+	{
+		method: http.MethodPost, path: "/api/tournaments/:id/start", tag: "tournament", summary: "开始比赛，参赛玩家会收到 tournament_seat 消息", role: models.RoleModerator,
+		responses: responses(reply(http.StatusOK, protocol.Tournament{}), failures(http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError)),
+	},
+
+	// 服务器
+	{
+		method: http.MethodGet, path: "/ws", tag: "server", summary: "建立 WebSocket 连接，消息格式见 protocol/schema.json",
+		query: []apiParam{
+			{name: "player_id", typ: "string"},
+			{name: "player_name", typ: "string"},
+			{name: "token", typ: "string", description: "携带时校验身份并使用用户角色"},
+		},
+		responses: responses(apiResponse{status: http.StatusSwitchingProtocols}, failures(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError)),
+	},
+	{
+		method: http.MethodGet, path: "/api/health", tag: "server", summary: "健康检查",
+		responses: responses(reply(http.StatusOK, HealthResponse{})),
+	},
+	{
+		method: http.MethodGet, path: "/metrics", tag: "server", summary: "Prometheus 指标（metrics.token 或管理员 token）",
+		responses: responses(apiResponse{status: http.StatusOK, contentType: "text/plain"}, failures(http.StatusUnauthorized, http.StatusForbidden)),
+	},
+	{
+		method: http.MethodGet, path: "/api/rooms", tag: "server", summary: "房间列表",
+		responses: responses(reply(http.StatusOK, []redis.RoomInfo{})),
+	},
+	{
+		method: http.MethodGet, path: "/api/openapi.json", tag: "server", summary: "本文档",
+		responses: responses(reply(http.StatusOK, map[string]interface{}{})),
+	},
+}
+
+// OpenAPI 生成 REST 接口的 OpenAPI 3.1 文档
+//
+// 请求体和响应体的 schema 由 Go 类型通过反射生成（见 protocol.SchemaGenerator）。
+func OpenAPI() map[string]interface{} {
+	g := protocol.NewSchemaGenerator("#/components/schemas/")
+	paths := make(map[string]interface{})
+	for _, op := range apiOperations {
+		path := openAPIPath(op.path)
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(op.method)] = op.document(g)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   "Hong3 REST API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.Defs(),
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// document 生成接口的 Operation Object
+func (op *apiOperation) document(g *protocol.SchemaGenerator) map[string]interface{} {
+	doc := map[string]interface{}{
+		"tags":    []string{op.tag},
+		"summary": op.summary,
+	}
+
+	params := make([]interface{}, 0)
+	for _, segment := range strings.Split(op.path, "/") {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	for _, p := range op.query {
+		params = append(params, p.document("query"))
+	}
+	for _, p := range op.headers {
+		params = append(params, p.document("header"))
+	}
+	if len(params) > 0 {
+		doc["parameters"] = params
+	}
+
+	if op.request != nil {
+		doc["requestBody"] = map[string]interface{}{
+			"required": !op.requestOptional,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": g.TypeSchema(reflect.TypeOf(op.request))},
+			},
+		}
+	}
+
+	all := op.responses
+	if op.role != "" {
+		doc["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+		if op.role != models.RolePlayer {
+			doc["description"] = "需要 " + op.role + " 或更高角色"
+			all = append(failures(http.StatusForbidden), all...)
+		}
+		all = append(failures(http.StatusUnauthorized), all...)
+	}
+	responses := make(map[string]interface{})
+	for _, r := range all {
+		response := map[string]interface{}{"description": http.StatusText(r.status)}
+		switch {
+		case r.body != nil:
+			response["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": g.TypeSchema(reflect.TypeOf(r.body))},
+			}
+		case r.contentType != "":
+			response["content"] = map[string]interface{}{
+				r.contentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+			}
+		}
+		responses[strconv.Itoa(r.status)] = response
+	}
+	doc["responses"] = responses
+	return doc
+}
+
+// document 生成 Parameter Object
+func (p apiParam) document(in string) map[string]interface{} {
+	doc := map[string]interface{}{
+		"name":   p.name,
+		"in":     in,
+		"schema": map[string]interface{}{"type": p.typ},
+	}
+	if p.description != "" {
+		doc["description"] = p.description
+	}
+	return doc
+}
+
+// openAPIPath 把 gin 的路由参数 :id 转换为 OpenAPI 的 {id}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// openAPIDocument 编码后的文档，只生成一次
+var openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+	return json.Marshal(OpenAPI())
+})
+
+// handleOpenAPI 返回 OpenAPI 文档
+func (s *Server) handleOpenAPI(c *gin.Context) {
+	data, err := openAPIDocument()
+	if err != nil {
+		requestLog(c).Error("failed to encode openapi document", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成文档失败"})
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
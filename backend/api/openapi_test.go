@@ -0,0 +1,379 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/chenhailong/hong3/auth"
+	"github.com/chenhailong/hong3/config"
+	"github.com/chenhailong/hong3/protocol"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestServer 使用内存存储的服务器
+func newTestServer(t *testing.T) (*Server, *auth.UserStore) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	snapshots := auth.NewMemoryGameSnapshotRepository()
+	store := auth.NewUserStore(auth.Repositories{
+		Users:      auth.NewMemoryUserRepository(),
+		Tokens:     auth.NewMemoryTokenRepository(),
+		Attempts:   auth.NewMemoryAttemptRepository(),
+		OIDCStates: auth.NewMemoryOIDCStateRepository(),
+		Snapshots:  snapshots,
+	}, cfg.Auth.TokenTTL, logger)
+	return NewServer(cfg, store, snapshots, logger), store
+}
+
+// openAPIDoc 经过 JSON 编解码的文档，便于按 JSON 值校验
+func openAPIDoc(t *testing.T) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(OpenAPI())
+	if err != nil {
+		t.Fatalf("marshal openapi: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("unmarshal openapi: %v", err)
+	}
+	return doc
+}
+
+// TestOpenAPIRoutes 文档中的接口与注册的路由一一对应
+func TestOpenAPIRoutes(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	routes := make(map[string]bool)
+	for _, r := range server.router.Routes() {
+		routes[r.Method+" "+r.Path] = true
+	}
+	documented := make(map[string]bool)
+	for _, op := range apiOperations {
+		key := op.method + " " + op.path
+		if documented[key] {
+			t.Errorf("%s is documented twice", key)
+		}
+		documented[key] = true
+		if !routes[key] {
+			t.Errorf("%s is documented but not registered", key)
+		}
+	}
+	for key := range routes {
+		if !documented[key] {
+			t.Errorf("%s is registered but missing from apiOperations", key)
+		}
+	}
+}
+
+// TestOpenAPIRequests 请求体的必填字段与 binding:"required" 一致
+func TestOpenAPIRequests(t *testing.T) {
+	for _, op := range apiOperations {
+		if op.request == nil {
+			continue
+		}
+		typ := reflect.TypeOf(op.request)
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			documentedRequired := !strings.Contains(opts, "omitempty")
+			bindingRequired := strings.Contains(f.Tag.Get("binding"), "required")
+			if documentedRequired != bindingRequired {
+				t.Errorf("%s %s: field %q is required=%v in the spec but binding required=%v",
+					op.method, op.path, name, documentedRequired, bindingRequired)
+			}
+		}
+	}
+}
+
+// TestOpenAPIResponses 调用各个接口，响应的状态码和响应体必须符合文档
+func TestOpenAPIResponses(t *testing.T) {
+	server, store := newTestServer(t)
+	c := &specClient{t: t, server: server, doc: openAPIDoc(t), exercised: make(map[string]bool)}
+
+	// 服务器
+	c.call("GET", "/api/health", "/api/health", "", nil, 200)
+	c.call("GET", "/api/openapi.json", "/api/openapi.json", "", nil, 200)
+	c.call("GET", "/api/rooms", "/api/rooms", "", nil, 200)
+	c.call("GET", "/ws", "/ws", "", nil, 400)
+	c.call("GET", "/metrics", "/metrics", "", nil, 401)
+
+	// 账号
+	c.call("POST", "/api/register", "/api/register", "", map[string]string{"username": "alice", "password": "password123", "name": "Alice"}, 200)
+	c.call("POST", "/api/register", "/api/register", "", map[string]string{"username": "alice", "password": "password123", "name": "Alice"}, 409)
+	c.call("POST", "/api/register", "/api/register", "", map[string]string{"username": "bob"}, 400)
+	var login LoginResponse
+	c.decode(c.call("POST", "/api/login", "/api/login", "", map[string]string{"username": "alice", "password": "password123"}, 200), &login)
+	c.call("POST", "/api/login", "/api/login", "", map[string]string{"username": "alice", "password": "wrong"}, 401)
+	token := login.Token
+	c.call("GET", "/api/oidc/login", "/api/oidc/login", "", nil, 404)
+	c.call("GET", "/api/oidc/callback", "/api/oidc/callback", "", nil, 404)
+	c.call("GET", "/api/me", "/api/me", "", nil, 401)
+	c.call("GET", "/api/me", "/api/me", token, nil, 200)
+	c.call("PUT", "/api/me", "/api/me", token, map[string]string{"name": "Alice L."}, 200)
+	c.call("PUT", "/api/me/password", "/api/me/password", token, map[string]string{"old_password": "password123", "new_password": "password456"}, 200)
+	c.call("GET", "/api/me/export", "/api/me/export", token, nil, 200)
+
+	// 游戏
+	var created CreateRoomResponse
+	c.decode(c.call("POST", "/api/game/rooms", "/api/game/rooms", token, nil, 201), &created)
+	c.call("GET", "/api/game/state", "/api/game/state", token, nil, 200)
+	c.call("GET", "/api/rooms", "/api/rooms", "", nil, 200)
+	c.call("POST", "/api/game/pass", "/api/game/pass", token, nil, 409)
+	c.call("POST", "/api/game/play", "/api/game/play", token, map[string]interface{}{"card_indices": []int{99}}, 400)
+	c.call("POST", "/api/game/ready", "/api/game/ready", token, map[string]string{"action_id": "ready-1"}, 200)
+	c.call("GET", "/api/game/events", "/api/game/events?after=0&timeout=0", token, nil, 200)
+	c.call("GET", "/api/game/events", "/api/game/events?after=x", token, nil, 400)
+	c.call("GET", "/api/game/events/stream", "/api/game/events/stream?after=x", token, nil, 400)
+	c.call("POST", "/api/game/leave", "/api/game/leave", token, nil, 200)
+	c.call("POST", "/api/game/rooms/:id/join", "/api/game/rooms/"+created.RoomID+"/join", token, nil, 200)
+
+	// 管理
+	c.call("GET", "/api/admin/rooms", "/api/admin/rooms", token, nil, 403)
+	if err := store.SeedAdmin("root", "password123"); err != nil {
+		t.Fatalf("seed admin: %v", err)
+	}
+	var admin LoginResponse
+	c.decode(c.call("POST", "/api/login", "/api/login", "", map[string]string{"username": "root", "password": "password123"}, 200), &admin)
+	c.call("GET", "/api/admin/rooms", "/api/admin/rooms", admin.Token, nil, 200)
+	c.call("GET", "/api/admin/rooms/:id", "/api/admin/rooms/"+created.RoomID, admin.Token, nil, 200)
+	c.call("GET", "/api/admin/rooms/:id", "/api/admin/rooms/missing", admin.Token, nil, 404)
+	c.call("POST", "/api/admin/announcements", "/api/admin/announcements", admin.Token, map[string]string{"message": "hello"}, 200)
+	c.call("PUT", "/api/admin/users/:id/role", "/api/admin/users/"+login.User.ID+"/role", admin.Token, map[string]string{"role": "moderator"}, 200)
+	c.call("POST", "/api/admin/clients/:id/kick", "/api/admin/clients/missing/kick", admin.Token, nil, 404)
+	c.call("POST", "/api/admin/rooms/:id/close", "/api/admin/rooms/"+created.RoomID+"/close", admin.Token, map[string]string{"reason": "test"}, 200)
+
+	// 比赛
+	c.call("POST", "/api/tournaments", "/api/tournaments", admin.Token, map[string]interface{}{"name": "cup", "hands_per_round": 99}, 400)
+	var tournament protocol.Tournament
+	c.decode(c.call("POST", "/api/tournaments", "/api/tournaments", admin.Token, map[string]interface{}{"name": "cup", "format": "advance"}, 201), &tournament)
+	c.call("POST", "/api/tournaments/:id/register", "/api/tournaments/"+tournament.ID+"/register", token, nil, 200)
+	c.call("POST", "/api/tournaments/:id/register", "/api/tournaments/missing/register", token, nil, 404)
+	c.call("POST", "/api/tournaments/:id/start", "/api/tournaments/"+tournament.ID+"/start", admin.Token, nil, 409)
+	c.call("POST", "/api/tournaments/:id/withdraw", "/api/tournaments/"+tournament.ID+"/withdraw", token, nil, 200)
+	c.call("POST", "/api/tournaments/:id/withdraw", "/api/tournaments/"+tournament.ID+"/withdraw", token, nil, 409)
+	for _, name := range []string{"p1", "p2", "p3", "p4"} {
+		c.call("POST", "/api/register", "/api/register", "", map[string]string{"username": name, "password": "password123", "name": name}, 200)
+		var player LoginResponse
+		c.decode(c.call("POST", "/api/login", "/api/login", "", map[string]string{"username": name, "password": "password123"}, 200), &player)
+		c.call("POST", "/api/tournaments/:id/register", "/api/tournaments/"+tournament.ID+"/register", player.Token, nil, 200)
+	}
+	c.call("POST", "/api/tournaments/:id/start", "/api/tournaments/"+tournament.ID+"/start", admin.Token, nil, 200)
+	c.call("POST", "/api/tournaments/:id/start", "/api/tournaments/missing/start", admin.Token, nil, 404)
+	c.call("GET", "/api/tournaments", "/api/tournaments", "", nil, 200)
+	c.call("GET", "/api/tournaments/:id", "/api/tournaments/"+tournament.ID, "", nil, 200)
+	c.call("GET", "/api/tournaments/:id", "/api/tournaments/missing", "", nil, 404)
+
+	c.call("DELETE", "/api/me", "/api/me", token, nil, 200)
+
+	// 新增的接口需要在这里调用一次，SSE 的事件流不会结束，只调用了出错的情况
+	for _, op := range apiOperations {
+		if key := op.method + " " + op.path; !c.exercised[key] {
+			t.Errorf("%s is not exercised by TestOpenAPIResponses", key)
+		}
+	}
+}
+
+// specClient 调用接口并按文档校验响应
+type specClient struct {
+	t         *testing.T
+	server    *Server
+	doc       map[string]interface{}
+	exercised map[string]bool
+}
+
+// call 发送请求，检查状态码为 want，并且状态码和响应体符合 route 对应的文档
+func (c *specClient) call(method, route, target, token string, body interface{}, want int) []byte {
+	c.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatalf("marshal request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	c.server.router.ServeHTTP(rec, req)
+
+	key := method + " " + route
+	c.exercised[key] = true
+	if rec.Code != want {
+		c.t.Fatalf("%s %s: status %d, want %d: %s", method, target, rec.Code, want, rec.Body.String())
+	}
+
+	operation, _ := lookup(c.doc, "paths", openAPIPath(route), strings.ToLower(method)).(map[string]interface{})
+	if operation == nil {
+		c.t.Fatalf("%s is not documented", key)
+	}
+	response, _ := lookup(operation, "responses", fmt.Sprint(rec.Code)).(map[string]interface{})
+	if response == nil {
+		c.t.Fatalf("%s: status %d is not documented", key, rec.Code)
+	}
+	schema := lookup(response, "content", "application/json", "schema")
+	if schema == nil {
+		return rec.Body.Bytes()
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &value); err != nil {
+		c.t.Fatalf("%s: response is not JSON: %v", key, err)
+	}
+	if errs := validate(c.doc, schema.(map[string]interface{}), value, "$"); len(errs) > 0 {
+		c.t.Errorf("%s: status %d response does not match the spec:\n  %s\n  body: %s",
+			key, rec.Code, strings.Join(errs, "\n  "), rec.Body.String())
+	}
+	return rec.Body.Bytes()
+}
+
+// decode 解码响应体
+func (c *specClient) decode(data []byte, v interface{}) {
+	c.t.Helper()
+	if err := json.Unmarshal(data, v); err != nil {
+		c.t.Fatalf("decode response: %v", err)
+	}
+}
+
+// lookup 按 key 依次取出嵌套的值，不存在时返回 nil
+func lookup(v interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// validate 按 schema 校验 JSON 值，只支持 protocol.SchemaGenerator 生成的关键字
+func validate(doc map[string]interface{}, schema map[string]interface{}, value interface{}, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		keys := strings.Split(strings.TrimPrefix(ref, "#/"), "/")
+		target, _ := lookup(doc, keys...).(map[string]interface{})
+		if target == nil {
+			return []string{path + ": unresolved " + ref}
+		}
+		return validate(doc, target, value, path)
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		var errs []string
+		for _, option := range anyOf {
+			optionErrs := validate(doc, option.(map[string]interface{}), value, path)
+			if len(optionErrs) == 0 {
+				return nil
+			}
+			errs = append(errs, optionErrs...)
+		}
+		return errs
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, v := range enum {
+			found = found || v == value
+		}
+		if !found {
+			return []string{fmt.Sprintf("%s: %v is not one of %v", path, value, enum)}
+		}
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !types[jsonType(value)] {
+		if !(jsonType(value) == "integer" && types["number"]) {
+			return []string{fmt.Sprintf("%s: got %s, want %v", path, jsonType(value), schema["type"])}
+		}
+	}
+
+	var errs []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					errs = append(errs, fmt.Sprintf("%s: missing required field %q", path, name))
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if property, ok := properties[key].(map[string]interface{}); ok {
+				errs = append(errs, validate(doc, property, v[key], path+"."+key)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					errs = append(errs, fmt.Sprintf("%s: unexpected field %q", path, key))
+				}
+			case map[string]interface{}:
+				errs = append(errs, validate(doc, extra, v[key], path+"."+key)...)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				errs = append(errs, validate(doc, items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return errs
+}
+
+// schemaTypes schema 中 type 关键字的取值
+func schemaTypes(v interface{}) map[string]bool {
+	types := make(map[string]bool)
+	switch t := v.(type) {
+	case string:
+		types[t] = true
+	case []interface{}:
+		for _, name := range t {
+			types[name.(string)] = true
+		}
+	}
+	return types
+}
+
+// jsonType JSON 值的类型名
+func jsonType(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if n == float64(int64(n)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
@@ -1,10 +1,21 @@
 package api
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/chenhailong/hong3/auth"
+	"github.com/chenhailong/hong3/config"
+	"github.com/chenhailong/hong3/logging"
+	"github.com/chenhailong/hong3/metrics"
+	"github.com/chenhailong/hong3/models"
 	"github.com/chenhailong/hong3/websocket"
 	"github.com/gin-gonic/gin"
 	gorilla "github.com/gorilla/websocket"
@@ -12,64 +23,178 @@ import (
 
 // Server 表示API服务器
 type Server struct {
-	router *gin.Engine
-	hub    *websocket.Hub
+	router     *gin.Engine
+	hub        *websocket.Hub
+	store      *auth.UserStore
+	snapshots  auth.GameSnapshotRepository
+	config     *config.Config
+	logger     *slog.Logger
+	httpServer *http.Server
+	origins    *originPolicy
+	upgrader   gorilla.Upgrader
+
+	// HTTP 服务器开始关闭时取消，用于结束长轮询和事件流
+	streams context.Context
+
+	// 把 HTTP 请求跳转到 HTTPS 的服务器（未配置时为 nil）
+	redirectServer *http.Server
 }
 
-var upgrader = gorilla.Upgrader{
-	ReadBufferSize:  4096,
-	WriteBufferSize: 4096,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许所有跨域请求
-	},
-	EnableCompression: true,
-}
-
-// NewServer 创建一个新的API服务器
-func NewServer() *Server {
-	router := gin.Default()
-	hub := websocket.NewHub()
+// NewServer 创建一个新的API服务器，store 用于注册、登录和校验 token，
+// snapshots 保存停机时未结束的游戏
+func NewServer(cfg *config.Config, store *auth.UserStore, snapshots auth.GameSnapshotRepository, logger *slog.Logger) *Server {
+	logger = logging.OrDefault(logger)
+	router := gin.New()
+	router.Use(gin.Recovery())
+	// 只有来自可信代理的请求才按 X-Forwarded-For / X-Real-IP 确定客户端 IP，
+	// 否则任何客户端都可以伪造 IP，绕过按 IP 的登录限制并伪造审计日志中的地址
+	router.RemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.Error("invalid trusted proxies, ignoring forwarded headers", "error", err)
+		router.SetTrustedProxies(nil)
+	}
+	hub := websocket.NewHub(cfg, logger)
 	go hub.Run()
 
+	origins := newOriginPolicy(cfg.CORS, cfg.Server.TrustedProxies)
+	streams, closeStreams := context.WithCancel(context.Background())
 	server := &Server{
-		router: router,
-		hub:    hub,
+		router:     router,
+		hub:        hub,
+		store:      store,
+		snapshots:  snapshots,
+		config:     cfg,
+		logger:     logger,
+		httpServer: &http.Server{Handler: router},
+		origins:    origins,
+		upgrader: gorilla.Upgrader{
+			ReadBufferSize:  4096,
+			WriteBufferSize: 4096,
+			// WebSocket 握手与 REST 接口使用同一份来源白名单
+			CheckOrigin:       origins.allowed,
+			EnableCompression: true,
+		},
+		streams: streams,
+	}
+	server.httpServer.RegisterOnShutdown(closeStreams)
+
+	if cfg.TLS.Enabled() && cfg.TLS.RedirectAddr != "" {
+		server.redirectServer = newRedirectServer(cfg.TLS.RedirectAddr, cfg.Server.Port)
 	}
 
 	server.setupRoutes()
 	return server
 }
 
+// RegisterMetrics 把 Hub 的指标注册到 metrics.Registry，进程启动时调用一次
+func (s *Server) RegisterMetrics() error {
+	return metrics.Registry.Register(s.hub.Collector())
+}
+
 // setupRoutes 设置路由
 func (s *Server) setupRoutes() {
-	// 允许跨域
-	s.router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	s.router.Use(s.requestLogger)
 
-		c.Next()
-	})
+	// 跨域访问（来源白名单见 config.CORSConfig）
+	s.router.Use(s.cors)
 
 	// API路由
 	s.router.POST("/api/register", s.handleRegister)
 	s.router.POST("/api/login", s.handleLogin)
-	s.router.GET("/api/me", s.handleGetMe)
+	s.router.GET("/api/oidc/login", s.handleOIDCLogin)
+	s.router.GET("/api/oidc/callback", s.handleOIDCCallback)
+	me := s.router.Group("/api/me", s.requireAuth)
+	me.GET("", s.handleGetMe)
+	me.PUT("", s.handleUpdateProfile)
+	me.PUT("/password", s.handleChangePassword)
+	me.DELETE("", s.handleDeleteAccount)
+	me.GET("/export", s.handleExportData)
+
+	// 版主可以查看房间、踢人和关闭房间；查看手牌、公告和角色管理仅限管理员
+	moderator := s.router.Group("/api/admin", s.requireAuth, s.requireRole(models.RoleModerator))
+	moderator.GET("/rooms", s.handleAdminRooms)
+	moderator.POST("/rooms/:id/close", s.handleAdminCloseRoom)
+	moderator.POST("/clients/:id/kick", s.handleAdminKick)
+
+	admin := s.router.Group("/api/admin", s.requireAuth, s.requireRole(models.RoleAdmin))
+	admin.GET("/rooms/:id", s.handleAdminRoom)
+	admin.POST("/announcements", s.handleAdminAnnounce)
+	admin.PUT("/users/:id/role", s.handleAdminSetRole)
+
+	// 通过 REST 接口玩游戏，与 WebSocket 客户端使用同一个 Hub
+	game := s.router.Group("/api/game", s.requireAuth)
+	game.POST("/rooms", s.handleGameCreateRoom)
+	game.POST("/rooms/:id/join", s.handleGameJoinRoom)
+	game.POST("/leave", s.handleGameLeave)
+	game.GET("/state", s.handleGameState)
+	game.POST("/ready", s.handleGameReady)
+	game.POST("/play", s.handleGamePlay)
+	game.POST("/pass", s.handleGamePass)
+	game.GET("/events", s.handleGameEvents)
+	game.GET("/events/stream", s.handleGameEventStream)
+
+	// 比赛：任何人可以查看积分榜，登录用户报名，版主创建和开始比赛
+	s.router.GET("/api/tournaments", s.handleGetTournaments)
+	s.router.GET("/api/tournaments/:id", s.handleGetTournament)
+	tournaments := s.router.Group("/api/tournaments", s.requireAuth)
+	tournaments.POST("/:id/register", s.handleRegisterTournament)
+	tournaments.POST("/:id/withdraw", s.handleWithdrawTournament)
+	organizer := s.router.Group("/api/tournaments", s.requireAuth, s.requireRole(models.RoleModerator))
+	organizer.POST("", s.handleCreateTournament)
+	organizer.POST("/:id/start", s.handleStartTournament)
+
 	s.router.GET("/ws", s.handleWebSocket)
 	s.router.GET("/api/health", s.handleHealth)
+	s.router.GET("/metrics", s.requireMetricsAccess, s.handleMetrics)
 	s.router.GET("/api/rooms", s.handleGetRooms)
+	s.router.GET("/api/openapi.json", s.handleOpenAPI)
+}
+
+// StartCluster 启用多实例模式（需要 Redis），需在 Run 之前调用
+func (s *Server) StartCluster(ctx context.Context, instanceID string, leaseTTL time.Duration) error {
+	return s.hub.StartCluster(ctx, instanceID, leaseTTL)
 }
 
-// Run 启动服务器
+// Run 启动服务器，调用 Shutdown 后返回 nil
+//
+// 配置了证书时以 HTTPS 提供服务（WebSocket 使用 wss），证书文件更新后自动重新加载。
 func (s *Server) Run(addr string) error {
-	log.Printf("Starting server on %s", addr)
-	return s.router.Run(addr)
+	s.httpServer.Addr = addr
+	if !s.config.TLS.Enabled() {
+		s.logger.Info("starting server", "addr", addr)
+		if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	}
+
+	reloader, err := newCertReloader(s.config.TLS, s.logger)
+	if err != nil {
+		return err
+	}
+	s.httpServer.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if s.redirectServer != nil {
+		ln, err := net.Listen("tcp", s.redirectServer.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for http redirect: %w", err)
+		}
+		s.logger.Info("redirecting http to https", "addr", s.redirectServer.Addr)
+		go func() {
+			if err := s.redirectServer.Serve(ln); err != http.ErrServerClosed {
+				s.logger.Error("http redirect server stopped", "error", err)
+			}
+		}()
+	}
+
+	s.logger.Info("starting server", "addr", addr, "tls", true)
+	if err := s.httpServer.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
 // handleWebSocket 处理WebSocket连接
@@ -78,35 +203,48 @@ func (s *Server) handleWebSocket(c *gin.Context) {
 	playerName := c.Query("player_name")
 
 	if playerID == "" || playerName == "" {
-		log.Printf("WebSocket连接失败: 缺少玩家信息 (ID: %s, Name: %s)", playerID, playerName)
+		requestLog(c).Warn("websocket rejected: missing player info", logging.KeyPlayerID, playerID)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少玩家ID或名称"})
 		return
 	}
 
-	// 记录连接请求
-	log.Printf("收到WebSocket连接请求 (ID: %s, Name: %s)", playerID, playerName)
+	logger := requestLog(c).With(logging.KeyPlayerID, playerID)
+
+	// 携带 token 时校验身份，以便在 Hub 中使用用户角色；未携带 token 的连接不能加入比赛桌
+	role := models.RolePlayer
+	token := c.Query("token")
+	if token != "" {
+		user, err := s.store.ValidateToken(token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
+			return
+		}
+		if user.ID != playerID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "token与玩家ID不匹配"})
+			return
+		}
+		role = user.Role
+	}
 
 	// 升级HTTP连接为WebSocket
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Printf("WebSocket连接升级失败: %v", err)
+		logger.Warn("websocket upgrade failed", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "无法升级到WebSocket连接"})
 		return
 	}
 
 	// 创建新的客户端
-	client := websocket.NewClient(s.hub, conn, playerID, playerName)
-	log.Printf("创建新客户端 (ID: %s, Name: %s)", playerID, playerName)
+	client := websocket.NewClient(s.hub, conn, playerID, playerName, role, token != "", requestLog(c))
 
 	// 注册客户端
 	s.hub.Register <- client
-	log.Printf("注册客户端到Hub (ID: %s, Name: %s)", playerID, playerName)
 
 	// 启动客户端的读写循环
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				log.Printf("客户端读取循环panic: %v (ID: %s)", r, playerID)
+				logger.Error("client read loop panic", "panic", r)
 			}
 		}()
 		client.ReadPump()
@@ -115,13 +253,13 @@ func (s *Server) handleWebSocket(c *gin.Context) {
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				log.Printf("客户端写入循环panic: %v (ID: %s)", r, playerID)
+				logger.Error("client write loop panic", "panic", r)
 			}
 		}()
 		client.WritePump()
 	}()
 
-	log.Printf("WebSocket连接建立成功 (ID: %s, Name: %s)", playerID, playerName)
+	logger.Info("websocket connected", "role", role, "verified", token != "")
 }
 
 // handleHealth 处理健康检查
@@ -156,9 +294,18 @@ func (s *Server) handleRegister(c *gin.Context) {
 		return
 	}
 
-	store := auth.GetStore()
-	user, err := store.Register(req.Username, req.Password, req.Name)
+	ip := c.ClientIP()
+	throttle := s.store.Throttle()
+	if wait := throttle.CheckRegister(c.Request.Context(), ip); wait > 0 {
+		auth.Audit(c.Request.Context(), auth.AuditRegisterThrottled, "ip", ip, "username", req.Username)
+		tooManyAttempts(c, wait)
+		return
+	}
+	throttle.RegisterAttempted(c.Request.Context(), ip)
+
+	user, err := s.store.Register(req.Username, req.Password, req.Name)
 	if err != nil {
+		auth.Audit(c.Request.Context(), auth.AuditRegisterFailed, "ip", ip, "username", req.Username, "reason", err.Error())
 		if err == auth.ErrUserExists {
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		} else {
@@ -166,6 +313,7 @@ func (s *Server) handleRegister(c *gin.Context) {
 		}
 		return
 	}
+	auth.Audit(c.Request.Context(), auth.AuditRegisterSuccess, "ip", ip, "user_id", user.ID, "username", user.Username)
 
 	c.JSON(http.StatusOK, gin.H{
 		"user": gin.H{
@@ -185,16 +333,30 @@ func (s *Server) handleLogin(c *gin.Context) {
 		return
 	}
 
-	store := auth.GetStore()
-	user, token, err := store.Login(req.Username, req.Password)
+	ip := c.ClientIP()
+	throttle := s.store.Throttle()
+	if wait := throttle.CheckLogin(c.Request.Context(), ip, req.Username); wait > 0 {
+		auth.Audit(c.Request.Context(), auth.AuditLoginThrottled, "ip", ip, "username", req.Username)
+		tooManyAttempts(c, wait)
+		return
+	}
+
+	user, token, err := s.store.Login(req.Username, req.Password)
 	if err != nil {
 		if err == auth.ErrInvalidCredentials {
+			auth.Audit(c.Request.Context(), auth.AuditLoginFailed, "ip", ip, "username", req.Username)
+			if wait := throttle.LoginFailed(c.Request.Context(), ip, req.Username); wait > 0 {
+				tooManyAttempts(c, wait)
+				return
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
 		}
 		return
 	}
+	throttle.LoginSucceeded(c.Request.Context(), ip, req.Username)
+	auth.Audit(c.Request.Context(), auth.AuditLoginSuccess, "ip", ip, "user_id", user.ID, "username", user.Username)
 
 	c.JSON(http.StatusOK, gin.H{
 		"token": token,
@@ -209,34 +371,39 @@ func (s *Server) handleLogin(c *gin.Context) {
 
 // handleGetMe 获取当前用户信息
 func (s *Server) handleGetMe(c *gin.Context) {
+	user := currentUser(c)
+	c.JSON(http.StatusOK, gin.H{
+		"user": gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"name":     user.Name,
+			"role":     user.Role,
+		},
+	})
+}
+
+// tooManyAttempts 返回 429，并告知调用方多久之后可以重试
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       fmt.Sprintf("尝试次数过多，请在%d秒后重试", seconds),
+		"retry_after": seconds,
+	})
+}
+
+// extractToken 从 Authorization 头或 query 参数中获取 token
+func extractToken(c *gin.Context) string {
 	token := c.GetHeader("Authorization")
 	if token == "" {
 		// 尝试从query参数获取
 		token = c.Query("token")
 	}
 
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供token"})
-		return
-	}
-
 	// 移除 "Bearer " 前缀（如果有）
 	if len(token) > 7 && token[:7] == "Bearer " {
 		token = token[7:]
 	}
 
-	store := auth.GetStore()
-	user, err := store.ValidateToken(token)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"name":     user.Name,
-		},
-	})
-}
\ No newline at end of file
+	return token
+}
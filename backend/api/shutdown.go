@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// httpShutdownTimeout 等待进行中的 HTTP 请求完成的最长时间
+	httpShutdownTimeout = 10 * time.Second
+
+	// disconnectTimeout 等待 WebSocket 客户端断开的最长时间
+	disconnectTimeout = 5 * time.Second
+)
+
+// Shutdown 优雅关闭服务器
+//
+// 停止接受新的房间和游戏并通知在线客户端，等待进行中的游戏结束（最多 gracePeriod）。
+// 宽限期内服务器照常提供服务，断线的玩家可以重新连接、REST 玩家可以继续出牌。
+// 宽限期结束后关闭 HTTP 服务器，保存比赛和仍未结束的游戏快照（下次启动时由 RestoreGames 恢复），
+// 最后断开所有 WebSocket 连接。
+func (s *Server) Shutdown(ctx context.Context, gracePeriod time.Duration) error {
+	deadline := time.Now().Add(gracePeriod)
+	s.hub.StartDrain(deadline)
+
+	s.waitForGames(ctx, deadline)
+
+	// 已升级的 WebSocket 连接不受 http.Server.Shutdown 影响，之后统一断开
+	httpCtx, cancel := context.WithTimeout(ctx, httpShutdownTimeout)
+	err := s.httpServer.Shutdown(httpCtx)
+	if s.redirectServer != nil {
+		s.redirectServer.Shutdown(httpCtx)
+	}
+	cancel()
+	if err != nil {
+		s.logger.Warn("http server shutdown", "error", err)
+	}
+
+	tournaments := s.hub.SnapshotTournaments("shutdown")
+	if len(tournaments) > 0 {
+		if saveErr := s.snapshots.SaveTournamentSnapshots(tournaments); saveErr != nil {
+			s.logger.Error("failed to save tournaments, tournaments lost", "tournaments", len(tournaments), "error", saveErr)
+		} else {
+			s.logger.Info("saved tournaments", "tournaments", len(tournaments))
+		}
+	}
+
+	snapshots := s.hub.SnapshotGames("shutdown")
+	if len(snapshots) > 0 {
+		if saveErr := s.snapshots.SaveSnapshots(snapshots); saveErr != nil {
+			s.logger.Error("failed to save game snapshots, unfinished games lost", "games", len(snapshots), "error", saveErr)
+		} else {
+			s.logger.Info("saved unfinished games", "games", len(snapshots))
+		}
+	}
+
+	// 多实例模式下把房间交给其他实例接管
+	s.hub.LeaveCluster()
+
+	disconnectCtx, cancel := context.WithTimeout(ctx, disconnectTimeout)
+	s.hub.CloseAll(disconnectCtx, "服务器维护")
+	cancel()
+
+	return err
+}
+
+// RestoreGames 恢复上次停机时保存的比赛和未结束游戏，启动时（多实例模式下在加入集群后）调用
+//
+// 先恢复比赛，比赛桌上的游戏才能随之恢复。恢复的房间等待玩家重新加入后继续游戏，处理过的快照随即删除。
+func (s *Server) RestoreGames() error {
+	tournaments, err := s.snapshots.TakeTournamentSnapshots()
+	if err != nil {
+		return err
+	}
+	if len(tournaments) > 0 {
+		s.hub.RestoreTournaments(tournaments)
+		s.logger.Info("restored tournaments", "snapshots", len(tournaments))
+	}
+
+	snapshots, err := s.snapshots.ListSnapshots()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	done := s.hub.RestoreGames(snapshots)
+	s.logger.Info("restored unfinished games", "snapshots", len(snapshots), "processed", len(done))
+	return s.snapshots.DeleteSnapshots(done)
+}
+
+// waitForGames 等待进行中的游戏全部结束，直到 deadline 或 ctx 结束
+func (s *Server) waitForGames(ctx context.Context, deadline time.Time) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	for {
+		active := s.hub.ActiveGames()
+		if active == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			s.logger.Warn("grace period expired with games in progress", "games", active)
+			return
+		case <-ticker.C:
+		}
+	}
+}
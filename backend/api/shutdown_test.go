@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/chenhailong/hong3/models"
+)
+
+// TestRestoreGamesDeletesSnapshots 启动时处理过的快照从存储中删除
+func TestRestoreGamesDeletesSnapshots(t *testing.T) {
+	server, _ := newTestServer(t)
+	err := server.snapshots.SaveSnapshots([]models.GameSnapshot{
+		{RoomID: "broken-room", Status: "playing", State: "not json", Reason: "shutdown"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.RestoreGames(); err != nil {
+		t.Fatal(err)
+	}
+	remaining, err := server.snapshots.ListSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 0 {
+		t.Fatalf("%d snapshots left after restore, want 0", len(remaining))
+	}
+}
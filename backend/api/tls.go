@@ -0,0 +1,118 @@
+package api
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenhailong/hong3/config"
+)
+
+// certReloader 从磁盘加载证书，证书文件更新后在下一次握手时重新加载
+//
+// 握手时最多每 interval 检查一次文件的修改时间。新证书加载失败时继续使用旧证书，
+// 便于在不重启的情况下替换证书（例如 certbot 续期后）。
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time // 已加载的证书文件的修改时间
+	checked time.Time // 上次检查文件的时间
+}
+
+// newCertReloader 加载证书，证书无效时返回错误
+func newCertReloader(cfg config.TLSConfig, logger *slog.Logger) (*certReloader, error) {
+	r := &certReloader{
+		certFile: cfg.CertFile,
+		keyFile:  cfg.KeyFile,
+		interval: cfg.ReloadInterval,
+		logger:   logger.With("component", "tls"),
+	}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate 供 tls.Config 使用
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) >= r.interval {
+		r.checked = time.Now()
+		modTime, err := r.latestModTime()
+		if err != nil {
+			r.logger.Warn("failed to check certificate files, keeping current certificate", "error", err)
+		} else if modTime.After(r.modTime) {
+			if err := r.load(modTime); err != nil {
+				r.logger.Error("failed to reload certificate, keeping current certificate", "error", err)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// load 加载证书（调用方需持有锁，或在证书开始使用之前调用）
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checked = time.Now()
+	r.logger.Info("certificate loaded", "cert_file", r.certFile, "not_after", cert.Leaf.NotAfter)
+	return nil
+}
+
+// latestModTime 证书和私钥文件中较新的修改时间
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// newRedirectServer 创建把 HTTP 请求跳转到 HTTPS 的服务器
+//
+// httpsPort 为 HTTPS 服务的端口，为 443 时跳转地址不带端口。
+func newRedirectServer(addr, httpsPort string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		ReadHeaderTimeout: 10 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			host := strings.Trim(req.Host, "[]")
+			if h, _, err := net.SplitHostPort(req.Host); err == nil {
+				host = h
+			}
+			if httpsPort != "443" {
+				host = net.JoinHostPort(host, httpsPort)
+			} else if strings.Contains(host, ":") {
+				host = "[" + host + "]" // IPv6
+			}
+			http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusPermanentRedirect)
+		}),
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/chenhailong/hong3/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateTournamentRequest 创建比赛请求，省略的字段使用默认值
+type CreateTournamentRequest struct {
+	Name          string `json:"name" binding:"required"`
+	Format        string `json:"format,omitempty" enum:"reseat,advance"` // 默认为 reseat
+	HandsPerRound int    `json:"hands_per_round,omitempty"`              // 每轮每桌的局数，默认为 4
+	Rounds        int    `json:"rounds,omitempty"`                       // reseat 赛制的轮数，默认为 3
+}
+
+// handleGetTournaments 比赛列表
+func (s *Server) handleGetTournaments(c *gin.Context) {
+	c.JSON(http.StatusOK, s.hub.Tournaments())
+}
+
+// handleGetTournament 比赛的状态和实时积分榜
+func (s *Server) handleGetTournament(c *gin.Context) {
+	tournament, err := s.hub.Tournament(c.Param("id"))
+	if err != nil {
+		tournamentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tournament)
+}
+
+// handleCreateTournament 创建比赛
+func (s *Server) handleCreateTournament(c *gin.Context) {
+	var req CreateTournamentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	tournament, err := s.hub.CreateTournament(websocket.TournamentOptions{
+		Name:          req.Name,
+		Format:        req.Format,
+		HandsPerRound: req.HandsPerRound,
+		Rounds:        req.Rounds,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, tournament)
+}
+
+// handleRegisterTournament 当前用户报名比赛
+func (s *Server) handleRegisterTournament(c *gin.Context) {
+	user := currentUser(c)
+	tournament, err := s.hub.RegisterTournament(c.Param("id"), user.ID, user.Name)
+	if err != nil {
+		tournamentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tournament)
+}
+
+// handleWithdrawTournament 当前用户退出尚未开始的比赛
+func (s *Server) handleWithdrawTournament(c *gin.Context) {
+	tournament, err := s.hub.WithdrawTournament(c.Param("id"), currentUser(c).ID)
+	if err != nil {
+		tournamentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tournament)
+}
+
+// handleStartTournament 开始比赛，参赛玩家会收到各自的座位
+func (s *Server) handleStartTournament(c *gin.Context) {
+	tournament, err := s.hub.StartTournament(c.Param("id"))
+	if err != nil {
+		tournamentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tournament)
+}
+
+// tournamentError 把比赛操作的错误转换为 HTTP 响应：比赛不存在为 404，比赛桌开放失败为 500，
+// 其余为当前状态下不能执行的操作
+func tournamentError(c *gin.Context, err error) {
+	if errors.Is(err, websocket.ErrTournamentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, websocket.ErrTablesUnavailable) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chenhailong/hong3/models"
+)
+
+// SessionInfo 会话信息（不包含 token 本身）
+type SessionInfo struct {
+	Current   bool      `json:"current"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UserExport 用户数据导出
+type UserExport struct {
+	User                *models.User                `json:"user"`
+	Identities          []models.Identity           `json:"identities"`
+	Sessions            []SessionInfo               `json:"sessions"`
+	GameSnapshots       []models.GameSnapshot       `json:"game_snapshots"`
+	TournamentSnapshots []models.TournamentSnapshot `json:"tournament_snapshots"`
+	ExportedAt          time.Time                   `json:"exported_at"`
+}
+
+// UpdateName 修改显示名称
+func (s *UserStore) UpdateName(userID, name string) (*models.User, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 100 {
+		return nil, ErrInvalidName
+	}
+
+	user, err := s.users.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Name = name
+	if err := s.users.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ChangePassword 修改密码，并撤销除 currentToken 以外的所有会话
+func (s *UserStore) ChangePassword(userID, oldPassword, newPassword, currentToken string) error {
+	if newPassword == "" {
+		return ErrInvalidPassword
+	}
+
+	user, err := s.users.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Password != hashPassword(oldPassword) {
+		return ErrInvalidCredentials
+	}
+
+	user.Password = hashPassword(newPassword)
+	if err := s.users.UpdateUser(user); err != nil {
+		return err
+	}
+
+	return s.tokens.DeleteUserTokens(userID, currentToken)
+}
+
+// DeleteAccount 注销账号
+// 用户记录会被匿名化并软删除，保留 ID 以免破坏对局记录等关联数据；
+// 包含该用户的游戏和比赛快照同样把玩家名称替换为已注销用户
+func (s *UserStore) DeleteAccount(userID string) error {
+	if err := s.users.DeleteUser(userID); err != nil {
+		return err
+	}
+
+	if err := s.snapshots.AnonymizePlayer(userID); err != nil {
+		return err
+	}
+
+	return s.tokens.DeleteUserTokens(userID, "")
+}
+
+// ExportUserData 导出用户的全部数据
+func (s *UserStore) ExportUserData(userID, currentToken string) (*UserExport, error) {
+	user, err := s.users.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := s.users.ListIdentities(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.tokens.ListUserTokens(userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]SessionInfo, 0, len(tokens))
+	for token, data := range tokens {
+		sessions = append(sessions, SessionInfo{
+			Current:   token == currentToken,
+			ExpiresAt: data.ExpiresAt,
+		})
+	}
+
+	snapshots, err := s.snapshots.ListPlayerSnapshots(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tournaments, err := s.snapshots.ListPlayerTournamentSnapshots(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserExport{
+		User:                user,
+		Identities:          identities,
+		Sessions:            sessions,
+		GameSnapshots:       snapshots,
+		TournamentSnapshots: tournaments,
+		ExportedAt:          time.Now(),
+	}, nil
+}
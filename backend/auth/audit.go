@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/chenhailong/hong3/logging"
+)
+
+// 审计事件
+const (
+	AuditLoginSuccess      = "login_success"
+	AuditLoginFailed       = "login_failed"
+	AuditLoginThrottled    = "login_throttled"
+	AuditLockout           = "lockout"
+	AuditRegisterSuccess   = "register_success"
+	AuditRegisterFailed    = "register_failed"
+	AuditRegisterThrottled = "register_throttled"
+	AuditOIDCLogin         = "oidc_login"
+	AuditPasswordChanged   = "password_changed"
+	AuditAccountDeleted    = "account_deleted"
+	AuditRoleChanged       = "role_changed"
+)
+
+// Audit 记录一条安全相关的审计日志
+// ctx 中的日志记录器带有请求ID等字段；args 为 slog 风格的键值对
+func Audit(ctx context.Context, event string, args ...any) {
+	logging.FromContext(ctx).With("audit", true, "event", event).InfoContext(ctx, "audit: "+event, args...)
+}
@@ -8,5 +8,12 @@ var (
 	ErrInvalidToken     = errors.New("无效的token")
 	ErrTokenExpired     = errors.New("token已过期")
 	ErrUserNotFound     = errors.New("用户不存在")
+	ErrOIDCDisabled     = errors.New("未启用OIDC登录")
+	ErrOIDCState        = errors.New("OIDC登录状态无效或已过期")
+	ErrIdentityLinked   = errors.New("该外部身份已关联其他用户")
+	ErrInvalidName      = errors.New("名称不能为空且不超过100个字符")
+	ErrInvalidPassword  = errors.New("新密码不能为空")
+	ErrInvalidRole      = errors.New("无效的角色")
+	ErrIdentityNotFound = errors.New("外部身份不存在")
 )
 
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/chenhailong/hong3/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GormUserRepository 使用 GORM（PostgreSQL 或 SQLite）存储用户
+type GormUserRepository struct {
+	db *gorm.DB
+}
+
+// NewGormUserRepository 创建使用 GORM 的用户存储
+func NewGormUserRepository(db *gorm.DB) *GormUserRepository {
+	return &GormUserRepository{db: db}
+}
+
+// GetUser 根据 ID 获取用户
+func (r *GormUserRepository) GetUser(id string) (*models.User, error) {
+	var user models.User
+	if err := r.db.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	return &user, nil
+}
+
+// GetUserByUsername 根据用户名获取用户
+func (r *GormUserRepository) GetUserByUsername(username string) (*models.User, error) {
+	var user models.User
+	if err := r.db.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	return &user, nil
+}
+
+// CreateUser 创建用户
+func (r *GormUserRepository) CreateUser(user *models.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return createUser(tx, user)
+	})
+}
+
+// UpdateUser 保存用户的名称、密码和角色
+func (r *GormUserRepository) UpdateUser(user *models.User) error {
+	result := r.db.Model(user).Select("name", "password", "role").Updates(user)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeleteUser 匿名化并软删除用户，保留 ID 以免破坏对局记录等关联数据
+func (r *GormUserRepository) DeleteUser(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("id = ?", id).First(&user).Error; err != nil {
+			return notFound(err, ErrUserNotFound)
+		}
+
+		// 外部身份包含邮箱等个人信息，直接删除
+		if err := tx.Where("user_id = ?", id).Delete(&models.Identity{}).Error; err != nil {
+			return err
+		}
+
+		user.Anonymize()
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&user).Error
+	})
+}
+
+// ListIdentities 获取用户关联的外部身份
+func (r *GormUserRepository) ListIdentities(userID string) ([]models.Identity, error) {
+	identities := make([]models.Identity, 0)
+	if err := r.db.Where("user_id = ?", userID).Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// GetIdentity 根据身份提供方和 subject 获取外部身份
+func (r *GormUserRepository) GetIdentity(issuer, subject string) (*models.Identity, error) {
+	var identity models.Identity
+	if err := r.db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error; err != nil {
+		return nil, notFound(err, ErrIdentityNotFound)
+	}
+	return &identity, nil
+}
+
+// UpdateIdentity 保存外部身份的邮箱
+func (r *GormUserRepository) UpdateIdentity(identity *models.Identity) error {
+	return r.db.Model(identity).Update("email", identity.Email).Error
+}
+
+// CreateIdentity 创建外部身份，newUser 不为 nil 时先创建该用户
+func (r *GormUserRepository) CreateIdentity(identity *models.Identity, newUser *models.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if newUser != nil {
+			if err := createUser(tx, newUser); err != nil {
+				return err
+			}
+			identity.UserID = newUser.ID
+		}
+		return tx.Create(identity).Error
+	})
+}
+
+// GormGameSnapshotRepository 使用 GORM 存储停机时保存的游戏（game_snapshots 表）
+type GormGameSnapshotRepository struct {
+	db *gorm.DB
+}
+
+// NewGormGameSnapshotRepository 创建使用 GORM 的游戏快照存储
+func NewGormGameSnapshotRepository(db *gorm.DB) *GormGameSnapshotRepository {
+	return &GormGameSnapshotRepository{db: db}
+}
+
+// SaveSnapshots 保存快照
+func (r *GormGameSnapshotRepository) SaveSnapshots(snapshots []models.GameSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	return r.db.Create(&snapshots).Error
+}
+
+// ListSnapshots 所有保存的快照，按保存时间排序
+func (r *GormGameSnapshotRepository) ListSnapshots() ([]models.GameSnapshot, error) {
+	var snapshots []models.GameSnapshot
+	if err := r.db.Order("created_at").Find(&snapshots).Error; err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// DeleteSnapshots 删除快照
+func (r *GormGameSnapshotRepository) DeleteSnapshots(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	// SQLite 默认不检查外键，不能依赖 ON DELETE CASCADE
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("snapshot_id IN ?", ids).Delete(&models.GameSnapshotPlayer{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.GameSnapshot{}).Error
+	})
+}
+
+// ListPlayerSnapshots 包含该玩家的快照，按保存时间排序
+func (r *GormGameSnapshotRepository) ListPlayerSnapshots(playerID string) ([]models.GameSnapshot, error) {
+	return playerSnapshots(r.db, playerID)
+}
+
+// AnonymizePlayer 把包含该玩家的游戏和比赛快照中的玩家名称替换为已注销用户
+func (r *GormGameSnapshotRepository) AnonymizePlayer(playerID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		snapshots, err := playerSnapshots(tx, playerID)
+		if err != nil {
+			return err
+		}
+		for i := range snapshots {
+			if err := snapshots[i].AnonymizePlayer(playerID); err != nil {
+				return err
+			}
+			if err := tx.Model(&snapshots[i]).Update("state", snapshots[i].State).Error; err != nil {
+				return err
+			}
+		}
+
+		tournaments, err := playerTournamentSnapshots(tx, playerID)
+		if err != nil {
+			return err
+		}
+		for i := range tournaments {
+			if err := tournaments[i].AnonymizePlayer(playerID); err != nil {
+				return err
+			}
+			if err := tx.Model(&tournaments[i]).Update("state", tournaments[i].State).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SaveTournamentSnapshots 保存比赛快照
+func (r *GormGameSnapshotRepository) SaveTournamentSnapshots(snapshots []models.TournamentSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	return r.db.Create(&snapshots).Error
+}
+
+// TakeTournamentSnapshots 取出并删除所有保存的比赛快照，按保存时间排序
+//
+// 使用 DELETE ... RETURNING，同时启动的实例中只有一个能取到同一个快照。
+func (r *GormGameSnapshotRepository) TakeTournamentSnapshots() ([]models.TournamentSnapshot, error) {
+	var snapshots []models.TournamentSnapshot
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Returning{}).Where("1 = 1").Delete(&snapshots).Error; err != nil {
+			return err
+		}
+		ids := make([]string, 0, len(snapshots))
+		for _, s := range snapshots {
+			ids = append(ids, s.ID)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return tx.Where("snapshot_id IN ?", ids).Delete(&models.TournamentSnapshotPlayer{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt) })
+	return snapshots, nil
+}
+
+// ListPlayerTournamentSnapshots 包含该玩家的比赛快照，按保存时间排序
+func (r *GormGameSnapshotRepository) ListPlayerTournamentSnapshots(playerID string) ([]models.TournamentSnapshot, error) {
+	return playerTournamentSnapshots(r.db, playerID)
+}
+
+// playerSnapshots 查询包含该玩家的快照
+func playerSnapshots(tx *gorm.DB, playerID string) ([]models.GameSnapshot, error) {
+	players := tx.Model(&models.GameSnapshotPlayer{}).Select("snapshot_id").Where("player_id = ?", playerID)
+	var snapshots []models.GameSnapshot
+	if err := tx.Where("id IN (?)", players).Order("created_at").Find(&snapshots).Error; err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// playerTournamentSnapshots 查询包含该玩家的比赛快照
+func playerTournamentSnapshots(tx *gorm.DB, playerID string) ([]models.TournamentSnapshot, error) {
+	players := tx.Model(&models.TournamentSnapshotPlayer{}).Select("snapshot_id").Where("player_id = ?", playerID)
+	var snapshots []models.TournamentSnapshot
+	if err := tx.Where("id IN (?)", players).Order("created_at").Find(&snapshots).Error; err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// createUser 在事务中创建用户，用户名已存在时返回 ErrUserExists
+func createUser(tx *gorm.DB, user *models.User) error {
+	var count int64
+	if err := tx.Model(&models.User{}).Unscoped().Where("username = ?", user.Username).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrUserExists
+	}
+	return tx.Create(user).Error
+}
+
+// notFound 把 gorm.ErrRecordNotFound 转换为 auth 包的错误
+func notFound(err, target error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return target
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chenhailong/hong3/db"
+	"github.com/chenhailong/hong3/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB 使用执行过全部迁移的 SQLite 内存数据库
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	previous := db.DB
+	db.DB = conn
+	t.Cleanup(func() {
+		db.DB = previous
+		sqlDB.Close()
+	})
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestGormGameSnapshotPlayers(t *testing.T) {
+	conn := useTestDB(t)
+	repo := NewGormGameSnapshotRepository(conn)
+
+	state := strings.ReplaceAll(snapshotState, "%s", "u1")
+	snapshots := []models.GameSnapshot{
+		{RoomID: "r1", Status: "playing", State: state, Reason: "shutdown", Players: []models.GameSnapshotPlayer{{PlayerID: "u1"}, {PlayerID: "guest"}}},
+		{RoomID: "r2", Status: "playing", State: `{"game":{"players":[]}}`, Reason: "shutdown", Players: []models.GameSnapshotPlayer{{PlayerID: "guest"}}},
+	}
+	if err := repo.SaveSnapshots(snapshots); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := repo.ListPlayerSnapshots("u1")
+	if err != nil || len(found) != 1 || found[0].ID != snapshots[0].ID {
+		t.Fatalf("u1 snapshots %+v (%v), want r1", found, err)
+	}
+	if found, _ := repo.ListPlayerSnapshots("guest"); len(found) != 2 {
+		t.Errorf("guest snapshots %+v, want 2", found)
+	}
+
+	if err := repo.AnonymizePlayer("u1"); err != nil {
+		t.Fatal(err)
+	}
+	all, err := repo.ListSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range all {
+		if strings.Contains(s.State, "Frank") {
+			t.Errorf("snapshot %s still has the player name: %s", s.RoomID, s.State)
+		}
+	}
+
+	// 删除快照时一并删除玩家记录
+	if err := repo.DeleteSnapshots([]string{snapshots[0].ID, snapshots[1].ID}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := conn.Model(&models.GameSnapshotPlayer{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d snapshot players left after deletion", count)
+	}
+}
+
+func TestGormTournamentSnapshots(t *testing.T) {
+	conn := useTestDB(t)
+	repo := NewGormGameSnapshotRepository(conn)
+
+	state := `{"id":"t1","entrants":[{"id":"u1","name":"Frank"},{"id":"u2","name":"Grace"}]}`
+	snapshots := []models.TournamentSnapshot{
+		{TournamentID: "t1", Status: "playing", State: state, Reason: "shutdown", Players: []models.TournamentSnapshotPlayer{{PlayerID: "u1"}, {PlayerID: "u2"}}},
+	}
+	if err := repo.SaveTournamentSnapshots(snapshots); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.AnonymizePlayer("u1"); err != nil {
+		t.Fatal(err)
+	}
+	found, err := repo.ListPlayerTournamentSnapshots("u1")
+	if err != nil || len(found) != 1 {
+		t.Fatalf("u1 tournament snapshots %+v (%v), want t1", found, err)
+	}
+	if strings.Contains(found[0].State, "Frank") || !strings.Contains(found[0].State, "Grace") {
+		t.Errorf("anonymized state %s, want only Frank replaced", found[0].State)
+	}
+
+	// 取走的快照同时被删除，另一个实例取不到
+	taken, err := repo.TakeTournamentSnapshots()
+	if err != nil || len(taken) != 1 || taken[0].TournamentID != "t1" {
+		t.Fatalf("taken %+v (%v), want t1", taken, err)
+	}
+	if again, err := repo.TakeTournamentSnapshots(); err != nil || len(again) != 0 {
+		t.Errorf("taken again %+v (%v), want none", again, err)
+	}
+	var count int64
+	if err := conn.Model(&models.TournamentSnapshotPlayer{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d tournament snapshot players left after taking", count)
+	}
+}
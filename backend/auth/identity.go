@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/chenhailong/hong3/models"
+)
+
+// ExternalIdentity 外部身份提供方返回的用户信息
+type ExternalIdentity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	PreferredUsername string
+	Name              string
+}
+
+var usernameSanitizer = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// LoginWithIdentity 使用外部身份登录
+// linkUserID 不为空时，将外部身份关联到该用户；否则按需创建新用户
+func (s *UserStore) LoginWithIdentity(ext *ExternalIdentity, linkUserID string) (*models.User, string, error) {
+	user, err := s.resolveIdentity(ext, linkUserID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := s.IssueToken(user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return user, token, nil
+}
+
+// resolveIdentity 找到外部身份关联的用户，尚未关联时关联到 linkUserID 或新用户
+func (s *UserStore) resolveIdentity(ext *ExternalIdentity, linkUserID string) (*models.User, error) {
+	identity, err := s.users.GetIdentity(ext.Issuer, ext.Subject)
+	if err == nil {
+		// 身份已关联
+		if linkUserID != "" && identity.UserID != linkUserID {
+			return nil, ErrIdentityLinked
+		}
+		user, err := s.users.GetUser(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if ext.Email != "" && identity.Email != ext.Email {
+			identity.Email = ext.Email
+			if err := s.users.UpdateIdentity(identity); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}
+	if !errors.Is(err, ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	identity = &models.Identity{
+		Issuer:  ext.Issuer,
+		Subject: ext.Subject,
+		Email:   ext.Email,
+	}
+
+	if linkUserID != "" {
+		// 关联到已登录的用户
+		user, err := s.users.GetUser(linkUserID)
+		if err != nil {
+			return nil, err
+		}
+		identity.UserID = user.ID
+		if err := s.users.CreateIdentity(identity, nil); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	// 首次登录，创建新用户（随机密码，只能通过外部身份登录）
+	username, err := s.uniqueUsername(ext)
+	if err != nil {
+		return nil, err
+	}
+	name := ext.Name
+	if name == "" {
+		name = username
+	}
+	user := &models.User{
+		Username: username,
+		Password: hashPassword(generateID()),
+		Name:     name,
+	}
+	if err := s.users.CreateIdentity(identity, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// uniqueUsername 根据外部身份生成一个未被占用的用户名
+func (s *UserStore) uniqueUsername(ext *ExternalIdentity) (string, error) {
+	base := ext.PreferredUsername
+	if base == "" && ext.Email != "" {
+		base = strings.SplitN(ext.Email, "@", 2)[0]
+	}
+	base = usernameSanitizer.ReplaceAllString(base, "")
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	username := base
+	for i := 0; i < 5; i++ {
+		_, err := s.users.GetUserByUsername(username)
+		if err == ErrUserNotFound {
+			return username, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		username = base + "_" + generateID()[:6]
+	}
+
+	return "", ErrUserExists
+}
@@ -0,0 +1,552 @@
+package auth
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/chenhailong/hong3/models"
+	"gorm.io/gorm"
+)
+
+// MemoryUserRepository 进程内存中的用户存储，重启后数据丢失
+//
+// 用于测试和不依赖数据库的场景，行为与 GormUserRepository 一致：
+// 注销的用户保留匿名记录，用户名和外部身份唯一。
+type MemoryUserRepository struct {
+	mu         sync.RWMutex
+	users      map[string]*models.User     // key 为用户 ID，包含已注销的用户
+	identities map[string]*models.Identity // key 为外部身份 ID
+}
+
+// NewMemoryUserRepository 创建内存中的用户存储
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:      make(map[string]*models.User),
+		identities: make(map[string]*models.Identity),
+	}
+}
+
+// GetUser 根据 ID 获取用户
+func (r *MemoryUserRepository) GetUser(id string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt.Valid {
+		return nil, ErrUserNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// GetUserByUsername 根据用户名获取用户
+func (r *MemoryUserRepository) GetUserByUsername(username string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Username == username && !user.DeletedAt.Valid {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// CreateUser 创建用户
+func (r *MemoryUserRepository) CreateUser(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.createUser(user)
+}
+
+// UpdateUser 保存用户的名称、密码和角色
+func (r *MemoryUserRepository) UpdateUser(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrUserNotFound
+	}
+	stored.Name = user.Name
+	stored.Password = user.Password
+	stored.Role = user.Role
+	stored.UpdatedAt = time.Now()
+	user.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+// DeleteUser 匿名化并软删除用户，同时删除其外部身份
+func (r *MemoryUserRepository) DeleteUser(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt.Valid {
+		return ErrUserNotFound
+	}
+	for identityID, identity := range r.identities {
+		if identity.UserID == id {
+			delete(r.identities, identityID)
+		}
+	}
+	user.Anonymize()
+	user.UpdatedAt = time.Now()
+	user.DeletedAt = gorm.DeletedAt{Time: user.UpdatedAt, Valid: true}
+	return nil
+}
+
+// ListIdentities 获取用户关联的外部身份
+func (r *MemoryUserRepository) ListIdentities(userID string) ([]models.Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	identities := make([]models.Identity, 0)
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, *identity)
+		}
+	}
+	return identities, nil
+}
+
+// GetIdentity 根据身份提供方和 subject 获取外部身份
+func (r *MemoryUserRepository) GetIdentity(issuer, subject string) (*models.Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if identity := r.findIdentity(issuer, subject); identity != nil {
+		copied := *identity
+		return &copied, nil
+	}
+	return nil, ErrIdentityNotFound
+}
+
+// UpdateIdentity 保存外部身份的邮箱
+func (r *MemoryUserRepository) UpdateIdentity(identity *models.Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.identities[identity.ID]
+	if !ok {
+		return ErrIdentityNotFound
+	}
+	stored.Email = identity.Email
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+// CreateIdentity 创建外部身份，newUser 不为 nil 时先创建该用户
+func (r *MemoryUserRepository) CreateIdentity(identity *models.Identity, newUser *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.findIdentity(identity.Issuer, identity.Subject) != nil {
+		return ErrIdentityLinked
+	}
+	if newUser != nil {
+		if err := r.createUser(newUser); err != nil {
+			return err
+		}
+		identity.UserID = newUser.ID
+	}
+
+	identity.BeforeCreate(nil)
+	identity.CreatedAt = time.Now()
+	identity.UpdatedAt = identity.CreatedAt
+	copied := *identity
+	r.identities[identity.ID] = &copied
+	return nil
+}
+
+// createUser 保存新用户（调用方需持有写锁）
+func (r *MemoryUserRepository) createUser(user *models.User) error {
+	for _, existing := range r.users {
+		if existing.Username == user.Username {
+			return ErrUserExists
+		}
+	}
+	user.BeforeCreate(nil)
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+// findIdentity 查找外部身份（调用方需持有锁）
+func (r *MemoryUserRepository) findIdentity(issuer, subject string) *models.Identity {
+	for _, identity := range r.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity
+		}
+	}
+	return nil
+}
+
+// MemoryTokenRepository 进程内存中的 token 存储
+//
+// 重启后所有会话失效，且不能在多个实例之间共享，适合测试和单实例部署。
+type MemoryTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]*memoryToken
+}
+
+type memoryToken struct {
+	data      TokenData
+	expiresAt time.Time // 存储的过期时间（ttl），与会话的 ExpiresAt 相同或更早
+}
+
+// NewMemoryTokenRepository 创建内存中的 token 存储
+func NewMemoryTokenRepository() *MemoryTokenRepository {
+	return &MemoryTokenRepository{tokens: make(map[string]*memoryToken)}
+}
+
+// SaveToken 保存 token
+func (r *MemoryTokenRepository) SaveToken(token string, data *TokenData, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.removeExpired()
+	r.tokens[token] = &memoryToken{data: *data, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// GetToken 获取 token 对应的会话
+func (r *MemoryTokenRepository) GetToken(token string) (*TokenData, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tokens[token]
+	if !ok || time.Now().After(stored.expiresAt) {
+		delete(r.tokens, token)
+		return nil, ErrInvalidToken
+	}
+	data := stored.data
+	return &data, nil
+}
+
+// DeleteToken 删除 token
+func (r *MemoryTokenRepository) DeleteToken(token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.tokens, token)
+	return nil
+}
+
+// ListUserTokens 用户所有仍然有效的 token
+func (r *MemoryTokenRepository) ListUserTokens(userID string) (map[string]*TokenData, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.removeExpired()
+	result := make(map[string]*TokenData)
+	for token, stored := range r.tokens {
+		if stored.data.UserID == userID {
+			data := stored.data
+			result[token] = &data
+		}
+	}
+	return result, nil
+}
+
+// DeleteUserTokens 删除用户的所有 token，except 不为空时保留该 token
+func (r *MemoryTokenRepository) DeleteUserTokens(userID, except string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for token, stored := range r.tokens {
+		if stored.data.UserID == userID && token != except {
+			delete(r.tokens, token)
+		}
+	}
+	return nil
+}
+
+// removeExpired 删除过期的 token（调用方需持有锁）
+func (r *MemoryTokenRepository) removeExpired() {
+	now := time.Now()
+	for token, stored := range r.tokens {
+		if now.After(stored.expiresAt) {
+			delete(r.tokens, token)
+		}
+	}
+}
+
+// MemoryGameSnapshotRepository 进程内存中的游戏快照存储，用于测试和不依赖数据库的场景
+type MemoryGameSnapshotRepository struct {
+	mu          sync.Mutex
+	snapshots   []models.GameSnapshot
+	tournaments []models.TournamentSnapshot
+}
+
+// NewMemoryGameSnapshotRepository 创建内存中的游戏快照存储
+func NewMemoryGameSnapshotRepository() *MemoryGameSnapshotRepository {
+	return &MemoryGameSnapshotRepository{}
+}
+
+// SaveSnapshots 保存快照
+func (r *MemoryGameSnapshotRepository) SaveSnapshots(snapshots []models.GameSnapshot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for i := range snapshots {
+		snapshots[i].BeforeCreate(nil)
+		snapshots[i].CreatedAt = now
+		for j := range snapshots[i].Players {
+			snapshots[i].Players[j].SnapshotID = snapshots[i].ID
+		}
+		r.snapshots = append(r.snapshots, snapshots[i])
+	}
+	return nil
+}
+
+// ListSnapshots 所有保存的快照，按保存时间排序
+func (r *MemoryGameSnapshotRepository) ListSnapshots() ([]models.GameSnapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.snapshots), nil
+}
+
+// DeleteSnapshots 删除快照
+func (r *MemoryGameSnapshotRepository) DeleteSnapshots(ids []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.snapshots = slices.DeleteFunc(r.snapshots, func(s models.GameSnapshot) bool {
+		return slices.Contains(ids, s.ID)
+	})
+	return nil
+}
+
+// ListPlayerSnapshots 包含该玩家的快照，按保存时间排序
+func (r *MemoryGameSnapshotRepository) ListPlayerSnapshots(playerID string) ([]models.GameSnapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshots := make([]models.GameSnapshot, 0)
+	for _, s := range r.snapshots {
+		if hasPlayer(s, playerID) {
+			snapshots = append(snapshots, s)
+		}
+	}
+	return snapshots, nil
+}
+
+// AnonymizePlayer 把包含该玩家的游戏和比赛快照中的玩家名称替换为已注销用户
+func (r *MemoryGameSnapshotRepository) AnonymizePlayer(playerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.snapshots {
+		if !hasPlayer(r.snapshots[i], playerID) {
+			continue
+		}
+		if err := r.snapshots[i].AnonymizePlayer(playerID); err != nil {
+			return err
+		}
+	}
+	for i := range r.tournaments {
+		if !hasEntrant(r.tournaments[i], playerID) {
+			continue
+		}
+		if err := r.tournaments[i].AnonymizePlayer(playerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveTournamentSnapshots 保存比赛快照
+func (r *MemoryGameSnapshotRepository) SaveTournamentSnapshots(snapshots []models.TournamentSnapshot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for i := range snapshots {
+		snapshots[i].BeforeCreate(nil)
+		snapshots[i].CreatedAt = now
+		for j := range snapshots[i].Players {
+			snapshots[i].Players[j].SnapshotID = snapshots[i].ID
+		}
+		r.tournaments = append(r.tournaments, snapshots[i])
+	}
+	return nil
+}
+
+// TakeTournamentSnapshots 取出并删除所有保存的比赛快照，按保存时间排序
+func (r *MemoryGameSnapshotRepository) TakeTournamentSnapshots() ([]models.TournamentSnapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshots := r.tournaments
+	r.tournaments = nil
+	return snapshots, nil
+}
+
+// ListPlayerTournamentSnapshots 包含该玩家的比赛快照，按保存时间排序
+func (r *MemoryGameSnapshotRepository) ListPlayerTournamentSnapshots(playerID string) ([]models.TournamentSnapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshots := make([]models.TournamentSnapshot, 0)
+	for _, s := range r.tournaments {
+		if hasEntrant(s, playerID) {
+			snapshots = append(snapshots, s)
+		}
+	}
+	return snapshots, nil
+}
+
+// hasPlayer 快照中是否有该玩家
+func hasPlayer(s models.GameSnapshot, playerID string) bool {
+	return slices.ContainsFunc(s.Players, func(p models.GameSnapshotPlayer) bool {
+		return p.PlayerID == playerID
+	})
+}
+
+// hasEntrant 比赛快照中是否有该玩家
+func hasEntrant(s models.TournamentSnapshot, playerID string) bool {
+	return slices.ContainsFunc(s.Players, func(p models.TournamentSnapshotPlayer) bool {
+		return p.PlayerID == playerID
+	})
+}
+
+// MemoryAttemptRepository 进程内存中的失败计数
+//
+// 不能在多个实例之间共享，适合测试和单实例部署；Redis 出错时 Throttle 也退回到这里计数。
+type MemoryAttemptRepository struct {
+	mu      sync.Mutex
+	entries map[string]*memoryAttempt
+}
+
+type memoryAttempt struct {
+	count       int
+	windowEnd   time.Time
+	lockedUntil time.Time
+}
+
+// NewMemoryAttemptRepository 创建内存中的失败计数
+func NewMemoryAttemptRepository() *MemoryAttemptRepository {
+	return &MemoryAttemptRepository{entries: make(map[string]*memoryAttempt)}
+}
+
+// AddAttempt 失败次数加一并返回当前次数
+func (r *MemoryAttemptRepository) AddAttempt(key string, window time.Duration) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.removeExpired(now)
+
+	entry, ok := r.entries[key]
+	if !ok {
+		entry = &memoryAttempt{windowEnd: now.Add(window)}
+		r.entries[key] = entry
+	}
+	if now.After(entry.windowEnd) {
+		// 统计窗口已过，重新计数（锁定仍然保留）
+		entry.count = 0
+		entry.windowEnd = now.Add(window)
+	}
+	entry.count++
+	return entry.count, nil
+}
+
+// Lockout key 剩余的锁定时间
+func (r *MemoryAttemptRepository) Lockout(key string) (time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	return max(time.Until(entry.lockedUntil), 0), nil
+}
+
+// SetLockout 锁定 key 一段时间
+func (r *MemoryAttemptRepository) SetLockout(key string, duration time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[key]
+	if !ok {
+		entry = &memoryAttempt{}
+		r.entries[key] = entry
+	}
+	entry.lockedUntil = time.Now().Add(duration)
+	return nil
+}
+
+// ResetAttempts 清空失败次数和锁定
+func (r *MemoryAttemptRepository) ResetAttempts(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entries, key)
+	return nil
+}
+
+// removeExpired 删除窗口和锁定都已过期的计数（调用方需持有锁）
+func (r *MemoryAttemptRepository) removeExpired(now time.Time) {
+	for key, entry := range r.entries {
+		if now.After(entry.windowEnd) && now.After(entry.lockedUntil) {
+			delete(r.entries, key)
+		}
+	}
+}
+
+// MemoryOIDCStateRepository 进程内存中的 OIDC 登录流程状态
+//
+// 回调必须到达发起登录的同一个实例，适合测试和单实例部署。
+type MemoryOIDCStateRepository struct {
+	mu     sync.Mutex
+	states map[string]*OIDCLoginState
+}
+
+// NewMemoryOIDCStateRepository 创建内存中的 OIDC 登录流程状态存储
+func NewMemoryOIDCStateRepository() *MemoryOIDCStateRepository {
+	return &MemoryOIDCStateRepository{states: make(map[string]*OIDCLoginState)}
+}
+
+// SaveOIDCState 保存登录流程的状态，在 ttl 和 data.ExpiresAt 中较早的时间过期
+func (r *MemoryOIDCStateRepository) SaveOIDCState(state string, data *OIDCLoginState, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.removeExpired(time.Now())
+	copied := *data
+	if expiresAt := time.Now().Add(ttl); expiresAt.Before(copied.ExpiresAt) {
+		copied.ExpiresAt = expiresAt
+	}
+	r.states[state] = &copied
+	return nil
+}
+
+// TakeOIDCState 取出并删除登录流程的状态
+func (r *MemoryOIDCStateRepository) TakeOIDCState(state string) (*OIDCLoginState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, ok := r.states[state]
+	delete(r.states, state)
+	if !ok || time.Now().After(data.ExpiresAt) {
+		return nil, ErrOIDCState
+	}
+	return data, nil
+}
+
+// removeExpired 删除过期的登录流程（调用方需持有锁）
+func (r *MemoryOIDCStateRepository) removeExpired(now time.Time) {
+	for state, data := range r.states {
+		if now.After(data.ExpiresAt) {
+			delete(r.states, state)
+		}
+	}
+}
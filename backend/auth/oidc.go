@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/chenhailong/hong3/config"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// oidcStateTTL 登录流程（从跳转到回调）的最长有效时间
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCProvider OpenID Connect 授权码流程（PKCE）
+type OIDCProvider struct {
+	name        string
+	issuer      string
+	frontendURL string
+	verifier    *oidc.IDTokenVerifier
+	oauth2      oauth2.Config
+}
+
+var defaultOIDC *OIDCProvider
+
+// InitOIDC 初始化默认的 OIDC 身份提供方
+func InitOIDC(ctx context.Context, cfg config.OIDCConfig) error {
+	provider, err := NewOIDCProvider(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defaultOIDC = provider
+	return nil
+}
+
+// SetOIDC 设置默认的 OIDC 身份提供方，nil 表示禁用
+func SetOIDC(provider *OIDCProvider) {
+	defaultOIDC = provider
+}
+
+// GetOIDC 获取默认的 OIDC 身份提供方，未启用时返回 nil
+func GetOIDC() *OIDCProvider {
+	return defaultOIDC
+}
+
+// NewOIDCProvider 通过 issuer 的 discovery 文档创建 OIDC 身份提供方
+func NewOIDCProvider(ctx context.Context, cfg config.OIDCConfig) (*OIDCProvider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("oidc issuer and client id are required")
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc provider: %w", err)
+	}
+
+	authLogger.Info("OIDC provider discovered", "provider", cfg.ProviderName, "issuer", cfg.Issuer)
+	return &OIDCProvider{
+		name:        cfg.ProviderName,
+		issuer:      cfg.Issuer,
+		frontendURL: cfg.FrontendURL,
+		verifier:    provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+	}, nil
+}
+
+// Name 身份提供方名称
+func (p *OIDCProvider) Name() string {
+	return p.name
+}
+
+// FrontendURL 登录成功后跳转的前端地址
+func (p *OIDCProvider) FrontendURL() string {
+	return p.frontendURL
+}
+
+// RedirectURL 身份提供方回调的地址
+func (p *OIDCProvider) RedirectURL() string {
+	return p.oauth2.RedirectURL
+}
+
+// StartOIDCLogin 开始一次登录流程，返回身份提供方的授权地址和 state
+// linkUserID 不为空时，回调成功后将外部身份关联到该用户。
+// 调用方需要把 state 绑定到发起登录的浏览器（例如 cookie），回调时校验一致后才能调用 FinishOIDCLogin。
+func (s *UserStore) StartOIDCLogin(provider *OIDCProvider, linkUserID string) (string, string, error) {
+	state := generateID()
+	loginState := &OIDCLoginState{
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce:        generateID(),
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	if err := s.oidcStates.SaveOIDCState(state, loginState, oidcStateTTL); err != nil {
+		return "", "", fmt.Errorf("failed to save oidc state: %w", err)
+	}
+
+	return provider.authCodeURL(state, loginState), state, nil
+}
+
+// FinishOIDCLogin 处理回调：取出登录流程的状态，用授权码换取并校验 ID token
+// 返回外部身份以及发起流程时指定的待关联用户ID；state 无效或已使用时返回 ErrOIDCState
+func (s *UserStore) FinishOIDCLogin(ctx context.Context, provider *OIDCProvider, state, code string) (*ExternalIdentity, string, error) {
+	loginState, err := s.oidcStates.TakeOIDCState(state)
+	if err != nil {
+		if err != ErrOIDCState {
+			err = fmt.Errorf("failed to load oidc state: %w", err)
+		}
+		return nil, "", err
+	}
+	if time.Now().After(loginState.ExpiresAt) {
+		return nil, "", ErrOIDCState
+	}
+
+	ext, err := provider.exchange(ctx, code, loginState)
+	if err != nil {
+		return nil, "", err
+	}
+	return ext, loginState.LinkUserID, nil
+}
+
+// authCodeURL 身份提供方的授权地址
+func (p *OIDCProvider) authCodeURL(state string, loginState *OIDCLoginState) string {
+	return p.oauth2.AuthCodeURL(state,
+		oidc.Nonce(loginState.Nonce),
+		oauth2.S256ChallengeOption(loginState.CodeVerifier),
+	)
+}
+
+// exchange 用授权码换取并校验 ID token
+func (p *OIDCProvider) exchange(ctx context.Context, code string, loginState *OIDCLoginState) (*ExternalIdentity, error) {
+	oauth2Token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(loginState.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if idToken.Nonce != loginState.Nonce {
+		return nil, fmt.Errorf("id_token nonce mismatch")
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse id_token claims: %w", err)
+	}
+
+	return &ExternalIdentity{
+		Issuer:            idToken.Issuer,
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
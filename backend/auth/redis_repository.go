@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chenhailong/hong3/redis"
+)
+
+// RedisTokenRepository 使用 Redis 存储登录 token（需要先调用 redis.InitRedis）
+//
+// token 依靠 Redis 的过期时间自动删除，多个实例共享同一份会话。
+type RedisTokenRepository struct{}
+
+// NewRedisTokenRepository 创建使用 Redis 的 token 存储
+func NewRedisTokenRepository() *RedisTokenRepository {
+	return &RedisTokenRepository{}
+}
+
+// SaveToken 保存 token
+func (r *RedisTokenRepository) SaveToken(token string, data *TokenData, ttl time.Duration) error {
+	return redis.SetToken(token, &redis.TokenData{
+		UserID:    data.UserID,
+		Username:  data.Username,
+		ExpiresAt: data.ExpiresAt,
+	}, ttl)
+}
+
+// GetToken 获取 token 对应的会话
+func (r *RedisTokenRepository) GetToken(token string) (*TokenData, error) {
+	data, err := redis.GetToken(token)
+	if errors.Is(err, redis.ErrTokenNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromRedisToken(data), nil
+}
+
+// DeleteToken 删除 token
+func (r *RedisTokenRepository) DeleteToken(token string) error {
+	return redis.DeleteToken(token)
+}
+
+// ListUserTokens 用户所有仍然有效的 token
+func (r *RedisTokenRepository) ListUserTokens(userID string) (map[string]*TokenData, error) {
+	tokens, err := redis.GetUserTokens(userID)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*TokenData, len(tokens))
+	for token, data := range tokens {
+		result[token] = fromRedisToken(data)
+	}
+	return result, nil
+}
+
+// DeleteUserTokens 删除用户的所有 token，except 不为空时保留该 token
+func (r *RedisTokenRepository) DeleteUserTokens(userID, except string) error {
+	return redis.DeleteUserTokens(userID, except)
+}
+
+func fromRedisToken(data *redis.TokenData) *TokenData {
+	return &TokenData{
+		UserID:    data.UserID,
+		Username:  data.Username,
+		ExpiresAt: data.ExpiresAt,
+	}
+}
+
+// RedisAttemptRepository 使用 Redis 保存失败计数和锁定（需要先调用 redis.InitRedis）
+//
+// 多个实例共享同一份计数，计数和锁定依靠 Redis 的过期时间自动删除。
+type RedisAttemptRepository struct{}
+
+// NewRedisAttemptRepository 创建使用 Redis 的失败计数
+func NewRedisAttemptRepository() *RedisAttemptRepository {
+	return &RedisAttemptRepository{}
+}
+
+// AddAttempt 失败次数加一并返回当前次数
+func (r *RedisAttemptRepository) AddAttempt(key string, window time.Duration) (int, error) {
+	count, err := redis.IncrAttempts(key, window)
+	return int(count), err
+}
+
+// Lockout key 剩余的锁定时间
+func (r *RedisAttemptRepository) Lockout(key string) (time.Duration, error) {
+	return redis.GetLockout(key)
+}
+
+// SetLockout 锁定 key 一段时间
+func (r *RedisAttemptRepository) SetLockout(key string, duration time.Duration) error {
+	return redis.SetLockout(key, duration)
+}
+
+// ResetAttempts 清空失败次数和锁定
+func (r *RedisAttemptRepository) ResetAttempts(key string) error {
+	return redis.ResetAttempts(key)
+}
+
+// RedisOIDCStateRepository 使用 Redis 保存 OIDC 登录流程的状态（需要先调用 redis.InitRedis）
+//
+// 回调可以由集群中的任意实例处理。
+type RedisOIDCStateRepository struct{}
+
+// NewRedisOIDCStateRepository 创建使用 Redis 的 OIDC 登录流程状态存储
+func NewRedisOIDCStateRepository() *RedisOIDCStateRepository {
+	return &RedisOIDCStateRepository{}
+}
+
+// SaveOIDCState 保存登录流程的状态
+func (r *RedisOIDCStateRepository) SaveOIDCState(state string, data *OIDCLoginState, ttl time.Duration) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return redis.SetOIDCState(state, encoded, ttl)
+}
+
+// TakeOIDCState 取出并删除登录流程的状态
+func (r *RedisOIDCStateRepository) TakeOIDCState(state string) (*OIDCLoginState, error) {
+	encoded, err := redis.TakeOIDCState(state)
+	if errors.Is(err, redis.ErrOIDCStateNotFound) {
+		return nil, ErrOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data OIDCLoginState
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode oidc state: %w", err)
+	}
+	if time.Now().After(data.ExpiresAt) {
+		return nil, ErrOIDCState
+	}
+	return &data, nil
+}
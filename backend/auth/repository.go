@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/chenhailong/hong3/models"
+)
+
+// UserRepository 用户和外部身份的存储
+//
+// 查询不到用户时返回 ErrUserNotFound，查询不到外部身份时返回 ErrIdentityNotFound，
+// 用户名已被占用时返回 ErrUserExists。已注销（软删除）的用户查询不到。
+type UserRepository interface {
+	GetUser(id string) (*models.User, error)
+	GetUserByUsername(username string) (*models.User, error)
+	CreateUser(user *models.User) error
+
+	// UpdateUser 保存用户的名称、密码和角色
+	UpdateUser(user *models.User) error
+
+	// DeleteUser 匿名化并软删除用户，同时删除其外部身份
+	DeleteUser(id string) error
+
+	ListIdentities(userID string) ([]models.Identity, error)
+	GetIdentity(issuer, subject string) (*models.Identity, error)
+
+	// UpdateIdentity 保存外部身份的邮箱
+	UpdateIdentity(identity *models.Identity) error
+
+	// CreateIdentity 创建外部身份；newUser 不为 nil 时在同一事务中先创建该用户，
+	// 并把外部身份关联到新用户
+	CreateIdentity(identity *models.Identity, newUser *models.User) error
+}
+
+// GameSnapshotRepository 停机时保存的未结束游戏和比赛，下次启动时据此恢复比赛和房间
+type GameSnapshotRepository interface {
+	SaveSnapshots(snapshots []models.GameSnapshot) error
+
+	// ListSnapshots 所有保存的快照，按保存时间排序
+	ListSnapshots() ([]models.GameSnapshot, error)
+
+	DeleteSnapshots(ids []string) error
+
+	// ListPlayerSnapshots 包含该玩家的快照，按保存时间排序
+	ListPlayerSnapshots(playerID string) ([]models.GameSnapshot, error)
+
+	SaveTournamentSnapshots(snapshots []models.TournamentSnapshot) error
+
+	// TakeTournamentSnapshots 取出并删除所有保存的比赛快照，多个实例同时启动时每个快照只会被一个实例取出
+	TakeTournamentSnapshots() ([]models.TournamentSnapshot, error)
+
+	// ListPlayerTournamentSnapshots 包含该玩家的比赛快照，按保存时间排序
+	ListPlayerTournamentSnapshots(playerID string) ([]models.TournamentSnapshot, error)
+
+	// AnonymizePlayer 把包含该玩家的游戏和比赛快照中的玩家名称替换为已注销用户（注销账号时调用）
+	AnonymizePlayer(playerID string) error
+}
+
+// TokenData 登录 token 对应的会话
+type TokenData struct {
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TokenRepository 登录 token 的存储
+//
+// token 在 ttl 之后自动失效；查询不到 token 时返回 ErrInvalidToken。
+type TokenRepository interface {
+	SaveToken(token string, data *TokenData, ttl time.Duration) error
+	GetToken(token string) (*TokenData, error)
+	DeleteToken(token string) error
+
+	// ListUserTokens 用户所有仍然有效的 token，key 为 token
+	ListUserTokens(userID string) (map[string]*TokenData, error)
+
+	// DeleteUserTokens 删除用户的所有 token，except 不为空时保留该 token
+	DeleteUserTokens(userID, except string) error
+}
+
+// AttemptRepository 登录和注册的失败计数与锁定
+//
+// 多个实例共享同一份计数时，攻击者无法通过轮换实例绕过限制。
+type AttemptRepository interface {
+	// AddAttempt 失败次数加一并返回当前次数，计数从第一次失败开始在 window 内有效
+	AddAttempt(key string, window time.Duration) (int, error)
+
+	// Lockout key 剩余的锁定时间，未锁定时返回 0
+	Lockout(key string) (time.Duration, error)
+
+	SetLockout(key string, duration time.Duration) error
+
+	// ResetAttempts 清空失败次数和锁定
+	ResetAttempts(key string) error
+}
+
+// OIDCLoginState 单次 OIDC 登录流程的状态
+type OIDCLoginState struct {
+	CodeVerifier string    `json:"code_verifier"`
+	Nonce        string    `json:"nonce"`
+	LinkUserID   string    `json:"link_user_id,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// OIDCStateRepository 进行中的 OIDC 登录流程，key 为 state
+//
+// 回调可能到达集群中的其他实例，多实例部署时需要共享存储。
+// 每个状态只能取出一次；不存在或已过期时返回 ErrOIDCState。
+type OIDCStateRepository interface {
+	SaveOIDCState(state string, data *OIDCLoginState, ttl time.Duration) error
+	TakeOIDCState(state string) (*OIDCLoginState, error)
+}
+
+// Repositories 用户存储依赖的各类存储
+type Repositories struct {
+	Users      UserRepository
+	Tokens     TokenRepository
+	Attempts   AttemptRepository
+	OIDCStates OIDCStateRepository
+	Snapshots  GameSnapshotRepository
+}
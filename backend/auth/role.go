@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"github.com/chenhailong/hong3/logging"
+	"github.com/chenhailong/hong3/models"
+)
+
+// SetRole 修改用户角色
+func (s *UserStore) SetRole(userID, role string) (*models.User, error) {
+	if !models.ValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	user, err := s.users.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Role = role
+	if err := s.users.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// SetRoleByUsername 根据用户名修改用户角色
+func (s *UserStore) SetRoleByUsername(username, role string) (*models.User, error) {
+	user, err := s.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	return s.SetRole(user.ID, role)
+}
+
+// SeedAdmin 确保指定用户是管理员
+// 用户不存在且提供了密码时创建该用户
+func (s *UserStore) SeedAdmin(username, password string) error {
+	user, err := s.GetUserByUsername(username)
+	if err == ErrUserNotFound {
+		if password == "" {
+			return ErrUserNotFound
+		}
+		user, err = s.Register(username, password, username)
+		if err != nil {
+			return err
+		}
+		s.logger.Info("Created admin user", "username", username)
+	} else if err != nil {
+		return err
+	}
+
+	if user.Role == models.RoleAdmin {
+		return nil
+	}
+
+	if _, err := s.SetRole(user.ID, models.RoleAdmin); err != nil {
+		return err
+	}
+	s.logger.Info("Granted admin role", "username", username, logging.KeyUserID, user.ID)
+	return nil
+}
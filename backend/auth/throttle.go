@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/chenhailong/hong3/logging"
+)
+
+const (
+	// attemptWindow 失败次数的统计窗口
+	attemptWindow = 15 * time.Minute
+
+	// baseLockout 超过免费次数后的首次锁定时间，之后每次失败翻倍
+	baseLockout = 30 * time.Second
+
+	// maxLockout 最长锁定时间
+	maxLockout = 15 * time.Minute
+
+	// 窗口内允许的失败次数（同一 IP 可能是整个办公室，所以更宽松）
+	loginUserFreeAttempts = 5
+	loginIPFreeAttempts   = 20
+	registerFreeAttempts  = 10
+)
+
+// Throttle 登录和注册的防暴力破解限制
+// 计数保存在 AttemptRepository 中，存储出错时退回到进程内存计数
+type Throttle struct {
+	attempts AttemptRepository
+	fallback *MemoryAttemptRepository
+}
+
+// newThrottle 创建使用 attempts 计数的限制器
+func newThrottle(attempts AttemptRepository) *Throttle {
+	return &Throttle{attempts: attempts, fallback: NewMemoryAttemptRepository()}
+}
+
+// CheckLogin 检查登录是否被锁定，返回需要等待的时间（0 表示可以尝试）
+func (t *Throttle) CheckLogin(ctx context.Context, ip, username string) time.Duration {
+	return maxDuration(t.lockout(ctx, loginIPKey(ip)), t.lockout(ctx, loginUserKey(username)))
+}
+
+// LoginFailed 记录一次登录失败，返回新的锁定时间
+func (t *Throttle) LoginFailed(ctx context.Context, ip, username string) time.Duration {
+	wait := maxDuration(
+		t.fail(ctx, loginIPKey(ip), loginIPFreeAttempts),
+		t.fail(ctx, loginUserKey(username), loginUserFreeAttempts),
+	)
+	if wait > 0 {
+		Audit(ctx, AuditLockout, "ip", ip, "username", username, "retry_after", int(wait.Seconds()))
+	}
+	return wait
+}
+
+// LoginSucceeded 登录成功后清空该用户的失败计数
+func (t *Throttle) LoginSucceeded(ctx context.Context, ip, username string) {
+	t.reset(ctx, loginUserKey(username))
+}
+
+// CheckRegister 检查注册是否被限制
+func (t *Throttle) CheckRegister(ctx context.Context, ip string) time.Duration {
+	return t.lockout(ctx, registerIPKey(ip))
+}
+
+// RegisterAttempted 记录一次注册尝试（无论成败都计数，防止批量探测用户名）
+func (t *Throttle) RegisterAttempted(ctx context.Context, ip string) time.Duration {
+	return t.fail(ctx, registerIPKey(ip), registerFreeAttempts)
+}
+
+// lockout 获取 key 剩余的锁定时间
+func (t *Throttle) lockout(ctx context.Context, key string) time.Duration {
+	wait, err := t.attempts.Lockout(key)
+	if err != nil {
+		logging.FromContext(ctx).Warn("读取锁定状态失败，使用内存计数", "error", err)
+		wait, _ = t.fallback.Lockout(key)
+	}
+	return wait
+}
+
+// fail 记录一次失败，超过免费次数后按指数退避锁定
+func (t *Throttle) fail(ctx context.Context, key string, freeAttempts int) time.Duration {
+	attempts := t.attempts
+	count, err := attempts.AddAttempt(key, attemptWindow)
+	if err != nil {
+		logging.FromContext(ctx).Warn("记录失败次数失败，使用内存计数", "error", err)
+		attempts = t.fallback
+		count, _ = attempts.AddAttempt(key, attemptWindow)
+	}
+
+	wait := lockoutFor(count, freeAttempts)
+	if wait > 0 {
+		if err := attempts.SetLockout(key, wait); err != nil {
+			logging.FromContext(ctx).Warn("设置锁定失败", "error", err)
+		}
+	}
+	return wait
+}
+
+// reset 清空计数
+func (t *Throttle) reset(ctx context.Context, key string) {
+	if err := t.attempts.ResetAttempts(key); err != nil {
+		logging.FromContext(ctx).Warn("清空失败次数失败", "error", err)
+	}
+	t.fallback.ResetAttempts(key)
+}
+
+// lockoutFor 根据失败次数计算锁定时间
+func lockoutFor(count, freeAttempts int) time.Duration {
+	over := count - freeAttempts
+	if over <= 0 {
+		return 0
+	}
+	if over > 16 {
+		return maxLockout
+	}
+	wait := baseLockout << (over - 1)
+	if wait > maxLockout {
+		wait = maxLockout
+	}
+	return wait
+}
+
+func loginIPKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+func loginUserKey(username string) string {
+	return "login:user:" + strings.ToLower(username)
+}
+
+func registerIPKey(ip string) string {
+	return "register:ip:" + ip
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
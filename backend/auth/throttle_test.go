@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/chenhailong/hong3/logging"
+)
+
+// quietContext 不输出审计和警告日志的 context
+func quietContext() context.Context {
+	return logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestLockoutFor(t *testing.T) {
+	tests := []struct {
+		count int
+		want  time.Duration
+	}{
+		{0, 0},
+		{5, 0},
+		{6, baseLockout},
+		{7, 2 * baseLockout},
+		{8, 4 * baseLockout},
+		{10, 16 * baseLockout},
+		{11, maxLockout}, // 32 倍超过上限
+		{21, maxLockout},
+		{22, maxLockout}, // 不会因移位溢出
+		{1000, maxLockout},
+	}
+	for _, tt := range tests {
+		if got := lockoutFor(tt.count, loginUserFreeAttempts); got != tt.want {
+			t.Errorf("lockoutFor(%d, %d) = %v, want %v", tt.count, loginUserFreeAttempts, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryAttemptWindow(t *testing.T) {
+	attempts := NewMemoryAttemptRepository()
+	window := 20 * time.Millisecond
+
+	for want := 1; want <= 3; want++ {
+		if count, _ := attempts.AddAttempt("key", window); count != want {
+			t.Fatalf("attempt %d counted as %d", want, count)
+		}
+	}
+	attempts.SetLockout("key", time.Hour)
+
+	// 窗口过后重新计数，锁定仍然保留
+	time.Sleep(2 * window)
+	if count, _ := attempts.AddAttempt("key", window); count != 1 {
+		t.Errorf("attempt after the window counted as %d, want 1", count)
+	}
+	if wait, _ := attempts.Lockout("key"); wait <= 0 {
+		t.Error("lockout cleared with the window")
+	}
+
+	attempts.ResetAttempts("key")
+	if wait, _ := attempts.Lockout("key"); wait != 0 {
+		t.Errorf("lockout %v after reset, want 0", wait)
+	}
+	if count, _ := attempts.AddAttempt("key", window); count != 1 {
+		t.Errorf("attempt after reset counted as %d, want 1", count)
+	}
+}
+
+func TestThrottleLogin(t *testing.T) {
+	ctx := quietContext()
+	throttle := newThrottle(NewMemoryAttemptRepository())
+
+	for i := 1; i <= loginUserFreeAttempts; i++ {
+		if wait := throttle.LoginFailed(ctx, "10.0.0.1", "alice"); wait != 0 {
+			t.Fatalf("failure %d locked for %v, want free", i, wait)
+		}
+	}
+	if wait := throttle.CheckLogin(ctx, "10.0.0.1", "alice"); wait != 0 {
+		t.Fatalf("locked for %v within the free attempts", wait)
+	}
+
+	// 之后每次失败锁定时间翻倍
+	for _, want := range []time.Duration{baseLockout, 2 * baseLockout, 4 * baseLockout} {
+		if wait := throttle.LoginFailed(ctx, "10.0.0.1", "alice"); wait != want {
+			t.Fatalf("lockout %v, want %v", wait, want)
+		}
+	}
+	if wait := throttle.CheckLogin(ctx, "10.0.0.2", "ALICE"); wait <= 2*baseLockout {
+		t.Errorf("check from another IP with a different case: %v, want the user lockout", wait)
+	}
+	// 同一 IP 的其他用户有更多的免费次数
+	if wait := throttle.CheckLogin(ctx, "10.0.0.1", "bob"); wait != 0 {
+		t.Errorf("other user locked for %v", wait)
+	}
+
+	// 登录成功清空用户的计数，重新获得免费次数
+	throttle.LoginSucceeded(ctx, "10.0.0.1", "alice")
+	if wait := throttle.CheckLogin(ctx, "10.0.0.3", "alice"); wait != 0 {
+		t.Errorf("locked for %v after a successful login", wait)
+	}
+	if wait := throttle.LoginFailed(ctx, "10.0.0.3", "alice"); wait != 0 {
+		t.Errorf("first failure after success locked for %v", wait)
+	}
+}
+
+func TestThrottleLoginIP(t *testing.T) {
+	ctx := quietContext()
+	throttle := newThrottle(NewMemoryAttemptRepository())
+
+	// 每个用户名都在免费次数内，但同一 IP 的失败合计超过上限
+	var wait time.Duration
+	for i := 0; i <= loginIPFreeAttempts; i++ {
+		wait = throttle.LoginFailed(ctx, "10.0.0.1", string(rune('a'+i)))
+	}
+	if wait != baseLockout {
+		t.Errorf("IP lockout %v, want %v", wait, baseLockout)
+	}
+	if wait := throttle.CheckLogin(ctx, "10.0.0.1", "new-user"); wait <= 0 {
+		t.Error("locked IP can try another user")
+	}
+	// IP 的计数不因某个用户登录成功而清空
+	throttle.LoginSucceeded(ctx, "10.0.0.1", "a")
+	if wait := throttle.CheckLogin(ctx, "10.0.0.1", "a"); wait <= 0 {
+		t.Error("IP lockout cleared by a successful login")
+	}
+}
+
+func TestThrottleRegister(t *testing.T) {
+	ctx := quietContext()
+	throttle := newThrottle(NewMemoryAttemptRepository())
+
+	for i := 1; i <= registerFreeAttempts; i++ {
+		if wait := throttle.RegisterAttempted(ctx, "10.0.0.1"); wait != 0 {
+			t.Fatalf("registration %d limited for %v", i, wait)
+		}
+	}
+	if wait := throttle.RegisterAttempted(ctx, "10.0.0.1"); wait != baseLockout {
+		t.Errorf("limit %v, want %v", wait, baseLockout)
+	}
+	if wait := throttle.CheckRegister(ctx, "10.0.0.1"); wait <= 0 {
+		t.Error("registration not limited")
+	}
+	if wait := throttle.CheckRegister(ctx, "10.0.0.2"); wait != 0 {
+		t.Errorf("other IP limited for %v", wait)
+	}
+}
+
+// brokenAttempts 总是出错的计数存储（例如 Redis 不可用）
+type brokenAttempts struct{}
+
+var errBroken = errors.New("storage unavailable")
+
+func (brokenAttempts) AddAttempt(string, time.Duration) (int, error) { return 0, errBroken }
+func (brokenAttempts) Lockout(string) (time.Duration, error)         { return 0, errBroken }
+func (brokenAttempts) SetLockout(string, time.Duration) error        { return errBroken }
+func (brokenAttempts) ResetAttempts(string) error                    { return errBroken }
+
+func TestThrottleFallback(t *testing.T) {
+	ctx := quietContext()
+	throttle := newThrottle(brokenAttempts{})
+
+	// 存储出错时在内存中计数，仍然能锁定
+	for i := 0; i < loginUserFreeAttempts; i++ {
+		throttle.LoginFailed(ctx, "10.0.0.1", "alice")
+	}
+	if wait := throttle.LoginFailed(ctx, "10.0.0.1", "alice"); wait != baseLockout {
+		t.Fatalf("lockout %v with a broken store, want %v", wait, baseLockout)
+	}
+	if wait := throttle.CheckLogin(ctx, "10.0.0.1", "alice"); wait <= 0 {
+		t.Error("fallback lockout not enforced")
+	}
+
+	throttle.LoginSucceeded(ctx, "10.0.0.1", "alice")
+	if wait := throttle.CheckLogin(ctx, "10.0.0.2", "alice"); wait != 0 {
+		t.Errorf("fallback lockout %v after a successful login, want 0", wait)
+	}
+}
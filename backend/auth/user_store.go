@@ -5,50 +5,65 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"time"
 
-	"github.com/chenhailong/hong3/db"
+	"github.com/chenhailong/hong3/logging"
 	"github.com/chenhailong/hong3/models"
-	"github.com/chenhailong/hong3/redis"
 )
 
-// UserStore 用户存储（使用 GORM + Redis）
+// UserStore 用户注册、登录和会话管理
+//
+// 用户保存在 UserRepository 中，登录 token 保存在 TokenRepository 中，
+// 失败计数和 OIDC 登录流程分别保存在 AttemptRepository 和 OIDCStateRepository 中。
+// 注销账号和导出数据时还会处理 GameSnapshotRepository 中包含该用户的游戏快照。
 type UserStore struct {
+	users      UserRepository
+	tokens     TokenRepository
+	oidcStates OIDCStateRepository
+	snapshots  GameSnapshotRepository
+	throttle   *Throttle
+	logger     *slog.Logger
+
+	// 登录 token 的有效期
+	tokenTTL time.Duration
 }
 
-var defaultStore *UserStore
+// authLogger 认证相关日志（限流、OIDC 等）
+var authLogger = slog.Default()
 
-// InitStore 初始化用户存储
-func InitStore() {
-	defaultStore = &UserStore{}
+// SetLogger 设置认证相关的日志记录器
+func SetLogger(logger *slog.Logger) {
+	authLogger = logging.OrDefault(logger).With("component", "auth")
 }
 
-// GetStore 获取默认的用户存储
-func GetStore() *UserStore {
-	if defaultStore == nil {
-		InitStore()
+// NewUserStore 创建用户存储，tokenTTL 为登录 token 的有效期
+func NewUserStore(repos Repositories, tokenTTL time.Duration, logger *slog.Logger) *UserStore {
+	return &UserStore{
+		users:      repos.Users,
+		tokens:     repos.Tokens,
+		oidcStates: repos.OIDCStates,
+		snapshots:  repos.Snapshots,
+		throttle:   newThrottle(repos.Attempts),
+		logger:     logging.OrDefault(logger).With("component", "auth"),
+		tokenTTL:   tokenTTL,
 	}
-	return defaultStore
+}
+
+// Throttle 登录和注册的防暴力破解限制
+func (s *UserStore) Throttle() *Throttle {
+	return s.throttle
 }
 
 // Register 注册新用户
 func (s *UserStore) Register(username, password, name string) (*models.User, error) {
-	// 检查用户名是否已存在
-	var existingUser models.User
-	result := db.DB.Where("username = ?", username).First(&existingUser)
-	if result.Error == nil {
-		// 用户已存在
-		return nil, ErrUserExists
-	}
-
-	// 创建新用户
 	user := &models.User{
 		Username: username,
 		Password: hashPassword(password),
 		Name:     name,
 	}
 
-	if err := db.DB.Create(user).Error; err != nil {
+	if err := s.users.CreateUser(user); err != nil {
 		return nil, err
 	}
 
@@ -58,10 +73,11 @@ func (s *UserStore) Register(username, password, name string) (*models.User, err
 // Login 登录
 func (s *UserStore) Login(username, password string) (*models.User, string, error) {
 	// 查找用户
-	var user models.User
-	result := db.DB.Where("username = ?", username).First(&user)
-	if result.Error != nil {
+	user, err := s.users.GetUserByUsername(username)
+	if err == ErrUserNotFound {
 		return nil, "", ErrInvalidCredentials
+	} else if err != nil {
+		return nil, "", err
 	}
 
 	// 验证密码
@@ -69,29 +85,35 @@ func (s *UserStore) Login(username, password string) (*models.User, string, erro
 		return nil, "", ErrInvalidCredentials
 	}
 
+	token, err := s.IssueToken(user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return user, token, nil
+}
+
+// IssueToken 为用户签发登录 token
+func (s *UserStore) IssueToken(user *models.User) (string, error) {
 	// 生成 token
 	token := generateID()
-	expiresAt := time.Now().Add(7 * 24 * time.Hour) // 7天过期
-	expiration := 7 * 24 * time.Hour
 
-	// 存储 token 到 Redis
-	tokenData := &redis.TokenData{
+	tokenData := &TokenData{
 		UserID:    user.ID,
 		Username:  user.Username,
-		ExpiresAt: expiresAt,
+		ExpiresAt: time.Now().Add(s.tokenTTL),
 	}
 
-	if err := redis.SetToken(token, tokenData, expiration); err != nil {
-		return nil, "", fmt.Errorf("failed to save token: %w", err)
+	if err := s.tokens.SaveToken(token, tokenData, s.tokenTTL); err != nil {
+		return "", fmt.Errorf("failed to save token: %w", err)
 	}
 
-	return &user, token, nil
+	return token, nil
 }
 
 // ValidateToken 验证token
 func (s *UserStore) ValidateToken(token string) (*models.User, error) {
-	// 从 Redis 获取 token 数据
-	tokenData, err := redis.GetToken(token)
+	tokenData, err := s.tokens.GetToken(token)
 	if err != nil {
 		return nil, ErrInvalidToken
 	}
@@ -99,29 +121,22 @@ func (s *UserStore) ValidateToken(token string) (*models.User, error) {
 	// 检查 token 是否过期
 	if time.Now().After(tokenData.ExpiresAt) {
 		// 删除过期的 token
-		redis.DeleteToken(token)
+		s.tokens.DeleteToken(token)
 		return nil, ErrTokenExpired
 	}
 
 	// 查找用户
-	var user models.User
-	result := db.DB.Where("id = ?", tokenData.UserID).First(&user)
-	if result.Error != nil {
+	user, err := s.users.GetUser(tokenData.UserID)
+	if err != nil {
 		return nil, ErrUserNotFound
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 // GetUserByUsername 根据用户名获取用户
 func (s *UserStore) GetUserByUsername(username string) (*models.User, error) {
-	var user models.User
-	result := db.DB.Where("username = ?", username).First(&user)
-	if result.Error != nil {
-		return nil, ErrUserNotFound
-	}
-
-	return &user, nil
+	return s.users.GetUserByUsername(username)
 }
 
 // hashPassword 简单的密码哈希（生产环境应该使用bcrypt）
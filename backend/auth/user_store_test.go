@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenhailong/hong3/models"
+)
+
+// newTestStore 使用内存存储的 UserStore
+func newTestStore(t *testing.T) (*UserStore, *MemoryUserRepository) {
+	t.Helper()
+	users := NewMemoryUserRepository()
+	store := NewUserStore(Repositories{
+		Users:      users,
+		Tokens:     NewMemoryTokenRepository(),
+		Attempts:   NewMemoryAttemptRepository(),
+		OIDCStates: NewMemoryOIDCStateRepository(),
+		Snapshots:  NewMemoryGameSnapshotRepository(),
+	}, time.Hour, nil)
+	return store, users
+}
+
+// login 登录并返回 token
+func login(t *testing.T, store *UserStore, username, password string) string {
+	t.Helper()
+	_, token, err := store.Login(username, password)
+	if err != nil {
+		t.Fatalf("login %s: %v", username, err)
+	}
+	return token
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	store, _ := newTestStore(t)
+
+	user, err := store.Register("alice", "password123", "Alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == "" || user.Password == "password123" {
+		t.Fatalf("registered user %+v, want an ID and a hashed password", user)
+	}
+	if _, err := store.Register("alice", "other", "Other"); err != ErrUserExists {
+		t.Errorf("registering a taken username: %v, want ErrUserExists", err)
+	}
+
+	if _, _, err := store.Login("alice", "wrong"); err != ErrInvalidCredentials {
+		t.Errorf("wrong password: %v, want ErrInvalidCredentials", err)
+	}
+	if _, _, err := store.Login("nobody", "password123"); err != ErrInvalidCredentials {
+		t.Errorf("unknown user: %v, want ErrInvalidCredentials", err)
+	}
+
+	token := login(t, store, "alice", "password123")
+	validated, err := store.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validated.ID != user.ID {
+		t.Errorf("token user %s, want %s", validated.ID, user.ID)
+	}
+	if _, err := store.ValidateToken("unknown"); err != ErrInvalidToken {
+		t.Errorf("unknown token: %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	store, _ := newTestStore(t)
+	user, err := store.Register("bob", "password123", "Bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := login(t, store, "bob", "password123")
+	other := login(t, store, "bob", "password123")
+
+	if err := store.ChangePassword(user.ID, "wrong", "newpassword", current); err != ErrInvalidCredentials {
+		t.Fatalf("wrong old password: %v, want ErrInvalidCredentials", err)
+	}
+	if err := store.ChangePassword(user.ID, "password123", "", current); err != ErrInvalidPassword {
+		t.Fatalf("empty new password: %v, want ErrInvalidPassword", err)
+	}
+	if _, err := store.ValidateToken(other); err != nil {
+		t.Fatalf("failed password change revoked a session: %v", err)
+	}
+
+	if err := store.ChangePassword(user.ID, "password123", "newpassword", current); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ValidateToken(current); err != nil {
+		t.Errorf("current session revoked: %v", err)
+	}
+	if _, err := store.ValidateToken(other); err != ErrInvalidToken {
+		t.Errorf("other session: %v, want ErrInvalidToken", err)
+	}
+	if _, _, err := store.Login("bob", "password123"); err != ErrInvalidCredentials {
+		t.Errorf("login with the old password: %v, want ErrInvalidCredentials", err)
+	}
+	login(t, store, "bob", "newpassword")
+}
+
+func TestDeleteAccountAnonymizes(t *testing.T) {
+	store, users := newTestStore(t)
+	user, err := store.Register("carol", "password123", "Carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := login(t, store, "carol", "password123")
+	if _, _, err := store.LoginWithIdentity(&ExternalIdentity{Issuer: "https://idp.test", Subject: "carol"}, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.DeleteAccount(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ValidateToken(token); err != ErrInvalidToken {
+		t.Errorf("session after deletion: %v, want ErrInvalidToken", err)
+	}
+	if _, _, err := store.Login("carol", "password123"); err != ErrInvalidCredentials {
+		t.Errorf("login after deletion: %v, want ErrInvalidCredentials", err)
+	}
+	if err := store.DeleteAccount(user.ID); err != ErrUserNotFound {
+		t.Errorf("deleting twice: %v, want ErrUserNotFound", err)
+	}
+
+	// 记录保留 ID，但不再包含个人信息
+	stored := users.users[user.ID]
+	if stored == nil || !stored.DeletedAt.Valid {
+		t.Fatalf("deleted user %+v, want a soft-deleted record", stored)
+	}
+	if stored.Username == "carol" || stored.Name == "Carol" || stored.Password != "" {
+		t.Errorf("deleted user %+v still has personal data", stored)
+	}
+	if identities, _ := users.ListIdentities(user.ID); len(identities) != 0 {
+		t.Errorf("deleted user still has identities %+v", identities)
+	}
+
+	// 用户名可以重新注册，外部身份登录得到新用户
+	if _, err := store.Register("carol", "password123", "Carol"); err != nil {
+		t.Errorf("registering the freed username: %v", err)
+	}
+	again, _, err := store.LoginWithIdentity(&ExternalIdentity{Issuer: "https://idp.test", Subject: "carol"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID == user.ID {
+		t.Error("identity login returned the deleted user")
+	}
+}
+
+// snapshotState 两名玩家的房间快照（与 websocket 保存的格式相同）
+const snapshotState = `{"game":{"id":"g1","players":[{"id":"%s","name":"Frank","position":0},{"id":"guest","name":"Guest","position":1}]},"host":"%s"}`
+
+func TestDeleteAccountAnonymizesSnapshots(t *testing.T) {
+	store, _ := newTestStore(t)
+	user, err := store.Register("frank", "password123", "Frank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := login(t, store, "frank", "password123")
+
+	state := strings.ReplaceAll(snapshotState, "%s", user.ID)
+	if err := store.snapshots.SaveSnapshots([]models.GameSnapshot{
+		{RoomID: "r1", Status: "playing", State: state, Reason: "shutdown", Players: []models.GameSnapshotPlayer{{PlayerID: user.ID}, {PlayerID: "guest"}}},
+		{RoomID: "r2", Status: "playing", State: `{"game":{"players":[]}}`, Reason: "shutdown", Players: []models.GameSnapshotPlayer{{PlayerID: "guest"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := store.ExportUserData(user.ID, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(export.GameSnapshots) != 1 || export.GameSnapshots[0].RoomID != "r1" {
+		t.Fatalf("exported snapshots %+v, want only r1", export.GameSnapshots)
+	}
+
+	if err := store.DeleteAccount(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := store.snapshots.ListPlayerSnapshots(user.ID)
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("snapshots after deletion %+v (%v), want r1", snapshots, err)
+	}
+	got := snapshots[0].State
+	if strings.Contains(got, "Frank") || !strings.Contains(got, models.DeletedUserName) {
+		t.Errorf("snapshot state %s still has the player name", got)
+	}
+	// 保留玩家 ID 和其他玩家的信息，快照仍能恢复
+	if !strings.Contains(got, user.ID) || !strings.Contains(got, `"name":"Guest"`) {
+		t.Errorf("snapshot state %s lost other data", got)
+	}
+}
+
+func TestLoginWithIdentityLinks(t *testing.T) {
+	store, users := newTestStore(t)
+	owner, err := store.Register("dave", "password123", "Dave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext := &ExternalIdentity{Issuer: "https://idp.test", Subject: "dave-sub", Email: "dave@example.com", Name: "Dave OIDC"}
+
+	linked, token, err := store.LoginWithIdentity(ext, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked.ID != owner.ID {
+		t.Fatalf("linked user %s, want %s", linked.ID, owner.ID)
+	}
+	if validated, err := store.ValidateToken(token); err != nil || validated.ID != owner.ID {
+		t.Fatalf("identity login token user %+v (%v), want %s", validated, err, owner.ID)
+	}
+
+	// 之后不指定用户登录也进入关联的用户，邮箱随提供方更新
+	ext.Email = "dave@new.example.com"
+	user, _, err := store.LoginWithIdentity(ext, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != owner.ID {
+		t.Errorf("login after link user %s, want %s", user.ID, owner.ID)
+	}
+	if identity, _ := users.GetIdentity(ext.Issuer, ext.Subject); identity == nil || identity.Email != "dave@new.example.com" {
+		t.Errorf("identity %+v, want updated email", identity)
+	}
+
+	// 已关联的身份不能再关联到其他用户
+	other, err := store.Register("erin", "password123", "Erin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.LoginWithIdentity(ext, other.ID); err != ErrIdentityLinked {
+		t.Errorf("linking to another user: %v, want ErrIdentityLinked", err)
+	}
+
+	// 未关联的身份创建新用户
+	created, _, err := store.LoginWithIdentity(&ExternalIdentity{Issuer: "https://idp.test", Subject: "new-sub", PreferredUsername: "dave"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == owner.ID || created.Username == "dave" {
+		t.Errorf("new identity user %+v, want a new user with a free username", created)
+	}
+}
+
+func TestOIDCStateUsedOnce(t *testing.T) {
+	states := NewMemoryOIDCStateRepository()
+	data := &OIDCLoginState{Nonce: "nonce", ExpiresAt: time.Now().Add(time.Minute)}
+	if err := states.SaveOIDCState("state", data, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	taken, err := states.TakeOIDCState("state")
+	if err != nil || taken.Nonce != "nonce" {
+		t.Fatalf("take state: %+v, %v", taken, err)
+	}
+	if _, err := states.TakeOIDCState("state"); err != ErrOIDCState {
+		t.Errorf("second take: %v, want ErrOIDCState", err)
+	}
+
+	if err := states.SaveOIDCState("expired", data, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := states.TakeOIDCState("expired"); err != ErrOIDCState {
+		t.Errorf("expired state: %v, want ErrOIDCState", err)
+	}
+}
@@ -0,0 +1,28 @@
+// mockoidc 在本地启动一个模拟的 OIDC 身份提供方，便于不依赖公司身份系统调试 OIDC 登录
+//
+//	go run ./cmd/mockoidc -addr :9999
+//
+// 后端配置 OIDC_ISSUER=http://localhost:9999、OIDC_CLIENT_ID=hong3、OIDC_CLIENT_SECRET=secret 即可。
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/chenhailong/hong3/auth/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9999", "监听地址")
+	issuer := flag.String("issuer", "http://localhost:9999", "对外的 issuer 地址")
+	clientID := flag.String("client-id", "hong3", "客户端ID")
+	clientSecret := flag.String("client-secret", "secret", "客户端密钥")
+	flag.Parse()
+
+	provider := oidctest.New(*issuer, *clientID, *clientSecret)
+	log.Printf("Mock OIDC provider listening on %s (issuer: %s)", *addr, *issuer)
+	if err := http.ListenAndServe(*addr, provider); err != nil {
+		log.Fatalf("Failed to start mock OIDC provider: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+// protocolschema 生成 WebSocket 协议的 JSON Schema，供前端和机器人校验消息
+//
+//	go run ./cmd/protocolschema -o protocol/schema.json
+//
+// 通常通过 go generate ./protocol 调用。
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/chenhailong/hong3/protocol"
+)
+
+func main() {
+	output := flag.String("o", "", "输出文件（默认输出到标准输出）")
+	flag.Parse()
+
+	data, err := json.MarshalIndent(protocol.Schema(), "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to marshal schema: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		log.Fatalf("Failed to write schema: %v", err)
+	}
+}
@@ -2,80 +2,298 @@ package config
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
+	"time"
 )
 
 // Config 应用配置
+//
+// 字段的 json 标签是配置文件中的键名，env 标签是对应的环境变量，secret 标签标记
+// 打印配置时需要隐藏的字段。
 type Config struct {
-	Server   ServerConfig   `json:"server"`
-	Database DatabaseConfig `json:"database"`
-	Redis    RedisConfig    `json:"redis"`
+	Server    ServerConfig    `json:"server"`
+	TLS       TLSConfig       `json:"tls"`
+	CORS      CORSConfig      `json:"cors"`
+	Database  DatabaseConfig  `json:"database"`
+	Redis     RedisConfig     `json:"redis"`
+	Auth      AuthConfig      `json:"auth"`
+	OIDC      OIDCConfig      `json:"oidc"`
+	Admin     AdminConfig     `json:"admin"`
+	Metrics   MetricsConfig   `json:"metrics"`
+	Log       LogConfig       `json:"log"`
+	Cluster   ClusterConfig   `json:"cluster"`
+	WebSocket WebSocketConfig `json:"websocket"`
+	Game      GameConfig      `json:"game"`
+	REST      RESTConfig      `json:"rest"`
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Port string `json:"port"`
-	Host string `json:"host"`
+	Port                string        `json:"port" env:"PORT"`
+	Host                string        `json:"host" env:"HOST"`
+	ShutdownGracePeriod time.Duration `json:"shutdown_grace_period" env:"SHUTDOWN_GRACE_PERIOD"` // 停机时等待进行中游戏结束的最长时间
+	TrustedProxies      []string      `json:"trusted_proxies" env:"TRUSTED_PROXIES"`             // 可信的反向代理（IP 或 CIDR），只采用来自这些地址的 X-Forwarded-For；为空时使用连接的对端地址
 }
 
+// TLSConfig HTTPS 配置，同时设置证书和私钥时启用
+type TLSConfig struct {
+	CertFile       string        `json:"cert_file" env:"TLS_CERT_FILE"`             // PEM 格式的证书（可包含中间证书）
+	KeyFile        string        `json:"key_file" env:"TLS_KEY_FILE"`               // PEM 格式的私钥
+	ReloadInterval time.Duration `json:"reload_interval" env:"TLS_RELOAD_INTERVAL"` // 检查证书文件是否更新的间隔，更新后无需重启
+	RedirectAddr   string        `json:"redirect_addr" env:"TLS_REDIRECT_ADDR"`     // 把 HTTP 请求跳转到 HTTPS 的监听地址（如 :80），为空时不监听
+}
+
+// Enabled 是否启用 HTTPS
+func (c *TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// CORSConfig 跨域访问配置，REST 接口和 WebSocket 握手使用同一份来源白名单
+//
+// 与服务器同源的请求和不带 Origin 头的请求（非浏览器客户端）总是允许。
+type CORSConfig struct {
+	AllowedOrigins   []string      `json:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`     // 允许的来源，如 https://hong3.example.com；"*" 允许所有来源
+	AllowedMethods   []string      `json:"allowed_methods" env:"CORS_ALLOWED_METHODS"`     // 跨域请求允许的方法
+	AllowedHeaders   []string      `json:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`     // 跨域请求允许的请求头
+	AllowCredentials bool          `json:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"` // 是否允许携带 Cookie，不能与 "*" 同时使用
+	MaxAge           time.Duration `json:"max_age" env:"CORS_MAX_AGE"`                     // 浏览器缓存预检结果的时间
+	DevMode          bool          `json:"dev_mode" env:"CORS_DEV_MODE"`                   // 开发模式：额外允许 localhost 上任意端口的来源
+}
+
+// 数据库驱动
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 // DatabaseConfig 数据库配置
+//
+// 使用 PostgreSQL 时读取 host、port 等连接参数，使用 SQLite 时只读取 path。
 type DatabaseConfig struct {
-	Host     string `json:"host"`
-	Port     string `json:"port"`
-	User     string `json:"user"`
-	Password string `json:"password"`
-	Name     string `json:"name"`
-	SSLMode  string `json:"ssl_mode"`
+	Driver          string        `json:"driver" env:"DB_DRIVER"` // postgres 或 sqlite
+	Path            string        `json:"path" env:"DB_PATH"`     // SQLite 数据库文件，":memory:" 为内存数据库（重启后数据丢失）
+	Host            string        `json:"host" env:"DB_HOST"`
+	Port            string        `json:"port" env:"DB_PORT"`
+	User            string        `json:"user" env:"DB_USER"`
+	Password        string        `json:"password" env:"DB_PASSWORD" secret:"true"`
+	Name            string        `json:"name" env:"DB_NAME"`
+	SSLMode         string        `json:"ssl_mode" env:"DB_SSLMODE"`
+	MaxOpenConns    int           `json:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `json:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `json:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	AutoMigrate     bool          `json:"auto_migrate" env:"DB_AUTO_MIGRATE"` // 启动时执行未执行的数据库迁移，关闭后需要通过 migrate 子命令执行
 }
 
 // RedisConfig Redis 配置
 type RedisConfig struct {
-	Host     string `json:"host"`
-	Port     string `json:"port"`
-	Password string `json:"password"`
-	DB       int    `json:"db"`
-	Enabled  bool   `json:"enabled"`
+	Host     string `json:"host" env:"REDIS_HOST"`
+	Port     string `json:"port" env:"REDIS_PORT"`
+	Password string `json:"password" env:"REDIS_PASSWORD" secret:"true"`
+	DB       int    `json:"db" env:"REDIS_DB"`
+	Enabled  bool   `json:"enabled" env:"REDIS_ENABLED"`
+}
+
+// AuthConfig 登录配置
+type AuthConfig struct {
+	TokenTTL time.Duration `json:"token_ttl" env:"AUTH_TOKEN_TTL"` // 登录 token 的有效期
+}
+
+// OIDCConfig OpenID Connect 登录配置
+type OIDCConfig struct {
+	Enabled      bool   `json:"enabled" env:"OIDC_ENABLED"`
+	Issuer       string `json:"issuer" env:"OIDC_ISSUER"`
+	ClientID     string `json:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string `json:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true"`
+	RedirectURL  string `json:"redirect_url" env:"OIDC_REDIRECT_URL"`   // 身份提供方回调到后端的地址
+	FrontendURL  string `json:"frontend_url" env:"OIDC_FRONTEND_URL"`   // 登录成功后跳转的前端地址（为空则直接返回 JSON）
+	ProviderName string `json:"provider_name" env:"OIDC_PROVIDER_NAME"` // 展示给用户的身份提供方名称
+}
+
+// AdminConfig 初始管理员配置
+type AdminConfig struct {
+	Username string `json:"username" env:"ADMIN_USERNAME"`               // 启动时授予管理员角色的用户名
+	Password string `json:"password" env:"ADMIN_PASSWORD" secret:"true"` // 用户不存在时用于创建该用户
+}
+
+// MetricsConfig 监控指标配置
+type MetricsConfig struct {
+	Token string `json:"token" env:"METRICS_TOKEN" secret:"true"` // Prometheus 抓取 /metrics 使用的 Bearer token，为空时仅管理员可访问
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level       string `json:"level" env:"LOG_LEVEL"`               // debug、info、warn、error
+	Format      string `json:"format" env:"LOG_FORMAT"`             // text 或 json
+	RevealCards bool   `json:"reveal_cards" env:"LOG_REVEAL_CARDS"` // 是否在日志中输出牌面（默认隐藏）
+}
+
+// ClusterConfig 多实例部署配置
+type ClusterConfig struct {
+	Enabled    bool          `json:"enabled" env:"CLUSTER_ENABLED"`         // 是否启用多实例模式（需要 Redis）
+	InstanceID string        `json:"instance_id" env:"CLUSTER_INSTANCE_ID"` // 实例ID，默认使用主机名
+	LeaseTTL   time.Duration `json:"lease_ttl" env:"CLUSTER_LEASE_TTL"`     // 房间所有权租约时长，实例故障后房间在此时间后转移
+}
+
+// WebSocketConfig WebSocket 连接配置
+type WebSocketConfig struct {
+	MaxMessageSize int64         `json:"max_message_size" env:"WS_MAX_MESSAGE_SIZE"` // 客户端消息的最大字节数
+	WriteTimeout   time.Duration `json:"write_timeout" env:"WS_WRITE_TIMEOUT"`       // 写入一条消息的超时时间
+	PongTimeout    time.Duration `json:"pong_timeout" env:"WS_PONG_TIMEOUT"`         // 超过这个时间没有收到客户端的消息或 pong 时断开连接
+	PingInterval   time.Duration `json:"ping_interval" env:"WS_PING_INTERVAL"`       // 发送 ping 的间隔，必须小于 pong_timeout
+	SendQueueSize  int           `json:"send_queue_size" env:"WS_SEND_QUEUE_SIZE"`   // 发送队列最多积压的消息数
+	MaxSendLag     time.Duration `json:"max_send_lag" env:"WS_MAX_SEND_LAG"`         // 队列中的消息等待超过这个时间时断开连接
+}
+
+// GameConfig 房间和游戏配置
+//
+// 房间人数不在这里：红三的规则固定为四人一局（game.Game.Players），房间容量随之固定为 4。
+type GameConfig struct {
+	EventBufferSize int `json:"event_buffer_size" env:"GAME_EVENT_BUFFER_SIZE"` // 每个房间保留的最近事件数，用于断线补发
+	RecentActions   int `json:"recent_actions" env:"GAME_RECENT_ACTIONS"`       // 每位玩家记住的最近动作数，用于识别重复的动作
+}
+
+// RESTConfig 游戏 REST 接口的会话配置
+//
+// 通过 REST 接口玩游戏的用户在 Hub 中对应一个没有 WebSocket 连接的会话，
+// 服务器发给会话的消息保存在事件日志中，由长轮询或 Server-Sent Events 取走。
+type RESTConfig struct {
+	SessionIdleTimeout time.Duration `json:"session_idle_timeout" env:"REST_SESSION_IDLE_TIMEOUT"` // 超过这个时间没有请求时结束会话，与断开连接相同
+	EventLogSize       int           `json:"event_log_size" env:"REST_EVENT_LOG_SIZE"`             // 每个会话保留的最近事件数
+	MaxPollWait        time.Duration `json:"max_poll_wait" env:"REST_MAX_POLL_WAIT"`               // 长轮询等待新事件的最长时间
+	ReplyTimeout       time.Duration `json:"reply_timeout" env:"REST_REPLY_TIMEOUT"`               // 等待房间处理命令的最长时间
 }
 
 var AppConfig *Config
 
-// LoadConfig 从环境变量加载配置
-func LoadConfig() *Config {
-	config := &Config{
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"),
-			Host: getEnv("HOST", "0.0.0.0"),
+			Port:                "8080",
+			Host:                "0.0.0.0",
+			ShutdownGracePeriod: 60 * time.Second,
+		},
+		TLS: TLSConfig{
+			ReloadInterval: time.Minute,
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{
+				"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization",
+				"Accept", "Origin", "Cache-Control", "X-Requested-With", "X-Request-ID",
+			},
+			MaxAge: 10 * time.Minute,
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "postgres"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "postgres"),
-			Name:     getEnv("DB_NAME", "hong3"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			Driver:          DriverPostgres,
+			Path:            "hong3.db",
+			Host:            "postgres",
+			Port:            "5432",
+			User:            "postgres",
+			Password:        "postgres",
+			Name:            "hong3",
+			SSLMode:         "disable",
+			MaxOpenConns:    100,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: time.Hour,
+			AutoMigrate:     true,
 		},
 		Redis: RedisConfig{
-			Host:     getEnv("REDIS_HOST", "redis"),
-			Port:     getEnv("REDIS_PORT", "6379"),
-			Password: getEnv("REDIS_PASSWORD", ""), // Redis 默认无密码
-			DB:       getEnvAsInt("REDIS_DB", 0),
-			Enabled:  getEnvAsBool("REDIS_ENABLED", false),
+			Host: "redis",
+			Port: "6379",
+			// Redis 默认无密码
 		},
+		Auth: AuthConfig{
+			TokenTTL: 7 * 24 * time.Hour,
+		},
+		OIDC: OIDCConfig{
+			RedirectURL:  "http://localhost:8080/api/oidc/callback",
+			ProviderName: "OIDC",
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Cluster: ClusterConfig{
+			InstanceID: hostname(),
+			LeaseTTL:   15 * time.Second,
+		},
+		WebSocket: WebSocketConfig{
+			MaxMessageSize: 4096,
+			WriteTimeout:   10 * time.Second,
+			PongTimeout:    60 * time.Second,
+			PingInterval:   54 * time.Second,
+			SendQueueSize:  256,
+			MaxSendLag:     15 * time.Second,
+		},
+		Game: GameConfig{
+			EventBufferSize: 256,
+			RecentActions:   32,
+		},
+		REST: RESTConfig{
+			SessionIdleTimeout: 2 * time.Minute,
+			EventLogSize:       256,
+			MaxPollWait:        30 * time.Second,
+			ReplyTimeout:       5 * time.Second,
+		},
+	}
+}
+
+// LoadConfig 加载配置并校验
+//
+// 配置按以下顺序合并，后者覆盖前者：默认值、配置文件（YAML 或 TOML）、环境变量。
+// path 为空时使用环境变量 CONFIG_FILE 指定的文件，也没有指定时只读取环境变量。
+func LoadConfig(path string) (*Config, error) {
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+
+	config := Default()
+	if path != "" {
+		if err := config.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
 
 	AppConfig = config
-	logConfig(config)
-	return config
+	return config, nil
 }
 
 // GetDSN 获取数据库连接字符串
 func (c *DatabaseConfig) GetDSN() string {
+	if c.Driver == DriverSQLite {
+		// 等待其他连接的写锁，而不是立即返回 SQLITE_BUSY
+		dsn := c.Path + "?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+		if !c.InMemory() {
+			dsn += "&_pragma=journal_mode(WAL)"
+		}
+		return dsn
+	}
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		c.Host, c.Port, c.User, c.Password, c.Name, c.SSLMode)
 }
 
+// InMemory 是否使用 SQLite 内存数据库
+func (c *DatabaseConfig) InMemory() bool {
+	return c.Driver == DriverSQLite && c.Path == ":memory:"
+}
+
+// Summary 用于日志的数据库描述（不包含密码）
+func (c *DatabaseConfig) Summary() string {
+	if c.Driver == DriverSQLite {
+		return "sqlite:" + c.Path
+	}
+	return fmt.Sprintf("%s@%s:%s/%s", c.User, c.Host, c.Port, c.Name)
+}
+
 // GetRedisURL 获取 Redis 连接 URL
 func (c *RedisConfig) GetRedisURL() string {
 	if c.Password != "" {
@@ -89,52 +307,29 @@ func (c *ServerConfig) GetServerAddr() string {
 	return c.Host + ":" + c.Port
 }
 
-// getEnv 获取环境变量，如果不存在则返回默认值
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// hostname 获取主机名，失败时返回 "hong3"
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "hong3"
 	}
-	return value
+	return name
 }
 
-// getEnvAsInt 获取环境变量并转换为整数
-func getEnvAsInt(key string, defaultValue int) int {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-	intValue, err := strconv.Atoi(value)
-	if err != nil {
-		log.Printf("Warning: Invalid integer value for %s, using default: %d", key, defaultValue)
-		return defaultValue
-	}
-	return intValue
-}
-
-// getEnvAsBool 获取环境变量并转换为布尔值
-func getEnvAsBool(key string, defaultValue bool) bool {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-	boolValue, err := strconv.ParseBool(value)
-	if err != nil {
-		log.Printf("Warning: Invalid boolean value for %s, using default: %v", key, defaultValue)
-		return defaultValue
-	}
-	return boolValue
-}
-
-// logConfig 打印配置信息（不打印敏感信息）
-func logConfig(config *Config) {
-	log.Println("=== Application Configuration ===")
-	log.Printf("Server: %s:%s", config.Server.Host, config.Server.Port)
-	log.Printf("Database: %s@%s:%s/%s", config.Database.User, config.Database.Host, config.Database.Port, config.Database.Name)
-	if config.Redis.Enabled {
-		log.Printf("Redis: %s:%s (DB: %d)", config.Redis.Host, config.Redis.Port, config.Redis.DB)
-	} else {
-		log.Println("Redis: Disabled")
-	}
-	log.Println("=================================")
+// LogSummary 打印配置信息（不打印敏感信息）
+func (c *Config) LogSummary(logger *slog.Logger) {
+	logger.Info("application configuration",
+		"server", c.Server.GetServerAddr(),
+		"shutdown_grace_period", c.Server.ShutdownGracePeriod,
+		"tls_enabled", c.TLS.Enabled(),
+		"database", c.Database.Summary(),
+		"redis_enabled", c.Redis.Enabled,
+		"redis", fmt.Sprintf("%s:%s/%d", c.Redis.Host, c.Redis.Port, c.Redis.DB),
+		"oidc_enabled", c.OIDC.Enabled,
+		"oidc_issuer", c.OIDC.Issuer,
+		"log_level", c.Log.Level,
+		"log_format", c.Log.Format,
+		"cluster_enabled", c.Cluster.Enabled,
+		"cluster_instance_id", c.Cluster.InstanceID,
+	)
 }
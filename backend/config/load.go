@@ -0,0 +1,217 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// loadFile 读取配置文件，按扩展名识别 YAML（.yaml、.yml）或 TOML（.toml）
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	values := make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("%s: 不支持的配置文件格式 %q（支持 .yaml、.yml、.toml）", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: 解析失败: %w", path, err)
+	}
+
+	if err := applyMap(reflect.ValueOf(c).Elem(), values, ""); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// applyMap 把配置文件中的一节写入结构体，键名为字段的 json 标签
+func applyMap(v reflect.Value, values map[string]interface{}, prefix string) error {
+	fields := make(map[string]reflect.Value, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		fields[fieldKey(v.Type().Field(i))] = v.Field(i)
+	}
+
+	for key, raw := range values {
+		name := prefix + key
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("%s: 未知的配置项", name)
+		}
+
+		if field.Kind() == reflect.Struct && field.Type() != durationType {
+			section, ok := raw.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: 应为一节配置", name)
+			}
+			if err := applyMap(field, section, name+"."); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := setValue(field, raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// loadEnv 用已设置的环境变量覆盖配置，值为空的环境变量会被忽略
+func (c *Config) loadEnv() error {
+	return walkFields(reflect.ValueOf(c).Elem(), "", func(name string, field reflect.Value, f reflect.StructField) error {
+		key := f.Tag.Get("env")
+		if key == "" {
+			return nil
+		}
+		value := os.Getenv(key)
+		if value == "" {
+			return nil
+		}
+		if err := setValue(field, value); err != nil {
+			return fmt.Errorf("环境变量 %s: %w", key, err)
+		}
+		return nil
+	})
+}
+
+// walkFields 依次访问所有配置项，name 为配置项在配置文件中的完整键名
+func walkFields(v reflect.Value, prefix string, fn func(name string, field reflect.Value, f reflect.StructField) error) error {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		name := prefix + fieldKey(f)
+		if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+			if err := walkFields(v.Field(i), name+".", fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(name, v.Field(i), f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldKey 字段在配置文件中的键名
+func fieldKey(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// setValue 把配置文件或环境变量中的值写入字段
+//
+// 环境变量的值总是字符串，按字段类型解析；时间间隔必须带单位（如 30s、5m），
+// 列表在环境变量中用逗号分隔。
+func setValue(field reflect.Value, raw interface{}) error {
+	if field.Type() == durationType {
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("应为带单位的时间间隔（如 30s、5m），实际为 %v", raw)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("无效的时间间隔 %q（如 30s、5m）", s)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		switch v := raw.(type) {
+		case string:
+			field.SetString(v)
+		case int, int64, uint64, float64:
+			// 端口等字段在配置文件中可以写成数字
+			field.SetString(fmt.Sprint(v))
+		default:
+			return fmt.Errorf("应为字符串，实际为 %v", raw)
+		}
+
+	case reflect.Int, reflect.Int64:
+		var n int64
+		switch v := raw.(type) {
+		case int:
+			n = int64(v)
+		case int64:
+			n = v
+		case string:
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("无效的整数 %q", v)
+			}
+			n = parsed
+		default:
+			return fmt.Errorf("应为整数，实际为 %v", raw)
+		}
+		field.SetInt(n)
+
+	case reflect.Bool:
+		switch v := raw.(type) {
+		case bool:
+			field.SetBool(v)
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("无效的布尔值 %q（应为 true 或 false）", v)
+			}
+			field.SetBool(b)
+		default:
+			return fmt.Errorf("应为布尔值，实际为 %v", raw)
+		}
+
+	case reflect.Slice:
+		list, err := stringList(raw)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(list))
+
+	default:
+		return fmt.Errorf("不支持的配置类型 %s", field.Type())
+	}
+	return nil
+}
+
+// stringList 解析字符串列表：配置文件中的列表，或逗号分隔的字符串
+func stringList(raw interface{}) ([]string, error) {
+	list := make([]string, 0)
+	switch v := raw.(type) {
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("列表中应为字符串，实际为 %v", item)
+			}
+			list = append(list, s)
+		}
+	default:
+		return nil, fmt.Errorf("应为字符串列表，实际为 %v", raw)
+	}
+	return list, nil
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig 在临时目录中写入配置文件
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+server:
+  port: 9000
+  host: 127.0.0.1
+database:
+  driver: sqlite
+  path: /tmp/hong3.db
+websocket:
+  write_timeout: 5s
+cors:
+  allowed_origins: [https://a.example.com, https://b.example.com]
+`,
+		"config.toml": `
+[server]
+port = 9000
+host = "127.0.0.1"
+
+[database]
+driver = "sqlite"
+path = "/tmp/hong3.db"
+
+[websocket]
+write_timeout = "5s"
+
+[cors]
+allowed_origins = ["https://a.example.com", "https://b.example.com"]
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			// 环境变量覆盖配置文件，值为空的环境变量被忽略
+			t.Setenv("PORT", "9100")
+			t.Setenv("HOST", "")
+			t.Setenv("DB_PATH", "")
+			t.Setenv("WS_WRITE_TIMEOUT", "")
+			t.Setenv("CORS_ALLOWED_ORIGINS", "")
+			t.Setenv("GAME_RECENT_ACTIONS", "8")
+
+			cfg, err := LoadConfig(writeConfig(t, name, content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Port != "9100" {
+				t.Errorf("server.port %q, want 9100 from the environment", cfg.Server.Port)
+			}
+			if cfg.Server.Host != "127.0.0.1" || cfg.Database.Driver != DriverSQLite || cfg.Database.Path != "/tmp/hong3.db" {
+				t.Errorf("file values not applied: host %q driver %q path %q", cfg.Server.Host, cfg.Database.Driver, cfg.Database.Path)
+			}
+			if cfg.WebSocket.WriteTimeout != 5*time.Second {
+				t.Errorf("websocket.write_timeout %s, want 5s", cfg.WebSocket.WriteTimeout)
+			}
+			if want := []string{"https://a.example.com", "https://b.example.com"}; !slices.Equal(cfg.CORS.AllowedOrigins, want) {
+				t.Errorf("cors.allowed_origins %v, want %v", cfg.CORS.AllowedOrigins, want)
+			}
+			if cfg.Game.RecentActions != 8 {
+				t.Errorf("game.recent_actions %d, want 8 from the environment", cfg.Game.RecentActions)
+			}
+			// 没有设置的配置项保留默认值
+			if cfg.WebSocket.PongTimeout != Default().WebSocket.PongTimeout {
+				t.Errorf("websocket.pong_timeout %s, want the default", cfg.WebSocket.PongTimeout)
+			}
+		})
+	}
+}
+
+func TestLoadConfigEnvList(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", " https://a.example.com, ,https://b.example.com ")
+	cfg, err := LoadConfig(writeConfig(t, "config.yaml", "{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://a.example.com", "https://b.example.com"}; !slices.Equal(cfg.CORS.AllowedOrigins, want) {
+		t.Errorf("cors.allowed_origins %v, want %v", cfg.CORS.AllowedOrigins, want)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		env     map[string]string
+		want    string
+	}{
+		{"unknown key", "config.yaml", "server:\n  prot: 9000\n", nil, "server.prot: 未知的配置项"},
+		{"unknown section", "config.yaml", "servers: {}\n", nil, "servers: 未知的配置项"},
+		{"section is a value", "config.yaml", "server: 9000\n", nil, "server: 应为一节配置"},
+		{"duration without unit", "config.yaml", "auth:\n  token_ttl: 3600\n", nil, "auth.token_ttl: 应为带单位的时间间隔"},
+		{"invalid duration", "config.toml", "[auth]\ntoken_ttl = \"soon\"\n", nil, `auth.token_ttl: 无效的时间间隔 "soon"`},
+		{"string for int", "config.yaml", "redis:\n  db: [1]\n", nil, "redis.db: 应为整数"},
+		{"string for bool", "config.yaml", "redis:\n  enabled: 1\n", nil, "redis.enabled: 应为布尔值"},
+		{"list of numbers", "config.yaml", "cors:\n  allowed_origins: [1]\n", nil, "cors.allowed_origins: 列表中应为字符串"},
+		{"unsupported format", "config.json", "{}", nil, `不支持的配置文件格式 ".json"`},
+		{"invalid yaml", "config.yaml", "server: [\n", nil, "解析失败"},
+		{"env int", "config.yaml", "{}", map[string]string{"DB_MAX_OPEN_CONNS": "many"}, `环境变量 DB_MAX_OPEN_CONNS: 无效的整数 "many"`},
+		{"env bool", "config.yaml", "{}", map[string]string{"REDIS_ENABLED": "maybe"}, `环境变量 REDIS_ENABLED: 无效的布尔值 "maybe"`},
+		{"env duration", "config.yaml", "{}", map[string]string{"AUTH_TOKEN_TTL": "7"}, `环境变量 AUTH_TOKEN_TTL: 无效的时间间隔 "7"`},
+		{"invalid after merge", "config.yaml", "server:\n  port: 9000\n", map[string]string{"PORT": "0"}, `server.port: 无效的端口 "0"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := LoadConfig(writeConfig(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
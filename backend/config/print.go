@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maskedValue 打印配置时替代敏感字段的值
+const maskedValue = "******"
+
+// Print 以 YAML 格式输出配置，敏感字段（密码、密钥、token）会被隐藏
+//
+// 输出的内容可以直接作为配置文件使用（敏感字段需要重新填写）。
+func (c *Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(sectionNode(reflect.ValueOf(c).Elem())); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// sectionNode 把一节配置转换为 YAML 节点，保持字段顺序
+func sectionNode(v reflect.Value) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: fieldKey(f)}
+
+		var value *yaml.Node
+		switch {
+		case f.Type.Kind() == reflect.Struct && f.Type != durationType:
+			value = sectionNode(v.Field(i))
+		case f.Tag.Get("secret") == "true" && !v.Field(i).IsZero():
+			value = scalarNode(maskedValue)
+		case f.Type.Kind() == reflect.Slice:
+			value = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+			for j := 0; j < v.Field(i).Len(); j++ {
+				value.Content = append(value.Content, scalarNode(v.Field(i).Index(j).Interface()))
+			}
+		default:
+			value = scalarNode(v.Field(i).Interface())
+		}
+		node.Content = append(node.Content, key, value)
+	}
+	return node
+}
+
+// scalarNode 把配置项的值转换为 YAML 节点，字符串和时间间隔总是按字符串输出
+func scalarNode(value interface{}) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(value)}
+	switch value.(type) {
+	case bool:
+		node.Tag = "!!bool"
+	case int, int64:
+		node.Tag = "!!int"
+	default:
+		node.Tag = "!!str"
+		if node.Value == "" || strings.ContainsAny(node.Value, ":#") {
+			node.Style = yaml.DoubleQuotedStyle
+		}
+	}
+	return node
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// minMessageSize 客户端消息读取上限的最小值
+//
+// 原因、公告等文本最多 200 个字符，辅助平面的字符（如 emoji）转义为代理对时每个字符 12 字节，
+// 再加上消息的其他字段（最多 1024 字节）。与 protocol.MinMessageSize 相同（config 不能依赖 protocol），
+// 两者是否一致由 protocol 的测试检查。
+const minMessageSize = 200*12 + 1024
+
+// Validate 校验配置，返回所有不合法的配置项
+func (c *Config) Validate() error {
+	v := &validation{}
+
+	v.port("server.port", c.Server.Port)
+	v.notEmpty("server.host", c.Server.Host)
+	v.nonNegative("server.shutdown_grace_period", c.Server.ShutdownGracePeriod)
+	for _, proxy := range c.Server.TrustedProxies {
+		v.ipOrCIDR("server.trusted_proxies", proxy)
+	}
+
+	v.check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls", "cert_file 和 key_file 需要同时设置")
+	v.positive("tls.reload_interval", c.TLS.ReloadInterval)
+	if c.TLS.RedirectAddr != "" {
+		v.check(c.TLS.Enabled(), "tls.redirect_addr", "需要同时设置 cert_file 和 key_file")
+		_, port, err := net.SplitHostPort(c.TLS.RedirectAddr)
+		v.check(err == nil && port != "", "tls.redirect_addr", "无效的监听地址 %q（如 :80）", c.TLS.RedirectAddr)
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		v.origin("cors.allowed_origins", origin)
+		v.check(origin != "*" || !c.CORS.AllowCredentials, "cors.allow_credentials", "不能与允许所有来源（\"*\"）同时使用")
+	}
+	v.check(len(c.CORS.AllowedMethods) > 0, "cors.allowed_methods", "不能为空")
+	v.nonNegative("cors.max_age", c.CORS.MaxAge)
+
+	v.oneOf("database.driver", c.Database.Driver, DriverPostgres, DriverSQLite)
+	switch c.Database.Driver {
+	case DriverPostgres:
+		v.notEmpty("database.host", c.Database.Host)
+		v.port("database.port", c.Database.Port)
+		v.notEmpty("database.user", c.Database.User)
+		v.notEmpty("database.name", c.Database.Name)
+		v.oneOf("database.ssl_mode", c.Database.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	case DriverSQLite:
+		v.notEmpty("database.path", c.Database.Path)
+	}
+	v.check(c.Database.MaxOpenConns > 0, "database.max_open_conns", "必须大于 0")
+	v.check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns", "必须在 0 到 max_open_conns（%d）之间", c.Database.MaxOpenConns)
+	v.nonNegative("database.conn_max_lifetime", c.Database.ConnMaxLifetime)
+
+	if c.Redis.Enabled {
+		v.notEmpty("redis.host", c.Redis.Host)
+		v.port("redis.port", c.Redis.Port)
+	}
+	v.check(c.Redis.DB >= 0, "redis.db", "不能为负数")
+
+	v.positive("auth.token_ttl", c.Auth.TokenTTL)
+
+	if c.OIDC.Enabled {
+		v.notEmpty("oidc.issuer", c.OIDC.Issuer)
+		v.notEmpty("oidc.client_id", c.OIDC.ClientID)
+		v.notEmpty("oidc.redirect_url", c.OIDC.RedirectURL)
+	}
+
+	v.oneOf("log.level", c.Log.Level, "debug", "info", "warn", "error")
+	v.oneOf("log.format", c.Log.Format, "text", "json")
+
+	if c.Cluster.Enabled {
+		v.check(c.Redis.Enabled, "cluster.enabled", "多实例模式需要启用 Redis（redis.enabled）")
+		v.notEmpty("cluster.instance_id", c.Cluster.InstanceID)
+	}
+	v.check(c.Cluster.LeaseTTL >= 3*time.Second, "cluster.lease_ttl", "不能小于 3s")
+
+	v.check(c.WebSocket.MaxMessageSize >= minMessageSize, "websocket.max_message_size", "不能小于 %d（需要容纳文本字段最长的消息）", minMessageSize)
+	v.positive("websocket.write_timeout", c.WebSocket.WriteTimeout)
+	v.positive("websocket.pong_timeout", c.WebSocket.PongTimeout)
+	v.positive("websocket.ping_interval", c.WebSocket.PingInterval)
+	v.check(c.WebSocket.PingInterval < c.WebSocket.PongTimeout,
+		"websocket.ping_interval", "必须小于 pong_timeout（%s）", c.WebSocket.PongTimeout)
+	v.check(c.WebSocket.SendQueueSize > 0, "websocket.send_queue_size", "必须大于 0")
+	v.positive("websocket.max_send_lag", c.WebSocket.MaxSendLag)
+
+	v.check(c.Game.EventBufferSize > 0, "game.event_buffer_size", "必须大于 0")
+	v.check(c.Game.RecentActions > 0, "game.recent_actions", "必须大于 0")
+
+	v.positive("rest.session_idle_timeout", c.REST.SessionIdleTimeout)
+	v.check(c.REST.EventLogSize > 0, "rest.event_log_size", "必须大于 0")
+	v.positive("rest.max_poll_wait", c.REST.MaxPollWait)
+	v.check(c.REST.MaxPollWait < c.REST.SessionIdleTimeout,
+		"rest.max_poll_wait", "必须小于 session_idle_timeout（%s）", c.REST.SessionIdleTimeout)
+	v.positive("rest.reply_timeout", c.REST.ReplyTimeout)
+
+	return errors.Join(v.errs...)
+}
+
+// validation 收集校验错误
+type validation struct {
+	errs []error
+}
+
+// check 条件不成立时记录错误
+func (v *validation) check(ok bool, name, format string, args ...interface{}) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+	}
+}
+
+func (v *validation) notEmpty(name, value string) {
+	v.check(value != "", name, "不能为空")
+}
+
+func (v *validation) port(name, value string) {
+	port, err := strconv.Atoi(value)
+	v.check(err == nil && port > 0 && port <= 65535, name, "无效的端口 %q", value)
+}
+
+// ipOrCIDR 校验 IP 地址或网段
+func (v *validation) ipOrCIDR(name, value string) {
+	_, _, err := net.ParseCIDR(value)
+	v.check(err == nil || net.ParseIP(value) != nil, name, "无效的地址 %q（应为 IP 或 CIDR，如 172.28.0.10 或 10.0.0.0/8）", value)
+}
+
+// origin 校验来源：scheme://host[:port]，不带路径
+func (v *validation) origin(name, origin string) {
+	if origin == "*" {
+		return
+	}
+	u, err := url.Parse(origin)
+	ok := err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		(u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.User == nil
+	v.check(ok, name, "无效的来源 %q（应为 scheme://host[:port]，如 https://hong3.example.com）", origin)
+}
+
+func (v *validation) oneOf(name, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.check(false, name, "无效的值 %q（可选 %v）", value, allowed)
+}
+
+func (v *validation) positive(name string, d time.Duration) {
+	v.check(d > 0, name, "必须大于 0")
+}
+
+func (v *validation) nonNegative(name string, d time.Duration) {
+	v.check(d >= 0, name, "不能为负数")
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateDefault(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("default config is invalid: %v", err)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{"port", func(c *Config) { c.Server.Port = "70000" }, `server.port: 无效的端口 "70000"`},
+		{"host", func(c *Config) { c.Server.Host = "" }, "server.host: 不能为空"},
+		{"grace period", func(c *Config) { c.Server.ShutdownGracePeriod = -time.Second }, "server.shutdown_grace_period: 不能为负数"},
+		{"trusted proxy", func(c *Config) { c.Server.TrustedProxies = []string{"proxy"} }, `server.trusted_proxies: 无效的地址 "proxy"`},
+		{"tls pair", func(c *Config) { c.TLS.CertFile = "cert.pem" }, "tls: cert_file 和 key_file 需要同时设置"},
+		{"tls reload", func(c *Config) { c.TLS.ReloadInterval = 0 }, "tls.reload_interval: 必须大于 0"},
+		{"tls redirect without tls", func(c *Config) { c.TLS.RedirectAddr = ":80" }, "tls.redirect_addr: 需要同时设置 cert_file 和 key_file"},
+		{"tls redirect addr", func(c *Config) {
+			c.TLS.CertFile, c.TLS.KeyFile, c.TLS.RedirectAddr = "cert.pem", "key.pem", "80"
+		}, `tls.redirect_addr: 无效的监听地址 "80"`},
+		{"origin", func(c *Config) { c.CORS.AllowedOrigins = []string{"https://a.example.com/app"} }, `cors.allowed_origins: 无效的来源 "https://a.example.com/app"`},
+		{"wildcard credentials", func(c *Config) {
+			c.CORS.AllowedOrigins, c.CORS.AllowCredentials = []string{"*"}, true
+		}, `cors.allow_credentials: 不能与允许所有来源（"*"）同时使用`},
+		{"methods", func(c *Config) { c.CORS.AllowedMethods = nil }, "cors.allowed_methods: 不能为空"},
+		{"cors max age", func(c *Config) { c.CORS.MaxAge = -time.Second }, "cors.max_age: 不能为负数"},
+		{"driver", func(c *Config) { c.Database.Driver = "mysql" }, `database.driver: 无效的值 "mysql"`},
+		{"postgres host", func(c *Config) { c.Database.Host = "" }, "database.host: 不能为空"},
+		{"postgres port", func(c *Config) { c.Database.Port = "pg" }, `database.port: 无效的端口 "pg"`},
+		{"postgres user", func(c *Config) { c.Database.User = "" }, "database.user: 不能为空"},
+		{"postgres name", func(c *Config) { c.Database.Name = "" }, "database.name: 不能为空"},
+		{"ssl mode", func(c *Config) { c.Database.SSLMode = "on" }, `database.ssl_mode: 无效的值 "on"`},
+		{"sqlite path", func(c *Config) { c.Database.Driver, c.Database.Path = DriverSQLite, "" }, "database.path: 不能为空"},
+		{"open conns", func(c *Config) { c.Database.MaxOpenConns = 0 }, "database.max_open_conns: 必须大于 0"},
+		{"idle conns", func(c *Config) { c.Database.MaxIdleConns = 200 }, "database.max_idle_conns: 必须在 0 到 max_open_conns（100）之间"},
+		{"conn lifetime", func(c *Config) { c.Database.ConnMaxLifetime = -time.Second }, "database.conn_max_lifetime: 不能为负数"},
+		{"redis host", func(c *Config) { c.Redis.Enabled, c.Redis.Host = true, "" }, "redis.host: 不能为空"},
+		{"redis port", func(c *Config) { c.Redis.Enabled, c.Redis.Port = true, "0" }, `redis.port: 无效的端口 "0"`},
+		{"redis db", func(c *Config) { c.Redis.DB = -1 }, "redis.db: 不能为负数"},
+		{"token ttl", func(c *Config) { c.Auth.TokenTTL = 0 }, "auth.token_ttl: 必须大于 0"},
+		{"oidc issuer", func(c *Config) { c.OIDC.Enabled, c.OIDC.ClientID = true, "hong3" }, "oidc.issuer: 不能为空"},
+		{"oidc client", func(c *Config) { c.OIDC.Enabled, c.OIDC.Issuer = true, "https://idp.test" }, "oidc.client_id: 不能为空"},
+		{"oidc redirect", func(c *Config) {
+			c.OIDC = OIDCConfig{Enabled: true, Issuer: "https://idp.test", ClientID: "hong3"}
+		}, "oidc.redirect_url: 不能为空"},
+		{"log level", func(c *Config) { c.Log.Level = "trace" }, `log.level: 无效的值 "trace"`},
+		{"log format", func(c *Config) { c.Log.Format = "xml" }, `log.format: 无效的值 "xml"`},
+		{"cluster redis", func(c *Config) { c.Cluster.Enabled = true }, "cluster.enabled: 多实例模式需要启用 Redis（redis.enabled）"},
+		{"cluster instance", func(c *Config) {
+			c.Cluster.Enabled, c.Redis.Enabled, c.Cluster.InstanceID = true, true, ""
+		}, "cluster.instance_id: 不能为空"},
+		{"lease ttl", func(c *Config) { c.Cluster.LeaseTTL = time.Second }, "cluster.lease_ttl: 不能小于 3s"},
+		{"message size", func(c *Config) { c.WebSocket.MaxMessageSize = minMessageSize - 1 },
+			fmt.Sprintf("websocket.max_message_size: 不能小于 %d", minMessageSize)},
+		{"write timeout", func(c *Config) { c.WebSocket.WriteTimeout = 0 }, "websocket.write_timeout: 必须大于 0"},
+		{"pong timeout", func(c *Config) { c.WebSocket.PongTimeout = 0 }, "websocket.pong_timeout: 必须大于 0"},
+		{"ping interval", func(c *Config) { c.WebSocket.PingInterval = 0 }, "websocket.ping_interval: 必须大于 0"},
+		{"ping after pong", func(c *Config) { c.WebSocket.PingInterval = time.Minute }, "websocket.ping_interval: 必须小于 pong_timeout（1m0s）"},
+		{"send queue", func(c *Config) { c.WebSocket.SendQueueSize = 0 }, "websocket.send_queue_size: 必须大于 0"},
+		{"send lag", func(c *Config) { c.WebSocket.MaxSendLag = 0 }, "websocket.max_send_lag: 必须大于 0"},
+		{"event buffer", func(c *Config) { c.Game.EventBufferSize = 0 }, "game.event_buffer_size: 必须大于 0"},
+		{"recent actions", func(c *Config) { c.Game.RecentActions = 0 }, "game.recent_actions: 必须大于 0"},
+		{"session idle", func(c *Config) { c.REST.SessionIdleTimeout = 0 }, "rest.session_idle_timeout: 必须大于 0"},
+		{"event log", func(c *Config) { c.REST.EventLogSize = 0 }, "rest.event_log_size: 必须大于 0"},
+		{"poll wait", func(c *Config) { c.REST.MaxPollWait = 0 }, "rest.max_poll_wait: 必须大于 0"},
+		{"poll after idle", func(c *Config) { c.REST.MaxPollWait = time.Hour }, "rest.max_poll_wait: 必须小于 session_idle_timeout（2m0s）"},
+		{"reply timeout", func(c *Config) { c.REST.ReplyTimeout = 0 }, "rest.reply_timeout: 必须大于 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if err == nil {
+				t.Fatalf("no error, want %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Host = ""
+	cfg.Log.Level = "trace"
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "server.host") || !strings.Contains(err.Error(), "log.level") {
+		t.Errorf("error %v, want both server.host and log.level", err)
+	}
+}
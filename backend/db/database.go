@@ -2,37 +2,47 @@ package db
 
 import (
 	"fmt"
-	"log"
-	"time"
+	"log/slog"
 
 	"github.com/chenhailong/hong3/config"
-	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/logging"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
+// dbLogger 数据库相关日志
+var dbLogger = slog.Default()
+
 // InitDB 初始化数据库连接
-func InitDB() (*gorm.DB, error) {
+func InitDB(logger *slog.Logger) (*gorm.DB, error) {
+	dbLogger = logging.OrDefault(logger).With("component", "db")
+
 	// 从配置获取数据库连接信息
 	cfg := config.AppConfig
 	if cfg == nil {
-		cfg = config.LoadConfig()
+		var err error
+		if cfg, err = config.LoadConfig(""); err != nil {
+			return nil, err
+		}
 	}
 
-	dsn := cfg.Database.GetDSN()
-
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+	DB, err = gorm.Open(dialector(&cfg.Database), &gorm.Config{
+		Logger: &gormLogger{logger: dbLogger},
 	})
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// 统计数据库操作耗时
+	if err := registerMetrics(DB); err != nil {
+		return nil, fmt.Errorf("failed to register database metrics: %w", err)
+	}
+
 	// 获取底层 sql.DB 连接池
 	sqlDB, err := DB.DB()
 	if err != nil {
@@ -40,35 +50,41 @@ func InitDB() (*gorm.DB, error) {
 	}
 
 	// 设置连接池参数
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	if cfg.Database.InMemory() {
+		// 内存数据库只存在于创建它的连接中，只能使用一个连接且不能关闭
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+	}
 
 	// 测试连接
 	if err := sqlDB.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("Database connected successfully")
+	dbLogger.Info("Database connected successfully", "driver", cfg.Database.Driver, "database", cfg.Database.Summary())
 	return DB, nil
 }
 
-// AutoMigrate 自动迁移数据库表
-func AutoMigrate() error {
-	if DB == nil {
-		return fmt.Errorf("database not initialized")
+// dialector 根据配置选择数据库驱动
+func dialector(cfg *config.DatabaseConfig) gorm.Dialector {
+	if cfg.Driver == config.DriverSQLite {
+		return sqlite.Open(cfg.GetDSN())
 	}
+	return postgres.Open(cfg.GetDSN())
+}
 
-	// 自动迁移所有模型（token 已迁移到 Redis，不再需要 tokens 表）
-	err := DB.AutoMigrate(
-		&models.User{},
-		// &models.Token{}, // Token 已迁移到 Redis
-	)
-
+// Close 关闭数据库连接池
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
 	if err != nil {
-		return fmt.Errorf("failed to auto migrate: %w", err)
+		return err
 	}
-
-	log.Println("Database migration completed")
-	return nil
+	return sqlDB.Close()
 }
@@ -10,12 +10,41 @@ CREATE TABLE IF NOT EXISTS users (
     username VARCHAR(50) UNIQUE NOT NULL,
     password VARCHAR(255) NOT NULL,
     name VARCHAR(100) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'player',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP
 );
 
 -- 创建索引
 CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at);
+
+-- 创建外部身份表（OIDC 登录）
+CREATE TABLE IF NOT EXISTS identities (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identities_issuer_subject ON identities(issuer, subject);
+CREATE INDEX IF NOT EXISTS idx_identities_user_id ON identities(user_id);
+
+-- 创建游戏快照表（停机时保存未结束的游戏）
+CREATE TABLE IF NOT EXISTS game_snapshots (
+    id VARCHAR(36) PRIMARY KEY,
+    room_id VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    state TEXT NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_game_snapshots_room_id ON game_snapshots(room_id);
 
 -- 注意：token 表已迁移到 Redis，不再需要创建 tokens 表
 -- Token 现在存储在 Redis 中，以获得更好的性能和自动过期功能
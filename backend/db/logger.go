@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// slowQueryThreshold 超过该耗时的 SQL 以 warn 级别记录
+const slowQueryThreshold = 200 * time.Millisecond
+
+// gormLogger 把 GORM 日志转发到 slog，SQL 语句只在 debug 级别输出
+type gormLogger struct {
+	logger *slog.Logger
+}
+
+// LogMode 实现 logger.Interface，日志级别由 slog 控制
+func (l *gormLogger) LogMode(logger.LogLevel) logger.Interface {
+	return l
+}
+
+// Info 实现 logger.Interface
+func (l *gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	l.logger.InfoContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+// Warn 实现 logger.Interface
+func (l *gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	l.logger.WarnContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+// Error 实现 logger.Interface
+func (l *gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	l.logger.ErrorContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+// Trace 实现 logger.Interface
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		l.logger.WarnContext(ctx, "sql error", "error", err, "elapsed", elapsed, "rows", rows, "sql", sql)
+	case elapsed > slowQueryThreshold:
+		sql, rows := fc()
+		l.logger.WarnContext(ctx, "slow sql", "elapsed", elapsed, "rows", rows, "sql", sql)
+	case l.logger.Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		l.logger.DebugContext(ctx, "sql", "elapsed", elapsed, "rows", rows, "sql", sql)
+	}
+}
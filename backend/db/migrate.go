@@ -0,0 +1,403 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chenhailong/hong3/config"
+	"gorm.io/gorm"
+)
+
+// migrationFiles 版本化迁移脚本
+//
+// 文件名格式为 <版本号>_<名称>.<up|down>[.<驱动>].sql，例如 003_add_users_deleted_at.up.sql。
+// 带驱动名的文件（如 .up.sqlite.sql）只在对应驱动下使用，并替代同版本的通用脚本。
+// 脚本中的语句以分号结尾，按顺序在同一个事务中执行。
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// legacySchema AutoMigrate 时期的数据库中各迁移创建的表和字段是否已经存在，键为迁移版本号
+//
+// 这类数据库没有 schema_migrations 表，由哪个版本创建决定了包含哪些表和字段
+// （发布的第一个版本只创建了 users 表），第一次迁移时只把已经存在的记录为已执行，
+// 其余的照常执行。
+var legacySchema = map[int]func(m gorm.Migrator) bool{
+	1: func(m gorm.Migrator) bool { return m.HasTable("users") },
+	2: func(m gorm.Migrator) bool { return m.HasTable("identities") },
+	3: func(m gorm.Migrator) bool { return m.HasColumn("users", "deleted_at") },
+	4: func(m gorm.Migrator) bool { return m.HasColumn("users", "role") },
+	5: func(m gorm.Migrator) bool { return m.HasTable("game_snapshots") },
+}
+
+// migration 一个版本的迁移脚本
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// schemaMigration 已执行的迁移
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// TableName 指定表名
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus 迁移的执行状态
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // 未执行时为 nil
+}
+
+// MigrateUp 执行所有未执行的迁移，返回执行的数量
+func MigrateUp() (int, error) {
+	migrations, err := prepareMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+		done, err := runMigration(m, true)
+		if err != nil {
+			return count, err
+		}
+		if done {
+			count++
+		}
+	}
+
+	// 数据库由更新的版本迁移过（例如滚动升级期间的旧实例）
+	latest := latestVersion(migrations)
+	for version := range applied {
+		if version > latest {
+			dbLogger.Warn("database schema is newer than this build", "database_version", version, "latest_known_version", latest)
+			break
+		}
+	}
+	dbLogger.Info("Database migration completed", "applied", count)
+	return count, nil
+}
+
+// MigrateDown 回滚最近执行的 steps 个迁移，返回回滚的数量
+func MigrateDown(steps int) (int, error) {
+	migrations, err := prepareMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	byVersion := make(map[int]migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.version] = m
+	}
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	count := 0
+	for _, version := range versions {
+		if count >= steps {
+			break
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			return count, fmt.Errorf("migration %d is not known to this build, cannot roll back", version)
+		}
+		done, err := runMigration(m, false)
+		if err != nil {
+			return count, err
+		}
+		if done {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// MigrationStatuses 所有迁移的执行状态，按版本号排序
+//
+// 数据库中记录了、但当前版本不认识的迁移（由更新的版本执行）也会列出，名称来自数据库。
+func MigrationStatuses() ([]MigrationStatus, error) {
+	migrations, err := prepareMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.version, Name: m.name}
+		if record, ok := applied[m.version]; ok {
+			status.AppliedAt = &record.AppliedAt
+			delete(applied, m.version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, record := range applied {
+		appliedAt := record.AppliedAt
+		statuses = append(statuses, MigrationStatus{Version: record.Version, Name: record.Name, AppliedAt: &appliedAt})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// PendingMigrations 未执行的迁移数量
+func PendingMigrations() (int, error) {
+	statuses, err := MigrationStatuses()
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// prepareMigrations 加载当前驱动的迁移脚本，并确保 schema_migrations 表存在
+func prepareMigrations() ([]migration, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	migrations, err := loadMigrations(migrationFiles, DB.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationTable(migrations); err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// ensureMigrationTable 创建 schema_migrations 表
+//
+// 已有 users 表但没有 schema_migrations 表时，数据库由 AutoMigrate 创建，
+// 把表和字段已经存在的迁移记录为已执行（见 legacySchema）。
+func ensureMigrationTable(migrations []migration) error {
+	if DB.Migrator().HasTable(&schemaMigration{}) {
+		return nil
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockMigrations(tx); err != nil {
+			return err
+		}
+		// 其他实例可能已经创建
+		if tx.Migrator().HasTable(&schemaMigration{}) {
+			return nil
+		}
+		legacy := tx.Migrator().HasTable("users")
+		if err := tx.Migrator().CreateTable(&schemaMigration{}); err != nil {
+			return fmt.Errorf("failed to create schema_migrations table: %w", err)
+		}
+		if !legacy {
+			return nil
+		}
+		now := time.Now()
+		recorded := make([]int, 0, len(legacySchema))
+		for _, m := range migrations {
+			exists, ok := legacySchema[m.version]
+			if !ok || !exists(tx.Migrator()) {
+				continue
+			}
+			if err := tx.Create(&schemaMigration{Version: m.version, Name: m.name, AppliedAt: now}).Error; err != nil {
+				return fmt.Errorf("failed to record existing migration %d: %w", m.version, err)
+			}
+			recorded = append(recorded, m.version)
+		}
+		dbLogger.Info("existing database recorded migrations already in its schema", "versions", recorded)
+		return nil
+	})
+}
+
+// appliedMigrations 已执行的迁移，键为版本号
+func appliedMigrations() (map[int]schemaMigration, error) {
+	var records []schemaMigration
+	if err := DB.Order("version").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	applied := make(map[int]schemaMigration, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// runMigration 在事务中执行一个迁移并更新 schema_migrations
+//
+// 拿到迁移锁后重新检查迁移状态，已由其他实例执行过时返回 false。
+func runMigration(m migration, up bool) (bool, error) {
+	direction, script := "up", m.up
+	if !up {
+		direction, script = "down", m.down
+	}
+
+	done := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockMigrations(tx); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&schemaMigration{}).Where("version = ?", m.version).Count(&count).Error; err != nil {
+			return err
+		}
+		if (count > 0) == up {
+			return nil
+		}
+
+		for _, statement := range splitStatements(script) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		if up {
+			if err := tx.Create(&schemaMigration{Version: m.version, Name: m.name, AppliedAt: time.Now()}).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Delete(&schemaMigration{}, "version = ?", m.version).Error; err != nil {
+			return err
+		}
+		done = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("migration %03d_%s (%s) failed: %w", m.version, m.name, direction, err)
+	}
+	if done {
+		dbLogger.Info("migration applied", "version", m.version, "name", m.name, "direction", direction)
+	}
+	return done, nil
+}
+
+// migrationLockID 迁移使用的 PostgreSQL advisory lock 编号
+const migrationLockID = 0x686f6e6733 // "hong3"
+
+// lockMigrations 多个实例同时启动时串行执行迁移
+//
+// PostgreSQL 使用事务级的 advisory lock，事务结束时自动释放；SQLite 由数据库的写锁串行化。
+func lockMigrations(tx *gorm.DB) error {
+	if tx.Dialector.Name() != config.DriverPostgres {
+		return nil
+	}
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	return nil
+}
+
+// loadMigrations 读取迁移脚本，按版本号排序
+func loadMigrations(files fs.FS, driver string) ([]migration, error) {
+	paths, err := fs.Glob(files, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	type versionScripts struct {
+		name    string
+		scripts map[string]string // 键为 up、down 或 up.<驱动>、down.<驱动>
+	}
+	byVersion := make(map[int]*versionScripts)
+	for _, path := range paths {
+		file := strings.TrimSuffix(strings.TrimPrefix(path, "migrations/"), ".sql")
+		base, kind, _ := strings.Cut(file, ".")
+		direction, fileDriver, _ := strings.Cut(kind, ".")
+		versionText, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionText)
+		if !ok || err != nil || version <= 0 || (direction != "up" && direction != "down") || strings.Contains(fileDriver, ".") {
+			return nil, fmt.Errorf("invalid migration file name %q", path)
+		}
+		if fileDriver != "" && fileDriver != driver {
+			continue
+		}
+
+		content, err := fs.ReadFile(files, path)
+		if err != nil {
+			return nil, err
+		}
+		v := byVersion[version]
+		if v == nil {
+			v = &versionScripts{name: name, scripts: make(map[string]string)}
+			byVersion[version] = v
+		}
+		if v.name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, v.name, name)
+		}
+		v.scripts[kind] = string(content)
+	}
+
+	// 驱动专用的脚本优先
+	script := func(scripts map[string]string, direction string) string {
+		if s, ok := scripts[direction+"."+driver]; ok {
+			return s
+		}
+		return scripts[direction]
+	}
+	migrations := make([]migration, 0, len(byVersion))
+	for version, v := range byVersion {
+		m := migration{version: version, name: v.name, up: script(v.scripts, "up"), down: script(v.scripts, "down")}
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %03d_%s needs both up and down scripts", version, v.name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// latestVersion 最新的迁移版本号
+func latestVersion(migrations []migration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].version
+}
+
+// splitStatements 把脚本拆分为单条语句，忽略注释行和空语句
+func splitStatements(script string) []string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	var statements []string
+	for _, statement := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
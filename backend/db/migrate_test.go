@@ -0,0 +1,167 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// baselineUser 发布的第一个版本由 AutoMigrate 创建的 users 表
+type baselineUser struct {
+	ID        string `gorm:"primaryKey;type:varchar(36)"`
+	Username  string `gorm:"uniqueIndex;type:varchar(50);not null"`
+	Password  string `gorm:"type:varchar(255);not null"`
+	Name      string `gorm:"type:varchar(100);not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (baselineUser) TableName() string {
+	return "users"
+}
+
+// useTestDB 使用 SQLite 内存数据库作为 DB
+func useTestDB(t *testing.T) {
+	t.Helper()
+	conn, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	previous := DB
+	DB = conn
+	t.Cleanup(func() {
+		DB = previous
+		sqlDB.Close()
+	})
+}
+
+// appliedVersions 已记录为执行的迁移版本
+func appliedVersions(t *testing.T) []int {
+	t.Helper()
+	applied, err := appliedMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := make([]int, 0, len(applied))
+	for v := 1; v <= 8; v++ {
+		if _, ok := applied[v]; ok {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+func TestMigrateUpFromBaseline(t *testing.T) {
+	useTestDB(t)
+	if err := DB.AutoMigrate(&baselineUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Create(&baselineUser{ID: "u1", Username: "alice", Password: "x", Name: "Alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只有版本 1 记录为已执行，其余都要执行
+	if count != 7 {
+		t.Fatalf("applied %d migrations, want 7", count)
+	}
+	if got := appliedVersions(t); len(got) != 8 {
+		t.Fatalf("applied versions %v, want 1-8", got)
+	}
+
+	m := DB.Migrator()
+	for _, table := range []string{"identities", "game_snapshots", "game_snapshot_players", "tournament_snapshots", "tournament_snapshot_players"} {
+		if !m.HasTable(table) {
+			t.Errorf("table %s missing", table)
+		}
+	}
+	for _, column := range []string{"deleted_at", "role"} {
+		if !m.HasColumn("users", column) {
+			t.Errorf("column users.%s missing", column)
+		}
+	}
+
+	var role string
+	if err := DB.Raw("SELECT role FROM users WHERE id = ? AND deleted_at IS NULL", "u1").Scan(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	if role != "player" {
+		t.Errorf("existing user role = %q, want player", role)
+	}
+}
+
+func TestMigrateUpFromPartialLegacySchema(t *testing.T) {
+	useTestDB(t)
+	// 较晚的 AutoMigrate 版本：已有 identities 表和 users.role，没有 deleted_at 和 game_snapshots
+	if err := DB.AutoMigrate(&baselineUser{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range []string{
+		"ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'player'",
+		"CREATE TABLE identities (id VARCHAR(36) PRIMARY KEY, user_id VARCHAR(36) NOT NULL, issuer VARCHAR(255) NOT NULL, subject VARCHAR(255) NOT NULL, email VARCHAR(255), created_at TIMESTAMP, updated_at TIMESTAMP)",
+	} {
+		if err := DB.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ensureMigrationTable(mustLoadMigrations(t)); err != nil {
+		t.Fatal(err)
+	}
+	got := appliedVersions(t)
+	want := []int{1, 2, 4}
+	if len(got) != len(want) {
+		t.Fatalf("recorded versions %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("recorded versions %v, want %v", got, want)
+		}
+	}
+
+	count, err := MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Fatalf("applied %d migrations, want 5", count)
+	}
+	if !DB.Migrator().HasColumn("users", "deleted_at") || !DB.Migrator().HasTable("game_snapshots") {
+		t.Error("missing migrations were not applied")
+	}
+}
+
+func TestMigrateUpFreshDatabase(t *testing.T) {
+	useTestDB(t)
+	count, err := MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 8 {
+		t.Fatalf("applied %d migrations, want 8", count)
+	}
+	if count, err = MigrateUp(); err != nil || count != 0 {
+		t.Fatalf("second MigrateUp applied %d (err %v), want 0", count, err)
+	}
+}
+
+func mustLoadMigrations(t *testing.T) []migration {
+	t.Helper()
+	migrations, err := loadMigrations(migrationFiles, DB.Dialector.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrations
+}
@@ -0,0 +1,14 @@
+-- 创建外部身份表（OIDC 登录）
+CREATE TABLE IF NOT EXISTS identities (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 同一身份提供方下的 subject 唯一
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identities_issuer_subject ON identities(issuer, subject);
+CREATE INDEX IF NOT EXISTS idx_identities_user_id ON identities(user_id);
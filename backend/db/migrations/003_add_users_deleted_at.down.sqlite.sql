@@ -0,0 +1,4 @@
+-- SQLite 不支持 DROP COLUMN IF EXISTS，且删除列之前需要先删除列上的索引
+DROP INDEX IF EXISTS idx_users_deleted_at;
+
+ALTER TABLE users DROP COLUMN deleted_at;
@@ -0,0 +1,4 @@
+-- 用户注销：保留匿名化的用户记录（软删除）
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at);
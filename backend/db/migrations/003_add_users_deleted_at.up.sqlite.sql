@@ -0,0 +1,5 @@
+-- 用户注销：保留匿名化的用户记录（软删除）
+-- SQLite 不支持 ADD COLUMN IF NOT EXISTS
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at);
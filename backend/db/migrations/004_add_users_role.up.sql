@@ -0,0 +1,5 @@
+-- 用户角色（player / admin）
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'player';
+
+-- 指定管理员示例：
+-- UPDATE users SET role = 'admin' WHERE username = 'your_admin';
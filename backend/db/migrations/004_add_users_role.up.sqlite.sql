@@ -0,0 +1,3 @@
+-- 用户角色（player / admin）
+-- SQLite 不支持 ADD COLUMN IF NOT EXISTS
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'player';
@@ -0,0 +1,11 @@
+-- 创建游戏快照表（停机时保存未结束的游戏）
+CREATE TABLE IF NOT EXISTS game_snapshots (
+    id VARCHAR(36) PRIMARY KEY,
+    room_id VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    state TEXT NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_game_snapshots_room_id ON game_snapshots(room_id);
@@ -0,0 +1,11 @@
+-- 恢复旧版本的 tokens 表（不恢复其中的数据）
+CREATE TABLE IF NOT EXISTS tokens (
+    token VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    username VARCHAR(50) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tokens_user_id ON tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_tokens_expires_at ON tokens(expires_at);
@@ -0,0 +1,2 @@
+-- token 已迁移到 Redis，删除旧版本创建的 tokens 表
+DROP TABLE IF EXISTS tokens;
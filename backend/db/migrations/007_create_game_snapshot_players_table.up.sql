@@ -0,0 +1,8 @@
+-- 创建游戏快照玩家表（注销账号时据此查找并匿名化包含该玩家的快照）
+CREATE TABLE IF NOT EXISTS game_snapshot_players (
+    snapshot_id VARCHAR(36) NOT NULL REFERENCES game_snapshots(id) ON DELETE CASCADE,
+    player_id TEXT NOT NULL,
+    PRIMARY KEY (snapshot_id, player_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_game_snapshot_players_player_id ON game_snapshot_players(player_id);
@@ -0,0 +1,20 @@
+-- 创建比赛快照表（停机时保存比赛的积分榜和比赛桌）
+CREATE TABLE IF NOT EXISTS tournament_snapshots (
+    id VARCHAR(36) PRIMARY KEY,
+    tournament_id VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    state TEXT NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tournament_snapshots_tournament_id ON tournament_snapshots(tournament_id);
+
+-- 比赛快照中的玩家（注销账号时据此查找并匿名化包含该玩家的快照）
+CREATE TABLE IF NOT EXISTS tournament_snapshot_players (
+    snapshot_id VARCHAR(36) NOT NULL REFERENCES tournament_snapshots(id) ON DELETE CASCADE,
+    player_id TEXT NOT NULL,
+    PRIMARY KEY (snapshot_id, player_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tournament_snapshot_players_player_id ON tournament_snapshot_players(player_id);
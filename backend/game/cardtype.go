@@ -1,6 +1,7 @@
 package game
 
 import (
+	"log/slog"
 	"sort"
 
 	"github.com/chenhailong/hong3/models"
@@ -26,6 +27,15 @@ type CardGroup struct {
 	Value models.Rank // 用于比较大小的值
 }
 
+// LogValue 实现 slog.LogValuer，牌面是否输出由 models.RevealCardsInLogs 决定
+func (g *CardGroup) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("type", int(g.Type)),
+		slog.Int("value", int(g.Value)),
+		slog.Any("cards", models.CardsLogValue(g.Cards)),
+	)
+}
+
 // ValidateAndCreateCardGroup 验证牌型并创建CardGroup
 func ValidateAndCreateCardGroup(cards []models.Card) (*CardGroup, bool) {
 	if len(cards) == 0 {
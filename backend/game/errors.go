@@ -0,0 +1,50 @@
+package game
+
+import "errors"
+
+var (
+	ErrCannotJoin           = errors.New("游戏已开始，无法加入")
+	ErrRoomFull             = errors.New("房间已满")
+	ErrAlreadyStarted       = errors.New("游戏已开始")
+	ErrNotPlaying           = errors.New("游戏未开始或已结束")
+	ErrPlayerNotInGame      = errors.New("玩家不在游戏中")
+	ErrNotYourTurn          = errors.New("不是该玩家的回合")
+	ErrPlayerFinished       = errors.New("玩家已经出完牌")
+	ErrLastPlayerCannotPass = errors.New("最后出牌的玩家不能过")
+	ErrTooManyCards         = errors.New("选择的牌数超过手牌数量")
+	ErrInvalidCardIndex     = errors.New("无效的牌索引")
+	ErrInvalidCardType      = errors.New("无效的牌型")
+	ErrMustPlayHeartFour    = errors.New("首轮必须出包含红桃4的牌")
+	ErrCannotBeat           = errors.New("出的牌无法打过桌面上的牌")
+	ErrInvalidSeat          = errors.New("无效的座位")
+	ErrSeatTaken            = errors.New("座位已有玩家")
+	ErrAlreadySeated        = errors.New("玩家已在其他座位")
+)
+
+// errorReasons 错误对应的简短原因，用于统计和日志
+var errorReasons = map[error]string{
+	ErrCannotJoin:           "cannot_join",
+	ErrRoomFull:             "room_full",
+	ErrAlreadyStarted:       "already_started",
+	ErrNotPlaying:           "not_playing",
+	ErrPlayerNotInGame:      "not_in_game",
+	ErrNotYourTurn:          "not_your_turn",
+	ErrPlayerFinished:       "player_finished",
+	ErrLastPlayerCannotPass: "last_player_cannot_pass",
+	ErrTooManyCards:         "too_many_cards",
+	ErrInvalidCardIndex:     "invalid_card_index",
+	ErrInvalidCardType:      "invalid_card_type",
+	ErrMustPlayHeartFour:    "must_play_heart_four",
+	ErrCannotBeat:           "cannot_beat",
+	ErrInvalidSeat:          "invalid_seat",
+	ErrSeatTaken:            "seat_taken",
+	ErrAlreadySeated:        "already_seated",
+}
+
+// ErrorReason 返回错误的简短原因，未知错误返回 "other"
+func ErrorReason(err error) string {
+	if reason, ok := errorReasons[err]; ok {
+		return reason
+	}
+	return "other"
+}
@@ -1,10 +1,12 @@
 package game
 
 import (
-	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
+	"time"
 
+	"github.com/chenhailong/hong3/logging"
 	"github.com/chenhailong/hong3/models"
 )
 
@@ -27,6 +29,20 @@ const (
 	GameStatusFinished                   // 已结束
 )
 
+// String 返回游戏状态的名称
+func (s GameStatus) String() string {
+	switch s {
+	case GameStatusWaiting:
+		return "waiting"
+	case GameStatusPlaying:
+		return "playing"
+	case GameStatusFinished:
+		return "finished"
+	default:
+		return "unknown"
+	}
+}
+
 // TeamType 表示队伍类型
 type TeamType int
 
@@ -58,17 +74,21 @@ type Game struct {
 	TableCards    *CardGroup            `json:"table_cards"`    // 桌面上的牌
 	TeamType      TeamType              `json:"-"`              // 队伍类型
 	FinishedOrder []int                 `json:"finished_order"` // 完成顺序
+	StartedAt     time.Time             `json:"started_at"`     // 开始时间
+	FinishedAt    time.Time             `json:"finished_at"`    // 结束时间
+	logger        *slog.Logger
 	mutex         sync.Mutex
 }
 
 // NewGame 创建新游戏
-func NewGame(id string) *Game {
+func NewGame(id string, logger *slog.Logger) *Game {
 	return &Game{
 		ID:            id,
 		Status:        GameStatusWaiting,
 		CurrentPlayer: -1,
 		LastPlayer:    -1,
 		FinishedOrder: make([]int, 0, 4),
+		logger:        logging.OrDefault(logger).With(logging.KeyRoomID, id),
 	}
 }
 
@@ -78,7 +98,7 @@ func (g *Game) AddPlayer(player *Player) error {
 	defer g.mutex.Unlock()
 
 	if g.Status != GameStatusWaiting {
-		return errors.New("游戏已开始，无法加入")
+		return ErrCannotJoin
 	}
 
 	// 检查玩家是否已经存在
@@ -100,7 +120,106 @@ func (g *Game) AddPlayer(player *Player) error {
 		}
 	}
 
-	return errors.New("房间已满")
+	return ErrRoomFull
+}
+
+// AddPlayerAt 把玩家添加到指定座位（座位决定出牌顺序）
+func (g *Game) AddPlayerAt(player *Player, position int) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != GameStatusWaiting {
+		return ErrCannotJoin
+	}
+	if position < 0 || position >= len(g.Players) {
+		return ErrInvalidSeat
+	}
+
+	if p := g.Players[position]; p != nil {
+		if p.ID != player.ID {
+			return ErrSeatTaken
+		}
+		// 玩家已在该座位，更新信息
+		p.Name = player.Name
+		p.Status = player.Status
+		return nil
+	}
+	for _, p := range g.Players {
+		if p != nil && p.ID == player.ID {
+			return ErrAlreadySeated
+		}
+	}
+
+	player.Position = position
+	g.Players[position] = player
+	return nil
+}
+
+// MovePlayer 玩家换到空座位
+func (g *Game) MovePlayer(playerID string, position int) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != GameStatusWaiting {
+		return ErrAlreadyStarted
+	}
+	if position < 0 || position >= len(g.Players) {
+		return ErrInvalidSeat
+	}
+
+	from := g.seatOf(playerID)
+	if from < 0 {
+		return ErrPlayerNotInGame
+	}
+	if from == position {
+		return nil
+	}
+	if g.Players[position] != nil {
+		return ErrSeatTaken
+	}
+
+	g.Players[position] = g.Players[from]
+	g.Players[position].Position = position
+	g.Players[from] = nil
+	return nil
+}
+
+// SwapPlayers 交换两名玩家的座位
+func (g *Game) SwapPlayers(playerID, otherID string) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != GameStatusWaiting {
+		return ErrAlreadyStarted
+	}
+
+	a, b := g.seatOf(playerID), g.seatOf(otherID)
+	if a < 0 || b < 0 {
+		return ErrPlayerNotInGame
+	}
+
+	g.Players[a], g.Players[b] = g.Players[b], g.Players[a]
+	g.Players[a].Position = a
+	g.Players[b].Position = b
+	return nil
+}
+
+// SeatOf 返回玩家的座位，不在游戏中时返回 -1
+func (g *Game) SeatOf(playerID string) int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.seatOf(playerID)
+}
+
+// seatOf 返回玩家的座位（需在持有锁的情况下调用）
+func (g *Game) seatOf(playerID string) int {
+	for i, p := range g.Players {
+		if p != nil && p.ID == playerID {
+			return i
+		}
+	}
+	return -1
 }
 
 // RemovePlayer 从游戏中移除玩家
@@ -116,13 +235,26 @@ func (g *Game) RemovePlayer(playerID string) {
 	}
 }
 
+// HasPlayer 检查玩家是否在游戏中
+func (g *Game) HasPlayer(playerID string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for _, p := range g.Players {
+		if p != nil && p.ID == playerID {
+			return true
+		}
+	}
+	return false
+}
+
 // SetPlayerReady 设置玩家准备状态
 func (g *Game) SetPlayerReady(playerID string) error {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
 	if g.Status != GameStatusWaiting {
-		return errors.New("游戏已开始")
+		return ErrAlreadyStarted
 	}
 
 	for _, p := range g.Players {
@@ -132,7 +264,24 @@ func (g *Game) SetPlayerReady(playerID string) error {
 		}
 	}
 
-	return errors.New("玩家不在游戏中")
+	return ErrPlayerNotInGame
+}
+
+// ResetReady 取消所有玩家的准备状态
+func (g *Game) ResetReady() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.Status != GameStatusWaiting {
+		return ErrAlreadyStarted
+	}
+
+	for _, p := range g.Players {
+		if p != nil && p.Status == PlayerStatusReady {
+			p.Status = PlayerStatusWaiting
+		}
+	}
+	return nil
 }
 
 // AllPlayersReady 检查是否所有玩家都已准备
@@ -161,7 +310,7 @@ func (g *Game) StartGame() error {
 	defer g.mutex.Unlock()
 
 	if g.Status != GameStatusWaiting {
-		return errors.New("游戏已开始")
+		return ErrAlreadyStarted
 	}
 
 	// 检查所有玩家是否准备好（不需要再次加锁，因为已经在锁内）
@@ -201,6 +350,8 @@ func (g *Game) StartGame() error {
 	g.findFirstPlayer()
 
 	g.Status = GameStatusPlaying
+	g.StartedAt = time.Now()
+	g.logger.Info("game started", "team_type", g.TeamType, "first_player", g.CurrentPlayer)
 	return nil
 }
 
@@ -296,7 +447,7 @@ func (g *Game) PlayCards(playerID string, cardIndices []int) error {
 	defer g.mutex.Unlock()
 
 	if g.Status != GameStatusPlaying {
-		return errors.New("游戏未开始或已结束")
+		return ErrNotPlaying
 	}
 
 	// 找到玩家
@@ -311,23 +462,23 @@ func (g *Game) PlayCards(playerID string, cardIndices []int) error {
 	}
 
 	if playerIndex == -1 || player == nil {
-		return errors.New("玩家不在游戏中")
+		return ErrPlayerNotInGame
 	}
 
 	if playerIndex != g.CurrentPlayer {
-		return errors.New("不是该玩家的回合")
+		return ErrNotYourTurn
 	}
 
 	// 检查玩家是否已经完成游戏
 	if player.Status == PlayerStatusFinished {
-		return errors.New("玩家已经出完牌")
+		return ErrPlayerFinished
 	}
 
 	// 如果不出牌（过）
 	if len(cardIndices) == 0 {
 		// 如果是最后出牌的玩家，不能过
 		if playerIndex == g.LastPlayer {
-			return errors.New("最后出牌的玩家不能过")
+			return ErrLastPlayerCannotPass
 		}
 		
 		// 更新当前玩家
@@ -342,14 +493,14 @@ func (g *Game) PlayCards(playerID string, cardIndices []int) error {
 
 	// 检查索引是否有效
 	if len(cardIndices) > len(player.Cards) {
-		return errors.New("选择的牌数超过手牌数量")
+		return ErrTooManyCards
 	}
 
 	// 获取选中的牌
 	selectedCards := make([]models.Card, 0, len(cardIndices))
 	for _, idx := range cardIndices {
 		if idx < 0 || idx >= len(player.Cards) {
-			return errors.New("无效的牌索引")
+			return ErrInvalidCardIndex
 		}
 		selectedCards = append(selectedCards, player.Cards[idx])
 	}
@@ -357,7 +508,7 @@ func (g *Game) PlayCards(playerID string, cardIndices []int) error {
 	// 验证牌型
 	cardGroup, valid := ValidateAndCreateCardGroup(selectedCards)
 	if !valid {
-		return errors.New("无效的牌型")
+		return ErrInvalidCardType
 	}
 
 	// 首轮必须出红桃4
@@ -379,17 +530,18 @@ func (g *Game) PlayCards(playerID string, cardIndices []int) error {
 		}
 
 		if fourCount < 4 && !hasHeartFour {
-			return errors.New("首轮必须出包含红桃4的牌")
+			return ErrMustPlayHeartFour
 		}
 	} else {
 		// 检查是否能打过桌面上的牌
 		if !cardGroup.CanBeat(g.TableCards) {
-			return errors.New("出的牌无法打过桌面上的牌")
+			return ErrCannotBeat
 		}
 	}
 
 	// 更新桌面牌
 	g.TableCards = cardGroup
+	g.logger.Debug("cards played", logging.KeyPlayerID, playerID, "cards", cardGroup)
 
 	// 从玩家手牌中移除出的牌
 	for i := len(cardIndices) - 1; i >= 0; i-- {
@@ -409,6 +561,8 @@ func (g *Game) PlayCards(playerID string, cardIndices []int) error {
 		// 检查游戏是否结束
 		if g.checkGameEnd() {
 			g.Status = GameStatusFinished
+			g.FinishedAt = time.Now()
+			g.logger.Info("game finished", "duration", g.FinishedAt.Sub(g.StartedAt), "finished_order", g.FinishedOrder)
 			return nil
 		}
 	}
@@ -429,7 +583,7 @@ func (g *Game) Pass(playerID string) error {
 	defer g.mutex.Unlock()
 
 	if g.Status != GameStatusPlaying {
-		return errors.New("游戏未开始或已结束")
+		return ErrNotPlaying
 	}
 
 	// 找到玩家
@@ -442,16 +596,16 @@ func (g *Game) Pass(playerID string) error {
 	}
 
 	if playerIndex == -1 {
-		return errors.New("玩家不在游戏中")
+		return ErrPlayerNotInGame
 	}
 
 	if playerIndex != g.CurrentPlayer {
-		return errors.New("不是该玩家的回合")
+		return ErrNotYourTurn
 	}
 
 	// 如果是最后出牌的玩家，不能过
 	if playerIndex == g.LastPlayer {
-		return errors.New("最后出牌的玩家不能过")
+		return ErrLastPlayerCannotPass
 	}
 
 	// 更新当前玩家
@@ -523,13 +677,27 @@ func (g *Game) CollectTableCards() {
 	g.TableCards = nil
 }
 
-// GetGameResult 获取游戏结果
-func (g *Game) GetGameResult() map[string]interface{} {
-	result := make(map[string]interface{})
-	
+// Result 游戏结果
+type Result struct {
+	WinningTeam   int            `json:"winning_team"`
+	FinishedOrder []int          `json:"finished_order"`
+	Players       []PlayerResult `json:"players"`
+}
+
+// PlayerResult 玩家的游戏结果
+type PlayerResult struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Position       int    `json:"position"`
+	Team           int    `json:"team"`
+	CollectedCards int    `json:"collected_cards"`
+	IsWinner       bool   `json:"is_winner"`
+}
+
+// GetGameResult 获取游戏结果，游戏未结束时返回 nil
+func (g *Game) GetGameResult() *Result {
 	if g.Status != GameStatusFinished {
-		result["status"] = "游戏未结束"
-		return result
+		return nil
 	}
 	
 	// 计算胜利队伍
@@ -571,24 +739,23 @@ func (g *Game) GetGameResult() map[string]interface{} {
 		}
 	}
 	
-	result["winning_team"] = winningTeam
-	result["finished_order"] = g.FinishedOrder
-	
-	playerResults := make([]map[string]interface{}, 0, 4)
+	result := &Result{
+		WinningTeam:   winningTeam,
+		FinishedOrder: g.FinishedOrder,
+		Players:       make([]PlayerResult, 0, 4),
+	}
 	for _, p := range g.Players {
 		if p != nil {
-			playerResult := map[string]interface{}{
-				"id":             p.ID,
-				"name":           p.Name,
-				"position":       p.Position,
-				"team":           p.Team,
-				"collected_cards": p.CollectedCards,
-				"is_winner":      p.Team == winningTeam,
-			}
-			playerResults = append(playerResults, playerResult)
+			result.Players = append(result.Players, PlayerResult{
+				ID:             p.ID,
+				Name:           p.Name,
+				Position:       p.Position,
+				Team:           p.Team,
+				CollectedCards: p.CollectedCards,
+				IsWinner:       p.Team == winningTeam,
+			})
 		}
 	}
-	result["players"] = playerResults
 	
 	return result
 }
@@ -598,14 +765,16 @@ func (g *Game) GetStatus() string {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
-	switch g.Status {
-	case GameStatusWaiting:
-		return "waiting"
-	case GameStatusPlaying:
-		return "playing"
-	case GameStatusFinished:
-		return "finished"
-	default:
-		return "unknown"
+	return g.Status.String()
+}
+
+// Duration 获取已结束游戏的时长
+func (g *Game) Duration() time.Duration {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.StartedAt.IsZero() || g.FinishedAt.IsZero() {
+		return 0
 	}
-}
\ No newline at end of file
+	return g.FinishedAt.Sub(g.StartedAt)
+}
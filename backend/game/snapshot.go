@@ -0,0 +1,79 @@
+package game
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/chenhailong/hong3/models"
+)
+
+// Snapshot 游戏的完整状态（包含手牌和队伍），用于停机时持久化
+type Snapshot struct {
+	ID            string           `json:"id"`
+	Status        GameStatus       `json:"status"`
+	Players       []PlayerSnapshot `json:"players"`
+	CurrentPlayer int              `json:"current_player"`
+	LastPlayer    int              `json:"last_player"`
+	TableCards    *CardGroup       `json:"table_cards"`
+	TeamType      TeamType         `json:"team_type"`
+	FinishedOrder []int            `json:"finished_order"`
+	StartedAt     time.Time        `json:"started_at"`
+}
+
+// PlayerSnapshot 玩家的完整状态
+type PlayerSnapshot struct {
+	Player
+	Team int `json:"team"`
+}
+
+// Snapshot 获取游戏的完整状态
+func (g *Game) Snapshot() Snapshot {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	players := make([]PlayerSnapshot, 0, len(g.Players))
+	for _, p := range g.Players {
+		if p == nil {
+			continue
+		}
+		player := *p
+		player.Cards = append([]models.Card(nil), p.Cards...)
+		players = append(players, PlayerSnapshot{Player: player, Team: p.Team})
+	}
+
+	return Snapshot{
+		ID:            g.ID,
+		Status:        g.Status,
+		Players:       players,
+		CurrentPlayer: g.CurrentPlayer,
+		LastPlayer:    g.LastPlayer,
+		TableCards:    g.TableCards,
+		TeamType:      g.TeamType,
+		FinishedOrder: append([]int(nil), g.FinishedOrder...),
+		StartedAt:     g.StartedAt,
+	}
+}
+
+// Restore 从快照恢复游戏（用于房间转移到其他实例）
+func Restore(s Snapshot, logger *slog.Logger) *Game {
+	g := NewGame(s.ID, logger)
+	g.Status = s.Status
+	g.CurrentPlayer = s.CurrentPlayer
+	g.LastPlayer = s.LastPlayer
+	g.TableCards = s.TableCards
+	g.TeamType = s.TeamType
+	g.StartedAt = s.StartedAt
+	if s.FinishedOrder != nil {
+		g.FinishedOrder = s.FinishedOrder
+	}
+
+	for _, ps := range s.Players {
+		if ps.Position < 0 || ps.Position >= len(g.Players) {
+			continue
+		}
+		player := ps.Player
+		player.Team = ps.Team
+		g.Players[ps.Position] = &player
+	}
+	return g
+}
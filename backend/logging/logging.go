@@ -0,0 +1,87 @@
+// Package logging 创建结构化日志记录器
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/chenhailong/hong3/config"
+	"github.com/chenhailong/hong3/models"
+)
+
+// 常用字段名，所有包使用相同的 key 便于检索
+const (
+	KeyRequestID    = "request_id"
+	KeyRoomID       = "room_id"
+	KeyPlayerID     = "player_id"
+	KeyUserID       = "user_id"
+	KeyTournamentID = "tournament_id"
+)
+
+type contextKey struct{}
+
+// New 根据配置创建日志记录器
+func New(cfg config.LogConfig) (*slog.Logger, error) {
+	return NewWithWriter(cfg, os.Stdout)
+}
+
+// NewWithWriter 根据配置创建写入 w 的日志记录器
+func NewWithWriter(cfg config.LogConfig, w io.Writer) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	// 默认不在日志中输出牌面，避免泄露手牌
+	models.RevealCardsInLogs = cfg.RevealCards
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q (expected text or json)", cfg.Format)
+	}
+
+	return slog.New(handler), nil
+}
+
+// ParseLevel 解析日志级别（debug、info、warn、error）
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", level)
+	}
+	return l, nil
+}
+
+// OrDefault 返回 logger，为 nil 时返回 slog.Default()
+func OrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+// NewContext 把日志记录器放入 context
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext 从 context 中取出日志记录器，没有时返回 slog.Default()
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -1,49 +1,256 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/chenhailong/hong3/api"
 	"github.com/chenhailong/hong3/auth"
 	"github.com/chenhailong/hong3/config"
 	"github.com/chenhailong/hong3/db"
+	"github.com/chenhailong/hong3/logging"
 	"github.com/chenhailong/hong3/redis"
 )
 
 func main() {
+	configPath := flag.String("config", "", "配置文件路径（YAML 或 TOML），默认读取环境变量 CONFIG_FILE")
+	printConfig := flag.Bool("print-config", false, "输出合并后的配置（隐藏敏感字段）并退出")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: hong3 [flags] [set-role <username> <role> | migrate <up|down [n]|status>]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	// 加载配置
-	log.Println("Loading configuration...")
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to print configuration: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 初始化日志
+	logger, err := logging.New(cfg.Log)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid log configuration: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+	cfg.LogSummary(logger)
 
 	// 初始化数据库
-	log.Println("Initializing database...")
-	if _, err := db.InitDB(); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	logger.Info("initializing database")
+	database, err := db.InitDB(logger)
+	if err != nil {
+		fatal(logger, "failed to initialize database", err)
+	}
+
+	// 命令行子命令：hong3 migrate <up|down [n]|status>，不受 auto_migrate 影响
+	if flag.NArg() > 0 && flag.Arg(0) == "migrate" {
+		runMigrate(logger, flag.Args()[1:])
+		return
+	}
+
+	// 执行数据库迁移
+	if cfg.Database.AutoMigrate {
+		if _, err := db.MigrateUp(); err != nil {
+			fatal(logger, "failed to migrate database", err)
+		}
+	} else if pending, err := db.PendingMigrations(); err != nil {
+		fatal(logger, "failed to check database migrations", err)
+	} else if pending > 0 {
+		logger.Warn("database has pending migrations, run \"hong3 migrate up\"", "pending", pending)
 	}
 
-	// 自动迁移数据库表
-	if err := db.AutoMigrate(); err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
+	auth.SetLogger(logger)
+	users := auth.NewGormUserRepository(database)
+	snapshots := auth.NewGormGameSnapshotRepository(database)
+
+	// 命令行子命令：hong3 set-role <username> <role>（不涉及登录 token）
+	if flag.NArg() > 0 {
+		runCommand(logger, auth.NewUserStore(auth.Repositories{
+			Users:      users,
+			Tokens:     auth.NewMemoryTokenRepository(),
+			Attempts:   auth.NewMemoryAttemptRepository(),
+			OIDCStates: auth.NewMemoryOIDCStateRepository(),
+			Snapshots:  snapshots,
+		}, cfg.Auth.TokenTTL, logger), flag.Args())
+		return
 	}
 
-	// 初始化 Redis（如果启用）
+	// 初始化 Redis（如果启用），登录 token、失败计数和 OIDC 登录流程保存在 Redis 中
+	repos := auth.Repositories{Users: users, Snapshots: snapshots}
 	if cfg.Redis.Enabled {
-		log.Println("Initializing Redis...")
-		if _, err := redis.InitRedis(); err != nil {
-			log.Fatalf("Failed to initialize Redis: %v", err)
+		logger.Info("initializing redis")
+		if _, err := redis.InitRedis(logger); err != nil {
+			fatal(logger, "failed to initialize redis", err)
 		}
+		repos.Tokens = auth.NewRedisTokenRepository()
+		repos.Attempts = auth.NewRedisAttemptRepository()
+		repos.OIDCStates = auth.NewRedisOIDCStateRepository()
 	} else {
-		log.Println("Redis is disabled, token storage will fail. Please enable Redis in configuration.")
+		logger.Warn("redis is disabled, login sessions are kept in memory and lost on restart")
+		repos.Tokens = auth.NewMemoryTokenRepository()
+		repos.Attempts = auth.NewMemoryAttemptRepository()
+		repos.OIDCStates = auth.NewMemoryOIDCStateRepository()
 	}
 
 	// 初始化用户存储
-	auth.InitStore()
+	store := auth.NewUserStore(repos, cfg.Auth.TokenTTL, logger)
+
+	// 授予初始管理员角色
+	if cfg.Admin.Username != "" {
+		if err := store.SeedAdmin(cfg.Admin.Username, cfg.Admin.Password); err != nil {
+			fatal(logger, "failed to seed admin user", err, "username", cfg.Admin.Username)
+		}
+	}
+
+	// 初始化 OIDC 登录（如果启用）
+	if cfg.OIDC.Enabled {
+		logger.Info("initializing oidc provider")
+		if err := auth.InitOIDC(context.Background(), cfg.OIDC); err != nil {
+			fatal(logger, "failed to initialize oidc provider", err)
+		}
+	}
 
 	// 启动服务器
-	server := api.NewServer()
-	serverAddr := cfg.Server.GetServerAddr()
-	log.Printf("Starting Hong3 server on %s", serverAddr)
-	if err := server.Run(serverAddr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := api.NewServer(cfg, store, snapshots, logger)
+	if err := server.RegisterMetrics(); err != nil {
+		fatal(logger, "failed to register metrics", err)
+	}
+	if cfg.Cluster.Enabled {
+		if err := server.StartCluster(context.Background(), cfg.Cluster.InstanceID, cfg.Cluster.LeaseTTL); err != nil {
+			fatal(logger, "failed to start cluster mode", err)
+		}
+	}
+	// 恢复上次停机时保存的比赛和未结束的游戏，失败时快照保留到下次启动
+	if err := server.RestoreGames(); err != nil {
+		logger.Error("failed to restore unfinished games", "error", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Run(cfg.Server.GetServerAddr())
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			fatal(logger, "failed to start server", err)
+		}
+	case <-ctx.Done():
+		// 再次收到信号时直接退出
+		stop()
+		logger.Info("shutting down", "grace_period", cfg.Server.ShutdownGracePeriod)
+		if err := server.Shutdown(context.Background(), cfg.Server.ShutdownGracePeriod); err != nil {
+			logger.Error("server shutdown", "error", err)
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		logger.Error("failed to close database", "error", err)
+	}
+	if err := redis.Close(); err != nil {
+		logger.Error("failed to close redis", "error", err)
+	}
+	logger.Info("server stopped")
+}
+
+// fatal 记录错误并退出
+func fatal(logger *slog.Logger, msg string, err error, args ...any) {
+	logger.Error(msg, append(args, "error", err)...)
+	os.Exit(1)
+}
+
+// runCommand 执行命令行子命令
+func runCommand(logger *slog.Logger, store *auth.UserStore, args []string) {
+	switch args[0] {
+	case "set-role":
+		if len(args) != 3 {
+			fmt.Fprintln(os.Stderr, "usage: hong3 set-role <username> <player|moderator|admin>")
+			os.Exit(2)
+		}
+		user, err := store.SetRoleByUsername(args[1], args[2])
+		if err != nil {
+			fatal(logger, "failed to set role", err)
+		}
+		logger.Info("role updated", "username", user.Username, "role", args[2])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", args[0])
+		os.Exit(2)
+	}
+}
+
+// runMigrate 执行 migrate 子命令
+func runMigrate(logger *slog.Logger, args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "usage: hong3 migrate <up|down [n]|status>")
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+
+	switch args[0] {
+	case "up":
+		if len(args) != 1 {
+			usage()
+		}
+		if _, err := db.MigrateUp(); err != nil {
+			fatal(logger, "failed to migrate database", err)
+		}
+	case "down":
+		// 默认回滚最近的一个迁移
+		steps := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				usage()
+			}
+			steps = n
+		} else if len(args) > 2 {
+			usage()
+		}
+		count, err := db.MigrateDown(steps)
+		if err != nil {
+			fatal(logger, "failed to roll back database migration", err, "rolled_back", count)
+		}
+		logger.Info("database migrations rolled back", "count", count)
+	case "status":
+		if len(args) != 1 {
+			usage()
+		}
+		statuses, err := db.MigrationStatuses()
+		if err != nil {
+			fatal(logger, "failed to read migration status", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+	default:
+		usage()
 	}
-}
\ No newline at end of file
+}
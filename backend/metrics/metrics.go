@@ -0,0 +1,113 @@
+// Package metrics 定义 Prometheus 指标
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "hong3"
+
+// Registry 所有指标注册到独立的 registry，避免依赖全局默认 registry
+var Registry = prometheus.NewRegistry()
+
+var (
+	// MessagesIn 收到的 WebSocket 消息数
+	MessagesIn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_messages_in_total",
+		Help:      "Number of WebSocket messages received, by message type.",
+	}, []string{"type"})
+
+	// MessagesOut 发出的 WebSocket 消息数
+	MessagesOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_messages_out_total",
+		Help:      "Number of WebSocket messages written, by message type.",
+	}, []string{"type"})
+
+	// SendDrops 客户端跟不上被断开时丢弃的消息数
+	SendDrops = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_send_drops_total",
+		Help:      "Number of queued messages dropped when a lagging client was disconnected.",
+	})
+
+	// SendCoalesced 被更新的快照替代而不再发送的消息数
+	SendCoalesced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_send_coalesced_total",
+		Help:      "Number of queued snapshots replaced by a newer one before being written, by message type.",
+	}, []string{"type"})
+
+	// SendLag 消息从入队到写出的时间
+	SendLag = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "websocket_send_lag_seconds",
+		Help:      "Time messages spend in a client send queue before being written.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 10),
+	})
+
+	// SlowConsumers 因跟不上消息被断开的连接数
+	SlowConsumers = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_slow_consumer_disconnects_total",
+		Help:      "Number of connections closed because the client fell too far behind.",
+	})
+
+	// GameDuration 已结束游戏的时长
+	GameDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "game_duration_seconds",
+		Help:      "Duration of finished games.",
+		Buckets:   []float64{60, 120, 300, 600, 900, 1200, 1800, 2700, 3600},
+	})
+
+	// GameActionErrors 出牌和过牌失败的次数
+	GameActionErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "game_action_errors_total",
+		Help:      "Number of rejected game actions, by action and reason.",
+	}, []string{"action", "reason"})
+
+	// DBQueryDuration 数据库操作耗时
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of database operations, by operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operation"})
+
+	// RedisCommandDuration Redis 命令耗时
+	RedisCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_command_duration_seconds",
+		Help:      "Latency of Redis commands, by command.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 14),
+	}, []string{"command"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		MessagesIn,
+		MessagesOut,
+		SendDrops,
+		SendCoalesced,
+		SendLag,
+		SlowConsumers,
+		GameDuration,
+		GameActionErrors,
+		DBQueryDuration,
+		RedisCommandDuration,
+	)
+}
+
+// Handler 返回 /metrics 的 HTTP 处理器
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"log/slog"
 	"math/rand"
 )
 
@@ -111,4 +112,35 @@ func (d *Deck) Deal() [4][]Card {
 	}
 
 	return hands
-}
\ No newline at end of file
+}
+
+// RevealCardsInLogs 是否在日志中输出牌面，默认隐藏以免手牌泄露到日志
+var RevealCardsInLogs = false
+
+// LogValue 实现 slog.LogValuer，默认隐藏牌面
+func (c Card) LogValue() slog.Value {
+	if !RevealCardsInLogs {
+		return slog.StringValue("[redacted]")
+	}
+	return slog.StringValue(c.logString())
+}
+
+// CardsLogValue 返回一组牌的日志值，默认只输出张数
+func CardsLogValue(cards []Card) slog.Value {
+	if !RevealCardsInLogs {
+		return slog.GroupValue(slog.Int("count", len(cards)))
+	}
+	values := make([]string, len(cards))
+	for i, card := range cards {
+		values[i] = card.logString()
+	}
+	return slog.GroupValue(slog.Int("count", len(cards)), slog.Any("cards", values))
+}
+
+// logString 牌面的日志表示，例如 hearts:3
+func (c Card) logString() string {
+	if c.Rank == Ten {
+		return string(c.Suit) + ":10"
+	}
+	return string(c.Suit) + ":" + c.GetRankString()
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GameSnapshot 停机时保存的未结束游戏状态
+type GameSnapshot struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	RoomID    string    `gorm:"type:varchar(100);not null;index" json:"room_id"`
+	Status    string    `gorm:"type:varchar(20);not null" json:"status"`
+	State     string    `gorm:"type:text;not null" json:"state"` // game.Snapshot 的 JSON
+	Reason    string    `gorm:"type:varchar(50);not null" json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// 参与游戏的玩家，注销账号时据此查找包含该玩家的快照
+	Players []GameSnapshotPlayer `gorm:"foreignKey:SnapshotID" json:"-"`
+}
+
+// TableName 指定表名
+func (GameSnapshot) TableName() string {
+	return "game_snapshots"
+}
+
+// AnonymizePlayer 把快照中该玩家的名称替换为已注销用户
+//
+// 与 User.Anonymize 一样保留玩家 ID，State 中 id 为 playerID 的对象的 name 字段会被替换。
+func (s *GameSnapshot) AnonymizePlayer(playerID string) error {
+	state, err := anonymizeState(s.State, playerID)
+	if err != nil {
+		return err
+	}
+	s.State = state
+	return nil
+}
+
+// anonymizeState 替换 JSON 状态中 id 为 playerID 的对象的 name 字段
+func anonymizeState(state, playerID string) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(state))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+	anonymizeName(value, playerID)
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// anonymizeName 递归替换 id 为 playerID 的对象的 name 字段
+func anonymizeName(value any, playerID string) {
+	switch v := value.(type) {
+	case map[string]any:
+		if id, ok := v["id"].(string); ok && id == playerID {
+			if _, ok := v["name"]; ok {
+				v["name"] = DeletedUserName
+			}
+		}
+		for _, child := range v {
+			anonymizeName(child, playerID)
+		}
+	case []any:
+		for _, child := range v {
+			anonymizeName(child, playerID)
+		}
+	}
+}
+
+// BeforeCreate 创建前钩子
+func (s *GameSnapshot) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = generateID()
+	}
+	return nil
+}
+
+// GameSnapshotPlayer 快照中的玩家
+type GameSnapshotPlayer struct {
+	SnapshotID string `gorm:"primaryKey;type:varchar(36)"`
+	PlayerID   string `gorm:"primaryKey;type:text;index"`
+}
+
+// TableName 指定表名
+func (GameSnapshotPlayer) TableName() string {
+	return "game_snapshot_players"
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Identity 外部身份（OIDC）与用户的关联
+type Identity struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	UserID    string    `gorm:"type:varchar(36);not null;index" json:"user_id"`
+	User      *User     `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Issuer    string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identities_issuer_subject" json:"issuer"`
+	Subject   string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identities_issuer_subject" json:"subject"`
+	Email     string    `gorm:"type:varchar(255)" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Identity) TableName() string {
+	return "identities"
+}
+
+// BeforeCreate 创建前钩子
+func (i *Identity) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == "" {
+		i.ID = generateID()
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package models
+
+// 用户角色，权限从低到高
+const (
+	RolePlayer    = "player"    // 普通玩家
+	RoleModerator = "moderator" // 版主：可以踢人、关闭房间
+	RoleAdmin     = "admin"     // 管理员：拥有全部权限
+)
+
+// roleLevels 角色等级，高等级拥有低等级的全部权限
+var roleLevels = map[string]int{
+	RolePlayer:    0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+// ValidRole 判断角色是否有效
+func ValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// RoleAtLeast 判断 role 是否拥有 required 角色的权限
+func RoleAtLeast(role, required string) bool {
+	level, ok := roleLevels[role]
+	if !ok {
+		return false
+	}
+	requiredLevel, ok := roleLevels[required]
+	if !ok {
+		return false
+	}
+	return level >= requiredLevel
+}
+
+// HasRole 判断用户是否拥有指定角色的权限
+func (u *User) HasRole(role string) bool {
+	return RoleAtLeast(u.Role, role)
+}
+
+// IsAdmin 是否为管理员
+func (u *User) IsAdmin() bool {
+	return u.HasRole(RoleAdmin)
+}
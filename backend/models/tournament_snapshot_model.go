@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TournamentSnapshot 停机时保存的比赛状态（包括积分榜和本轮的比赛桌）
+type TournamentSnapshot struct {
+	ID           string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	TournamentID string    `gorm:"type:varchar(100);not null;index" json:"tournament_id"`
+	Status       string    `gorm:"type:varchar(20);not null" json:"status"`
+	State        string    `gorm:"type:text;not null" json:"state"` // 比赛状态的 JSON
+	Reason       string    `gorm:"type:varchar(50);not null" json:"reason"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// 参赛的玩家，注销账号时据此查找包含该玩家的快照
+	Players []TournamentSnapshotPlayer `gorm:"foreignKey:SnapshotID" json:"-"`
+}
+
+// TableName 指定表名
+func (TournamentSnapshot) TableName() string {
+	return "tournament_snapshots"
+}
+
+// AnonymizePlayer 把快照中该玩家的名称替换为已注销用户，保留玩家 ID
+func (s *TournamentSnapshot) AnonymizePlayer(playerID string) error {
+	state, err := anonymizeState(s.State, playerID)
+	if err != nil {
+		return err
+	}
+	s.State = state
+	return nil
+}
+
+// BeforeCreate 创建前钩子
+func (s *TournamentSnapshot) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = generateID()
+	}
+	return nil
+}
+
+// TournamentSnapshotPlayer 比赛快照中的玩家
+type TournamentSnapshotPlayer struct {
+	SnapshotID string `gorm:"primaryKey;type:varchar(36)"`
+	PlayerID   string `gorm:"primaryKey;type:text;index"`
+}
+
+// TableName 指定表名
+func (TournamentSnapshotPlayer) TableName() string {
+	return "tournament_snapshot_players"
+}
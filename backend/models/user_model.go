@@ -10,12 +10,14 @@ import (
 
 // User 用户模型
 type User struct {
-	ID        string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
-	Username  string    `gorm:"uniqueIndex;type:varchar(50);not null" json:"username"`
-	Password  string    `gorm:"type:varchar(255);not null" json:"-"` // 不返回密码
-	Name      string    `gorm:"type:varchar(100);not null" json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string         `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	Username  string         `gorm:"uniqueIndex;type:varchar(50);not null" json:"username"`
+	Password  string         `gorm:"type:varchar(255);not null" json:"-"` // 不返回密码
+	Name      string         `gorm:"type:varchar(100);not null" json:"name"`
+	Role      string         `gorm:"type:varchar(20);not null;default:player" json:"role"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"` // 注销时间（注销后保留匿名记录）
 }
 
 // TableName 指定表名
@@ -23,34 +25,25 @@ func (User) TableName() string {
 	return "users"
 }
 
+// DeletedUserName 注销后的用户在用户记录和游戏快照中显示的名称
+const DeletedUserName = "已注销用户"
+
+// Anonymize 清除用户的个人信息，保留 ID 以免破坏关联数据
+func (u *User) Anonymize() {
+	u.Username = "deleted_" + u.ID
+	u.Name = DeletedUserName
+	u.Password = ""
+	u.Role = RolePlayer
+}
+
 // BeforeCreate 创建前钩子
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == "" {
 		// 如果 ID 为空，生成新的 ID
 		u.ID = generateID()
 	}
-	return nil
-}
-
-// Token token 模型
-type Token struct {
-	Token     string    `gorm:"primaryKey;type:varchar(36)" json:"token"`
-	UserID    string    `gorm:"type:varchar(36);not null;index" json:"user_id"`
-	Username  string    `gorm:"type:varchar(50);not null" json:"username"`
-	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-// TableName 指定表名
-func (Token) TableName() string {
-	return "tokens"
-}
-
-// BeforeCreate 创建前钩子
-func (t *Token) BeforeCreate(tx *gorm.DB) error {
-	if t.Token == "" {
-		// 如果 Token 为空，生成新的 Token
-		t.Token = generateID()
+	if u.Role == "" {
+		u.Role = RolePlayer
 	}
 	return nil
 }
@@ -61,4 +54,3 @@ func generateID() string {
 	rand.Read(b)
 	return fmt.Sprintf("%x", b)
 }
-
@@ -0,0 +1,331 @@
+package protocol
+
+import "unicode/utf8"
+
+// 客户端发送的消息类型
+const (
+	TypeJoinRoom    = "join_room"
+	TypeLeaveRoom   = "leave_room"
+	TypeCreateRoom  = "create_room"
+	TypeGameAction  = "game_action"
+	TypeKickPlayer  = "kick_player"
+	TypeCloseRoom   = "close_room"
+	TypeAnnounce    = "announce"
+	TypeEventsSince = "events_since"
+	TypeResync      = "resync"
+	TypeTakeSeat    = "take_seat"
+	TypeSwapSeat    = "swap_seat"
+	TypeAcceptSwap  = "accept_swap"
+	TypeDeclineSwap = "decline_swap"
+
+	TypeRoomKick     = "room_kick"
+	TypeTransferHost = "transfer_host"
+	TypeLockRoom     = "lock_room"
+	TypeResetReady   = "reset_ready"
+)
+
+// 游戏动作
+const (
+	ActionReady     = "ready"
+	ActionPlayCards = "play_cards"
+	ActionPass      = "pass"
+)
+
+const (
+	// maxHandSize 每位玩家最多的手牌数
+	maxHandSize = 13
+
+	// maxIDLength 房间ID、玩家ID和动作ID的最大长度
+	maxIDLength = 64
+
+	// maxTextLength 原因、公告等文本的最大字符数，按字符而不是字节计算
+	maxTextLength = 200
+
+	// maxEscapedRuneSize 一个字符在 JSON 中转义后的最大字节数：
+	// 辅助平面的字符（如 emoji）转义为代理对 \uXXXX\uXXXX
+	maxEscapedRuneSize = 12
+
+	// maxEnvelopeSize 文本以外的字段（版本、类型、ID 等）的最大字节数，ID 同样可能全部转义
+	maxEnvelopeSize = 1024
+
+	// seatCount 每局游戏的座位数
+	seatCount = 4
+)
+
+// MinMessageSize 能容纳任何合法客户端消息的最小读取上限（字节）
+//
+// 最长的文本即使每个字符都转义，加上其他字段也不超过这个大小，
+// 因此超长的文本返回校验错误，而不是超过 websocket.max_message_size 断开连接。
+const MinMessageSize = maxTextLength*maxEscapedRuneSize + maxEnvelopeSize
+
+// Inbound 客户端可以发送的所有消息
+var Inbound = []Message{
+	&JoinRoom{},
+	&LeaveRoom{},
+	&CreateRoom{},
+	&GameAction{},
+	&KickPlayer{},
+	&CloseRoom{},
+	&Announce{},
+	&EventsSince{},
+	&Resync{},
+	&TakeSeat{},
+	&SwapSeat{},
+	&AcceptSwap{},
+	&DeclineSwap{},
+	&RoomKick{},
+	&TransferHost{},
+	&LockRoom{},
+	&ResetReady{},
+}
+
+// JoinRoom 加入房间（房间不存在时创建）
+type JoinRoom struct {
+	Header
+	RoomID string `json:"room_id"`
+}
+
+func (*JoinRoom) MessageType() string { return TypeJoinRoom }
+
+func (m *JoinRoom) Validate() error {
+	return validateID("room_id", m.RoomID)
+}
+
+// LeaveRoom 离开当前房间
+type LeaveRoom struct {
+	Header
+}
+
+func (*LeaveRoom) MessageType() string { return TypeLeaveRoom }
+
+// CreateRoom 创建新房间并加入
+type CreateRoom struct {
+	Header
+}
+
+func (*CreateRoom) MessageType() string { return TypeCreateRoom }
+
+// GameAction 游戏动作：准备、出牌或过牌
+//
+// 携带 action_id 时，服务器处理后回复 action_ack 或带有同一 action_id 的 error；
+// 重复发送同一 action_id 的动作不会再次执行，服务器回复第一次处理的结果。
+type GameAction struct {
+	Header
+	ActionID    string `json:"action_id,omitempty"` // 客户端生成的动作ID，每个动作唯一
+	Action      string `json:"action" enum:"ready,play_cards,pass"`
+	CardIndices []int  `json:"card_indices,omitempty"` // 出牌时要出的手牌索引
+}
+
+func (*GameAction) MessageType() string { return TypeGameAction }
+
+func (m *GameAction) Validate() error {
+	if len(m.ActionID) > maxIDLength {
+		return invalid("action_id", "长度不能超过 %d", maxIDLength)
+	}
+	switch m.Action {
+	case ActionReady, ActionPass:
+		if len(m.CardIndices) > 0 {
+			return invalid("card_indices", "仅出牌时可以携带")
+		}
+	case ActionPlayCards:
+		if len(m.CardIndices) == 0 {
+			return invalid("card_indices", "不能为空")
+		}
+		if len(m.CardIndices) > maxHandSize {
+			return invalid("card_indices", "最多 %d 张牌", maxHandSize)
+		}
+		seen := make(map[int]bool, len(m.CardIndices))
+		for _, idx := range m.CardIndices {
+			if idx < 0 || idx >= maxHandSize {
+				return invalid("card_indices", "索引 %d 超出范围", idx)
+			}
+			if seen[idx] {
+				return invalid("card_indices", "索引 %d 重复", idx)
+			}
+			seen[idx] = true
+		}
+	case "":
+		return invalid("action", "缺少游戏动作")
+	default:
+		return invalid("action", "未知的游戏动作 %q", m.Action)
+	}
+	return nil
+}
+
+// KickPlayer 踢出玩家（版主）
+type KickPlayer struct {
+	Header
+	PlayerID string `json:"player_id"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func (*KickPlayer) MessageType() string { return TypeKickPlayer }
+
+func (m *KickPlayer) Validate() error {
+	if err := validateID("player_id", m.PlayerID); err != nil {
+		return err
+	}
+	return validateText("reason", m.Reason)
+}
+
+// CloseRoom 关闭房间（版主）
+type CloseRoom struct {
+	Header
+	RoomID string `json:"room_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (*CloseRoom) MessageType() string { return TypeCloseRoom }
+
+func (m *CloseRoom) Validate() error {
+	if err := validateID("room_id", m.RoomID); err != nil {
+		return err
+	}
+	return validateText("reason", m.Reason)
+}
+
+// Announce 发送服务器公告（管理员）
+type Announce struct {
+	Header
+	Message string `json:"message"`
+}
+
+func (*Announce) MessageType() string { return TypeAnnounce }
+
+func (m *Announce) Validate() error {
+	if m.Message == "" {
+		return invalid("message", "公告内容不能为空")
+	}
+	return validateText("message", m.Message)
+}
+
+// EventsSince 请求重发序号大于 Since 的房间事件
+//
+// 服务器依次重发缓冲区中的事件，然后发送当前的游戏状态；缓冲区中已没有所需的事件时
+// 按 Resync 处理。
+type EventsSince struct {
+	Header
+	Since uint64 `json:"since"`
+}
+
+func (*EventsSince) MessageType() string { return TypeEventsSince }
+
+// Resync 请求完整的房间状态和游戏状态
+type Resync struct {
+	Header
+}
+
+func (*Resync) MessageType() string { return TypeResync }
+
+// TakeSeat 换到空座位（游戏开始前），座位决定出牌顺序
+type TakeSeat struct {
+	Header
+	Position int `json:"position"` // 座位（0-3）
+}
+
+func (*TakeSeat) MessageType() string { return TypeTakeSeat }
+
+func (m *TakeSeat) Validate() error {
+	if m.Position < 0 || m.Position >= seatCount {
+		return invalid("position", "必须在 0 到 %d 之间", seatCount-1)
+	}
+	return nil
+}
+
+// SwapSeat 请求与房间内的另一名玩家交换座位（游戏开始前），对方收到 swap_requested
+type SwapSeat struct {
+	Header
+	PlayerID string `json:"player_id"`
+}
+
+func (*SwapSeat) MessageType() string { return TypeSwapSeat }
+
+func (m *SwapSeat) Validate() error {
+	return validateID("player_id", m.PlayerID)
+}
+
+// AcceptSwap 同意 player_id 的换座位请求
+type AcceptSwap struct {
+	Header
+	PlayerID string `json:"player_id"`
+}
+
+func (*AcceptSwap) MessageType() string { return TypeAcceptSwap }
+
+func (m *AcceptSwap) Validate() error {
+	return validateID("player_id", m.PlayerID)
+}
+
+// DeclineSwap 拒绝 player_id 的换座位请求，对方收到 swap_declined
+type DeclineSwap struct {
+	Header
+	PlayerID string `json:"player_id"`
+}
+
+func (*DeclineSwap) MessageType() string { return TypeDeclineSwap }
+
+func (m *DeclineSwap) Validate() error {
+	return validateID("player_id", m.PlayerID)
+}
+
+// RoomKick 把玩家移出当前房间（房主），被移出的玩家不能再加入该房间
+type RoomKick struct {
+	Header
+	PlayerID string `json:"player_id"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func (*RoomKick) MessageType() string { return TypeRoomKick }
+
+func (m *RoomKick) Validate() error {
+	if err := validateID("player_id", m.PlayerID); err != nil {
+		return err
+	}
+	return validateText("reason", m.Reason)
+}
+
+// TransferHost 把房主转给房间内的另一名玩家（房主）
+type TransferHost struct {
+	Header
+	PlayerID string `json:"player_id"`
+}
+
+func (*TransferHost) MessageType() string { return TypeTransferHost }
+
+func (m *TransferHost) Validate() error {
+	return validateID("player_id", m.PlayerID)
+}
+
+// LockRoom 锁定或解锁当前房间（房主），锁定后不在游戏中的玩家不能加入
+type LockRoom struct {
+	Header
+	Locked bool `json:"locked"`
+}
+
+func (*LockRoom) MessageType() string { return TypeLockRoom }
+
+// ResetReady 取消所有玩家的准备状态（房主，游戏开始前）
+type ResetReady struct {
+	Header
+}
+
+func (*ResetReady) MessageType() string { return TypeResetReady }
+
+// validateID 校验房间ID、玩家ID
+func validateID(field, id string) error {
+	if id == "" {
+		return invalid(field, "不能为空")
+	}
+	if len(id) > maxIDLength {
+		return invalid(field, "长度不能超过 %d", maxIDLength)
+	}
+	return nil
+}
+
+// validateText 校验文本长度
+func validateText(field, text string) error {
+	if utf8.RuneCountInString(text) > maxTextLength {
+		return invalid(field, "长度不能超过 %d 个字符", maxTextLength)
+	}
+	return nil
+}
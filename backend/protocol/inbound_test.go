@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	longID := strings.Repeat("x", maxIDLength+1)
+	longText := strings.Repeat("字", maxTextLength+1)
+
+	tests := []struct {
+		name  string
+		msg   validator
+		field string // 为空表示校验通过
+	}{
+		{"join room", &JoinRoom{RoomID: "r1"}, ""},
+		{"join room without id", &JoinRoom{}, "room_id"},
+		{"join room long id", &JoinRoom{RoomID: longID}, "room_id"},
+		{"ready", &GameAction{Action: ActionReady}, ""},
+		{"ready with cards", &GameAction{Action: ActionReady, CardIndices: []int{0}}, "card_indices"},
+		{"pass with cards", &GameAction{Action: ActionPass, CardIndices: []int{0}}, "card_indices"},
+		{"play cards", &GameAction{Action: ActionPlayCards, CardIndices: []int{0, 12}}, ""},
+		{"play no cards", &GameAction{Action: ActionPlayCards}, "card_indices"},
+		{"play too many cards", &GameAction{Action: ActionPlayCards, CardIndices: make([]int, maxHandSize+1)}, "card_indices"},
+		{"card out of range", &GameAction{Action: ActionPlayCards, CardIndices: []int{maxHandSize}}, "card_indices"},
+		{"negative card", &GameAction{Action: ActionPlayCards, CardIndices: []int{-1}}, "card_indices"},
+		{"duplicate card", &GameAction{Action: ActionPlayCards, CardIndices: []int{3, 3}}, "card_indices"},
+		{"missing action", &GameAction{}, "action"},
+		{"unknown action", &GameAction{Action: "cheat"}, "action"},
+		{"long action id", &GameAction{ActionID: longID, Action: ActionReady}, "action_id"},
+		{"kick", &KickPlayer{PlayerID: "p1", Reason: strings.Repeat("字", maxTextLength)}, ""},
+		{"kick without player", &KickPlayer{}, "player_id"},
+		{"kick long reason", &KickPlayer{PlayerID: "p1", Reason: longText}, "reason"},
+		{"close room", &CloseRoom{RoomID: "r1"}, ""},
+		{"close room long reason", &CloseRoom{RoomID: "r1", Reason: longText}, "reason"},
+		{"announce", &Announce{Message: "维护"}, ""},
+		{"empty announce", &Announce{}, "message"},
+		{"long announce", &Announce{Message: longText}, "message"},
+		{"take seat", &TakeSeat{Position: seatCount - 1}, ""},
+		{"seat out of range", &TakeSeat{Position: seatCount}, "position"},
+		{"negative seat", &TakeSeat{Position: -1}, "position"},
+		{"swap seat", &SwapSeat{PlayerID: "p2"}, ""},
+		{"swap without player", &SwapSeat{}, "player_id"},
+		{"accept swap without player", &AcceptSwap{}, "player_id"},
+		{"decline swap without player", &DeclineSwap{}, "player_id"},
+		{"room kick", &RoomKick{PlayerID: "p2"}, ""},
+		{"room kick without player", &RoomKick{}, "player_id"},
+		{"transfer host without player", &TransferHost{}, "player_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.msg.Validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			validationErr, ok := err.(*ValidationError)
+			if !ok || validationErr.Field != tt.field {
+				t.Errorf("error %v, want a ValidationError for %s", err, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package protocol
+
+import (
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/models"
+)
+
+// 服务器发送的消息类型
+const (
+	TypeError          = "error"
+	TypeActionAck      = "action_ack"
+	TypeRoomState      = "room_state"
+	TypeRoomCreated    = "room_created"
+	TypePlayerJoined   = "player_joined"
+	TypePlayerLeft     = "player_left"
+	TypePlayerReady    = "player_ready"
+	TypeGameStarted    = "game_started"
+	TypeGameState      = "game_state"
+	TypeCardsPlayed    = "cards_played"
+	TypeGameEnd        = "game_end"
+	TypePlayerPass     = "player_pass"
+	TypeRoundEnd       = "round_end"
+	TypeKicked         = "kicked"
+	TypeRoomClosed     = "room_closed"
+	TypeAnnouncement   = "announcement"
+	TypeServerShutdown = "server_shutdown"
+
+	TypeTournamentSeat   = "tournament_seat"
+	TypeTournamentUpdate = "tournament_update"
+
+	TypeSeatChanged   = "seat_changed"
+	TypeSwapRequested = "swap_requested"
+	TypeSwapDeclined  = "swap_declined"
+
+	TypeHostChanged = "host_changed"
+	TypeRoomLocked  = "room_locked"
+	TypeReadyReset  = "ready_reset"
+	TypeRoomKicked  = "room_kicked"
+)
+
+// Outbound 服务器可以发送的所有消息
+var Outbound = []Message{
+	&Error{},
+	&ActionAck{},
+	&RoomState{},
+	&RoomCreated{},
+	&PlayerJoined{},
+	&PlayerLeft{},
+	&PlayerReady{},
+	&GameStarted{},
+	&GameState{},
+	&CardsPlayed{},
+	&GameEnd{},
+	&PlayerPass{},
+	&RoundEnd{},
+	&Kicked{},
+	&RoomClosed{},
+	&Announcement{},
+	&ServerShutdown{},
+	&TournamentSeat{},
+	&TournamentUpdate{},
+	&SeatChanged{},
+	&SwapRequested{},
+	&SwapDeclined{},
+	&HostChanged{},
+	&RoomLocked{},
+	&ReadyReset{},
+	&RoomKicked{},
+}
+
+// snapshots 快照类消息的类型
+var snapshots = map[string]bool{
+	TypeRoomState: true,
+	TypeGameState: true,
+
+	TypeTournamentUpdate: true,
+}
+
+// IsSnapshot 判断消息是否为快照
+//
+// 快照包含生成时的完整状态，同一客户端较新的快照可以替代尚未发出的旧快照。
+func IsSnapshot(messageType string) bool {
+	return snapshots[messageType]
+}
+
+// Error 错误提示
+type Error struct {
+	Header
+	Error    string `json:"error"`
+	Field    string `json:"field,omitempty"`     // 消息不符合协议时出错的字段
+	ActionID string `json:"action_id,omitempty"` // 被拒绝的游戏动作的ID
+}
+
+func (*Error) MessageType() string { return TypeError }
+
+// ActionAck 携带 action_id 的游戏动作已执行
+type ActionAck struct {
+	Header
+	ActionID  string `json:"action_id"`
+	Action    string `json:"action" enum:"ready,play_cards,pass"`
+	Duplicate bool   `json:"duplicate,omitempty"` // 重复的请求，动作没有再次执行
+}
+
+func (*ActionAck) MessageType() string { return TypeActionAck }
+
+// RoomState 房间内的玩家
+type RoomState struct {
+	Header
+	Sequence
+	RoomID  string       `json:"room_id"`
+	Players []RoomPlayer `json:"players"`
+	Host    string       `json:"host,omitempty"` // 房主的玩家ID（比赛桌没有房主）
+	Locked  bool         `json:"locked,omitempty"`
+}
+
+func (*RoomState) MessageType() string { return TypeRoomState }
+
+// RoomPlayer 房间内的玩家
+type RoomPlayer struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Ready    bool   `json:"ready"`
+	Position int    `json:"position"` // 座位（0-3），不在游戏中时为 -1
+}
+
+// RoomCreated 房间创建成功
+type RoomCreated struct {
+	Header
+	RoomID string `json:"room_id"`
+}
+
+func (*RoomCreated) MessageType() string { return TypeRoomCreated }
+
+// PlayerJoined 有玩家加入房间
+type PlayerJoined struct {
+	Header
+	Sequence
+	PlayerID string `json:"player_id"`
+	Name     string `json:"name"`
+}
+
+func (*PlayerJoined) MessageType() string { return TypePlayerJoined }
+
+// PlayerLeft 有玩家离开房间
+type PlayerLeft struct {
+	Header
+	Sequence
+	PlayerID string `json:"player_id"`
+}
+
+func (*PlayerLeft) MessageType() string { return TypePlayerLeft }
+
+// PlayerReady 有玩家准备
+type PlayerReady struct {
+	Header
+	Sequence
+	PlayerID string `json:"player_id"`
+}
+
+func (*PlayerReady) MessageType() string { return TypePlayerReady }
+
+// GameStarted 游戏开始
+type GameStarted struct {
+	Header
+	Sequence
+	CurrentPlayer int `json:"current_player"`
+}
+
+func (*GameStarted) MessageType() string { return TypeGameStarted }
+
+// GameState 发给单个玩家的游戏状态（只包含该玩家自己的手牌）
+type GameState struct {
+	Header
+	Sequence
+	Status        string        `json:"status" enum:"waiting,playing,finished"`
+	CurrentPlayer int           `json:"current_player"`
+	LastPlayer    int           `json:"last_player"`
+	Player        *game.Player  `json:"player"`
+	OtherPlayers  []OtherPlayer `json:"other_players"`
+	TableCards    *TableCards   `json:"table_cards"`
+}
+
+func (*GameState) MessageType() string { return TypeGameState }
+
+// OtherPlayer 其他玩家的公开信息（不包含手牌）
+type OtherPlayer struct {
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	Position       int               `json:"position"`
+	Status         game.PlayerStatus `json:"status"`
+	CardCount      int               `json:"card_count"`
+	CollectedCards int               `json:"collected_cards"`
+}
+
+// TableCards 桌面上的牌
+type TableCards struct {
+	Type  game.CardType `json:"type"`
+	Cards []models.Card `json:"cards"`
+	Value models.Rank   `json:"value"`
+}
+
+// NewTableCards 转换桌面牌，桌面没有牌时返回 nil
+func NewTableCards(g *game.CardGroup) *TableCards {
+	if g == nil {
+		return nil
+	}
+	return &TableCards{Type: g.Type, Cards: g.Cards, Value: g.Value}
+}
+
+// CardsPlayed 有玩家出牌
+type CardsPlayed struct {
+	Header
+	Sequence
+	PlayerID      string      `json:"player_id"`
+	TableCards    *TableCards `json:"table_cards"`
+	CurrentPlayer int         `json:"current_player"`
+	LastPlayer    int         `json:"last_player"`
+}
+
+func (*CardsPlayed) MessageType() string { return TypeCardsPlayed }
+
+// GameEnd 游戏结束
+type GameEnd struct {
+	Header
+	Sequence
+	Result *game.Result `json:"result"`
+}
+
+func (*GameEnd) MessageType() string { return TypeGameEnd }
+
+// PlayerPass 有玩家过牌
+type PlayerPass struct {
+	Header
+	Sequence
+	PlayerID      string `json:"player_id"`
+	CurrentPlayer int    `json:"current_player"`
+}
+
+func (*PlayerPass) MessageType() string { return TypePlayerPass }
+
+// RoundEnd 所有人都过牌，桌面牌被清空
+type RoundEnd struct {
+	Header
+	Sequence
+	CurrentPlayer int `json:"current_player"`
+}
+
+func (*RoundEnd) MessageType() string { return TypeRoundEnd }
+
+// Kicked 被踢出房间，随后连接会被断开
+type Kicked struct {
+	Header
+	Reason string `json:"reason"`
+}
+
+func (*Kicked) MessageType() string { return TypeKicked }
+
+// RoomClosed 房间被关闭，玩家回到大厅
+type RoomClosed struct {
+	Header
+	Sequence
+	RoomID string `json:"room_id"`
+	Reason string `json:"reason"`
+}
+
+func (*RoomClosed) MessageType() string { return TypeRoomClosed }
+
+// Announcement 服务器公告
+type Announcement struct {
+	Header
+	Message string `json:"message"`
+}
+
+func (*Announcement) MessageType() string { return TypeAnnouncement }
+
+// ServerShutdown 服务器即将停机
+type ServerShutdown struct {
+	Header
+	Message  string `json:"message"`
+	Deadline int64  `json:"deadline"` // 断开连接的最晚时间（Unix 秒）
+}
+
+func (*ServerShutdown) MessageType() string { return TypeServerShutdown }
+
+// SeatChanged 有玩家换了座位
+//
+// 交换座位时 swapped_with 为另一名玩家，该玩家从 to 换到了 from。
+type SeatChanged struct {
+	Header
+	Sequence
+	PlayerID    string `json:"player_id"`
+	From        int    `json:"from"`
+	To          int    `json:"to"`
+	SwappedWith string `json:"swapped_with,omitempty"`
+}
+
+func (*SeatChanged) MessageType() string { return TypeSeatChanged }
+
+// SwapRequested 有玩家请求与你交换座位，回复 accept_swap 或 decline_swap
+type SwapRequested struct {
+	Header
+	PlayerID string `json:"player_id"`
+	Position int    `json:"position"` // 对方的座位
+}
+
+func (*SwapRequested) MessageType() string { return TypeSwapRequested }
+
+// SwapDeclined 对方拒绝了换座位请求
+type SwapDeclined struct {
+	Header
+	PlayerID string `json:"player_id"`
+}
+
+func (*SwapDeclined) MessageType() string { return TypeSwapDeclined }
+
+// HostChanged 房主变更（转让或原房主离开房间）
+type HostChanged struct {
+	Header
+	Sequence
+	PlayerID string `json:"player_id"`
+}
+
+func (*HostChanged) MessageType() string { return TypeHostChanged }
+
+// RoomLocked 房间被锁定或解锁
+type RoomLocked struct {
+	Header
+	Sequence
+	Locked bool `json:"locked"`
+}
+
+func (*RoomLocked) MessageType() string { return TypeRoomLocked }
+
+// ReadyReset 房主取消了所有玩家的准备状态
+type ReadyReset struct {
+	Header
+	Sequence
+}
+
+func (*ReadyReset) MessageType() string { return TypeReadyReset }
+
+// RoomKicked 被房主移出房间，玩家回到大厅，连接不会断开
+type RoomKicked struct {
+	Header
+	RoomID string `json:"room_id"`
+	Reason string `json:"reason"`
+}
+
+func (*RoomKicked) MessageType() string { return TypeRoomKicked }
+
+// TournamentSeat 比赛为玩家分配了本轮的座位，玩家应加入 room_id 对应的房间
+type TournamentSeat struct {
+	Header
+	TournamentID string `json:"tournament_id"`
+	Round        int    `json:"round"`
+	Table        int    `json:"table"` // 桌号，从 1 开始
+	RoomID       string `json:"room_id"`
+	Position     int    `json:"position"` // 座位（0-3）
+}
+
+func (*TournamentSeat) MessageType() string { return TypeTournamentSeat }
+
+// TournamentUpdate 比赛的积分榜或轮次有变化，发给所有参赛玩家
+type TournamentUpdate struct {
+	Header
+	Tournament *Tournament `json:"tournament"`
+}
+
+func (*TournamentUpdate) MessageType() string { return TypeTournamentUpdate }
+
+// Tournament 比赛的当前状态
+type Tournament struct {
+	ID            string               `json:"id"`
+	Name          string               `json:"name"`
+	Format        string               `json:"format" enum:"reseat,advance"`
+	Status        string               `json:"status" enum:"registering,playing,finished"`
+	HandsPerRound int                  `json:"hands_per_round"`
+	Rounds        int                  `json:"rounds"` // 总轮数，advance 赛制在开始时按报名人数确定
+	Round         int                  `json:"round"`  // 当前轮次，从 1 开始，未开始时为 0
+	Standings     []TournamentStanding `json:"standings"`
+	Tables        []TournamentTable    `json:"tables"` // 本轮的比赛桌
+}
+
+// TournamentStanding 积分榜中的一名玩家
+type TournamentStanding struct {
+	Rank           int    `json:"rank"`
+	PlayerID       string `json:"player_id"`
+	Name           string `json:"name"`
+	Points         int    `json:"points"`
+	Hands          int    `json:"hands"`           // 已完成的局数
+	CollectedCards int    `json:"collected_cards"` // 累计收集的牌数，同分时多者排名靠前
+	Eliminated     bool   `json:"eliminated,omitempty"`
+}
+
+// TournamentTable 一张比赛桌
+type TournamentTable struct {
+	Table   int      `json:"table"`
+	RoomID  string   `json:"room_id"`
+	Players []string `json:"players"` // 按座位排列的玩家ID
+	Hands   int      `json:"hands"`   // 本轮已完成的局数
+}
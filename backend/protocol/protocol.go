@@ -0,0 +1,162 @@
+// Package protocol 定义 WebSocket 协议的所有消息
+//
+// 每条消息都是一个 JSON 对象，带有协议版本 v 和消息类型 type，字段名统一使用 snake_case。
+// 客户端发来的消息通过 Decode 严格解码：未知的类型、未知的字段和类型不匹配的字段都会返回
+// ValidationError。服务器发出的消息通过 Marshal 编码，自动填写版本和类型。
+//
+// 房间内广播的事件带有序号 seq（见 Sequence）。客户端发现序号不连续时，可以发送
+// events_since 补齐缺失的事件，或发送 resync 重新获取完整的房间和游戏状态。
+// 客户端接收太慢时，尚未发出的旧快照会被新快照替代（见 IsSnapshot），积压仍然过多时
+// 服务器以 CloseSlowConsumer 断开连接。
+//
+// schema.json 由 Schema 生成，修改消息后需要重新生成：
+//
+//	go generate ./protocol
+package protocol
+
+//go:generate go run ../cmd/protocolschema -o schema.json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Version 当前协议版本
+const Version = 1
+
+// 服务器断开连接时使用的应用关闭码（4000-4999）
+const (
+	// CloseSlowConsumer 客户端接收消息太慢，发送队列积压。客户端应重新连接并发送 resync
+	// 获取完整状态
+	CloseSlowConsumer = 4008
+)
+
+// Header 所有消息共有的字段
+type Header struct {
+	V    int    `json:"v"`
+	Type string `json:"type"`
+}
+
+// header 返回消息头，供 Marshal 填写版本和类型
+func (h *Header) header() *Header {
+	return h
+}
+
+// Message 协议中的一条消息
+type Message interface {
+	// MessageType 返回消息类型（type 字段的值）
+	MessageType() string
+	header() *Header
+}
+
+// Sequence 房间事件的序号
+//
+// 同一房间内的事件按发生顺序编号，序号从 1 开始连续递增。快照类消息（room_state、game_state）
+// 不占用序号，携带的是生成快照时最后一个事件的序号。
+type Sequence struct {
+	Seq uint64 `json:"seq"`
+}
+
+// SetSeq 设置序号
+func (s *Sequence) SetSeq(seq uint64) {
+	s.Seq = seq
+}
+
+// Sequenced 带有房间序号的消息
+type Sequenced interface {
+	Message
+	SetSeq(seq uint64)
+}
+
+// validator 需要在解码后校验字段的消息
+type validator interface {
+	Validate() error
+}
+
+// ValidationError 消息不符合协议
+type ValidationError struct {
+	Field   string // 出错的字段，整条消息出错时为空
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// invalid 创建 ValidationError
+func invalid(field, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// inboundByType 按类型索引的客户端消息
+var inboundByType = func() map[string]reflect.Type {
+	types := make(map[string]reflect.Type, len(Inbound))
+	for _, m := range Inbound {
+		types[m.MessageType()] = reflect.TypeOf(m).Elem()
+	}
+	return types
+}()
+
+// Decode 严格解码客户端发来的消息
+func Decode(data []byte) (Message, error) {
+	var header Header
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, invalid("", "消息不是有效的 JSON 对象")
+	}
+	// 未携带版本号的消息按当前版本处理
+	if header.V != 0 && header.V != Version {
+		return nil, invalid("v", "不支持的协议版本 %d（当前版本 %d）", header.V, Version)
+	}
+	if header.Type == "" {
+		return nil, invalid("type", "缺少消息类型")
+	}
+
+	t, ok := inboundByType[header.Type]
+	if !ok {
+		return nil, invalid("type", "未知的消息类型 %q", header.Type)
+	}
+	msg := reflect.New(t).Interface().(Message)
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(msg); err != nil {
+		return nil, decodeError(err)
+	}
+	if decoder.More() {
+		return nil, invalid("", "消息后有多余的内容")
+	}
+
+	if v, ok := msg.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// decodeError 把 encoding/json 的错误转换为 ValidationError
+func decodeError(err error) *ValidationError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return invalid(typeErr.Field, "类型错误，应为 %s", typeErr.Type.Kind())
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return invalid(strings.Trim(field, `"`), "未知的字段")
+	}
+	return invalid("", "消息格式错误: %v", err)
+}
+
+// Marshal 编码服务器发出的消息，自动填写版本和类型
+func Marshal(msg Message) ([]byte, error) {
+	h := msg.header()
+	h.V = Version
+	h.Type = msg.MessageType()
+	return json.Marshal(msg)
+}
@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/chenhailong/hong3/config"
+)
+
+func TestDecode(t *testing.T) {
+	msg, err := Decode([]byte(`{"v":1,"type":"game_action","action_id":"a1","action":"play_cards","card_indices":[0,2]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	action, ok := msg.(*GameAction)
+	if !ok {
+		t.Fatalf("decoded %T, want *GameAction", msg)
+	}
+	if action.ActionID != "a1" || action.Action != ActionPlayCards || len(action.CardIndices) != 2 {
+		t.Errorf("decoded %+v", action)
+	}
+
+	// 未携带版本号的消息按当前版本处理
+	if _, err := Decode([]byte(`{"type":"resync"}`)); err != nil {
+		t.Errorf("message without version: %v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		field string
+		want  string
+	}{
+		{"not json", `join_room`, "", "消息不是有效的 JSON 对象"},
+		{"array", `[]`, "", "消息不是有效的 JSON 对象"},
+		{"unsupported version", `{"v":2,"type":"resync"}`, "v", "不支持的协议版本 2（当前版本 1）"},
+		{"missing type", `{"v":1}`, "type", "缺少消息类型"},
+		{"unknown type", `{"v":1,"type":"cheat"}`, "type", `未知的消息类型 "cheat"`},
+		{"server message", `{"v":1,"type":"game_state"}`, "type", `未知的消息类型 "game_state"`},
+		{"unknown field", `{"v":1,"type":"join_room","room_id":"r1","password":"x"}`, "password", "未知的字段"},
+		{"type mismatch", `{"v":1,"type":"join_room","room_id":1}`, "room_id", "类型错误，应为 string"},
+		{"nested type mismatch", `{"v":1,"type":"game_action","action":"play_cards","card_indices":["0"]}`, "card_indices.0", "类型错误，应为 int"},
+		{"trailing data", `{"v":1,"type":"resync"} {}`, "", "消息不是有效的 JSON 对象"},
+		{"fails validation", `{"v":1,"type":"join_room"}`, "room_id", "不能为空"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode([]byte(tt.data))
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("error %v, want a ValidationError", err)
+			}
+			if validationErr.Field != tt.field || validationErr.Message != tt.want {
+				t.Errorf("error field %q message %q, want %q %q", validationErr.Field, validationErr.Message, tt.field, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalFillsHeader(t *testing.T) {
+	data, err := Marshal(&Resync{Header: Header{V: 99, Type: "other"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != `{"v":1,"type":"resync"}` {
+		t.Errorf("marshaled %s", got)
+	}
+}
+
+// TestMinMessageSize 文本最长且全部转义的消息不超过读取上限的最小值
+func TestMinMessageSize(t *testing.T) {
+	// 每个字符都是辅助平面的 emoji，转义为代理对；ID 的每个字节都转义
+	text := strings.Repeat(`\ud83c\udccf`, maxTextLength)
+	id := strings.Repeat(`\u0069`, maxIDLength)
+	messages := []string{
+		`{"v":1,"type":"kick_player","player_id":"` + id + `","reason":"` + text + `"}`,
+		`{"v":1,"type":"close_room","room_id":"` + id + `","reason":"` + text + `"}`,
+		`{"v":1,"type":"announce","message":"` + text + `"}`,
+	}
+	for _, data := range messages {
+		if len(data) > MinMessageSize {
+			t.Errorf("%d byte message exceeds MinMessageSize %d", len(data), MinMessageSize)
+		}
+		if _, err := Decode([]byte(data)); err != nil {
+			t.Errorf("longest message rejected: %v", err)
+		}
+	}
+
+	// 超长一个字符的文本返回校验错误
+	if _, err := Decode([]byte(`{"v":1,"type":"announce","message":"` + text + `x"}`)); err == nil {
+		t.Error("text over maxTextLength accepted")
+	}
+
+	// 配置校验使用同一个最小值（config 不能依赖 protocol，只能分别定义）
+	cfg := config.Default()
+	cfg.WebSocket.MaxMessageSize = MinMessageSize
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("config rejects max_message_size %d: %v", MinMessageSize, err)
+	}
+	cfg.WebSocket.MaxMessageSize = MinMessageSize - 1
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("config accepts max_message_size %d", MinMessageSize-1)
+	}
+}
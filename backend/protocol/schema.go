@@ -0,0 +1,256 @@
+package protocol
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/chenhailong/hong3/models"
+)
+
+// SchemaDialect 生成的 JSON Schema 使用的规范版本
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// namedEnums 字段上没有 enum 标签时，按类型补充的取值范围
+var namedEnums = map[reflect.Type][]interface{}{
+	reflect.TypeOf(models.Suit("")): {models.Hearts, models.Diamonds, models.Clubs, models.Spades},
+}
+
+// knownTypes 按类型直接给出 schema 的类型，不通过反射展开
+var knownTypes = map[reflect.Type]func() map[string]interface{}{
+	reflect.TypeOf(time.Time{}): func() map[string]interface{} {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	},
+	// 任意 JSON 值
+	reflect.TypeOf(json.RawMessage(nil)): func() map[string]interface{} {
+		return map[string]interface{}{}
+	},
+}
+
+// Schema 生成协议的 JSON Schema
+//
+// 每条消息和嵌套的结构体都定义在 $defs 中，$defs/Inbound 和 $defs/Outbound
+// 分别列出客户端和服务器可以发送的消息。
+func Schema() map[string]interface{} {
+	g := NewSchemaGenerator("#/$defs/")
+
+	inbound := make([]interface{}, 0, len(Inbound))
+	for _, m := range Inbound {
+		inbound = append(inbound, g.message(m, false))
+	}
+	outbound := make([]interface{}, 0, len(Outbound))
+	for _, m := range Outbound {
+		outbound = append(outbound, g.message(m, true))
+	}
+	g.defs["Inbound"] = map[string]interface{}{
+		"description": "客户端发送的消息",
+		"oneOf":       inbound,
+	}
+	g.defs["Outbound"] = map[string]interface{}{
+		"description": "服务器发送的消息",
+		"oneOf":       outbound,
+	}
+
+	return map[string]interface{}{
+		"$schema": SchemaDialect,
+		"title":   "Hong3 WebSocket protocol",
+		"version": Version,
+		"$defs":   g.defs,
+		"anyOf": []interface{}{
+			g.ref("Inbound"),
+			g.ref("Outbound"),
+		},
+	}
+}
+
+// SchemaGenerator 通过反射生成 JSON Schema，也用于生成 REST 接口的 OpenAPI 文档
+//
+// 结构体生成为定义并通过 $ref 引用；字段名来自 json 标签，没有 omitempty 的字段是必填字段，
+// 必填的指针和切片可以为 null。
+type SchemaGenerator struct {
+	defs  map[string]interface{}
+	types map[string]reflect.Type // 定义名对应的类型
+
+	// 引用定义时使用的前缀，例如 "#/$defs/" 或 "#/components/schemas/"
+	refPrefix string
+}
+
+// NewSchemaGenerator 创建 SchemaGenerator，refPrefix 为引用定义时使用的前缀
+func NewSchemaGenerator(refPrefix string) *SchemaGenerator {
+	return &SchemaGenerator{
+		defs:      make(map[string]interface{}),
+		types:     make(map[string]reflect.Type),
+		refPrefix: refPrefix,
+	}
+}
+
+// TypeSchema 生成类型的 schema，结构体返回对定义的引用
+func (g *SchemaGenerator) TypeSchema(t reflect.Type) map[string]interface{} {
+	return g.schema(t, false)
+}
+
+// Defs 已生成的定义，key 为类型名
+func (g *SchemaGenerator) Defs() map[string]interface{} {
+	return g.defs
+}
+
+// message 生成消息的定义，返回对它的引用
+//
+// 客户端可以省略 v（按当前版本处理），服务器发出的消息总是带有 v。
+func (g *SchemaGenerator) message(m Message, versionRequired bool) map[string]interface{} {
+	t := reflect.TypeOf(m).Elem()
+	schema := g.object(t)
+
+	properties := schema["properties"].(map[string]interface{})
+	properties["v"] = map[string]interface{}{"const": Version}
+	properties["type"] = map[string]interface{}{"const": m.MessageType()}
+
+	required := []string{"type"}
+	if versionRequired {
+		required = append(required, "v")
+	}
+	for _, name := range schema["required"].([]string) {
+		if name != "v" && name != "type" {
+			required = append(required, name)
+		}
+	}
+	schema["required"] = required
+
+	name := g.name(t)
+	g.defs[name] = schema
+	return g.ref(name)
+}
+
+// object 生成结构体的 schema，嵌入的结构体字段会展开
+func (g *SchemaGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+	g.fields(t, properties, &required)
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// fields 收集结构体的 JSON 字段
+func (g *SchemaGenerator) fields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, properties, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		omitempty := strings.Contains(opts, "omitempty")
+
+		schema := g.schema(f.Type, !omitempty)
+		if enum := f.Tag.Get("enum"); enum != "" {
+			values := make([]interface{}, 0)
+			for _, v := range strings.Split(enum, ",") {
+				values = append(values, v)
+			}
+			schema["enum"] = values
+		}
+		properties[name] = schema
+		if !omitempty {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// schema 生成类型的 schema，nullable 为 true 时指针和切片可以为 null
+func (g *SchemaGenerator) schema(t reflect.Type, nullable bool) map[string]interface{} {
+	if known, ok := knownTypes[t]; ok {
+		return known()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if nullable {
+			return map[string]interface{}{
+				"anyOf": []interface{}{g.schema(t.Elem(), false), map[string]interface{}{"type": "null"}},
+			}
+		}
+		return g.schema(t.Elem(), false)
+
+	case reflect.Struct:
+		name := g.name(t)
+		if _, ok := g.defs[name]; !ok {
+			// 先占位，避免递归类型无限展开
+			g.defs[name] = nil
+			g.defs[name] = g.object(t)
+		}
+		return g.ref(name)
+
+	case reflect.Slice, reflect.Array:
+		schema := map[string]interface{}{
+			"type":  "array",
+			"items": g.schema(t.Elem(), false),
+		}
+		if t.Kind() == reflect.Array {
+			schema["minItems"] = t.Len()
+			schema["maxItems"] = t.Len()
+		} else if nullable {
+			schema["type"] = []string{"array", "null"}
+		}
+		return schema
+
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": g.schema(t.Elem(), false),
+		}
+
+	case reflect.String:
+		schema := map[string]interface{}{"type": "string"}
+		if values, ok := namedEnums[t]; ok {
+			schema["enum"] = values
+		}
+		return schema
+
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+// name 结构体的定义名，与其他包中的同名类型冲突时加上包名，例如 RedisRoomPlayer
+func (g *SchemaGenerator) name(t reflect.Type) string {
+	name := t.Name()
+	if other, ok := g.types[name]; ok && other != t {
+		pkg := path.Base(t.PkgPath())
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	g.types[name] = t
+	return name
+}
+
+// ref 引用已生成的定义
+func (g *SchemaGenerator) ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": g.refPrefix + name}
+}
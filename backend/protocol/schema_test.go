@@ -0,0 +1,25 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// TestSchemaUpToDate schema.json 与消息定义一致，修改消息后需要运行 go generate ./protocol
+func TestSchemaUpToDate(t *testing.T) {
+	want, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, '\n')
+
+	got, err := os.ReadFile("schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("schema.json is out of date, run go generate ./protocol")
+	}
+}
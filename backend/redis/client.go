@@ -3,18 +3,29 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
 	"time"
 
 	"github.com/chenhailong/hong3/config"
+	"github.com/chenhailong/hong3/logging"
 	redispkg "github.com/redis/go-redis/v9"
 )
 
 var Client *redispkg.Client
 var ctx = context.Background()
 
+// ErrTokenNotFound token 不存在或已过期
+var ErrTokenNotFound = errors.New("token not found")
+
+// ErrOIDCStateNotFound OIDC 登录流程不存在、已过期或已被使用
+var ErrOIDCStateNotFound = errors.New("oidc state not found")
+
+// redisLogger Redis 相关日志
+var redisLogger = slog.Default()
+
 // TokenData token 数据
 type TokenData struct {
 	UserID    string    `json:"user_id"`
@@ -23,14 +34,19 @@ type TokenData struct {
 }
 
 // InitRedis 初始化 Redis 连接
-func InitRedis() (*redispkg.Client, error) {
+func InitRedis(logger *slog.Logger) (*redispkg.Client, error) {
+	redisLogger = logging.OrDefault(logger).With("component", "redis")
+
 	cfg := config.AppConfig
 	if cfg == nil {
-		cfg = config.LoadConfig()
+		var err error
+		if cfg, err = config.LoadConfig(""); err != nil {
+			return nil, err
+		}
 	}
 
 	if !cfg.Redis.Enabled {
-		log.Println("Redis is disabled in configuration")
+		redisLogger.Info("Redis is disabled in configuration")
 		return nil, fmt.Errorf("redis is disabled")
 	}
 
@@ -44,6 +60,7 @@ func InitRedis() (*redispkg.Client, error) {
 		Password: cfg.Redis.Password,
 		DB:       cfg.Redis.DB,
 	})
+	Client.AddHook(metricsHook{})
 
 	// 测试连接
 	_, err = Client.Ping(ctx).Result()
@@ -51,7 +68,7 @@ func InitRedis() (*redispkg.Client, error) {
 		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	log.Println("Redis connected successfully")
+	redisLogger.Info("Redis connected successfully", "host", cfg.Redis.Host, "db", cfg.Redis.DB)
 	return Client, nil
 }
 
@@ -72,6 +89,15 @@ func SetToken(token string, data *TokenData, expiration time.Duration) error {
 		return fmt.Errorf("failed to set token: %w", err)
 	}
 
+	// 记录用户的 token 列表，用于撤销会话
+	userKey := fmt.Sprintf("user_tokens:%s", data.UserID)
+	pipe := Client.TxPipeline()
+	pipe.SAdd(ctx, userKey, token)
+	pipe.Expire(ctx, userKey, expiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to index token: %w", err)
+	}
+
 	return nil
 }
 
@@ -85,7 +111,7 @@ func GetToken(token string) (*TokenData, error) {
 	val, err := Client.Get(ctx, key).Result()
 	if err != nil {
 		if err == redispkg.Nil {
-			return nil, fmt.Errorf("token not found")
+			return nil, ErrTokenNotFound
 		}
 		return nil, fmt.Errorf("failed to get token: %w", err)
 	}
@@ -113,6 +139,153 @@ func DeleteToken(token string) error {
 	return nil
 }
 
+// GetUserTokens 获取用户所有仍然有效的 token 数据，key 为 token
+func GetUserTokens(userID string) (map[string]*TokenData, error) {
+	if Client == nil {
+		return nil, fmt.Errorf("redis client not initialized")
+	}
+
+	userKey := fmt.Sprintf("user_tokens:%s", userID)
+	tokens, err := Client.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user tokens: %w", err)
+	}
+
+	result := make(map[string]*TokenData, len(tokens))
+	for _, token := range tokens {
+		data, err := GetToken(token)
+		if err != nil {
+			// token 已过期，顺便从列表中移除
+			Client.SRem(ctx, userKey, token)
+			continue
+		}
+		result[token] = data
+	}
+
+	return result, nil
+}
+
+// DeleteUserTokens 删除用户的所有 token，except 不为空时保留该 token
+func DeleteUserTokens(userID, except string) error {
+	if Client == nil {
+		return fmt.Errorf("redis client not initialized")
+	}
+
+	userKey := fmt.Sprintf("user_tokens:%s", userID)
+	tokens, err := Client.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list user tokens: %w", err)
+	}
+
+	pipe := Client.TxPipeline()
+	for _, token := range tokens {
+		if token == except {
+			continue
+		}
+		pipe.Del(ctx, fmt.Sprintf("token:%s", token))
+		pipe.SRem(ctx, userKey, token)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete user tokens: %w", err)
+	}
+
+	return nil
+}
+
+// IncrAttempts 累加尝试次数，计数在 window 内有效，返回当前次数
+func IncrAttempts(key string, window time.Duration) (int64, error) {
+	if Client == nil {
+		return 0, fmt.Errorf("redis client not initialized")
+	}
+
+	attemptsKey := fmt.Sprintf("attempts:%s", key)
+	pipe := Client.TxPipeline()
+	incr := pipe.Incr(ctx, attemptsKey)
+	pipe.ExpireNX(ctx, attemptsKey, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to increase attempts: %w", err)
+	}
+
+	return incr.Val(), nil
+}
+
+// ResetAttempts 清空尝试次数和锁定
+func ResetAttempts(key string) error {
+	if Client == nil {
+		return fmt.Errorf("redis client not initialized")
+	}
+
+	err := Client.Del(ctx, fmt.Sprintf("attempts:%s", key), fmt.Sprintf("lockout:%s", key)).Err()
+	if err != nil {
+		return fmt.Errorf("failed to reset attempts: %w", err)
+	}
+
+	return nil
+}
+
+// SetLockout 锁定 key 一段时间
+func SetLockout(key string, duration time.Duration) error {
+	if Client == nil {
+		return fmt.Errorf("redis client not initialized")
+	}
+
+	err := Client.Set(ctx, fmt.Sprintf("lockout:%s", key), 1, duration).Err()
+	if err != nil {
+		return fmt.Errorf("failed to set lockout: %w", err)
+	}
+
+	return nil
+}
+
+// GetLockout 获取 key 剩余的锁定时间，未锁定时返回 0
+func GetLockout(key string) (time.Duration, error) {
+	if Client == nil {
+		return 0, fmt.Errorf("redis client not initialized")
+	}
+
+	ttl, err := Client.PTTL(ctx, fmt.Sprintf("lockout:%s", key)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get lockout: %w", err)
+	}
+	if ttl < 0 {
+		// -2 表示不存在，-1 表示没有过期时间
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+// SetOIDCState 保存 OIDC 登录流程的状态，回调可能由集群中的其他实例处理
+func SetOIDCState(state string, data []byte, expiration time.Duration) error {
+	if Client == nil {
+		return fmt.Errorf("redis client not initialized")
+	}
+
+	err := Client.Set(ctx, fmt.Sprintf("oidc_state:%s", state), data, expiration).Err()
+	if err != nil {
+		return fmt.Errorf("failed to set oidc state: %w", err)
+	}
+
+	return nil
+}
+
+// TakeOIDCState 取出并删除 OIDC 登录流程的状态，每个状态只能使用一次
+func TakeOIDCState(state string) ([]byte, error) {
+	if Client == nil {
+		return nil, fmt.Errorf("redis client not initialized")
+	}
+
+	data, err := Client.GetDel(ctx, fmt.Sprintf("oidc_state:%s", state)).Bytes()
+	if err != nil {
+		if err == redispkg.Nil {
+			return nil, ErrOIDCStateNotFound
+		}
+		return nil, fmt.Errorf("failed to get oidc state: %w", err)
+	}
+
+	return data, nil
+}
+
 // TokenExists 检查 token 是否存在
 func TokenExists(token string) (bool, error) {
 	if Client == nil {
@@ -138,3 +311,11 @@ func CleanExpiredTokens() error {
 	// 通常不需要手动清理，因为 Redis 的 TTL 会自动处理
 	return nil
 }
+
+// Close 关闭 Redis 客户端
+func Close() error {
+	if Client == nil {
+		return nil
+	}
+	return Client.Close()
+}
@@ -0,0 +1,257 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	redispkg "github.com/redis/go-redis/v9"
+)
+
+// 多实例模式下房间所有权和房间状态的存储
+//
+//	room_owner:<id>  拥有房间的实例ID（租约，带过期时间）
+//	room_info:<id>   房间概要（RoomInfo 的 JSON），用于集群范围的房间列表
+//	room_state:<id>  游戏快照，房间转移到其他实例时用于恢复
+//	rooms            所有房间ID的集合
+
+// RoomInfo 房间概要
+type RoomInfo struct {
+	ID       string       `json:"id"`
+	Players  []RoomPlayer `json:"players"`
+	Status   string       `json:"status"`
+	Capacity int          `json:"capacity"`
+	Locked   bool         `json:"locked,omitempty"` // 已被房主锁定，不能加入
+	Owner    string       `json:"owner,omitempty"`  // 拥有房间的实例ID（仅多实例模式）
+}
+
+// RoomPlayer 房间内的玩家
+type RoomPlayer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// renewScript 仅当租约仍属于该实例时续期
+var renewScript = redispkg.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseScript 仅当租约仍属于该实例时释放
+var releaseScript = redispkg.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// ClaimRoom 尝试获取房间所有权，返回当前拥有房间的实例ID（可能是其他实例）
+func ClaimRoom(roomID, instanceID string, ttl time.Duration) (string, error) {
+	if Client == nil {
+		return "", fmt.Errorf("redis client not initialized")
+	}
+
+	key := fmt.Sprintf("room_owner:%s", roomID)
+	for {
+		ok, err := Client.SetNX(ctx, key, instanceID, ttl).Result()
+		if err != nil {
+			return "", fmt.Errorf("failed to claim room: %w", err)
+		}
+		if ok {
+			return instanceID, nil
+		}
+
+		owner, err := Client.Get(ctx, key).Result()
+		if err == redispkg.Nil {
+			// 租约恰好过期，重新尝试
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to get room owner: %w", err)
+		}
+		return owner, nil
+	}
+}
+
+// RenewRoom 续期房间租约，租约已不属于该实例时返回 false
+func RenewRoom(roomID, instanceID string, ttl time.Duration) (bool, error) {
+	if Client == nil {
+		return false, fmt.Errorf("redis client not initialized")
+	}
+
+	key := fmt.Sprintf("room_owner:%s", roomID)
+	n, err := renewScript.Run(ctx, Client, []string{key}, instanceID, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to renew room lease: %w", err)
+	}
+	return n == 1, nil
+}
+
+// ReleaseRoom 释放房间租约（保留房间状态，其他实例可以接管）
+func ReleaseRoom(roomID, instanceID string) error {
+	if Client == nil {
+		return fmt.Errorf("redis client not initialized")
+	}
+
+	key := fmt.Sprintf("room_owner:%s", roomID)
+	if err := releaseScript.Run(ctx, Client, []string{key}, instanceID).Err(); err != nil {
+		return fmt.Errorf("failed to release room lease: %w", err)
+	}
+	return nil
+}
+
+// GetRoomOwner 获取拥有房间的实例ID，没有实例拥有时返回空字符串
+func GetRoomOwner(roomID string) (string, error) {
+	if Client == nil {
+		return "", fmt.Errorf("redis client not initialized")
+	}
+
+	owner, err := Client.Get(ctx, fmt.Sprintf("room_owner:%s", roomID)).Result()
+	if err == redispkg.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get room owner: %w", err)
+	}
+	return owner, nil
+}
+
+// SaveRoom 保存房间概要和游戏快照，ttl 内没有实例接管时自动过期
+func SaveRoom(info *RoomInfo, state []byte, ttl time.Duration) error {
+	if Client == nil {
+		return fmt.Errorf("redis client not initialized")
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to marshal room info: %w", err)
+	}
+
+	pipe := Client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("room_info:%s", info.ID), data, ttl)
+	pipe.Set(ctx, fmt.Sprintf("room_state:%s", info.ID), state, ttl)
+	pipe.SAdd(ctx, "rooms", info.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save room: %w", err)
+	}
+	return nil
+}
+
+// LoadRoomState 获取房间的游戏快照，不存在时返回 nil
+func LoadRoomState(roomID string) ([]byte, error) {
+	if Client == nil {
+		return nil, fmt.Errorf("redis client not initialized")
+	}
+
+	state, err := Client.Get(ctx, fmt.Sprintf("room_state:%s", roomID)).Bytes()
+	if err == redispkg.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load room state: %w", err)
+	}
+	return state, nil
+}
+
+// GetRoomInfo 获取房间的概要，不存在时返回 nil
+func GetRoomInfo(roomID string) (*RoomInfo, error) {
+	if Client == nil {
+		return nil, fmt.Errorf("redis client not initialized")
+	}
+
+	data, err := Client.Get(ctx, fmt.Sprintf("room_info:%s", roomID)).Bytes()
+	if err == redispkg.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room info: %w", err)
+	}
+	var info RoomInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal room info: %w", err)
+	}
+	return &info, nil
+}
+
+// DeleteRoom 删除房间的概要和状态（房间已解散）
+func DeleteRoom(roomID string) error {
+	if Client == nil {
+		return fmt.Errorf("redis client not initialized")
+	}
+
+	pipe := Client.TxPipeline()
+	pipe.Del(ctx, fmt.Sprintf("room_info:%s", roomID), fmt.Sprintf("room_state:%s", roomID))
+	pipe.SRem(ctx, "rooms", roomID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete room: %w", err)
+	}
+	return nil
+}
+
+// ListRooms 获取集群中所有房间的概要
+func ListRooms() ([]*RoomInfo, error) {
+	if Client == nil {
+		return nil, fmt.Errorf("redis client not initialized")
+	}
+
+	ids, err := Client.SMembers(ctx, "rooms").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rooms: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = fmt.Sprintf("room_info:%s", id)
+	}
+	values, err := Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get room info: %w", err)
+	}
+
+	rooms := make([]*RoomInfo, 0, len(ids))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			// 房间概要已过期，顺便从集合中移除
+			Client.SRem(ctx, "rooms", ids[i])
+			continue
+		}
+		var info RoomInfo
+		if err := json.Unmarshal([]byte(data), &info); err != nil {
+			continue
+		}
+		rooms = append(rooms, &info)
+	}
+	return rooms, nil
+}
+
+// Publish 向频道发布消息
+func Publish(channel string, data []byte) error {
+	if Client == nil {
+		return fmt.Errorf("redis client not initialized")
+	}
+
+	if err := Client.Publish(ctx, channel, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+// Subscribe 订阅频道，调用方负责 Close
+func Subscribe(c context.Context, channels ...string) (*redispkg.PubSub, error) {
+	if Client == nil {
+		return nil, fmt.Errorf("redis client not initialized")
+	}
+
+	pubsub := Client.Subscribe(c, channels...)
+	// 等待订阅确认，确保之后发布的消息不会丢失
+	if _, err := pubsub.Receive(c); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	return pubsub, nil
+}
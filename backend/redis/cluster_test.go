@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redispkg "github.com/redis/go-redis/v9"
+	"github.com/redis/go-redis/v9/maintnotifications"
+)
+
+// useMiniredis 连接到进程内的 miniredis，测试结束后断开
+func useMiniredis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	Client = redispkg.NewClient(&redispkg.Options{
+		Addr: mr.Addr(),
+		// miniredis 不支持 CLIENT MAINT_NOTIFICATIONS
+		MaintNotificationsConfig: &maintnotifications.Config{Mode: maintnotifications.ModeDisabled},
+	})
+	t.Cleanup(func() {
+		Client.Close()
+		Client = nil
+	})
+	return mr
+}
+
+// expectOwner 房间当前的 owner 应为 want
+func expectOwner(t *testing.T, roomID, want string) {
+	t.Helper()
+	owner, err := GetRoomOwner(roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != want {
+		t.Fatalf("owner %q, want %q", owner, want)
+	}
+}
+
+func TestRoomLease(t *testing.T) {
+	mr := useMiniredis(t)
+	ttl := 15 * time.Second
+
+	if owner, err := ClaimRoom("r1", "a", ttl); err != nil || owner != "a" {
+		t.Fatalf("first claim: %q %v, want a", owner, err)
+	}
+	if owner, err := ClaimRoom("r1", "b", ttl); err != nil || owner != "a" {
+		t.Fatalf("claim of an owned room: %q %v, want a", owner, err)
+	}
+
+	// 只有 owner 能续期和释放
+	if ok, err := RenewRoom("r1", "b", ttl); err != nil || ok {
+		t.Fatalf("renew by b: %v %v, want false", ok, err)
+	}
+	if err := ReleaseRoom("r1", "b"); err != nil {
+		t.Fatal(err)
+	}
+	expectOwner(t, "r1", "a")
+
+	// 续期后租约从续期时重新计算
+	mr.FastForward(10 * time.Second)
+	if ok, err := RenewRoom("r1", "a", ttl); err != nil || !ok {
+		t.Fatalf("renew by a: %v %v, want true", ok, err)
+	}
+	mr.FastForward(10 * time.Second)
+	expectOwner(t, "r1", "a")
+
+	// 租约过期后其他实例可以接管
+	mr.FastForward(ttl)
+	expectOwner(t, "r1", "")
+	if ok, err := RenewRoom("r1", "a", ttl); err != nil || ok {
+		t.Fatalf("renew of an expired lease: %v %v, want false", ok, err)
+	}
+	if owner, err := ClaimRoom("r1", "b", ttl); err != nil || owner != "b" {
+		t.Fatalf("claim after expiry: %q %v, want b", owner, err)
+	}
+
+	if err := ReleaseRoom("r1", "b"); err != nil {
+		t.Fatal(err)
+	}
+	expectOwner(t, "r1", "")
+}
+
+func TestSaveRoom(t *testing.T) {
+	mr := useMiniredis(t)
+	info := &RoomInfo{ID: "r1", Players: []RoomPlayer{{ID: "alice", Name: "Alice"}}, Status: "waiting", Capacity: 4, Owner: "a"}
+	if err := SaveRoom(info, []byte(`{"game":{}}`), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := GetRoomInfo("r1")
+	if err != nil || loaded == nil || loaded.Owner != "a" || len(loaded.Players) != 1 {
+		t.Fatalf("room info %+v, %v", loaded, err)
+	}
+	if state, err := LoadRoomState("r1"); err != nil || string(state) != `{"game":{}}` {
+		t.Fatalf("room state %s, %v", state, err)
+	}
+	if rooms, err := ListRooms(); err != nil || len(rooms) != 1 {
+		t.Fatalf("rooms %v, %v", rooms, err)
+	}
+
+	// 过期的房间从列表中移除
+	mr.FastForward(time.Minute)
+	if rooms, err := ListRooms(); err != nil || len(rooms) != 0 {
+		t.Fatalf("rooms after expiry %v, %v", rooms, err)
+	}
+	if loaded, err := GetRoomInfo("r1"); err != nil || loaded != nil {
+		t.Fatalf("expired room info %+v, %v", loaded, err)
+	}
+}
@@ -0,0 +1,40 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/chenhailong/hong3/metrics"
+	redispkg "github.com/redis/go-redis/v9"
+)
+
+// metricsHook 统计 Redis 命令耗时
+type metricsHook struct{}
+
+// DialHook 实现 redispkg.Hook
+func (metricsHook) DialHook(next redispkg.DialHook) redispkg.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+// ProcessHook 实现 redispkg.Hook
+func (metricsHook) ProcessHook(next redispkg.ProcessHook) redispkg.ProcessHook {
+	return func(ctx context.Context, cmd redispkg.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		metrics.RedisCommandDuration.WithLabelValues(cmd.Name()).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// ProcessPipelineHook 实现 redispkg.Hook
+func (metricsHook) ProcessPipelineHook(next redispkg.ProcessPipelineHook) redispkg.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redispkg.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		metrics.RedisCommandDuration.WithLabelValues("pipeline").Observe(time.Since(start).Seconds())
+		return err
+	}
+}
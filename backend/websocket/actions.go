@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"github.com/chenhailong/hong3/protocol"
+)
+
+// actionOutcome 游戏动作的处理结果
+type actionOutcome struct {
+	action string
+	err    string // 被拒绝的原因，执行成功时为空
+}
+
+// recentActions 一位玩家最近处理过的动作
+//
+// 记住的动作数由 game.recent_actions 配置，更早的动作ID重复发送时会再次执行。
+type recentActions struct {
+	outcomes map[string]actionOutcome
+
+	// 按处理顺序排列的动作ID，超出上限时淘汰最早的
+	order []string
+}
+
+// get 获取动作的处理结果
+func (a *recentActions) get(actionID string) (actionOutcome, bool) {
+	outcome, ok := a.outcomes[actionID]
+	return outcome, ok
+}
+
+// add 记录动作的处理结果
+func (a *recentActions) add(actionID string, outcome actionOutcome, limit int) {
+	if len(a.order) >= limit {
+		delete(a.outcomes, a.order[0])
+		a.order = a.order[1:]
+	}
+	a.outcomes[actionID] = outcome
+	a.order = append(a.order, actionID)
+}
+
+// handleAction 处理游戏动作
+//
+// 携带 action_id 的动作按玩家去重：重复的动作不再执行，直接回复第一次处理的结果。
+// 记录以玩家ID为键，断线重连后重发的动作同样会被识别。
+func (r *room) handleAction(client *Client, action *protocol.GameAction) {
+	if action.ActionID == "" {
+		if err := r.applyAction(client, action); err != nil {
+			client.sendError(err.Error())
+		}
+		return
+	}
+
+	recent := r.actions[client.playerID]
+	if recent == nil {
+		recent = &recentActions{outcomes: make(map[string]actionOutcome)}
+		r.actions[client.playerID] = recent
+	}
+	if outcome, ok := recent.get(action.ActionID); ok {
+		r.clientLog(client).Debug("重复的游戏动作", "action_id", action.ActionID, "action", outcome.action)
+		client.replyAction(action.ActionID, outcome, true)
+		return
+	}
+
+	outcome := actionOutcome{action: action.Action}
+	if err := r.applyAction(client, action); err != nil {
+		outcome.err = err.Error()
+	}
+	recent.add(action.ActionID, outcome, r.hub.gameConfig.RecentActions)
+	client.replyAction(action.ActionID, outcome, false)
+}
+
+// replyAction 回复携带 action_id 的动作的处理结果
+func (c *Client) replyAction(actionID string, outcome actionOutcome, duplicate bool) {
+	if outcome.err != "" {
+		c.sendMessage(&protocol.Error{Error: outcome.err, ActionID: actionID})
+		return
+	}
+	c.sendMessage(&protocol.ActionAck{ActionID: actionID, Action: outcome.action, Duplicate: duplicate})
+}
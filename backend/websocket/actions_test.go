@@ -0,0 +1,160 @@
+package websocket
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/chenhailong/hong3/config"
+	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/protocol"
+)
+
+// newActionsHub 每位玩家只记住 limit 个动作的 Hub
+func newActionsHub(t *testing.T, limit int) *Hub {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Game.RecentActions = limit
+	h := NewHub(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	go h.Run()
+	return h
+}
+
+// act 发送携带 action_id 的动作，返回玩家收到的回复（action_ack 或 error）
+func (p *testPlayer) act(h *Hub, actionID, action string) testMessage {
+	p.t.Helper()
+	h.HandleGameAction(p.client, &protocol.GameAction{ActionID: actionID, Action: action})
+	for _, m := range p.messages() {
+		if m.Type == protocol.TypeActionAck || m.Type == protocol.TypeError {
+			return m
+		}
+	}
+	p.t.Fatalf("%s got no reply to %s", p.client.playerID, actionID)
+	return testMessage{}
+}
+
+// TestActionReplay 重复的动作不再执行，回复第一次处理的结果
+func TestActionReplay(t *testing.T) {
+	h := newTestHub(t)
+	players := joinSeated(t, h, "replay-room", "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	var ack protocol.ActionAck
+	alice.act(h, "ready-1", protocol.ActionReady).decode(t, &ack)
+	if ack.ActionID != "ready-1" || ack.Action != protocol.ActionReady || ack.Duplicate {
+		t.Fatalf("first ack %+v, want ready-1 not duplicate", ack)
+	}
+	if _, ok := bob.last(protocol.TypePlayerReady); !ok {
+		t.Fatal("bob did not see alice get ready")
+	}
+
+	// 重发的动作只回复给发送者，不再广播
+	reply := alice.act(h, "ready-1", protocol.ActionReady)
+	if reply.Type != protocol.TypeActionAck {
+		t.Fatalf("replayed ready got %s, want action_ack", reply.Type)
+	}
+	var replayed protocol.ActionAck
+	reply.decode(t, &replayed)
+	if replayed.ActionID != "ready-1" || replayed.Action != protocol.ActionReady || !replayed.Duplicate {
+		t.Errorf("replayed ack %+v, want duplicate ready-1", replayed)
+	}
+	if messages := bob.messages(); len(messages) != 0 {
+		t.Errorf("bob got %d messages for a replayed action", len(messages))
+	}
+
+	// 重连后的新连接按玩家ID识别重复的动作
+	h.LeaveRoom(alice.client)
+	again := newTestPlayer(t, h, "alice", models.RolePlayer)
+	h.JoinRoom(again.client, "replay-room")
+	again.messages()
+	var reconnected protocol.ActionAck
+	again.act(h, "ready-1", protocol.ActionReady).decode(t, &reconnected)
+	if !reconnected.Duplicate {
+		t.Errorf("ack after reconnecting %+v, want duplicate", reconnected)
+	}
+}
+
+// TestActionReplayError 被拒绝的动作重发时回复同样的错误，不会再次执行
+func TestActionReplayError(t *testing.T) {
+	h := newTestHub(t)
+	alice := joinSeated(t, h, "error-room", "alice")[0]
+
+	first := alice.act(h, "pass-1", protocol.ActionPass)
+	if first.Type != protocol.TypeError {
+		t.Fatalf("pass before the game started got %s, want error", first.Type)
+	}
+	var rejected protocol.Error
+	first.decode(t, &rejected)
+	if rejected.ActionID != "pass-1" || rejected.Error == "" {
+		t.Fatalf("error %+v, want one for pass-1", rejected)
+	}
+
+	var replayed protocol.Error
+	alice.act(h, "pass-1", protocol.ActionPass).decode(t, &replayed)
+	if replayed.Error != rejected.Error || replayed.ActionID != "pass-1" {
+		t.Errorf("replayed error %+v, want %+v", replayed, rejected)
+	}
+
+	// 同一ID的不同动作同样视为重复，回复第一次的结果
+	var reused protocol.Error
+	alice.act(h, "pass-1", protocol.ActionReady).decode(t, &reused)
+	if reused.Error != rejected.Error {
+		t.Errorf("reused action_id got %+v, want the first error", reused)
+	}
+	if ready := alice.act(h, "ready-1", protocol.ActionReady); ready.Type != protocol.TypeActionAck {
+		t.Errorf("ready got %s, want action_ack", ready.Type)
+	}
+}
+
+// TestActionEviction 超出 game.recent_actions 后最早的动作被淘汰，重发时再次执行
+func TestActionEviction(t *testing.T) {
+	h := newActionsHub(t, 2)
+	alice := joinSeated(t, h, "evict-room", "alice")[0]
+
+	alice.act(h, "ready-1", protocol.ActionReady)
+	alice.act(h, "pass-1", protocol.ActionPass)
+
+	// 仍在记录中
+	var ack protocol.ActionAck
+	alice.act(h, "ready-1", protocol.ActionReady).decode(t, &ack)
+	if !ack.Duplicate {
+		t.Fatalf("ack %+v, want duplicate while ready-1 is remembered", ack)
+	}
+
+	alice.act(h, "pass-2", protocol.ActionPass)
+	var again protocol.ActionAck
+	alice.act(h, "ready-1", protocol.ActionReady).decode(t, &again)
+	if again.Duplicate {
+		t.Errorf("ack %+v, want ready-1 executed again after eviction", again)
+	}
+
+	r := testRoom(h, "evict-room")
+	r.do(func() {
+		recent := r.actions["alice"]
+		if len(recent.order) != 2 || len(recent.outcomes) != 2 {
+			t.Errorf("remembered %v (%d outcomes), want 2", recent.order, len(recent.outcomes))
+		}
+		if _, ok := recent.get("pass-1"); ok {
+			t.Error("pass-1 is still remembered")
+		}
+	})
+}
+
+func TestRecentActionsAdd(t *testing.T) {
+	recent := &recentActions{outcomes: make(map[string]actionOutcome)}
+	for _, id := range []string{"a", "b", "c"} {
+		recent.add(id, actionOutcome{action: protocol.ActionPass, err: id}, 2)
+	}
+
+	if _, ok := recent.get("a"); ok {
+		t.Error("oldest action a was not evicted")
+	}
+	for _, id := range []string{"b", "c"} {
+		if outcome, ok := recent.get(id); !ok || outcome.err != id {
+			t.Errorf("action %s: %+v, %v; want its outcome", id, outcome, ok)
+		}
+	}
+	if len(recent.order) != 2 || recent.order[0] != "b" || recent.order[1] != "c" {
+		t.Errorf("order %v, want [b c]", recent.order)
+	}
+}
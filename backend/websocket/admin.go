@@ -0,0 +1,267 @@
+package websocket
+
+import (
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/logging"
+	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/protocol"
+	"github.com/chenhailong/hong3/redis"
+	gorilla "github.com/gorilla/websocket"
+)
+
+// authorize 检查客户端是否拥有指定角色，没有时回复错误
+func (h *Hub) authorize(client *Client, role string) bool {
+	if models.RoleAtLeast(client.role, role) {
+		return true
+	}
+	client.logger.Warn("权限不足", "role", client.role, "required_role", role)
+	client.sendError("权限不足")
+	return false
+}
+
+// AdminRooms 获取所有房间的完整状态（不包含手牌）
+//
+// 多实例模式下包含其他实例的房间，按其 owner 最近一次同步到 Redis 的状态构建。
+func (h *Hub) AdminRooms() []map[string]interface{} {
+	local := make(map[string]bool)
+	rooms := make([]map[string]interface{}, 0)
+	for _, r := range h.acquireRooms() {
+		r.do(func() {
+			if !r.closed {
+				rooms = append(rooms, r.adminState(false))
+				local[r.id] = true
+			}
+		})
+	}
+
+	if h.cluster == nil {
+		return rooms
+	}
+
+	remote, err := redis.ListRooms()
+	if err != nil {
+		h.logger.Warn("failed to list cluster rooms", "error", err)
+		return rooms
+	}
+	for _, info := range remote {
+		if local[info.ID] {
+			continue
+		}
+		if state, ok := h.remoteAdminState(info, false); ok {
+			rooms = append(rooms, state)
+		}
+	}
+	return rooms
+}
+
+// AdminRoom 获取单个房间的完整状态（包含所有玩家的手牌），多实例模式下房间可以在其他实例上
+func (h *Hub) AdminRoom(roomID string) (map[string]interface{}, bool) {
+	if r := h.acquireRoom(roomID); r != nil {
+		var state map[string]interface{}
+		r.do(func() {
+			if !r.closed {
+				state = r.adminState(true)
+			}
+		})
+		if state != nil {
+			return state, true
+		}
+	}
+
+	if h.cluster == nil {
+		return nil, false
+	}
+	info, err := redis.GetRoomInfo(roomID)
+	if err != nil {
+		h.logger.Warn("failed to get cluster room", logging.KeyRoomID, roomID, "error", err)
+		return nil, false
+	}
+	if info == nil {
+		return nil, false
+	}
+	return h.remoteAdminState(info, true)
+}
+
+// remoteAdminState 按 Redis 中的房间概要和状态构建其他实例上房间的管理视图
+func (h *Hub) remoteAdminState(info *redis.RoomInfo, withHands bool) (map[string]interface{}, bool) {
+	data, err := redis.LoadRoomState(info.ID)
+	if err != nil {
+		h.logger.Warn("failed to load room state", logging.KeyRoomID, info.ID, "error", err)
+		return nil, false
+	}
+	if data == nil {
+		return nil, false
+	}
+	snapshot, err := decodeRoomSnapshot(data)
+	if err != nil {
+		h.logger.Error("invalid room state", logging.KeyRoomID, info.ID, "error", err)
+		return nil, false
+	}
+
+	clients := make([]map[string]interface{}, 0, len(info.Players))
+	for _, player := range info.Players {
+		clients = append(clients, map[string]interface{}{
+			"id":   player.ID,
+			"name": player.Name,
+		})
+	}
+	state := adminView(info.ID, clients, game.Restore(*snapshot.Game, h.logger), withHands)
+	state["owner"] = info.Owner
+	return state, true
+}
+
+// KickPlayer 将玩家踢出房间并断开连接，返回是否找到该玩家
+//
+// 多实例模式下广播到所有实例，踢出该玩家在每个实例上的连接；玩家在本实例上有连接，
+// 或在任一实例的房间中时视为找到。
+func (h *Hub) KickPlayer(playerID, reason string) bool {
+	found := h.kickLocal(playerID, reason)
+	if h.cluster == nil {
+		return found
+	}
+
+	h.publish(broadcastChannel, &envelope{Kind: envKick, PlayerID: playerID, Reason: reason})
+	if !found {
+		found = h.inClusterRoom(playerID)
+	}
+	return found
+}
+
+// kickLocal 踢出玩家在本实例上的所有连接，返回是否找到
+func (h *Hub) kickLocal(playerID, reason string) bool {
+	h.mutex.Lock()
+	targets := make([]*Client, 0)
+	for client := range h.clients {
+		if client.playerID == playerID {
+			targets = append(targets, client)
+		}
+	}
+	h.mutex.Unlock()
+
+	for _, client := range targets {
+		if r := h.clientRoom(client); r != nil {
+			r.do(func() {
+				if r.game.Status == game.GameStatusWaiting {
+					r.game.RemovePlayer(client.playerID)
+				}
+				r.leave(client)
+			})
+		}
+		client.sendMessage(&protocol.Kicked{Reason: reason})
+		client.Disconnect(gorilla.ClosePolicyViolation, "kicked")
+	}
+
+	if len(targets) > 0 {
+		h.logger.Info("踢出玩家", logging.KeyPlayerID, playerID, "reason", reason)
+	}
+	return len(targets) > 0
+}
+
+// inClusterRoom 玩家是否在集群中某个房间里
+func (h *Hub) inClusterRoom(playerID string) bool {
+	rooms, err := redis.ListRooms()
+	if err != nil {
+		h.logger.Warn("failed to list cluster rooms", "error", err)
+		return false
+	}
+	for _, info := range rooms {
+		for _, player := range info.Players {
+			if player.ID == playerID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CloseRoom 关闭房间，房间内的玩家回到大厅，返回房间是否存在
+func (h *Hub) CloseRoom(roomID, reason string) bool {
+	r := h.acquireRoom(roomID)
+	if r == nil {
+		return false
+	}
+
+	found := false
+	r.do(func() {
+		if r.closed {
+			return
+		}
+		found = true
+		r.close(&protocol.RoomClosed{RoomID: roomID, Reason: reason})
+	})
+
+	if found {
+		h.logger.Info("关闭房间", logging.KeyRoomID, roomID, "reason", reason)
+	}
+	return found
+}
+
+// Announce 向所有在线客户端发送服务器公告
+func (h *Hub) Announce(message string) {
+	data, err := protocol.Marshal(&protocol.Announcement{Message: message})
+	if err != nil {
+		h.logger.Error("Error marshalling announcement", "error", err)
+		return
+	}
+
+	// 多实例模式下广播到所有实例（包括本实例）
+	if h.cluster != nil {
+		h.publish(broadcastChannel, &envelope{Kind: envAnnounce, Data: data})
+		return
+	}
+	h.broadcast <- data
+}
+
+// adminState 构建房间的管理视图
+func (r *room) adminState(withHands bool) map[string]interface{} {
+	clients := make([]map[string]interface{}, 0, len(r.clients))
+	for client := range r.clients {
+		clients = append(clients, map[string]interface{}{
+			"id":   client.playerID,
+			"name": client.playerName,
+		})
+	}
+
+	state := adminView(r.id, clients, r.game, withHands)
+	if r.hub.cluster != nil {
+		state["owner"] = r.hub.cluster.id
+	}
+	return state
+}
+
+// adminView 房间管理视图：房间内的连接和游戏状态
+func adminView(roomID string, clients []map[string]interface{}, g *game.Game, withHands bool) map[string]interface{} {
+	players := make([]map[string]interface{}, 0, 4)
+	for _, p := range g.Players {
+		if p == nil {
+			continue
+		}
+		player := map[string]interface{}{
+			"id":              p.ID,
+			"name":            p.Name,
+			"position":        p.Position,
+			"status":          p.Status,
+			"team":            p.Team,
+			"card_count":      p.CardCount,
+			"collected_cards": p.CollectedCards,
+		}
+		if withHands {
+			player["cards"] = p.Cards
+		}
+		players = append(players, player)
+	}
+
+	return map[string]interface{}{
+		"id":      roomID,
+		"clients": clients,
+		"game": map[string]interface{}{
+			"status":         g.GetStatus(),
+			"team_type":      g.TeamType,
+			"current_player": g.CurrentPlayer,
+			"last_player":    g.LastPlayer,
+			"table_cards":    protocol.NewTableCards(g.TableCards),
+			"finished_order": g.FinishedOrder,
+			"players":        players,
+		},
+	}
+}
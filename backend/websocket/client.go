@@ -1,36 +1,40 @@
 package websocket
 
 import (
-	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
+	"sync"
 	"time"
 
+	"github.com/chenhailong/hong3/logging"
+	"github.com/chenhailong/hong3/metrics"
+	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/protocol"
 	"github.com/gorilla/websocket"
 )
 
-const (
-	// 写入超时
-	writeWait = 10 * time.Second
+// Client 是WebSocket连接的中间人
+type Client struct {
+	hub *Hub
 
-	// 读取超时
-	pongWait = 60 * time.Second
+	// 客户端ID（多实例模式下用于在实例之间识别连接）
+	id string
 
-	// 发送ping的频率
-	pingPeriod = (pongWait * 9) / 10
+	// 其他实例转发来的客户端所在的实例ID（本实例的连接为空，此时 conn 为 nil）
+	origin string
 
-	// 最大消息大小
-	maxMessageSize = 512
-)
+	// 其他实例转发来的消息，由 remoteReadPump 依次处理（只用于远程客户端，注销时关闭）
+	inbox chan []byte
 
-// Client 是WebSocket连接的中间人
-type Client struct {
-	hub *Hub
+	// 客户端接入的其他实例上的房间及其 owner（多实例模式）
+	owner      string
+	remoteRoom string
 
 	// WebSocket连接
 	conn *websocket.Conn
 
-	// 发送消息的缓冲通道
-	send chan []byte
+	// 发送队列，只由 Hub.unregister 关闭（或客户端跟不上时丢弃）
+	send *sendQueue
 
 	// 玩家ID
 	playerID string
@@ -38,21 +42,51 @@ type Client struct {
 	// 玩家名称
 	playerName string
 
-	// 房间ID
+	// 所在的房间ID（由 Hub 的锁保护）
 	roomID string
+
+	// 已注销，不能再加入房间（由 Hub 的锁保护）
+	unregistered bool
+
+	// 用户角色（未携带 token 连接时为普通玩家）
+	role string
+
+	// 连接时携带了有效的 token，玩家ID已经过验证（REST 会话总是已验证）
+	verified bool
+
+	// 日志（带玩家ID和连接请求ID）
+	logger *slog.Logger
+
+	// 主动断开连接的信号及关闭帧
+	quit       chan struct{}
+	quitOnce   sync.Once
+	closeFrame []byte
 }
 
 // NewClient 创建一个新的客户端
-func NewClient(hub *Hub, conn *websocket.Conn, playerID, playerName string) *Client {
+func NewClient(hub *Hub, conn *websocket.Conn, playerID, playerName, role string, verified bool, logger *slog.Logger) *Client {
 	return &Client{
+		logger:     logging.OrDefault(logger).With(logging.KeyPlayerID, playerID),
 		hub:        hub,
+		id:         newClientID(),
 		conn:       conn,
-		send:       make(chan []byte, 256),
+		send:       newSendQueue(),
 		playerID:   playerID,
 		playerName: playerName,
+		role:       role,
+		verified:   verified,
+		quit:       make(chan struct{}),
 	}
 }
 
+// Disconnect 发送完已排队的消息后，以指定的关闭码断开连接
+func (c *Client) Disconnect(code int, reason string) {
+	c.quitOnce.Do(func() {
+		c.closeFrame = websocket.FormatCloseMessage(code, reason)
+		close(c.quit)
+	})
+}
+
 // ReadPump 从WebSocket连接中泵取消息
 func (c *Client) ReadPump() {
 	defer func() {
@@ -60,10 +94,11 @@ func (c *Client) ReadPump() {
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	cfg := c.hub.config
+	c.conn.SetReadLimit(cfg.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(cfg.PongTimeout))
 	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.conn.SetReadDeadline(time.Now().Add(cfg.PongTimeout))
 		return nil
 	})
 
@@ -71,28 +106,22 @@ func (c *Client) ReadPump() {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("连接异常关闭: %v", err)
+				c.logger.Warn("连接异常关闭", "error", err)
 			} else {
-				log.Printf("连接正常关闭 (ID: %s)", c.playerID)
+				c.logger.Info("连接正常关闭")
 			}
 			break
 		}
 
-		// 解析消息
-		var data map[string]interface{}
-		if err := json.Unmarshal(message, &data); err != nil {
-			log.Printf("解析消息错误: %v", err)
-			continue
-		}
-
 		// 处理消息
-		c.handleMessage(data)
+		c.handleMessage(message)
 	}
 }
 
 // WritePump 将消息泵送到WebSocket连接
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
+	writeWait := c.hub.config.WriteTimeout
+	ticker := time.NewTicker(c.hub.config.PingInterval)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -100,27 +129,27 @@ func (c *Client) WritePump() {
 
 	for {
 		select {
-		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				// Hub关闭了通道
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+		case <-c.send.ready:
+			messages, closed := c.send.take()
+			if !c.write(messages) {
 				return
 			}
-
-			// 直接发送单个消息
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			if closed {
+				// Hub关闭了发送队列
+				c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+				c.conn.WriteMessage(websocket.CloseMessage, c.closeMessage())
 				return
 			}
 
-			// 发送队列中的其他消息
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				message := <-c.send
-				if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-					return
-				}
+		case <-c.quit:
+			// 先把已排队的消息发完，再关闭连接
+			messages, _ := c.send.take()
+			if !c.write(messages) {
+				return
 			}
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, c.closeFrame)
+			return
 
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
@@ -131,62 +160,165 @@ func (c *Client) WritePump() {
 	}
 }
 
-// handleMessage 处理接收到的消息
-func (c *Client) handleMessage(message map[string]interface{}) {
-	log.Printf("收到消息: %v", message)
-	
-	messageType, ok := message["type"].(string)
-	if !ok {
-		c.sendError("无效的消息类型")
+// write 依次写出消息，写入失败时返回 false
+func (c *Client) write(messages []queued) bool {
+	for _, message := range messages {
+		c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteTimeout))
+		if err := c.conn.WriteMessage(websocket.TextMessage, message.data); err != nil {
+			return false
+		}
+		countOutbound(message.typ)
+		metrics.SendLag.Observe(time.Since(message.at).Seconds())
+	}
+	return true
+}
+
+// closeMessage 返回关闭帧：主动断开时使用指定的关闭码，否则为空
+func (c *Client) closeMessage() []byte {
+	select {
+	case <-c.quit:
+		return c.closeFrame
+	default:
+		return []byte{}
+	}
+}
+
+// handleMessage 解码并处理接收到的消息
+func (c *Client) handleMessage(data []byte) {
+	msg, err := protocol.Decode(data)
+	if err != nil {
+		countInbound(invalidMessageType)
+		c.logger.Debug("消息不符合协议", "error", err)
+		c.sendProtocolError(err)
+		return
+	}
+	if c.hub.forward(c, msg, data) {
 		return
 	}
+	countInbound(msg.MessageType())
+	c.logger.Debug("收到消息", "type", msg.MessageType())
 
-	switch messageType {
-	case "join_room":
-		roomID, ok := message["room_id"].(string)
-		if !ok {
-			c.sendError("无效的房间ID")
-			return
-		}
-		c.hub.JoinRoom(c, roomID)
+	switch m := msg.(type) {
+	case *protocol.JoinRoom:
+		c.hub.JoinRoom(c, m.RoomID)
 
-	case "leave_room":
+	case *protocol.LeaveRoom:
 		c.hub.LeaveRoom(c)
 
-	case "game_action":
-		c.hub.HandleGameAction(c, message)
+	case *protocol.GameAction:
+		c.hub.HandleGameAction(c, m)
 
-	case "create_room":
-		log.Printf("创建房间请求")
+	case *protocol.CreateRoom:
 		// 生成一个唯一的房间ID
 		roomID := generateRoomID()
-		log.Printf("生成房间ID: %s", roomID)
-		
+
 		// 创建并加入房间
 		c.hub.CreateRoom(c, roomID)
-		
+
 		// 发送房间创建成功的消息
-		response := map[string]interface{}{
-			"type":    "room_created",
-			"room_id": roomID,
+		c.sendMessage(&protocol.RoomCreated{RoomID: roomID})
+
+	case *protocol.KickPlayer:
+		if !c.hub.authorize(c, models.RoleModerator) {
+			return
+		}
+		if !c.hub.KickPlayer(m.PlayerID, m.Reason) {
+			c.sendError("玩家不在线")
 		}
-		data, _ := json.Marshal(response)
-		c.send <- data
-		log.Printf("已发送房间创建成功消息")
 
-	default:
-		c.sendError("未知的消息类型")
+	case *protocol.CloseRoom:
+		if !c.hub.authorize(c, models.RoleModerator) {
+			return
+		}
+		if !c.hub.CloseRoom(m.RoomID, m.Reason) {
+			c.sendError("房间不存在")
+		}
+
+	case *protocol.Announce:
+		if !c.hub.authorize(c, models.RoleAdmin) {
+			return
+		}
+		c.hub.Announce(m.Message)
+
+	case *protocol.EventsSince:
+		c.hub.SendEventsSince(c, m.Since)
+
+	case *protocol.Resync:
+		c.hub.Resync(c)
+
+	case *protocol.TakeSeat:
+		c.hub.TakeSeat(c, m.Position)
+
+	case *protocol.SwapSeat:
+		c.hub.RequestSwap(c, m.PlayerID)
+
+	case *protocol.AcceptSwap:
+		c.hub.AcceptSwap(c, m.PlayerID)
+
+	case *protocol.DeclineSwap:
+		c.hub.DeclineSwap(c, m.PlayerID)
+
+	case *protocol.RoomKick:
+		c.hub.RoomKick(c, m.PlayerID, m.Reason)
+
+	case *protocol.TransferHost:
+		c.hub.TransferHost(c, m.PlayerID)
+
+	case *protocol.LockRoom:
+		c.hub.LockRoom(c, m.Locked)
+
+	case *protocol.ResetReady:
+		c.hub.ResetReady(c)
 	}
 }
 
 // sendError 发送错误消息给客户端
 func (c *Client) sendError(message string) {
-	response := map[string]interface{}{
-		"type":  "error",
-		"error": message,
+	c.sendMessage(&protocol.Error{Error: message})
+}
+
+// sendProtocolError 告知客户端消息不符合协议
+func (c *Client) sendProtocolError(err error) {
+	response := &protocol.Error{Error: err.Error()}
+	var validationErr *protocol.ValidationError
+	if errors.As(err, &validationErr) {
+		response.Error = validationErr.Message
+		response.Field = validationErr.Field
 	}
-	data, _ := json.Marshal(response)
-	c.send <- data
+	c.sendMessage(response)
+}
+
+// sendMessage 编码并发送消息给客户端
+func (c *Client) sendMessage(msg protocol.Message) {
+	data, err := protocol.Marshal(msg)
+	if err != nil {
+		c.logger.Error("Error marshalling message", "type", msg.MessageType(), "error", err)
+		return
+	}
+	c.deliver(encoded{typ: msg.MessageType(), data: data})
+}
+
+// deliver 把已编码的消息放入发送队列，不会阻塞
+//
+// 连接已注销时丢弃消息。积压的消息过多或最早的消息等待过久，说明客户端跟不上，
+// 丢弃排队的消息并以 protocol.CloseSlowConsumer 断开连接，客户端重新连接后同步状态。
+func (c *Client) deliver(message encoded) {
+	cfg := c.hub.config
+	queued, lag, ok := c.send.push(message)
+	if !ok || (queued <= cfg.SendQueueSize && lag <= cfg.MaxSendLag) {
+		return
+	}
+
+	c.Disconnect(protocol.CloseSlowConsumer, "消息积压，请重新连接")
+	dropped := c.send.discard()
+	metrics.SendDrops.Add(float64(dropped))
+	metrics.SlowConsumers.Inc()
+	c.logger.Warn("客户端跟不上消息，断开连接", "queued", queued, "lag", lag, "dropped", dropped)
+}
+
+// closeSend 关闭发送队列，WritePump 发送完已排队的消息后关闭连接
+func (c *Client) closeSend() {
+	c.send.close()
 }
 
 // generateRoomID 生成一个唯一的房间ID
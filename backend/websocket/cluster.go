@@ -0,0 +1,770 @@
+package websocket
+
+// 多实例模式
+//
+// 每个房间只由一个实例（owner）持有，所有权记录在 Redis 中并通过租约续期。
+// 客户端可以连接到任意实例：要加入的房间属于其他实例时，连接所在的实例通过
+// Redis pub/sub 把客户端的消息转发给 owner，owner 为其创建一个远程客户端，
+// 发给远程客户端的消息再转发回连接所在的实例。
+//
+// owner 定期把房间概要和游戏快照写入 Redis。owner 故障后租约过期，
+// 仍连接在其他实例上的玩家所在的实例会接管房间并从快照恢复游戏。
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/logging"
+	"github.com/chenhailong/hong3/protocol"
+	"github.com/chenhailong/hong3/redis"
+	gorilla "github.com/gorilla/websocket"
+)
+
+const (
+	// 实例频道前缀，每个实例订阅自己的频道
+	instanceChannelPrefix = "hong3:instance:"
+
+	// 所有实例都订阅的广播频道
+	broadcastChannel = "hong3:broadcast"
+
+	// 把有变化的房间同步到 Redis 的间隔
+	syncInterval = 500 * time.Millisecond
+
+	// 房间状态在 Redis 中的保留时间（租约时长的倍数），超过后无人接管的房间被丢弃
+	roomStateTTLFactor = 20
+
+	// 每个远程客户端待处理的消息数，超过时丢弃新消息
+	remoteInboxSize = 64
+)
+
+// 实例之间转发的消息类型
+const (
+	envMessage    = "message"    // 客户端消息：连接所在实例 → owner
+	envClosed     = "closed"     // 客户端已断开：连接所在实例 → owner
+	envDeliver    = "deliver"    // 发给客户端的消息：owner → 连接所在实例
+	envDetach     = "detach"     // 客户端已不在房间中：owner → 连接所在实例
+	envDisconnect = "disconnect" // 断开客户端连接：owner → 连接所在实例
+	envAnnounce   = "announce"   // 服务器公告：广播到所有实例
+	envNotify     = "notify"     // 发给某个玩家所有连接的消息：广播到所有实例
+	envKick       = "kick"       // 踢出玩家：广播到所有实例
+)
+
+// envelope 实例之间转发的消息
+type envelope struct {
+	Kind       string          `json:"kind"`
+	From       string          `json:"from"`
+	ClientID   string          `json:"client_id,omitempty"`
+	PlayerID   string          `json:"player_id,omitempty"`
+	PlayerName string          `json:"player_name,omitempty"`
+	Role       string          `json:"role,omitempty"`
+	Verified   bool            `json:"verified,omitempty"` // 客户端的玩家ID已验证
+	Type       string          `json:"type,omitempty"`     // Data 的消息类型
+	Data       json.RawMessage `json:"data,omitempty"`
+	Code       int             `json:"code,omitempty"`
+	Reason     string          `json:"reason,omitempty"`
+}
+
+// clusterState 多实例模式的状态（由 Hub 的锁保护）
+type clusterState struct {
+	id       string
+	leaseTTL time.Duration
+
+	// 本实例上的连接，key 为客户端ID
+	local map[string]*Client
+
+	// 其他实例转发来的客户端，key 为 来源实例/客户端ID
+	remote map[string]*Client
+
+	// 已解散、需要从 Redis 中删除的房间
+	removed map[string]bool
+
+	// 下次同步时写入所有房间（用于刷新 Redis 中的过期时间）
+	refresh bool
+
+	// 已退出集群（停机中），不再写入房间状态
+	stopped bool
+
+	cancel context.CancelFunc
+}
+
+// StartCluster 启用多实例模式：订阅本实例的频道并开始维护房间租约，需在接受连接之前调用
+func (h *Hub) StartCluster(ctx context.Context, instanceID string, leaseTTL time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	pubsub, err := redis.Subscribe(ctx, instanceChannel(instanceID), broadcastChannel)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	h.mutex.Lock()
+	h.cluster = &clusterState{
+		id:       instanceID,
+		leaseTTL: leaseTTL,
+		local:    make(map[string]*Client),
+		remote:   make(map[string]*Client),
+		removed:  make(map[string]bool),
+		cancel:   cancel,
+	}
+	for client := range h.clients {
+		h.cluster.local[client.id] = client
+	}
+	h.mutex.Unlock()
+
+	go func() {
+		defer pubsub.Close()
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				var env envelope
+				if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+					h.logger.Warn("invalid cluster message", "error", err)
+					continue
+				}
+				h.handleEnvelope(&env)
+			}
+		}
+	}()
+	go h.maintainCluster(ctx)
+
+	h.logger.Info("cluster mode enabled", "instance_id", instanceID, "lease_ttl", leaseTTL)
+	return nil
+}
+
+// LeaveCluster 停止维护租约，保存并释放本实例的所有房间，其他实例可以从 Redis 中的状态接管
+func (h *Hub) LeaveCluster() {
+	if h.cluster == nil {
+		return
+	}
+	h.cluster.cancel()
+
+	h.mutex.Lock()
+	rooms := make([]string, 0, len(h.rooms))
+	for roomID := range h.rooms {
+		rooms = append(rooms, roomID)
+	}
+	h.cluster.refresh = true
+	h.mutex.Unlock()
+
+	h.syncRooms()
+
+	h.mutex.Lock()
+	h.cluster.stopped = true
+	h.mutex.Unlock()
+
+	for _, roomID := range rooms {
+		if err := redis.ReleaseRoom(roomID, h.cluster.id); err != nil {
+			h.logger.Warn("failed to release room", logging.KeyRoomID, roomID, "error", err)
+		}
+	}
+	h.logger.Info("left cluster", "rooms", len(rooms))
+}
+
+// instanceChannel 实例的频道
+func instanceChannel(instanceID string) string {
+	return instanceChannelPrefix + instanceID
+}
+
+// publish 向频道发布消息
+func (h *Hub) publish(channel string, env *envelope) {
+	env.From = h.cluster.id
+	data, err := json.Marshal(env)
+	if err != nil {
+		h.logger.Error("Error marshalling cluster message", "error", err)
+		return
+	}
+	if err := redis.Publish(channel, data); err != nil {
+		h.logger.Warn("failed to publish cluster message", "channel", channel, "kind", env.Kind, "error", err)
+	}
+}
+
+// handleEnvelope 处理其他实例发来的消息
+func (h *Hub) handleEnvelope(env *envelope) {
+	switch env.Kind {
+	case envMessage:
+		h.handleRemoteMessage(env)
+
+	case envClosed:
+		h.mutex.Lock()
+		client := h.cluster.remote[env.From+"/"+env.ClientID]
+		h.mutex.Unlock()
+		if client != nil {
+			h.Unregister <- client
+		}
+
+	case envDeliver:
+		h.mutex.Lock()
+		if client, ok := h.cluster.local[env.ClientID]; ok {
+			client.deliver(encoded{typ: env.Type, data: env.Data})
+		}
+		h.mutex.Unlock()
+
+	case envDetach:
+		h.mutex.Lock()
+		if client, ok := h.cluster.local[env.ClientID]; ok && client.owner == env.From {
+			client.owner = ""
+			client.remoteRoom = ""
+		}
+		h.mutex.Unlock()
+
+	case envDisconnect:
+		h.mutex.Lock()
+		client := h.cluster.local[env.ClientID]
+		h.mutex.Unlock()
+		if client != nil {
+			client.Disconnect(env.Code, env.Reason)
+		}
+
+	case envAnnounce:
+		h.broadcast <- env.Data
+
+	case envNotify:
+		h.deliverToPlayer(env.PlayerID, encoded{typ: env.Type, data: env.Data})
+
+	case envKick:
+		// 发起的实例已经踢出了自己的连接；踢出需要等待房间执行，不能阻塞订阅
+		if env.From != h.cluster.id {
+			go h.kickLocal(env.PlayerID, env.Reason)
+		}
+	}
+}
+
+// handleRemoteMessage 把其他实例转发来的客户端消息交给对应的远程客户端
+//
+// 订阅只有一个 goroutine，这里不能等待房间执行：每个远程客户端在自己的 goroutine 中
+// 依次处理消息（remoteReadPump），同一客户端的消息保持顺序，不同客户端和房间互不阻塞。
+func (h *Hub) handleRemoteMessage(env *envelope) {
+	key := env.From + "/" + env.ClientID
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	client, ok := h.cluster.remote[key]
+	if !ok {
+		client = &Client{
+			hub:        h,
+			id:         env.ClientID,
+			origin:     env.From,
+			inbox:      make(chan []byte, remoteInboxSize),
+			send:       newSendQueue(),
+			playerID:   env.PlayerID,
+			playerName: env.PlayerName,
+			role:       env.Role,
+			verified:   env.Verified,
+			logger:     h.logger.With(logging.KeyPlayerID, env.PlayerID, "origin", env.From),
+			quit:       make(chan struct{}),
+		}
+		h.cluster.remote[key] = client
+		h.clients[client] = true
+		go client.remotePump()
+		go client.remoteReadPump()
+	}
+
+	select {
+	case client.inbox <- env.Data:
+	default:
+		client.logger.Warn("转发来的消息积压，丢弃消息", "pending", len(client.inbox))
+	}
+}
+
+// remoteReadPump 依次处理其他实例转发来的消息，inbox 关闭（客户端注销）后退出
+func (c *Client) remoteReadPump() {
+	for data := range c.inbox {
+		c.handleMessage(data)
+		c.hub.releaseIdleRemote(c)
+	}
+}
+
+// releaseIdleRemote 注销不在任何房间中、也没有待处理消息的远程客户端
+func (h *Hub) releaseIdleRemote(client *Client) {
+	h.mutex.Lock()
+	idle := client.roomID == "" && len(client.inbox) == 0 && !client.unregistered
+	if idle {
+		// 先从转发表中移除，之后到达的消息创建新的远程客户端，不会进入即将关闭的 inbox
+		delete(h.cluster.remote, client.origin+"/"+client.id)
+	}
+	h.mutex.Unlock()
+
+	if idle {
+		h.unregister(client)
+	}
+}
+
+// remotePump 把发给远程客户端的消息转发回连接所在的实例
+func (c *Client) remotePump() {
+	channel := instanceChannel(c.origin)
+	for {
+		select {
+		case <-c.send.ready:
+			messages, closed := c.send.take()
+			c.forwardMessages(channel, messages)
+			if closed {
+				// 已被移出房间
+				c.hub.publish(channel, &envelope{Kind: envDetach, ClientID: c.id})
+				return
+			}
+
+		case <-c.quit:
+			// 先把已排队的消息转发完，再通知断开连接
+			messages, _ := c.send.take()
+			c.forwardMessages(channel, messages)
+			code, reason := parseCloseFrame(c.closeFrame)
+			c.hub.publish(channel, &envelope{Kind: envDisconnect, ClientID: c.id, Code: code, Reason: reason})
+			return
+		}
+	}
+}
+
+// forwardMessages 把消息转发到连接所在的实例
+func (c *Client) forwardMessages(channel string, messages []queued) {
+	for _, message := range messages {
+		c.hub.publish(channel, &envelope{Kind: envDeliver, ClientID: c.id, Type: message.typ, Data: message.data})
+	}
+}
+
+// parseCloseFrame 解析关闭帧中的关闭码和原因
+func parseCloseFrame(frame []byte) (int, string) {
+	if len(frame) < 2 {
+		return gorilla.CloseNormalClosure, ""
+	}
+	return int(binary.BigEndian.Uint16(frame)), string(frame[2:])
+}
+
+// forward 客户端所在的房间属于其他实例时，把消息转发给该实例，返回消息是否已转发
+func (h *Hub) forward(client *Client, msg protocol.Message, data []byte) bool {
+	if h.cluster == nil || client.origin != "" {
+		return false
+	}
+
+	h.mutex.Lock()
+	owner := client.owner
+	h.mutex.Unlock()
+	if owner == "" {
+		return false
+	}
+
+	switch msg.(type) {
+	case *protocol.JoinRoom, *protocol.CreateRoom:
+		// 先离开当前房间，再按普通流程加入新房间
+		h.detach(client, owner)
+		return false
+	case *protocol.LeaveRoom:
+		h.detach(client, owner)
+		return true
+	case *protocol.KickPlayer, *protocol.CloseRoom, *protocol.Announce:
+		// 管理操作在本实例执行
+		return false
+	}
+
+	h.sendToOwner(client, owner, data)
+	return true
+}
+
+// attach 把客户端接入其他实例上的房间
+func (h *Hub) attach(client *Client, owner, roomID string) {
+	h.mutex.Lock()
+	client.owner = owner
+	client.remoteRoom = roomID
+	h.mutex.Unlock()
+
+	client.logger.Info("加入其他实例上的房间", logging.KeyRoomID, roomID, "owner", owner)
+	h.sendMessageToOwner(client, owner, &protocol.JoinRoom{RoomID: roomID})
+}
+
+// detach 让客户端离开其他实例上的房间
+func (h *Hub) detach(client *Client, owner string) {
+	h.mutex.Lock()
+	client.owner = ""
+	client.remoteRoom = ""
+	h.mutex.Unlock()
+
+	h.sendMessageToOwner(client, owner, &protocol.LeaveRoom{})
+}
+
+// sendMessageToOwner 以客户端的身份向房间所在的实例发送消息
+func (h *Hub) sendMessageToOwner(client *Client, owner string, msg protocol.Message) {
+	data, err := protocol.Marshal(msg)
+	if err != nil {
+		client.logger.Error("Error marshalling message", "error", err)
+		return
+	}
+	h.sendToOwner(client, owner, data)
+}
+
+// sendToOwner 把客户端消息转发给房间所在的实例
+func (h *Hub) sendToOwner(client *Client, owner string, data []byte) {
+	h.publish(instanceChannel(owner), &envelope{
+		Kind:       envMessage,
+		ClientID:   client.id,
+		PlayerID:   client.playerID,
+		PlayerName: client.playerName,
+		Role:       client.role,
+		Verified:   client.verified,
+		Data:       data,
+	})
+}
+
+// clusterRegister 记录本实例上的连接（需在持有锁的情况下调用）
+func (h *Hub) clusterRegister(client *Client) {
+	if h.cluster == nil || client.origin != "" {
+		return
+	}
+	h.cluster.local[client.id] = client
+}
+
+// clusterUnregister 连接断开时清理多实例状态（需在持有锁的情况下调用）
+func (h *Hub) clusterUnregister(client *Client) {
+	if h.cluster == nil {
+		return
+	}
+	if client.origin != "" {
+		// 空闲时已被移出转发表的客户端，表中可能已经是同一连接的新远程客户端
+		key := client.origin + "/" + client.id
+		if h.cluster.remote[key] == client {
+			delete(h.cluster.remote, key)
+		}
+		close(client.inbox)
+		return
+	}
+
+	delete(h.cluster.local, client.id)
+	if client.owner != "" {
+		go h.publish(instanceChannel(client.owner), &envelope{Kind: envClosed, ClientID: client.id})
+	}
+}
+
+// routeRoom 确定房间所在的实例
+//
+// 房间不在本实例时尝试获取所有权，获取成功且 Redis 中有房间状态时恢复房间。
+// 返回房间所在的其他实例ID（属于本实例时为空），失败时已向客户端回复错误并返回 false。
+func (h *Hub) routeRoom(client *Client, roomID string) (string, bool) {
+	if h.cluster == nil {
+		return "", true
+	}
+
+	h.mutex.Lock()
+	_, local := h.rooms[roomID]
+	draining := h.draining
+	h.mutex.Unlock()
+	if local {
+		return "", true
+	}
+
+	// 停机中只能加入其他实例上已有的房间
+	if draining {
+		owner, err := redis.GetRoomOwner(roomID)
+		if err == nil && owner != "" && owner != h.cluster.id {
+			return owner, true
+		}
+		client.sendError(errDraining)
+		return "", false
+	}
+
+	owner, err := redis.ClaimRoom(roomID, h.cluster.id, h.cluster.leaseTTL)
+	if err != nil {
+		client.logger.Error("获取房间所有权失败", logging.KeyRoomID, roomID, "error", err)
+		client.sendError("房间暂不可用，请稍后重试")
+		return "", false
+	}
+	if owner != h.cluster.id {
+		return owner, true
+	}
+
+	if !h.restoreRoom(roomID) {
+		client.sendError(errTableUnavailable)
+		return "", false
+	}
+	return "", true
+}
+
+// roomSnapshot 同步到 Redis 的房间状态，其他实例接管房间时据此恢复
+//
+// 旧版本只保存游戏快照（没有 game 字段），恢复时按旧格式解析。
+type roomSnapshot struct {
+	Game *game.Snapshot `json:"game"`
+
+	// 比赛桌所属的比赛。比赛只保存在举办比赛的实例中，其他实例不能恢复比赛桌
+	Tournament string `json:"tournament,omitempty"`
+
+	// 房主、房间是否锁定和被移出房间的玩家
+	Host   string   `json:"host,omitempty"`
+	Locked bool     `json:"locked,omitempty"`
+	Banned []string `json:"banned,omitempty"`
+}
+
+// snapshot 编码房间需要同步到 Redis 的状态（由房间的 goroutine 调用）
+func (r *room) snapshot() ([]byte, error) {
+	g := r.game.Snapshot()
+	s := roomSnapshot{Game: &g, Host: r.host, Locked: r.locked}
+	if r.table != nil {
+		s.Tournament = r.table.tournament.id
+	}
+	for playerID := range r.banned {
+		s.Banned = append(s.Banned, playerID)
+	}
+	slices.Sort(s.Banned)
+	return json.Marshal(s)
+}
+
+// restore 恢复快照中的房主、锁定状态和被移出的玩家（房间启动前调用）
+func (r *room) restore(s *roomSnapshot) {
+	if r.table == nil {
+		r.host = s.Host
+	}
+	r.locked = s.Locked
+	for _, playerID := range s.Banned {
+		r.banned[playerID] = true
+	}
+}
+
+// decodeRoomSnapshot 解析 Redis 中的房间状态
+func decodeRoomSnapshot(data []byte) (*roomSnapshot, error) {
+	var s roomSnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if s.Game == nil {
+		var g game.Snapshot
+		if err := json.Unmarshal(data, &g); err != nil {
+			return nil, err
+		}
+		s.Game = &g
+	}
+	return &s, nil
+}
+
+// restoreRoom 从 Redis 中保存的状态恢复房间（本实例刚获得所有权时调用）
+//
+// 不属于本实例比赛的比赛桌不能恢复：释放刚获得的所有权并返回 false。
+func (h *Hub) restoreRoom(roomID string) bool {
+	state, err := redis.LoadRoomState(roomID)
+	if err != nil {
+		h.logger.Error("failed to load room state", logging.KeyRoomID, roomID, "error", err)
+		return true
+	}
+	if state == nil {
+		return true
+	}
+
+	snapshot, err := decodeRoomSnapshot(state)
+	if err != nil {
+		h.logger.Error("invalid room state", logging.KeyRoomID, roomID, "error", err)
+		return true
+	}
+
+	if !h.addRestoredRoom(roomID, snapshot) {
+		h.logger.Warn("refusing to restore tournament table hosted elsewhere", logging.KeyRoomID, roomID, logging.KeyTournamentID, snapshot.Tournament)
+		if err := redis.ReleaseRoom(roomID, h.cluster.id); err != nil {
+			h.logger.Warn("failed to release room", logging.KeyRoomID, roomID, "error", err)
+		}
+		return false
+	}
+	return true
+}
+
+// roomRemoved 记录已解散的房间，下次同步时从 Redis 中删除（需在持有锁的情况下调用）
+func (h *Hub) roomRemoved(roomID string) {
+	if h.cluster != nil && !h.cluster.stopped {
+		h.cluster.removed[roomID] = true
+	}
+}
+
+// maintainCluster 定期同步房间状态并续期租约
+func (h *Hub) maintainCluster(ctx context.Context) {
+	syncTicker := time.NewTicker(syncInterval)
+	defer syncTicker.Stop()
+	leaseTicker := time.NewTicker(h.cluster.leaseTTL / 3)
+	defer leaseTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncTicker.C:
+			h.syncRooms()
+		case <-leaseTicker.C:
+			h.renewLeases()
+		}
+	}
+}
+
+// syncRooms 把有变化的房间写入 Redis，已解散的房间从 Redis 中删除
+func (h *Hub) syncRooms() {
+	type pendingRoom struct {
+		info  *redis.RoomInfo
+		state []byte
+	}
+
+	h.mutex.Lock()
+	if h.cluster.stopped {
+		h.mutex.Unlock()
+		return
+	}
+	refresh := h.cluster.refresh
+	h.cluster.refresh = false
+	deletes := make([]string, 0, len(h.cluster.removed))
+	for roomID := range h.cluster.removed {
+		delete(h.cluster.removed, roomID)
+		deletes = append(deletes, roomID)
+	}
+	rooms := make([]*room, 0)
+	for _, r := range h.rooms {
+		if refresh || r.dirty.Load() {
+			r.refs.Add(1)
+			rooms = append(rooms, r)
+		}
+	}
+	h.mutex.Unlock()
+
+	var saves []pendingRoom
+	for _, r := range rooms {
+		r.do(func() {
+			r.dirty.Store(false)
+			if r.closed {
+				return
+			}
+			state, err := r.snapshot()
+			if err != nil {
+				r.logger.Error("Error marshalling room snapshot", "error", err)
+				return
+			}
+			saves = append(saves, pendingRoom{info: r.info(), state: state})
+		})
+	}
+
+	ttl := h.cluster.leaseTTL * roomStateTTLFactor
+	for _, room := range saves {
+		if err := redis.SaveRoom(room.info, room.state, ttl); err != nil {
+			h.logger.Warn("failed to save room", logging.KeyRoomID, room.info.ID, "error", err)
+		}
+	}
+	for _, roomID := range deletes {
+		if err := redis.DeleteRoom(roomID); err != nil {
+			h.logger.Warn("failed to delete room", logging.KeyRoomID, roomID, "error", err)
+		}
+		if err := redis.ReleaseRoom(roomID, h.cluster.id); err != nil {
+			h.logger.Warn("failed to release room", logging.KeyRoomID, roomID, "error", err)
+		}
+	}
+}
+
+// renewLeases 续期本实例房间的租约，并检查客户端接入的其他实例上的房间是否仍有 owner
+func (h *Hub) renewLeases() {
+	h.mutex.Lock()
+	owned := make([]string, 0, len(h.rooms))
+	for roomID := range h.rooms {
+		owned = append(owned, roomID)
+	}
+	// 定期刷新房间状态，避免在 Redis 中过期
+	h.cluster.refresh = true
+	attached := make(map[string][]*Client)
+	owners := make(map[string]string)
+	for _, client := range h.cluster.local {
+		if client.owner != "" {
+			attached[client.remoteRoom] = append(attached[client.remoteRoom], client)
+			owners[client.remoteRoom] = client.owner
+		}
+	}
+	h.mutex.Unlock()
+
+	for _, roomID := range owned {
+		ok, err := redis.RenewRoom(roomID, h.cluster.id, h.cluster.leaseTTL)
+		if err != nil {
+			h.logger.Warn("failed to renew room lease", logging.KeyRoomID, roomID, "error", err)
+			continue
+		}
+		if !ok {
+			h.loseRoom(roomID)
+		}
+	}
+
+	for roomID, clients := range attached {
+		h.checkOwner(roomID, owners[roomID], clients)
+	}
+}
+
+// loseRoom 租约已被其他实例获得（例如与 Redis 断开过久），关闭本地的房间副本
+func (h *Hub) loseRoom(roomID string) {
+	r := h.acquireRoom(roomID)
+	if r == nil {
+		return
+	}
+	r.do(func() {
+		if r.closed {
+			return
+		}
+		r.logger.Error("room lease lost")
+		r.lost = true
+		r.close(&protocol.RoomClosed{RoomID: roomID, Reason: "房间已转移，请重新加入"})
+	})
+}
+
+// checkOwner 检查客户端接入的房间的 owner，owner 故障时接管房间或转到新的 owner
+func (h *Hub) checkOwner(roomID, oldOwner string, clients []*Client) {
+	owner, err := redis.GetRoomOwner(roomID)
+	if err != nil {
+		h.logger.Warn("failed to get room owner", logging.KeyRoomID, roomID, "error", err)
+		return
+	}
+	if owner == oldOwner {
+		return
+	}
+
+	h.mutex.Lock()
+	stopped := h.cluster.stopped || h.draining
+	h.mutex.Unlock()
+
+	if owner == "" && !stopped {
+		owner, err = redis.ClaimRoom(roomID, h.cluster.id, h.cluster.leaseTTL)
+		if err != nil {
+			h.logger.Warn("failed to claim room", logging.KeyRoomID, roomID, "error", err)
+			return
+		}
+	}
+	if owner == "" {
+		return
+	}
+	h.logger.Info("room owner changed", logging.KeyRoomID, roomID, "old_owner", oldOwner, "owner", owner)
+
+	// 比赛桌随举办比赛的实例一起失效，不能在本实例恢复
+	available := owner != h.cluster.id || h.restoreRoom(roomID)
+
+	for _, client := range clients {
+		h.mutex.Lock()
+		current := client.owner == oldOwner && client.remoteRoom == roomID
+		if current {
+			client.owner = ""
+			client.remoteRoom = ""
+		}
+		h.mutex.Unlock()
+		if !current {
+			continue
+		}
+
+		switch {
+		case !available:
+			client.sendMessage(&protocol.RoomClosed{RoomID: roomID, Reason: errTableUnavailable})
+		case owner == h.cluster.id:
+			h.JoinRoom(client, roomID)
+		default:
+			h.attach(client, owner, roomID)
+		}
+	}
+}
+
+// newClientID 生成随机客户端ID，用于在实例之间识别连接
+func newClientID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
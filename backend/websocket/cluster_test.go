@@ -0,0 +1,227 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/protocol"
+	"github.com/chenhailong/hong3/redis"
+	redispkg "github.com/redis/go-redis/v9"
+	"github.com/redis/go-redis/v9/maintnotifications"
+)
+
+// testLeaseTTL 测试中的租约时长，足够长，定时续期不会干扰测试
+const testLeaseTTL = 30 * time.Second
+
+// useMiniredis 让 redis 包连接到进程内的 miniredis，测试结束后断开
+func useMiniredis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	redis.Client = redispkg.NewClient(&redispkg.Options{
+		Addr: mr.Addr(),
+		// miniredis 不支持 CLIENT MAINT_NOTIFICATIONS
+		MaintNotificationsConfig: &maintnotifications.Config{Mode: maintnotifications.ModeDisabled},
+	})
+	t.Cleanup(func() { redis.Client.Close() })
+	return mr
+}
+
+// newClusterHub 创建以多实例模式运行的 Hub
+func newClusterHub(t *testing.T, instanceID string) *Hub {
+	t.Helper()
+	h := newTestHub(t)
+	if err := h.StartCluster(context.Background(), instanceID, testLeaseTTL); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.cluster.cancel)
+	return h
+}
+
+// eventually 等待条件成立（实例之间的消息经由 Redis 异步转发）
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitFor 等待玩家收到该类型的消息
+func (p *testPlayer) waitFor(typ string) testMessage {
+	p.t.Helper()
+	var found testMessage
+	eventually(p.t, p.client.playerID+" to get "+typ, func() bool {
+		for _, m := range p.messages() {
+			if m.Type == typ {
+				found = m
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+// send 以客户端的身份发送消息，按连接收到的消息处理（房间在其他实例上时转发）
+func (p *testPlayer) send(msg protocol.Message) {
+	p.t.Helper()
+	data, err := protocol.Marshal(msg)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.client.handleMessage(data)
+}
+
+// inGame 玩家是否已在房间的游戏中
+func inGame(h *Hub, roomID, playerID string) bool {
+	r := h.acquireRoom(roomID)
+	if r == nil {
+		return false
+	}
+	seat := -1
+	r.do(func() {
+		seat = r.game.SeatOf(playerID)
+	})
+	return seat >= 0
+}
+
+// TestClusterRouting 连接在其他实例上的玩家加入房间，消息经 owner 转发
+func TestClusterRouting(t *testing.T) {
+	useMiniredis(t)
+	a := newClusterHub(t, "a")
+	b := newClusterHub(t, "b")
+
+	alice := newTestPlayer(t, a, "alice", models.RolePlayer)
+	a.JoinRoom(alice.client, "r1")
+	if owner, _ := redis.GetRoomOwner("r1"); owner != "a" {
+		t.Fatalf("room owner %q, want a", owner)
+	}
+	alice.messages()
+
+	bob := newTestPlayer(t, b, "bob", models.RolePlayer)
+	b.JoinRoom(bob.client, "r1")
+	bob.waitFor("room_state")
+	alice.waitFor("player_joined")
+	if testRoom(b, "r1") != nil {
+		t.Fatal("instance b created its own copy of the room")
+	}
+	if !inGame(a, "r1", "bob") {
+		t.Fatal("bob is not in the game on the owner")
+	}
+
+	// 离开房间后远程客户端被释放
+	bob.send(&protocol.LeaveRoom{})
+	alice.waitFor("player_left")
+	eventually(t, "remote client to be released", func() bool {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		return len(a.cluster.remote) == 0
+	})
+}
+
+// TestClusterRoutingDoesNotBlock 一个房间忙碌时，其他房间的转发消息照常处理
+func TestClusterRoutingDoesNotBlock(t *testing.T) {
+	useMiniredis(t)
+	a := newClusterHub(t, "a")
+	b := newClusterHub(t, "b")
+
+	alice := newTestPlayer(t, a, "alice", models.RolePlayer)
+	a.JoinRoom(alice.client, "busy")
+	dave := newTestPlayer(t, a, "dave", models.RolePlayer)
+	a.JoinRoom(dave.client, "free")
+
+	// 阻塞 busy 房间的 goroutine
+	release := make(chan struct{})
+	busy := a.acquireRoom("busy")
+	go busy.do(func() { <-release })
+
+	bob := newTestPlayer(t, b, "bob", models.RolePlayer)
+	b.JoinRoom(bob.client, "busy")
+	carol := newTestPlayer(t, b, "carol", models.RolePlayer)
+	b.JoinRoom(carol.client, "free")
+
+	carol.waitFor("room_state")
+	if _, ok := bob.last("room_state"); ok {
+		t.Fatal("bob joined a blocked room")
+	}
+
+	close(release)
+	bob.waitFor("room_state")
+}
+
+// TestClusterTakeover owner 故障后，连接在其他实例上的玩家所在的实例从 Redis 中的状态接管房间
+func TestClusterTakeover(t *testing.T) {
+	mr := useMiniredis(t)
+	a := newClusterHub(t, "a")
+	b := newClusterHub(t, "b")
+
+	alice := newTestPlayer(t, a, "alice", models.RolePlayer)
+	a.JoinRoom(alice.client, "r1")
+	bob := newTestPlayer(t, b, "bob", models.RolePlayer)
+	b.JoinRoom(bob.client, "r1")
+	bob.waitFor("room_state")
+	aliceSeat, bobSeat := seatOf(a, "r1", "alice"), seatOf(a, "r1", "bob")
+
+	// 实例 a 同步状态后停止工作，租约随之过期
+	a.syncRooms()
+	a.cluster.cancel()
+	mr.FastForward(testLeaseTTL)
+
+	b.renewLeases()
+	if owner, _ := redis.GetRoomOwner("r1"); owner != "b" {
+		t.Fatalf("room owner %q after takeover, want b", owner)
+	}
+	if testRoom(b, "r1") == nil {
+		t.Fatal("instance b did not restore the room")
+	}
+	bob.waitFor("room_state")
+	if seat := seatOf(b, "r1", "bob"); seat != bobSeat {
+		t.Errorf("bob in seat %d after takeover, want %d", seat, bobSeat)
+	}
+	if seat := seatOf(b, "r1", "alice"); seat != aliceSeat {
+		t.Errorf("alice in seat %d after takeover, want %d", seat, aliceSeat)
+	}
+}
+
+// TestClusterAdmin 管理接口能看到和操作其他实例上的房间和玩家
+func TestClusterAdmin(t *testing.T) {
+	useMiniredis(t)
+	a := newClusterHub(t, "a")
+	b := newClusterHub(t, "b")
+
+	alice := newTestPlayer(t, a, "alice", models.RolePlayer)
+	a.JoinRoom(alice.client, "r1")
+	bob := newTestPlayer(t, b, "bob", models.RolePlayer)
+	b.JoinRoom(bob.client, "r1")
+	bob.waitFor("room_state")
+	a.syncRooms()
+
+	rooms := b.AdminRooms()
+	if len(rooms) != 1 || rooms[0]["id"] != "r1" || rooms[0]["owner"] != "a" {
+		t.Fatalf("admin rooms on b %v, want r1 owned by a", rooms)
+	}
+	if clients := rooms[0]["clients"].([]map[string]interface{}); len(clients) != 2 {
+		t.Errorf("r1 clients %v, want alice and bob", clients)
+	}
+	if _, ok := b.AdminRoom("r1"); !ok {
+		t.Error("AdminRoom on b did not find r1")
+	}
+	if _, ok := b.AdminRoom("missing"); ok {
+		t.Error("AdminRoom found a missing room")
+	}
+
+	// 在 b 上踢出连接在 a 上的玩家
+	if !b.KickPlayer("alice", "违规") {
+		t.Fatal("KickPlayer on b did not find alice")
+	}
+	alice.waitFor("kicked")
+	if b.KickPlayer("nobody", "") {
+		t.Error("KickPlayer found a missing player")
+	}
+}
@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/protocol"
+)
+
+// eventBuffer 房间最近的事件（已编码），用于按序号补发
+//
+// 缓冲区的大小由 game.event_buffer_size 配置，客户端缺失更早的事件时需要完整同步。
+type eventBuffer struct {
+	// 最后一个事件的序号
+	seq uint64
+
+	// 环形缓冲区，events[i % len(events)] 保存序号为 i 的事件
+	events []encoded
+}
+
+// newEventBuffer 创建保留最近 size 个事件的缓冲区
+func newEventBuffer(size int) eventBuffer {
+	return eventBuffer{events: make([]encoded, size)}
+}
+
+// next 为新事件分配序号
+func (b *eventBuffer) next() uint64 {
+	b.seq++
+	return b.seq
+}
+
+// store 保存序号为 seq 的事件
+func (b *eventBuffer) store(seq uint64, event encoded) {
+	b.events[seq%uint64(len(b.events))] = event
+}
+
+// since 获取序号大于 seq 的所有事件，缓冲区中已没有其中某些事件时返回 false
+func (b *eventBuffer) since(seq uint64) ([]encoded, bool) {
+	if seq > b.seq {
+		return nil, false
+	}
+	if b.seq-seq > uint64(len(b.events)) {
+		return nil, false
+	}
+	events := make([]encoded, 0, b.seq-seq)
+	for i := seq + 1; i <= b.seq; i++ {
+		events = append(events, b.events[i%uint64(len(b.events))])
+	}
+	return events, true
+}
+
+// encode 编码发往房间的消息，房间事件会分配序号并保存到缓冲区
+func (r *room) encode(message protocol.Message) ([]byte, error) {
+	event, ok := message.(protocol.Sequenced)
+	if !ok {
+		return protocol.Marshal(message)
+	}
+
+	seq := r.events.next()
+	event.SetSeq(seq)
+	data, err := protocol.Marshal(event)
+	if err != nil {
+		// 保持序号连续，缓冲区中留空（清除环形缓冲区中更早的事件），补发时跳过
+		r.events.store(seq, encoded{})
+		return nil, err
+	}
+	r.events.store(seq, encoded{typ: event.MessageType(), data: data})
+	return data, nil
+}
+
+// sendEventsSince 向客户端补发序号大于 since 的事件，然后发送当前的游戏状态
+func (r *room) sendEventsSince(client *Client, since uint64) {
+	events, ok := r.events.since(since)
+	if !ok {
+		// 缺失的事件已不在缓冲区中
+		r.clientLog(client).Debug("事件已不在缓冲区中，完整同步", "since", since, "seq", r.events.seq)
+		r.resync(client)
+		return
+	}
+	for _, event := range events {
+		if event.data != nil {
+			client.deliver(event)
+		}
+	}
+	if r.game.Status != game.GameStatusWaiting {
+		r.sendGameState(client)
+	}
+}
+
+// resync 发送完整的房间状态和游戏状态
+func (r *room) resync(client *Client) {
+	r.sendRoomState(client)
+	if r.game.Status != game.GameStatusWaiting {
+		r.sendGameState(client)
+	}
+}
+
+// SendEventsSince 向客户端补发序号大于 since 的房间事件
+func (h *Hub) SendEventsSince(client *Client, since uint64) {
+	h.inRoom(client, func(r *room) {
+		r.sendEventsSince(client, since)
+	})
+}
+
+// Resync 向客户端发送完整的房间状态和游戏状态
+func (h *Hub) Resync(client *Client) {
+	h.inRoom(client, func(r *room) {
+		r.resync(client)
+	})
+}
@@ -0,0 +1,76 @@
+package websocket
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// storeEvents 依次保存 n 个事件，事件内容为序号
+func storeEvents(b *eventBuffer, n int) {
+	for i := 0; i < n; i++ {
+		seq := b.next()
+		b.store(seq, encoded{typ: "event", data: []byte(strconv.FormatUint(seq, 10))})
+	}
+}
+
+// eventSeqs 事件内容中的序号，留空的事件记为 0
+func eventSeqs(events []encoded) []uint64 {
+	seqs := make([]uint64, 0, len(events))
+	for _, event := range events {
+		seq, _ := strconv.ParseUint(string(event.data), 10, 64)
+		seqs = append(seqs, seq)
+	}
+	return seqs
+}
+
+func TestEventBufferSince(t *testing.T) {
+	b := newEventBuffer(4)
+	if events, ok := b.since(0); !ok || len(events) != 0 {
+		t.Fatalf("empty buffer since 0: %v %v", events, ok)
+	}
+
+	// 序号 1-6 写入大小为 4 的缓冲区，5 和 6 覆盖了 1 和 2
+	storeEvents(&b, 6)
+
+	tests := []struct {
+		since uint64
+		want  []uint64
+		ok    bool
+	}{
+		{0, nil, false},
+		{1, nil, false},
+		{2, []uint64{3, 4, 5, 6}, true},
+		{4, []uint64{5, 6}, true},
+		{6, []uint64{}, true},
+		{7, nil, false},
+	}
+	for _, tt := range tests {
+		events, ok := b.since(tt.since)
+		if ok != tt.ok {
+			t.Errorf("since(%d) ok %v, want %v", tt.since, ok, tt.ok)
+			continue
+		}
+		if got := eventSeqs(events); ok && !slices.Equal(got, tt.want) {
+			t.Errorf("since(%d) = %v, want %v", tt.since, got, tt.want)
+		}
+	}
+}
+
+func TestEventBufferSkipsFailedEvent(t *testing.T) {
+	b := newEventBuffer(4)
+	storeEvents(&b, 4)
+
+	// 序号 5 编码失败，占用序号但留空，不能补发环形缓冲区中原来的序号 1
+	seq := b.next()
+	b.store(seq, encoded{})
+	storeEvents(&b, 1)
+
+	events, ok := b.since(2)
+	if !ok {
+		t.Fatal("since(2) not in buffer")
+	}
+	if got, want := eventSeqs(events), []uint64{3, 4, 0, 6}; !slices.Equal(got, want) {
+		t.Errorf("since(2) = %v, want %v", got, want)
+	}
+}
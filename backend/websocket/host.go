@@ -0,0 +1,187 @@
+package websocket
+
+// 房主
+//
+// 第一个进入房间的玩家成为房主（创建房间的玩家即为房主）。房主可以把玩家移出房间、
+// 转让房主、锁定房间和取消所有玩家的准备状态，版主拥有同样的权限。房主离开房间时，
+// 房主自动转给座位最靠前的玩家。比赛桌没有房主。
+//
+// 房主按玩家ID认定，只有携带有效 token 连接的客户端可以使用房主权限。
+
+import (
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/protocol"
+)
+
+// RoomKick 房主把玩家移出房间
+func (h *Hub) RoomKick(client *Client, playerID, reason string) {
+	h.inRoom(client, func(r *room) {
+		r.kick(client, playerID, reason)
+	})
+}
+
+// TransferHost 房主把房主转给房间内的另一名玩家
+func (h *Hub) TransferHost(client *Client, playerID string) {
+	h.inRoom(client, func(r *room) {
+		r.transferHost(client, playerID)
+	})
+}
+
+// LockRoom 房主锁定或解锁房间
+func (h *Hub) LockRoom(client *Client, locked bool) {
+	h.inRoom(client, func(r *room) {
+		r.lock(client, locked)
+	})
+}
+
+// ResetReady 房主取消所有玩家的准备状态
+func (h *Hub) ResetReady(client *Client) {
+	h.inRoom(client, func(r *room) {
+		r.resetReady(client)
+	})
+}
+
+// authorizeHost 检查客户端是否为房主（或版主），不是时回复错误
+func (r *room) authorizeHost(client *Client) bool {
+	if r.table != nil {
+		client.sendError("比赛桌没有房主")
+		return false
+	}
+	// 房主按玩家ID认定，未携带 token 的连接可能冒用房主的ID
+	if !client.verified {
+		client.sendError("请登录后再使用房主权限")
+		return false
+	}
+	if client.playerID == r.host || models.RoleAtLeast(client.role, models.RoleModerator) {
+		return true
+	}
+	client.sendError("只有房主可以执行该操作")
+	return false
+}
+
+// kick 把玩家移出房间，玩家在本房间中被禁止再次加入
+func (r *room) kick(client *Client, playerID, reason string) {
+	if !r.authorizeHost(client) {
+		return
+	}
+	if playerID == client.playerID {
+		client.sendError("不能把自己移出房间")
+		return
+	}
+	if r.game.Status != game.GameStatusWaiting {
+		client.sendError("游戏进行中不能移出玩家")
+		return
+	}
+
+	targets := make([]*Client, 0, 1)
+	for c := range r.clients {
+		if c.playerID == playerID {
+			targets = append(targets, c)
+		}
+	}
+	if len(targets) == 0 {
+		client.sendError("玩家不在房间中")
+		return
+	}
+	if reason == "" {
+		reason = "被房主移出房间"
+	}
+
+	r.clientLog(client).Info("房主移出玩家", "target", playerID, "reason", reason)
+	r.banned[playerID] = true
+	r.game.RemovePlayer(playerID)
+	for _, c := range targets {
+		c.sendMessage(&protocol.RoomKicked{RoomID: r.id, Reason: reason})
+		r.leave(c)
+		// 其他实例转发来的客户端已不在任何房间中，注销后其所在的实例会收到通知
+		if c.origin != "" {
+			r.hub.unregister(c)
+		}
+	}
+}
+
+// transferHost 把房主转给房间内的另一名玩家
+func (r *room) transferHost(client *Client, playerID string) {
+	if !r.authorizeHost(client) {
+		return
+	}
+	if playerID == r.host {
+		return
+	}
+	if !r.hasClient(playerID) {
+		client.sendError("玩家不在房间中")
+		return
+	}
+
+	r.clientLog(client).Info("转让房主", "host", playerID)
+	r.setHost(playerID)
+}
+
+// lock 锁定或解锁房间
+func (r *room) lock(client *Client, locked bool) {
+	if !r.authorizeHost(client) {
+		return
+	}
+	if r.locked == locked {
+		return
+	}
+
+	r.locked = locked
+	r.clientLog(client).Info("锁定房间", "locked", locked)
+	r.broadcast(&protocol.RoomLocked{Locked: locked})
+	for c := range r.clients {
+		r.sendRoomState(c)
+	}
+}
+
+// resetReady 取消所有玩家的准备状态
+func (r *room) resetReady(client *Client) {
+	if !r.authorizeHost(client) {
+		return
+	}
+	if err := r.game.ResetReady(); err != nil {
+		client.sendError(err.Error())
+		return
+	}
+
+	r.clientLog(client).Info("取消所有玩家的准备状态")
+	r.broadcast(&protocol.ReadyReset{})
+	for c := range r.clients {
+		r.sendRoomState(c)
+	}
+}
+
+// setHost 更换房主并通知房间内的玩家
+func (r *room) setHost(playerID string) {
+	r.host = playerID
+	r.broadcast(&protocol.HostChanged{PlayerID: playerID})
+	for c := range r.clients {
+		r.sendRoomState(c)
+	}
+}
+
+// nextHost 房主离开后的新房主：座位最靠前的玩家，不在游戏中的玩家排在最后，房间为空时返回空字符串
+func (r *room) nextHost() string {
+	next, best := "", len(r.game.Players)+1
+	for c := range r.clients {
+		seat := r.game.SeatOf(c.playerID)
+		if seat < 0 {
+			seat = len(r.game.Players)
+		}
+		if seat < best || (seat == best && c.playerID < next) {
+			next, best = c.playerID, seat
+		}
+	}
+	return next
+}
+
+// hasClient 玩家是否有客户端在房间中
+func (r *room) hasClient(playerID string) bool {
+	for c := range r.clients {
+		if c.playerID == playerID {
+			return true
+		}
+	}
+	return false
+}
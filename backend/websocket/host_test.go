@@ -0,0 +1,212 @@
+package websocket
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/models"
+)
+
+// roomHost 房间当前的房主
+func roomHost(h *Hub, roomID string) string {
+	r := testRoom(h, roomID)
+	var host string
+	r.do(func() {
+		host = r.host
+	})
+	return host
+}
+
+func TestKickBansPlayer(t *testing.T) {
+	h := newTestHub(t)
+	players := joinSeated(t, h, "host-room", "alice", "bob", "carol")
+	alice, bob, carol := players[0], players[1], players[2]
+
+	h.RoomKick(bob.client, "carol", "")
+	bob.expectError("只有房主可以执行该操作")
+
+	h.RoomKick(alice.client, "bob", "")
+	if _, ok := bob.last("room_kicked"); !ok {
+		t.Fatal("bob got no room_kicked")
+	}
+	if seat := seatOf(h, "host-room", "bob"); seat != -1 {
+		t.Fatalf("kicked bob still in seat %d", seat)
+	}
+	if _, ok := carol.last("player_left"); !ok {
+		t.Fatal("carol was not told that bob left")
+	}
+
+	// 被移出的玩家不能再次加入
+	h.JoinRoom(bob.client, "host-room")
+	bob.expectError("你已被房主移出该房间")
+	if seat := seatOf(h, "host-room", "bob"); seat != -1 {
+		t.Fatalf("banned bob rejoined in seat %d", seat)
+	}
+
+	// 版主也可以移出玩家
+	mod := newTestPlayer(t, h, "mod", models.RoleModerator)
+	h.JoinRoom(mod.client, "host-room")
+	h.RoomKick(mod.client, "carol", "")
+	if _, ok := carol.last("room_kicked"); !ok {
+		t.Fatal("moderator could not kick carol")
+	}
+}
+
+// TestHostCommandsRequireToken 未携带 token 的连接即使使用房主的玩家ID也不能使用房主权限
+func TestHostCommandsRequireToken(t *testing.T) {
+	h := newTestHub(t)
+	players := joinSeated(t, h, "host-room", "alice", "bob")
+	bob := players[1]
+
+	impostor := newGuestPlayer(t, h, "alice")
+	h.JoinRoom(impostor.client, "host-room")
+	h.RoomKick(impostor.client, "bob", "")
+	impostor.expectError("请登录后再使用房主权限")
+	h.LockRoom(impostor.client, true)
+	impostor.expectError("请登录后再使用房主权限")
+	h.TransferHost(impostor.client, "bob")
+	impostor.expectError("请登录后再使用房主权限")
+	h.ResetReady(impostor.client)
+	impostor.expectError("请登录后再使用房主权限")
+
+	if _, ok := bob.last("room_kicked"); ok {
+		t.Fatal("an unverified connection kicked bob")
+	}
+	if host := roomHost(h, "host-room"); host != "alice" {
+		t.Fatalf("host %q, want alice", host)
+	}
+}
+
+func TestLockRoom(t *testing.T) {
+	h := newTestHub(t)
+	players := joinSeated(t, h, "lock-room", "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	h.LockRoom(bob.client, true)
+	bob.expectError("只有房主可以执行该操作")
+
+	h.LockRoom(alice.client, true)
+	if _, ok := bob.last("room_locked"); !ok {
+		t.Fatal("bob got no room_locked")
+	}
+	carol := newTestPlayer(t, h, "carol", models.RolePlayer)
+	h.JoinRoom(carol.client, "lock-room")
+	carol.expectError("房间已锁定")
+
+	// 游戏中的玩家离开后可以重新加入锁定的房间
+	h.LeaveRoom(bob.client)
+	h.JoinRoom(bob.client, "lock-room")
+	if _, ok := bob.last("error"); ok {
+		t.Fatal("bob could not rejoin the locked room")
+	}
+	if seat := seatOf(h, "lock-room", "bob"); seat != 1 {
+		t.Fatalf("bob rejoined in seat %d, want 1", seat)
+	}
+
+	h.LockRoom(alice.client, false)
+	h.JoinRoom(carol.client, "lock-room")
+	if _, ok := carol.last("room_state"); !ok {
+		t.Fatal("carol could not join the unlocked room")
+	}
+}
+
+func TestTransferHost(t *testing.T) {
+	h := newTestHub(t)
+	players := joinSeated(t, h, "host-room", "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	h.TransferHost(alice.client, "nobody")
+	alice.expectError("玩家不在房间中")
+
+	h.TransferHost(alice.client, "bob")
+	if host := roomHost(h, "host-room"); host != "bob" {
+		t.Fatalf("host %q, want bob", host)
+	}
+	if _, ok := alice.last("host_changed"); !ok {
+		t.Fatal("alice got no host_changed")
+	}
+
+	// 原房主不再有房主的权限
+	h.LockRoom(alice.client, true)
+	alice.expectError("只有房主可以执行该操作")
+	h.LockRoom(bob.client, true)
+	if _, ok := alice.last("room_locked"); !ok {
+		t.Fatal("new host could not lock the room")
+	}
+}
+
+// TestNextHost 房主离开后房主转给座位最靠前的玩家，不在游戏中的玩家排在最后，同样时按玩家ID
+func TestNextHost(t *testing.T) {
+	h := newTestHub(t)
+	players := joinSeated(t, h, "host-room", "alice", "bob", "carol")
+	alice, bob := players[0], players[1]
+
+	// alice 在 0 号座位，carol 在 2 号，bob 在 3 号
+	h.TakeSeat(bob.client, 3)
+	h.LeaveRoom(alice.client)
+	if host := roomHost(h, "host-room"); host != "carol" {
+		t.Fatalf("host %q after alice left, want carol (lowest seat)", host)
+	}
+
+	dave := newTestPlayer(t, h, "dave", models.RolePlayer)
+	h.JoinRoom(dave.client, "host-room")
+	if seat := seatOf(h, "host-room", "dave"); seat != 1 {
+		t.Fatalf("dave joined in seat %d, want 1", seat)
+	}
+	r := testRoom(h, "host-room")
+	var order []string
+	r.do(func() {
+		// bob 和 carol 离开游戏但留在房间中
+		r.game.RemovePlayer("carol")
+		r.game.RemovePlayer("bob")
+		for len(r.clients) > 0 {
+			next := r.nextHost()
+			order = append(order, next)
+			for c := range r.clients {
+				if c.playerID == next {
+					delete(r.clients, c)
+				}
+			}
+		}
+	})
+	if want := []string{"dave", "bob", "carol"}; !slices.Equal(order, want) {
+		t.Fatalf("host order %v, want %v", order, want)
+	}
+}
+
+// TestRoomSnapshotKeepsHostState 其他实例接管房间时恢复房主、锁定状态和被移出的玩家
+func TestRoomSnapshotKeepsHostState(t *testing.T) {
+	h := newTestHub(t)
+	players := joinSeated(t, h, "host-room", "alice", "bob", "carol")
+	alice := players[0]
+	h.RoomKick(alice.client, "carol", "")
+	h.LockRoom(alice.client, true)
+	h.TransferHost(alice.client, "bob")
+
+	r := testRoom(h, "host-room")
+	var data []byte
+	var err error
+	r.do(func() {
+		data, err = r.snapshot()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := decodeRoomSnapshot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.mutex.Lock()
+	restored := newRoom(h, "host-room", game.Restore(*snapshot.Game, h.logger))
+	h.mutex.Unlock()
+	restored.restore(snapshot)
+	if restored.host != "bob" || !restored.locked || !restored.banned["carol"] || len(restored.banned) != 1 {
+		t.Fatalf("restored host %q locked %v banned %v, want bob, true and [carol]",
+			restored.host, restored.locked, restored.banned)
+	}
+	if restored.game.SeatOf("alice") != 0 || restored.game.SeatOf("bob") != 1 {
+		t.Fatal("restored game lost the seats")
+	}
+}
@@ -1,27 +1,29 @@
 package websocket
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
+	"github.com/chenhailong/hong3/config"
 	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/logging"
+	"github.com/chenhailong/hong3/protocol"
+	"github.com/chenhailong/hong3/redis"
 )
 
-// Hub 维护活跃的客户端连接和广播消息
+// Hub 维护活跃的客户端连接和房间
+//
+// Hub 只负责登记客户端和房间，游戏逻辑和房间内的消息发送都在各房间自己的 goroutine 中执行，
+// 一个繁忙的房间不会阻塞其他房间。Hub 的锁只在读写登记信息时短暂持有，持有锁时不会等待房间。
 type Hub struct {
 	// 注册的客户端
 	clients map[*Client]bool
 
-	// 房间映射
-	rooms map[string]map[*Client]bool
+	// 房间
+	rooms map[string]*room
 
-	// 游戏映射
-	games map[string]*game.Game
-
-	// 广播消息通道
+	// 广播消息通道（已编码的服务器公告）
 	broadcast chan []byte
 
 	// 注册客户端的通道
@@ -32,17 +34,46 @@ type Hub struct {
 
 	// 互斥锁
 	mutex sync.Mutex
+
+	// 日志
+	logger *slog.Logger
+
+	// 连接和房间的配置
+	config     config.WebSocketConfig
+	gameConfig config.GameConfig
+	restConfig config.RESTConfig
+
+	// REST 接口的会话，key 为玩家ID（由锁保护）
+	sessions map[string]*Session
+
+	// 比赛和本轮的比赛桌，比赛桌的 key 为房间ID（由锁保护）
+	tournaments map[string]*tournament
+	tables      map[string]*tournamentTable
+
+	// 停机中：不再接受新房间和新游戏，drainDeadline 为宽限期结束的时间
+	draining      bool
+	drainDeadline time.Time
+
+	// 多实例模式（单实例时为 nil）
+	cluster *clusterState
 }
 
 // NewHub 创建一个新的Hub
-func NewHub() *Hub {
+func NewHub(cfg *config.Config, logger *slog.Logger) *Hub {
 	return &Hub{
+		logger:     logging.OrDefault(logger).With("component", "hub"),
+		config:     cfg.WebSocket,
+		gameConfig: cfg.Game,
+		restConfig: cfg.REST,
 		broadcast:  make(chan []byte),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
-		rooms:      make(map[string]map[*Client]bool),
-		games:      make(map[string]*game.Game),
+		rooms:      make(map[string]*room),
+		sessions:   make(map[string]*Session),
+
+		tournaments: make(map[string]*tournament),
+		tables:      make(map[string]*tournamentTable),
 	}
 }
 
@@ -53,645 +84,273 @@ func (h *Hub) Run() {
 		case client := <-h.Register:
 			h.mutex.Lock()
 			h.clients[client] = true
-			h.mutex.Unlock()
-		case client := <-h.Unregister:
-			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-
-				// 从房间中移除
-				if client.roomID != "" {
-					if room, ok := h.rooms[client.roomID]; ok {
-						delete(room, client)
-						if len(room) == 0 {
-							delete(h.rooms, client.roomID)
-							delete(h.games, client.roomID)
-						} else {
-							// 通知房间内其他玩家
-							h.broadcastToRoom(client.roomID, map[string]interface{}{
-								"type":     "player_left",
-								"playerID": client.playerID,
-							})
-						}
-					}
-				}
+			h.clusterRegister(client)
+			// 停机期间重新连接的玩家同样需要知道服务器即将维护
+			if h.draining && client.origin == "" {
+				h.sendShutdownNotice(client)
 			}
 			h.mutex.Unlock()
+		case client := <-h.Unregister:
+			h.unregister(client)
 		case message := <-h.broadcast:
 			h.mutex.Lock()
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+				// 其他实例转发来的客户端由其所在的实例投递
+				if client.origin != "" {
+					continue
 				}
+				client.deliver(encoded{typ: protocol.TypeAnnouncement, data: message})
 			}
 			h.mutex.Unlock()
 		}
 	}
 }
 
-// JoinRoom 将客户端加入房间
-func (h *Hub) JoinRoom(client *Client, roomID string) {
+// unregister 注销客户端：先移出房间，再关闭发送通道
+//
+// 这是唯一正常关闭 client.send 的地方。房间只向房间内的客户端发送消息，客户端移出房间后
+// 不会再收到房间的消息；其他地方的发送通过 Client.deliver 检查队列是否已关闭。
+func (h *Hub) unregister(client *Client) {
 	h.mutex.Lock()
-	defer h.mutex.Unlock()
-
-	// 如果房间不存在，创建它
-	if _, ok := h.rooms[roomID]; !ok {
-		h.rooms[roomID] = make(map[*Client]bool)
-		h.games[roomID] = game.NewGame(roomID)
+	if !h.clients[client] {
+		h.mutex.Unlock()
+		return
 	}
-
-	// 使用内部加入逻辑
-	h.joinRoomInternal(client, roomID)
+	delete(h.clients, client)
+	client.unregistered = true
+	h.clusterUnregister(client)
+	r := h.acquireRoomLocked(client.roomID)
+	h.mutex.Unlock()
+
+	if r != nil {
+		r.do(func() { r.leave(client) })
+	}
+	client.closeSend()
 }
 
-// sendRoomStateToClient 向客户端发送房间状态
-func (h *Hub) sendRoomStateToClient(client *Client, roomID string) {
-	room, ok := h.rooms[roomID]
-	if !ok {
-		return
-	}
+// addRoom 登记并启动房间（需在持有锁的情况下调用）
+func (h *Hub) addRoom(r *room) {
+	h.rooms[r.id] = r
+	go r.run()
+}
 
-	// 获取房间内所有玩家信息
-	players := make([]map[string]interface{}, 0, len(room))
-	g := h.games[roomID]
-	for c := range room {
-		playerInfo := map[string]interface{}{
-			"id":   c.playerID,
-			"name": c.playerName,
-		}
-		// 从游戏中获取玩家的准备状态
-		if g != nil {
-			for _, p := range g.Players {
-				if p != nil && p.ID == c.playerID {
-					playerInfo["ready"] = p.Status == game.PlayerStatusReady
-					break
-				}
-			}
-		}
-		players = append(players, playerInfo)
-	}
+// addRestoredRoom 按快照重建房间，房间等待玩家重新接入，不会因为没有玩家而关闭
+//
+// 房间已经存在时不做处理。比赛桌只能在举办比赛的实例中恢复，比赛不在本实例时返回 false。
+func (h *Hub) addRestoredRoom(roomID string, snapshot *roomSnapshot) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 
-	// 准备房间状态消息
-	roomState := map[string]interface{}{
-		"type":    "room_state",
-		"room_id": roomID,
-		"players": players,
+	if _, ok := h.rooms[roomID]; ok {
+		return true
 	}
-
-	// 发送房间状态
-	data, err := json.Marshal(roomState)
-	if err != nil {
-		log.Printf("Error marshalling room state: %v", err)
-		return
+	if snapshot.Tournament != "" && h.tables[roomID] == nil {
+		return false
 	}
 
-	log.Printf("发送房间状态给玩家 %s: %s", client.playerID, string(data))
-	client.send <- data
+	r := newRoom(h, roomID, game.Restore(*snapshot.Game, h.logger))
+	r.restore(snapshot)
+	r.closeWhenEmpty = false
+	h.addRoom(r)
+	h.logger.Info("room restored", logging.KeyRoomID, roomID, "status", snapshot.Game.Status)
+	return true
 }
 
-// broadcastToRoomExcept 向房间内除指定客户端外的所有客户端广播消息
-func (h *Hub) broadcastToRoomExcept(roomID string, except *Client, message interface{}) {
-	data, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshalling message: %v", err)
-		return
-	}
+// retireRoom 房间没有待执行的命令时把它从 Hub 中移除，返回是否已移除（由房间的 goroutine 调用）
+func (h *Hub) retireRoom(r *room) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 
-	if room, ok := h.rooms[roomID]; ok {
-		for client := range room {
-			if client != except {
-				select {
-				case client.send <- data:
-				default:
-					close(client.send)
-					delete(room, client)
-					delete(h.clients, client)
-				}
-			}
+	// 引用只在持有锁时增加，这里检查为 0 后不会再有新的命令
+	if r.refs.Load() > 0 {
+		return false
+	}
+	if h.rooms[r.id] == r {
+		delete(h.rooms, r.id)
+		if !r.lost {
+			h.roomRemoved(r.id)
 		}
 	}
+	return true
 }
 
-// LeaveRoom 将客户端从房间中移除
-func (h *Hub) LeaveRoom(client *Client) {
+// acquireRoom 获取房间的引用，房间不存在时返回 nil
+func (h *Hub) acquireRoom(roomID string) *room {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	if client.roomID == "" {
-		return
-	}
-
-	roomID := client.roomID
-	if room, ok := h.rooms[roomID]; ok {
-		delete(room, client)
-		client.roomID = ""
-
-		// 如果房间为空，删除它
-		if len(room) == 0 {
-			delete(h.rooms, roomID)
-			delete(h.games, roomID)
-		} else {
-			// 更新其他玩家的房间状态
-			for c := range room {
-				h.sendRoomStateToClient(c, roomID)
-			}
-			// 通知房间内其他玩家
-			h.broadcastToRoom(roomID, map[string]interface{}{
-				"type":     "player_left",
-				"playerID": client.playerID,
-			})
-		}
-	}
+	return h.acquireRoomLocked(roomID)
 }
 
-// broadcastToRoom 向房间内所有客户端广播消息
-func (h *Hub) broadcastToRoom(roomID string, message interface{}) {
-	data, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshalling message: %v", err)
-		return
+// acquireRoomLocked 获取房间的引用（需在持有锁的情况下调用）
+func (h *Hub) acquireRoomLocked(roomID string) *room {
+	if roomID == "" {
+		return nil
 	}
-
-	if room, ok := h.rooms[roomID]; ok {
-		for client := range room {
-			select {
-			case client.send <- data:
-			default:
-				close(client.send)
-				delete(room, client)
-				delete(h.clients, client)
-			}
-		}
+	r, ok := h.rooms[roomID]
+	if !ok {
+		return nil
 	}
+	r.refs.Add(1)
+	return r
 }
 
-// GetGame 获取房间对应的游戏
-func (h *Hub) GetGame(roomID string) *game.Game {
+// acquireRooms 获取所有房间的引用
+func (h *Hub) acquireRooms() []*room {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	return h.games[roomID]
+	rooms := make([]*room, 0, len(h.rooms))
+	for _, r := range h.rooms {
+		r.refs.Add(1)
+		rooms = append(rooms, r)
+	}
+	return rooms
 }
 
-// HandleGameAction 处理游戏相关的动作
-func (h *Hub) HandleGameAction(client *Client, action map[string]interface{}) {
+// clientRoom 获取客户端所在房间的引用，未加入房间时返回 nil
+func (h *Hub) clientRoom(client *Client) *room {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	roomID := client.roomID
-	if roomID == "" {
-		client.sendError("未加入房间")
-		return
-	}
-
-	g, ok := h.games[roomID]
-	if !ok {
-		client.sendError("游戏不存在")
-		return
-	}
+	return h.acquireRoomLocked(client.roomID)
+}
 
-	actionType, ok := action["action"].(string)
-	if !ok {
-		client.sendError("无效的动作类型")
+// inRoom 在客户端所在房间的 goroutine 中执行 fn，客户端未加入房间时回复错误
+func (h *Hub) inRoom(client *Client, fn func(r *room)) {
+	r := h.clientRoom(client)
+	if r == nil {
+		client.sendError("未加入房间")
 		return
 	}
-
-	switch actionType {
-	case "ready":
-		log.Printf("玩家 %s (ID: %s) 准备，房间: %s", client.playerName, client.playerID, roomID)
-		
-		// 确保玩家在游戏中
-		playerInGame := false
-		for i, p := range g.Players {
-			if p != nil && p.ID == client.playerID {
-				playerInGame = true
-				log.Printf("玩家 %s 已在游戏中，位置: %d", client.playerID, i)
-				break
-			}
-		}
-		
-		// 如果玩家不在游戏中，尝试添加
-		if !playerInGame {
-			log.Printf("玩家 %s 不在游戏中，尝试添加", client.playerID)
-			player := &game.Player{
-				ID:       client.playerID,
-				Name:     client.playerName,
-				Status:   game.PlayerStatusWaiting,
-				CardCount: 0,
-			}
-			if err := g.AddPlayer(player); err != nil {
-				log.Printf("准备时添加玩家失败: 玩家ID=%s, 错误=%v", client.playerID, err)
-				// 打印当前游戏中的所有玩家
-				log.Printf("当前游戏中的玩家:")
-				for i, p := range g.Players {
-					if p != nil {
-						log.Printf("  位置 %d: ID=%s, Name=%s", i, p.ID, p.Name)
-					} else {
-						log.Printf("  位置 %d: 空", i)
-					}
-				}
-				client.sendError(fmt.Sprintf("玩家不在游戏中，无法准备: %v", err))
-				return
-			}
-			log.Printf("成功添加玩家 %s 到游戏", client.playerID)
-		}
-		
-		// 再次确认玩家在游戏中
-		err := g.SetPlayerReady(client.playerID)
-		if err != nil {
-			log.Printf("设置玩家准备状态失败: 玩家ID=%s, 错误=%v", client.playerID, err)
-			// 打印当前游戏中的所有玩家
-			log.Printf("当前游戏中的玩家:")
-			for i, p := range g.Players {
-				if p != nil {
-					log.Printf("  位置 %d: ID=%s, Name=%s", i, p.ID, p.Name)
-				} else {
-					log.Printf("  位置 %d: 空", i)
-				}
-			}
-			client.sendError(err.Error())
-			return
-		}
-		
-		log.Printf("玩家 %s 准备成功", client.playerID)
-
-		// 广播玩家准备状态
-		h.broadcastToRoom(roomID, map[string]interface{}{
-			"type":     "player_ready",
-			"playerID": client.playerID,
-		})
-
-		// 更新所有玩家的房间状态（包含准备状态）
-		if room, ok := h.rooms[roomID]; ok {
-			for c := range room {
-				h.sendRoomStateToClient(c, roomID)
-			}
-		}
-
-		// 检查是否所有玩家都准备好了
-		log.Printf("检查所有玩家准备状态...")
-		log.Printf("当前游戏中的玩家:")
-		for i, p := range g.Players {
-			if p != nil {
-				log.Printf("  位置 %d: ID=%s, Name=%s, Status=%d (Ready=%v)", i, p.ID, p.Name, p.Status, p.Status == game.PlayerStatusReady)
-			} else {
-				log.Printf("  位置 %d: 空", i)
-			}
-		}
-		
-		allReady := g.AllPlayersReady()
-		log.Printf("所有玩家准备状态: %v", allReady)
-		
-		if allReady {
-			log.Printf("所有玩家已准备，开始游戏...")
-			err := g.StartGame()
-			if err != nil {
-				log.Printf("开始游戏失败: %v", err)
-				client.sendError(err.Error())
-				return
-			}
-			log.Printf("游戏开始成功！")
-
-			// 先广播游戏开始
-			h.broadcastToRoom(roomID, map[string]interface{}{
-				"type":          "game_started",
-				"currentPlayer": g.CurrentPlayer,
-			})
-
-			// 然后向每个玩家发送他们的手牌（延迟一小段时间，确保 game_started 消息先到达）
-			go func() {
-				time.Sleep(100 * time.Millisecond)
-				h.mutex.Lock()
-				defer h.mutex.Unlock()
-				if room, ok := h.rooms[roomID]; ok {
-					for clientInRoom := range room {
-						for _, player := range g.Players {
-							if player != nil && player.ID == clientInRoom.playerID {
-								select {
-								case clientInRoom.send <- h.createGameStateMessage(g, player.ID):
-								default:
-									log.Printf("无法发送游戏状态给玩家 %s", clientInRoom.playerID)
-								}
-								break
-							}
-						}
-					}
-				}
-			}()
-		}
-
-	case "play_cards":
-		cardIndices, ok := action["card_indices"].([]interface{})
-		if !ok {
-			client.sendError("无效的牌索引")
+	r.do(func() {
+		if !r.clients[client] {
+			client.sendError("未加入房间")
 			return
 		}
-
-		// 转换为int切片
-		indices := make([]int, len(cardIndices))
-		for i, idx := range cardIndices {
-			if idxFloat, ok := idx.(float64); ok {
-				indices[i] = int(idxFloat)
-			} else {
-				client.sendError("无效的牌索引格式")
-				return
-			}
-		}
-
-		err := g.PlayCards(client.playerID, indices)
-		if err != nil {
-			client.sendError(err.Error())
-			return
-		}
-
-		log.Printf("玩家 %s 出牌成功，桌面牌: %+v", client.playerID, g.TableCards)
-
-		// 序列化桌面牌
-		var tableCardsData interface{} = nil
-		if g.TableCards != nil {
-			tableCardsData = map[string]interface{}{
-				"type":  g.TableCards.Type,
-				"cards": g.TableCards.Cards,
-				"value": g.TableCards.Value,
-			}
-		}
-
-		// 先广播出牌通知（包含桌面牌信息，但不包含手牌）
-		h.broadcastToRoom(roomID, map[string]interface{}{
-			"type":           "cards_played",
-			"playerID":       client.playerID,
-			"table_cards":    tableCardsData,
-			"current_player": g.CurrentPlayer,
-			"last_player":    g.LastPlayer,
-		})
-
-		// 然后向每个玩家发送完整的游戏状态（包含各自的手牌）
-		for clientInRoom := range h.rooms[roomID] {
-			for _, player := range g.Players {
-				if player != nil && player.ID == clientInRoom.playerID {
-					select {
-					case clientInRoom.send <- h.createGameStateMessage(g, player.ID):
-						log.Printf("已发送游戏状态给玩家 %s", clientInRoom.playerID)
-					default:
-						log.Printf("无法发送游戏状态给玩家 %s（channel 已满）", clientInRoom.playerID)
-					}
-					break
-				}
-			}
-		}
-
-		// 检查游戏是否结束
-		if g.Status == game.GameStatusFinished {
-			result := g.GetGameResult()
-			h.broadcastToRoom(roomID, map[string]interface{}{
-				"type":   "game_end",
-				"result": result,
-			})
-		}
-
-	case "pass":
-		err := g.Pass(client.playerID)
-		if err != nil {
-			client.sendError(err.Error())
-			return
-		}
-
-		// 广播玩家过牌
-		h.broadcastToRoom(roomID, map[string]interface{}{
-			"type":          "player_pass",
-			"playerID":      client.playerID,
-			"currentPlayer": g.CurrentPlayer,
-		})
-
-		// 如果所有人都过了，清空桌面牌
-		if g.TableCards == nil {
-			h.broadcastToRoom(roomID, map[string]interface{}{
-				"type":          "round_end",
-				"currentPlayer": g.CurrentPlayer,
-			})
-		}
-	}
+		fn(r)
+	})
 }
 
-// createGameStateMessage 创建游戏状态消息
-func (h *Hub) createGameStateMessage(g *game.Game, playerID string) []byte {
-	log.Printf("创建游戏状态消息给玩家 %s", playerID)
-	// 找到玩家
-	var currentPlayer *game.Player
-	for _, p := range g.Players {
-		if p != nil && p.ID == playerID {
-			currentPlayer = p
-			break
-		}
-	}
-
-	if currentPlayer == nil {
-		return []byte("{}")
-	}
-
-	// 创建其他玩家信息（不包含手牌）
-	otherPlayers := make([]map[string]interface{}, 0, 3)
-	for _, p := range g.Players {
-		if p != nil && p.ID != playerID {
-			otherPlayers = append(otherPlayers, map[string]interface{}{
-				"id":             p.ID,
-				"name":           p.Name,
-				"position":       p.Position,
-				"status":         p.Status,
-				"card_count":     p.CardCount,
-				"collected_cards": p.CollectedCards,
-			})
-		}
-	}
+// setClientRoom 记录客户端所在的房间，客户端已注销时返回 false
+func (h *Hub) setClientRoom(client *Client, roomID string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 
-	// 序列化桌面牌
-	var tableCardsData interface{} = nil
-	if g.TableCards != nil {
-		// 手动序列化 CardGroup 以确保 JSON 格式正确
-		tableCardsData = map[string]interface{}{
-			"type":  g.TableCards.Type,
-			"cards": g.TableCards.Cards,
-			"value": g.TableCards.Value,
-		}
+	if client.unregistered {
+		return false
 	}
+	client.roomID = roomID
+	return true
+}
 
-	// 创建游戏状态
-	gameState := map[string]interface{}{
-		"type":          "game_state",
-		"status":        g.Status,
-		"current_player": g.CurrentPlayer,
-		"last_player":   g.LastPlayer,
-		"player":        currentPlayer,
-		"other_players": otherPlayers,
-		"table_cards":   tableCardsData,
-	}
+// clearClientRoom 客户端离开房间
+func (h *Hub) clearClientRoom(client *Client, roomID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 
-	data, err := json.Marshal(gameState)
-	if err != nil {
-		log.Printf("序列化游戏状态失败: %v", err)
-		return []byte("{}")
+	if client.roomID == roomID {
+		client.roomID = ""
 	}
-	log.Printf("游戏状态消息大小: %d 字节，桌面牌: %+v", len(data), tableCardsData)
-	return data
 }
 
-// GetRooms 获取所有房间信息
-func (h *Hub) GetRooms() []map[string]interface{} {
+// isDraining 是否正在停机
+func (h *Hub) isDraining() bool {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	rooms := make([]map[string]interface{}, 0, len(h.rooms))
-	for roomID, clients := range h.rooms {
-		// 获取房间内的玩家信息
-		players := make([]map[string]string, 0, len(clients))
-		for client := range clients {
-			players = append(players, map[string]string{
-				"id":   client.playerID,
-				"name": client.playerName,
-			})
-		}
-
-		// 获取游戏状态
-		game := h.games[roomID]
-		var gameStatus string
-		if game != nil {
-			gameStatus = game.GetStatus()
-		} else {
-			gameStatus = "waiting"
-		}
-
-		// 构建房间信息
-		roomInfo := map[string]interface{}{
-			"id":       roomID,
-			"players":  players,
-			"status":   gameStatus,
-			"capacity": 4, // 每个房间最多4个玩家
-		}
-		rooms = append(rooms, roomInfo)
-	}
+	return h.draining
+}
 
-	return rooms
+// JoinRoom 将客户端加入房间（房间不存在时创建）
+func (h *Hub) JoinRoom(client *Client, roomID string) {
+	h.enterRoom(client, roomID)
 }
 
-// CreateRoom 创建新房间并将客户端加入
+// CreateRoom 创建新房间并将客户端加入（房间已存在时直接加入）
 func (h *Hub) CreateRoom(client *Client, roomID string) {
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
-
-	log.Printf("创建房间: %s", roomID)
+	client.logger.Info("创建房间", logging.KeyRoomID, roomID)
+	h.enterRoom(client, roomID)
+}
 
-	// 如果房间已存在，直接加入
-	if _, ok := h.rooms[roomID]; ok {
-		// 房间已存在，使用 JoinRoom 的逻辑
-		h.joinRoomInternal(client, roomID)
+// enterRoom 将客户端加入房间，房间不存在时创建
+func (h *Hub) enterRoom(client *Client, roomID string) {
+	// 多实例模式下房间可能属于其他实例
+	owner, ok := h.routeRoom(client, roomID)
+	if !ok {
+		return
+	}
+	if owner != "" {
+		h.attach(client, owner, roomID)
 		return
 	}
 
-	// 创建新房间
-	h.rooms[roomID] = make(map[*Client]bool)
-	h.games[roomID] = game.NewGame(roomID)
-
-	// 将客户端加入房间
-	h.rooms[roomID][client] = true
-	client.roomID = roomID
+	// 客户端同一时间只在一个房间中
+	h.mutex.Lock()
+	current := client.roomID
+	h.mutex.Unlock()
+	if current != "" && current != roomID {
+		h.LeaveRoom(client)
+	}
 
-	// 将玩家添加到游戏中
-	g := h.games[roomID]
-	if g != nil {
-		player := &game.Player{
-			ID:       client.playerID,
-			Name:     client.playerName,
-			Status:   game.PlayerStatusWaiting,
-			CardCount: 0,
-		}
-		if err := g.AddPlayer(player); err != nil {
-			log.Printf("创建房间时添加玩家到游戏失败: 玩家ID=%s, 房间=%s, 错误=%v", client.playerID, roomID, err)
-		} else {
-			log.Printf("成功添加玩家 %s (%s) 到游戏 %s", client.playerName, client.playerID, roomID)
+	h.mutex.Lock()
+	r, ok := h.rooms[roomID]
+	if !ok {
+		// 停机中不再创建新房间
+		if h.draining {
+			h.mutex.Unlock()
+			client.sendError(errDraining)
+			return
 		}
-	} else {
-		log.Printf("警告: 房间 %s 的游戏对象为 nil", roomID)
+		r = newRoom(h, roomID, game.NewGame(roomID, h.logger))
+		h.addRoom(r)
 	}
+	r.refs.Add(1)
+	h.mutex.Unlock()
 
-	// 发送房间状态
-	h.sendRoomStateToClient(client, roomID)
+	r.do(func() { r.join(client) })
 }
 
-// joinRoomInternal 内部加入房间逻辑（不加锁，需在持有锁的情况下调用）
-func (h *Hub) joinRoomInternal(client *Client, roomID string) {
-	// 检查房间是否已满（最多4人）
-	if len(h.rooms[roomID]) >= 4 {
-		client.sendError("房间已满")
-		return
+// LeaveRoom 将客户端从房间中移除
+func (h *Hub) LeaveRoom(client *Client) {
+	if r := h.clientRoom(client); r != nil {
+		r.do(func() { r.leave(client) })
 	}
+}
 
-	// 检查玩家是否已经在房间中
-	if _, exists := h.rooms[roomID][client]; exists {
-		// 玩家已在房间中，确保玩家在游戏中
-		g := h.games[roomID]
-		if g != nil {
-			// 检查玩家是否在游戏中
-			found := false
-			for _, p := range g.Players {
-				if p != nil && p.ID == client.playerID {
-					found = true
-					break
-				}
-			}
-			// 如果不在游戏中，添加玩家
-			if !found {
-				log.Printf("玩家 %s 在房间中但不在游戏中，尝试添加", client.playerID)
-				player := &game.Player{
-					ID:       client.playerID,
-					Name:     client.playerName,
-					Status:   game.PlayerStatusWaiting,
-					CardCount: 0,
-				}
-				if err := g.AddPlayer(player); err != nil {
-					log.Printf("加入房间时添加玩家到游戏失败: 玩家ID=%s, 房间=%s, 错误=%v", client.playerID, roomID, err)
-				} else {
-					log.Printf("成功添加玩家 %s (%s) 到游戏 %s", client.playerName, client.playerID, roomID)
-				}
+// HandleGameAction 处理游戏相关的动作
+func (h *Hub) HandleGameAction(client *Client, action *protocol.GameAction) {
+	h.inRoom(client, func(r *room) {
+		r.handleAction(client, action)
+	})
+}
+
+// GetRooms 获取所有房间信息（多实例模式下包含所有实例的房间）
+func (h *Hub) GetRooms() []redis.RoomInfo {
+	local := make(map[string]bool)
+	rooms := make([]redis.RoomInfo, 0)
+	for _, r := range h.acquireRooms() {
+		r.do(func() {
+			if !r.closed {
+				rooms = append(rooms, *r.info())
+				local[r.id] = true
 			}
-		}
-		// 发送房间状态
-		h.sendRoomStateToClient(client, roomID)
-		return
+		})
 	}
 
-	// 将客户端加入房间
-	h.rooms[roomID][client] = true
-	client.roomID = roomID
+	if h.cluster == nil {
+		return rooms
+	}
 
-	// 将玩家添加到游戏中
-	g := h.games[roomID]
-	if g != nil {
-		player := &game.Player{
-			ID:       client.playerID,
-			Name:     client.playerName,
-			Status:   game.PlayerStatusWaiting,
-			CardCount: 0,
-		}
-		if err := g.AddPlayer(player); err != nil {
-			log.Printf("加入房间时添加玩家到游戏失败: 玩家ID=%s, 房间=%s, 错误=%v", client.playerID, roomID, err)
-		} else {
-			log.Printf("成功添加玩家 %s (%s) 到游戏 %s", client.playerName, client.playerID, roomID)
+	remote, err := redis.ListRooms()
+	if err != nil {
+		h.logger.Warn("failed to list cluster rooms", "error", err)
+		return rooms
+	}
+	for _, info := range remote {
+		if !local[info.ID] {
+			rooms = append(rooms, *info)
 		}
-	} else {
-		log.Printf("警告: 房间 %s 的游戏对象为 nil，无法添加玩家", roomID)
 	}
-
-	// 向新加入的玩家发送完整的房间状态
-	h.sendRoomStateToClient(client, roomID)
-
-	// 通知房间内其他玩家有新玩家加入
-	h.broadcastToRoomExcept(roomID, client, map[string]interface{}{
-		"type":     "player_joined",
-		"playerID": client.playerID,
-		"name":     client.playerName,
-	})
-}
\ No newline at end of file
+	return rooms
+}
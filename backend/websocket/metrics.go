@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// invalidMessageType 不符合协议的消息统计为 invalid，避免标签无限增长
+const invalidMessageType = "invalid"
+
+// hubCollector 在抓取时从 Hub 读取连接、房间和游戏数量
+type hubCollector struct {
+	hub         *Hub
+	clients     *prometheus.Desc
+	rooms       *prometheus.Desc
+	activeGames *prometheus.Desc
+}
+
+// Collector 返回 Hub 的 Prometheus 采集器
+func (h *Hub) Collector() prometheus.Collector {
+	return &hubCollector{
+		hub: h,
+		clients: prometheus.NewDesc("hong3_connected_clients",
+			"Number of connected WebSocket clients.", nil, nil),
+		rooms: prometheus.NewDesc("hong3_rooms",
+			"Number of rooms, by game status.", []string{"status"}, nil),
+		activeGames: prometheus.NewDesc("hong3_active_games",
+			"Number of games currently being played.", nil, nil),
+	}
+}
+
+// Describe 实现 prometheus.Collector
+func (c *hubCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.clients
+	ch <- c.rooms
+	ch <- c.activeGames
+}
+
+// Collect 实现 prometheus.Collector
+func (c *hubCollector) Collect(ch chan<- prometheus.Metric) {
+	h := c.hub
+	h.mutex.Lock()
+	clients := h.localClients()
+	h.mutex.Unlock()
+
+	rooms := map[string]int{"waiting": 0, "playing": 0, "finished": 0}
+	for _, r := range h.acquireRooms() {
+		r.do(func() {
+			if !r.closed {
+				rooms[r.game.GetStatus()]++
+			}
+		})
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.clients, prometheus.GaugeValue, float64(clients))
+	for status, count := range rooms {
+		ch <- prometheus.MustNewConstMetric(c.rooms, prometheus.GaugeValue, float64(count), status)
+	}
+	ch <- prometheus.MustNewConstMetric(c.activeGames, prometheus.GaugeValue, float64(rooms["playing"]))
+}
+
+// countInbound 统计收到的消息
+func countInbound(messageType string) {
+	metrics.MessagesIn.WithLabelValues(messageType).Inc()
+}
+
+// countOutbound 统计发出的消息
+func countOutbound(messageType string) {
+	if messageType == "" {
+		messageType = "unknown"
+	}
+	metrics.MessagesOut.WithLabelValues(messageType).Inc()
+}
+
+// countActionError 统计被拒绝的游戏动作
+func countActionError(action string, err error) {
+	metrics.GameActionErrors.WithLabelValues(action, game.ErrorReason(err)).Inc()
+}
@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chenhailong/hong3/metrics"
+	"github.com/chenhailong/hong3/protocol"
+)
+
+// encoded 已编码的消息
+type encoded struct {
+	typ  string
+	data []byte
+}
+
+// queued 排队中的消息
+type queued struct {
+	encoded
+	at time.Time
+}
+
+// sendQueue 客户端的发送队列
+//
+// 事件按顺序排队，不会丢弃；快照（见 protocol.IsSnapshot）入队时替代队列中尚未发出的
+// 同类快照，新快照排在队尾，保证它之前的事件先发出。积压的上限和允许的等待时间见
+// config.WebSocketConfig 的 send_queue_size 和 max_send_lag。
+type sendQueue struct {
+	mu     sync.Mutex
+	items  []queued
+	closed bool
+
+	// 有新消息或队列关闭时通知
+	ready chan struct{}
+}
+
+func newSendQueue() *sendQueue {
+	return &sendQueue{ready: make(chan struct{}, 1)}
+}
+
+// push 消息入队，返回入队后的积压数和最早一条消息的等待时间；队列已关闭时返回 false
+func (q *sendQueue) push(m encoded) (int, time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0, 0, false
+	}
+	now := time.Now()
+	if protocol.IsSnapshot(m.typ) {
+		for i, item := range q.items {
+			if item.typ == m.typ {
+				q.items = append(q.items[:i], q.items[i+1:]...)
+				metrics.SendCoalesced.WithLabelValues(m.typ).Inc()
+				break
+			}
+		}
+	}
+	q.items = append(q.items, queued{encoded: m, at: now})
+	q.notify()
+
+	return len(q.items), now.Sub(q.items[0].at), true
+}
+
+// take 取出所有排队的消息，并返回队列是否已关闭
+func (q *sendQueue) take() ([]queued, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := q.items
+	q.items = nil
+	return items, q.closed
+}
+
+// close 关闭队列，已排队的消息仍会发出
+func (q *sendQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		q.notify()
+	}
+}
+
+// discard 关闭队列并丢弃尚未发出的消息，返回丢弃的消息数
+func (q *sendQueue) discard() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := len(q.items)
+	q.items = nil
+	q.closed = true
+	q.notify()
+	return n
+}
+
+// notify 通知发送协程（需在持有锁的情况下调用）
+func (q *sendQueue) notify() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,169 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chenhailong/hong3/config"
+	"github.com/chenhailong/hong3/metrics"
+	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/protocol"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// queuedTypes 队列中消息的类型和内容，按顺序排列
+func queuedTypes(items []queued) []string {
+	types := make([]string, 0, len(items))
+	for _, item := range items {
+		types = append(types, item.typ+":"+string(item.data))
+	}
+	return types
+}
+
+func TestSendQueueCoalescesSnapshots(t *testing.T) {
+	q := newSendQueue()
+	for _, m := range []encoded{
+		{protocol.TypePlayerJoined, []byte("1")},
+		{protocol.TypeRoomState, []byte("2")},
+		{protocol.TypeGameState, []byte("3")},
+		{protocol.TypePlayerLeft, []byte("4")},
+		{protocol.TypeRoomState, []byte("5")},
+		{protocol.TypePlayerJoined, []byte("6")},
+	} {
+		if _, _, ok := q.push(m); !ok {
+			t.Fatalf("push %s to an open queue failed", m.typ)
+		}
+	}
+
+	// 新的 room_state 替代旧的并排在队尾，它之前的事件先发出；事件不会合并
+	items, closed := q.take()
+	want := []string{"player_joined:1", "game_state:3", "player_left:4", "room_state:5", "player_joined:6"}
+	got := queuedTypes(items)
+	if closed || len(got) != len(want) {
+		t.Fatalf("queue %v (closed %v), want %v", got, closed, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("queue %v, want %v", got, want)
+		}
+	}
+
+	// 已取走的快照不会被替代
+	q.push(encoded{protocol.TypeRoomState, []byte("7")})
+	if items, _ := q.take(); len(items) != 1 || string(items[0].data) != "7" {
+		t.Errorf("queue after take %v, want only the new room_state", queuedTypes(items))
+	}
+}
+
+func TestSendQueueBacklog(t *testing.T) {
+	q := newSendQueue()
+	q.push(encoded{protocol.TypePlayerJoined, nil})
+	time.Sleep(10 * time.Millisecond)
+	n, lag, _ := q.push(encoded{protocol.TypePlayerLeft, nil})
+	if n != 2 || lag < 10*time.Millisecond {
+		t.Errorf("backlog %d, lag %v; want 2 and the age of the oldest message", n, lag)
+	}
+
+	// 替代快照不增加积压
+	q.push(encoded{protocol.TypeRoomState, nil})
+	if n, _, _ := q.push(encoded{protocol.TypeRoomState, nil}); n != 3 {
+		t.Errorf("backlog %d after coalescing, want 3", n)
+	}
+}
+
+func TestSendQueueDiscard(t *testing.T) {
+	q := newSendQueue()
+	q.push(encoded{protocol.TypePlayerJoined, nil})
+	q.push(encoded{protocol.TypePlayerLeft, nil})
+
+	if dropped := q.discard(); dropped != 2 {
+		t.Errorf("discarded %d, want 2", dropped)
+	}
+	if _, _, ok := q.push(encoded{protocol.TypePlayerJoined, nil}); ok {
+		t.Error("push to a discarded queue succeeded")
+	}
+	items, closed := q.take()
+	if len(items) != 0 || !closed {
+		t.Errorf("discarded queue has %d items (closed %v), want none and closed", len(items), closed)
+	}
+
+	// 关闭时已排队的消息仍会发出
+	q = newSendQueue()
+	q.push(encoded{protocol.TypePlayerJoined, nil})
+	q.close()
+	if items, closed := q.take(); len(items) != 1 || !closed {
+		t.Errorf("closed queue has %d items (closed %v), want 1 and closed", len(items), closed)
+	}
+}
+
+// newSlowClient 没有发送协程的客户端，使用指定的 WebSocket 配置
+func newSlowClient(t *testing.T, ws config.WebSocketConfig) *Client {
+	t.Helper()
+	h := newTestHub(t)
+	h.config = ws
+	return NewClient(h, nil, "slow", "slow", models.RolePlayer, true, h.logger)
+}
+
+// disconnected 客户端是否已被断开
+func disconnected(c *Client) bool {
+	select {
+	case <-c.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestDeliverDisconnectsOnQueueSize(t *testing.T) {
+	ws := config.Default().WebSocket
+	ws.SendQueueSize = 3
+	c := newSlowClient(t, ws)
+	drops := testutil.ToFloat64(metrics.SendDrops)
+
+	for i := 0; i < ws.SendQueueSize; i++ {
+		c.deliver(encoded{protocol.TypePlayerJoined, nil})
+	}
+	if disconnected(c) {
+		t.Fatal("client disconnected at the queue limit")
+	}
+
+	c.deliver(encoded{protocol.TypePlayerJoined, nil})
+	if !disconnected(c) {
+		t.Fatal("client not disconnected over the queue limit")
+	}
+	if items, closed := c.send.take(); len(items) != 0 || !closed {
+		t.Errorf("queue has %d items (closed %v), want discarded", len(items), closed)
+	}
+	if got := testutil.ToFloat64(metrics.SendDrops) - drops; got != float64(ws.SendQueueSize+1) {
+		t.Errorf("send drops increased by %v, want %d", got, ws.SendQueueSize+1)
+	}
+
+	// 断开后的消息直接丢弃
+	c.deliver(encoded{protocol.TypePlayerJoined, nil})
+	if got := testutil.ToFloat64(metrics.SendDrops) - drops; got != float64(ws.SendQueueSize+1) {
+		t.Errorf("send drops increased by %v after disconnecting, want %d", got, ws.SendQueueSize+1)
+	}
+}
+
+func TestDeliverDisconnectsOnLag(t *testing.T) {
+	ws := config.Default().WebSocket
+	ws.MaxSendLag = 10 * time.Millisecond
+	c := newSlowClient(t, ws)
+	drops := testutil.ToFloat64(metrics.SendDrops)
+
+	c.deliver(encoded{protocol.TypePlayerJoined, nil})
+	c.deliver(encoded{protocol.TypeRoomState, nil})
+	if disconnected(c) {
+		t.Fatal("client disconnected before the lag limit")
+	}
+
+	time.Sleep(2 * ws.MaxSendLag)
+	c.deliver(encoded{protocol.TypeRoomState, nil})
+	if !disconnected(c) {
+		t.Fatal("client not disconnected over the lag limit")
+	}
+	// 替代的快照不计入丢弃的消息
+	if got := testutil.ToFloat64(metrics.SendDrops) - drops; got != 2 {
+		t.Errorf("send drops increased by %v, want 2", got)
+	}
+}
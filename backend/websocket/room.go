@@ -0,0 +1,545 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/logging"
+	"github.com/chenhailong/hong3/metrics"
+	"github.com/chenhailong/hong3/protocol"
+	"github.com/chenhailong/hong3/redis"
+)
+
+const (
+	// roomInboxSize 房间命令队列的长度
+	roomInboxSize = 64
+
+	// roomCapacity 每个房间最多的玩家数，由游戏规则决定（四人一局），不能配置
+	roomCapacity = len(game.Game{}.Players)
+)
+
+// room 一个房间及其游戏，所有命令都在房间自己的 goroutine 中依次执行
+//
+// 除 refs 和 dirty 外，room 的字段只能在房间的 goroutine 中访问。其他 goroutine 先通过
+// Hub 获得房间的引用（acquireRoom 等），再用 do 把命令交给房间执行，每个引用对应一条命令。
+// 房间没有玩家、也没有待执行的命令时从 Hub 中移除，goroutine 随之退出。
+type room struct {
+	id     string
+	hub    *Hub
+	logger *slog.Logger
+
+	// 命令队列
+	inbox chan func()
+
+	// 已获得引用但尚未执行完的命令数（只在持有 Hub 锁时增加）
+	refs atomic.Int32
+
+	// 有变化，需要同步到 Redis（多实例模式）
+	dirty atomic.Bool
+
+	// 房间内的客户端
+	clients map[*Client]bool
+
+	// 房间的游戏
+	game *game.Game
+
+	// 最近的事件
+	events eventBuffer
+
+	// 每位玩家最近处理过的携带 action_id 的动作
+	actions map[string]*recentActions
+
+	// 等待回复的换座位请求，key 为发出请求的玩家ID
+	swaps map[string]swapRequest
+
+	// 房间是比赛桌时为对应的比赛桌，普通房间为 nil
+	table *tournamentTable
+
+	// 房主的玩家ID（比赛桌没有房主）
+	host string
+
+	// 已被房主锁定，不在游戏中的玩家不能加入
+	locked bool
+
+	// 被房主移出、不能再加入的玩家
+	banned map[string]bool
+
+	// 没有玩家时关闭房间（从快照恢复的房间在第一个玩家加入前保留，比赛桌在本轮结束前保留）
+	closeWhenEmpty bool
+
+	// 已被关闭，不再接受玩家
+	closed bool
+
+	// 已转移到其他实例，移除时不删除 Redis 中的状态
+	lost bool
+}
+
+// newRoom 创建房间，需要通过 Hub.addRoom 启动（需在持有 Hub 锁的情况下调用）
+func newRoom(h *Hub, roomID string, g *game.Game) *room {
+	table := h.tables[roomID]
+	r := &room{
+		id:             roomID,
+		hub:            h,
+		logger:         h.logger.With(logging.KeyRoomID, roomID),
+		inbox:          make(chan func(), roomInboxSize),
+		clients:        make(map[*Client]bool),
+		game:           g,
+		events:         newEventBuffer(h.gameConfig.EventBufferSize),
+		actions:        make(map[string]*recentActions),
+		swaps:          make(map[string]swapRequest),
+		banned:         make(map[string]bool),
+		table:          table,
+		closeWhenEmpty: table == nil,
+	}
+	r.dirty.Store(true)
+	return r
+}
+
+// run 依次执行房间的命令
+func (r *room) run() {
+	for fn := range r.inbox {
+		r.exec(fn)
+		r.refs.Add(-1)
+		if len(r.clients) == 0 && r.closeWhenEmpty && r.hub.retireRoom(r) {
+			return
+		}
+	}
+}
+
+// exec 执行一条命令，命令 panic 时只影响这一条命令
+func (r *room) exec(fn func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.logger.Error("room command panic", "panic", p)
+		}
+	}()
+	fn()
+}
+
+// do 在房间的 goroutine 中执行 fn 并等待完成，调用前需获得房间的引用，且不能持有 Hub 的锁
+func (r *room) do(fn func()) {
+	done := make(chan struct{})
+	r.inbox <- func() {
+		defer close(done)
+		fn()
+	}
+	<-done
+}
+
+// clientLog 返回带房间ID的客户端日志记录器
+func (r *room) clientLog(client *Client) *slog.Logger {
+	return client.logger.With(logging.KeyRoomID, r.id)
+}
+
+// markDirty 标记房间需要同步到 Redis
+func (r *room) markDirty() {
+	r.dirty.Store(true)
+}
+
+// add 把客户端加入房间，客户端已注销时返回 false
+func (r *room) add(client *Client) bool {
+	if !r.hub.setClientRoom(client, r.id) {
+		return false
+	}
+	r.clients[client] = true
+	r.closeWhenEmpty = r.table == nil
+	if r.host == "" && r.table == nil {
+		r.host = client.playerID
+	}
+	r.markDirty()
+	return true
+}
+
+// join 将客户端加入房间
+func (r *room) join(client *Client) {
+	logger := r.clientLog(client)
+	if r.closed {
+		client.sendError("房间已关闭")
+		return
+	}
+	// 比赛桌按玩家ID分配座位，只接受玩家ID经过验证的连接
+	if r.table != nil && !client.verified {
+		client.sendError("请登录后再加入比赛桌")
+		return
+	}
+	if r.table != nil && r.table.seatOf(client.playerID) < 0 {
+		client.sendError("只有分到本桌的参赛玩家可以加入")
+		return
+	}
+	if r.banned[client.playerID] {
+		client.sendError("你已被房主移出该房间")
+		return
+	}
+
+	// 已开始的游戏中的玩家重新接入（重新连接或房间转移到其他实例后）
+	if r.game.Status != game.GameStatusWaiting && r.game.HasPlayer(client.playerID) {
+		if !r.add(client) {
+			return
+		}
+		logger.Info("玩家重新接入游戏")
+		r.sendRoomState(client)
+		r.sendGameState(client)
+		return
+	}
+
+	// 检查玩家是否已经在房间中
+	if r.clients[client] {
+		// 玩家已在房间中，确保玩家在游戏中
+		if !r.game.HasPlayer(client.playerID) {
+			logger.Debug("玩家在房间中但不在游戏中，尝试添加")
+			if err := r.addPlayer(client); err != nil {
+				logger.Warn("加入房间时添加玩家到游戏失败", "error", err)
+			} else {
+				logger.Debug("成功添加玩家到游戏")
+			}
+		}
+		// 发送房间状态
+		r.sendRoomState(client)
+		return
+	}
+
+	// 锁定的房间只允许游戏中的玩家重新加入
+	if r.locked && !r.game.HasPlayer(client.playerID) {
+		client.sendError("房间已锁定")
+		return
+	}
+
+	// 检查房间是否已满
+	if len(r.clients) >= roomCapacity {
+		client.sendError("房间已满")
+		return
+	}
+
+	// 将客户端加入房间
+	if !r.add(client) {
+		return
+	}
+
+	// 将玩家添加到游戏中
+	if err := r.addPlayer(client); err != nil {
+		logger.Warn("加入房间时添加玩家到游戏失败", "error", err)
+	} else {
+		logger.Info("玩家加入房间")
+	}
+
+	// 通知房间内其他玩家有新玩家加入
+	r.broadcastExcept(client, &protocol.PlayerJoined{
+		PlayerID: client.playerID,
+		Name:     client.playerName,
+	})
+
+	// 向新加入的玩家发送完整的房间状态。在 player_joined 之后发送，
+	// 快照的序号已包含这条通知，新玩家收到的下一条房间事件不会出现序号缺口
+	r.sendRoomState(client)
+}
+
+// leave 将客户端移出房间
+func (r *room) leave(client *Client) {
+	if !r.clients[client] {
+		return
+	}
+	delete(r.clients, client)
+	r.hub.clearClientRoom(client, r.id)
+	r.dropSwaps(client.playerID)
+	r.markDirty()
+
+	// 房主离开后房主转给其他玩家，房间为空时下一个加入的玩家成为房主
+	hostLeft := client.playerID == r.host && !r.hasClient(client.playerID)
+	if hostLeft {
+		r.host = r.nextHost()
+	}
+
+	if len(r.clients) == 0 {
+		return
+	}
+
+	// 更新其他玩家的房间状态
+	for c := range r.clients {
+		r.sendRoomState(c)
+	}
+	// 通知房间内其他玩家
+	r.broadcast(&protocol.PlayerLeft{PlayerID: client.playerID})
+	if hostLeft {
+		r.broadcast(&protocol.HostChanged{PlayerID: r.host})
+	}
+}
+
+// close 关闭房间：通知并移出所有玩家，其他实例转发来的客户端随之注销
+func (r *room) close(message protocol.Message) {
+	r.broadcast(message)
+
+	remote := make([]*Client, 0)
+	for client := range r.clients {
+		delete(r.clients, client)
+		r.hub.clearClientRoom(client, r.id)
+		if client.origin != "" {
+			remote = append(remote, client)
+		}
+	}
+	// 客户端已不在任何房间中，注销时不会再回到本房间
+	for _, client := range remote {
+		r.hub.unregister(client)
+	}
+
+	r.closed = true
+	r.closeWhenEmpty = true
+	r.markDirty()
+}
+
+// applyAction 执行游戏动作，动作被拒绝时返回原因
+func (r *room) applyAction(client *Client, action *protocol.GameAction) error {
+	logger := r.clientLog(client)
+	g := r.game
+
+	switch action.Action {
+	case protocol.ActionReady:
+		logger.Debug("玩家准备")
+
+		// 停机中不再开始新游戏
+		if r.hub.isDraining() {
+			return errors.New(errDraining)
+		}
+
+		// 如果玩家不在游戏中，尝试添加
+		if !g.HasPlayer(client.playerID) {
+			logger.Debug("玩家不在游戏中，尝试添加")
+			if err := r.addPlayer(client); err != nil {
+				logger.Warn("准备时添加玩家失败", "error", err, "players", playerIDs(g))
+				return fmt.Errorf("玩家不在游戏中，无法准备: %w", err)
+			}
+		}
+
+		// 再次确认玩家在游戏中
+		if err := g.SetPlayerReady(client.playerID); err != nil {
+			logger.Warn("设置玩家准备状态失败", "error", err, "players", playerIDs(g))
+			return err
+		}
+
+		logger.Info("玩家准备成功")
+
+		// 广播玩家准备状态
+		r.broadcast(&protocol.PlayerReady{PlayerID: client.playerID})
+
+		// 更新所有玩家的房间状态（包含准备状态）
+		for c := range r.clients {
+			r.sendRoomState(c)
+		}
+
+		// 检查是否所有玩家都准备好了
+		if g.AllPlayersReady() {
+			if err := g.StartGame(); err != nil {
+				logger.Error("开始游戏失败", "error", err)
+				return err
+			}
+			clear(r.swaps)
+
+			// 先广播游戏开始，然后向每个玩家发送他们的手牌
+			// （同一连接上的消息按发送顺序到达，game_state 一定在 game_started 之后）
+			r.broadcast(&protocol.GameStarted{CurrentPlayer: g.CurrentPlayer})
+			for c := range r.clients {
+				r.sendGameState(c)
+			}
+		}
+
+	case protocol.ActionPlayCards:
+		if err := g.PlayCards(client.playerID, action.CardIndices); err != nil {
+			countActionError(action.Action, err)
+			return err
+		}
+
+		logger.Debug("玩家出牌成功", "table_cards", g.TableCards)
+
+		// 先广播出牌通知（包含桌面牌信息，但不包含手牌）
+		r.broadcast(&protocol.CardsPlayed{
+			PlayerID:      client.playerID,
+			TableCards:    protocol.NewTableCards(g.TableCards),
+			CurrentPlayer: g.CurrentPlayer,
+			LastPlayer:    g.LastPlayer,
+		})
+
+		// 然后向每个玩家发送完整的游戏状态（包含各自的手牌）
+		for c := range r.clients {
+			r.sendGameState(c)
+		}
+
+		// 检查游戏是否结束
+		if g.Status == game.GameStatusFinished {
+			metrics.GameDuration.Observe(g.Duration().Seconds())
+			result := g.GetGameResult()
+			r.broadcast(&protocol.GameEnd{Result: result})
+			if r.table != nil {
+				r.tableHandFinished(result)
+			}
+		}
+
+	case protocol.ActionPass:
+		if err := g.Pass(client.playerID); err != nil {
+			countActionError(action.Action, err)
+			return err
+		}
+
+		// 广播玩家过牌
+		r.broadcast(&protocol.PlayerPass{
+			PlayerID:      client.playerID,
+			CurrentPlayer: g.CurrentPlayer,
+		})
+
+		// 如果所有人都过了，清空桌面牌
+		if g.TableCards == nil {
+			r.broadcast(&protocol.RoundEnd{CurrentPlayer: g.CurrentPlayer})
+		}
+	}
+	return nil
+}
+
+// broadcast 向房间内所有客户端广播消息
+func (r *room) broadcast(message protocol.Message) {
+	r.broadcastExcept(nil, message)
+}
+
+// broadcastExcept 向房间内除指定客户端外的所有客户端广播消息
+func (r *room) broadcastExcept(except *Client, message protocol.Message) {
+	data, err := r.encode(message)
+	if err != nil {
+		r.logger.Error("Error marshalling message", "error", err)
+		return
+	}
+	r.markDirty()
+
+	m := encoded{typ: message.MessageType(), data: data}
+	for client := range r.clients {
+		if client != except {
+			client.deliver(m)
+		}
+	}
+}
+
+// sendRoomState 向客户端发送房间状态
+func (r *room) sendRoomState(client *Client) {
+	// 获取房间内所有玩家信息
+	players := make([]protocol.RoomPlayer, 0, len(r.clients))
+	for c := range r.clients {
+		playerInfo := protocol.RoomPlayer{
+			ID:       c.playerID,
+			Name:     c.playerName,
+			Position: -1,
+		}
+		// 从游戏中获取玩家的准备状态和座位
+		for _, p := range r.game.Players {
+			if p != nil && p.ID == c.playerID {
+				playerInfo.Ready = p.Status == game.PlayerStatusReady
+				playerInfo.Position = p.Position
+				break
+			}
+		}
+		players = append(players, playerInfo)
+	}
+
+	roomState := &protocol.RoomState{
+		RoomID:  r.id,
+		Players: players,
+		Host:    r.host,
+		Locked:  r.locked,
+	}
+	roomState.Seq = r.events.seq
+	client.sendMessage(roomState)
+}
+
+// sendGameState 向客户端发送游戏状态（包含该玩家的手牌），玩家不在游戏中时不发送
+func (r *room) sendGameState(client *Client) {
+	g := r.game
+
+	// 找到玩家
+	var currentPlayer *game.Player
+	for _, p := range g.Players {
+		if p != nil && p.ID == client.playerID {
+			currentPlayer = p
+			break
+		}
+	}
+	if currentPlayer == nil {
+		return
+	}
+
+	// 创建其他玩家信息（不包含手牌）
+	otherPlayers := make([]protocol.OtherPlayer, 0, 3)
+	for _, p := range g.Players {
+		if p != nil && p.ID != client.playerID {
+			otherPlayers = append(otherPlayers, protocol.OtherPlayer{
+				ID:             p.ID,
+				Name:           p.Name,
+				Position:       p.Position,
+				Status:         p.Status,
+				CardCount:      p.CardCount,
+				CollectedCards: p.CollectedCards,
+			})
+		}
+	}
+
+	state := &protocol.GameState{
+		Status:        g.Status.String(),
+		CurrentPlayer: g.CurrentPlayer,
+		LastPlayer:    g.LastPlayer,
+		Player:        currentPlayer,
+		OtherPlayers:  otherPlayers,
+		TableCards:    protocol.NewTableCards(g.TableCards),
+	}
+	state.Seq = r.events.seq
+	client.sendMessage(state)
+}
+
+// info 构建房间概要
+func (r *room) info() *redis.RoomInfo {
+	// 获取房间内的玩家信息
+	players := make([]redis.RoomPlayer, 0, len(r.clients))
+	for client := range r.clients {
+		players = append(players, redis.RoomPlayer{
+			ID:   client.playerID,
+			Name: client.playerName,
+		})
+	}
+
+	info := &redis.RoomInfo{
+		ID:       r.id,
+		Players:  players,
+		Status:   r.game.GetStatus(),
+		Capacity: roomCapacity,
+		Locked:   r.locked,
+	}
+	if r.hub.cluster != nil {
+		info.Owner = r.hub.cluster.id
+	}
+	return info
+}
+
+// addPlayer 把客户端的玩家添加到游戏中，比赛桌上的玩家坐到分配的座位
+func (r *room) addPlayer(client *Client) error {
+	if r.table != nil {
+		return r.game.AddPlayerAt(newPlayer(client), r.table.seatOf(client.playerID))
+	}
+	return r.game.AddPlayer(newPlayer(client))
+}
+
+// newPlayer 为客户端创建游戏玩家
+func newPlayer(client *Client) *game.Player {
+	return &game.Player{
+		ID:        client.playerID,
+		Name:      client.playerName,
+		Status:    game.PlayerStatusWaiting,
+		CardCount: 0,
+	}
+}
+
+// playerIDs 获取游戏各座位的玩家ID（空座位为空字符串），用于日志
+func playerIDs(g *game.Game) []string {
+	ids := make([]string, len(g.Players))
+	for i, p := range g.Players {
+		if p != nil {
+			ids[i] = p.ID
+		}
+	}
+	return ids
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chenhailong/hong3/config"
+	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/protocol"
+)
+
+// benchPlayer 没有 WebSocket 连接的客户端，发给它的消息被直接丢弃
+//
+// 同一连接的消息由 ReadPump 依次处理，mu 保证基准测试中同一客户端的操作也不会并发。
+type benchPlayer struct {
+	mu     sync.Mutex
+	client *Client
+	roomID string
+}
+
+// newBenchHub 创建并启动不输出日志的 Hub
+func newBenchHub() *Hub {
+	h := NewHub(config.Default(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	go h.Run()
+	return h
+}
+
+// newBenchPlayer 注册客户端并持续读取发给它的消息
+func newBenchPlayer(h *Hub, id, roomID string) *benchPlayer {
+	client := NewClient(h, nil, id, id, models.RolePlayer, false, h.logger)
+	h.Register <- client
+	go func() {
+		for range client.send.ready {
+			if _, closed := client.send.take(); closed {
+				return
+			}
+		}
+	}()
+	return &benchPlayer{client: client, roomID: roomID}
+}
+
+// setupBenchRooms 创建 n 个满员的房间，started 为 true 时所有玩家准备并开始游戏
+func setupBenchRooms(b *testing.B, h *Hub, n int, started bool) []*benchPlayer {
+	b.Helper()
+
+	players := make([]*benchPlayer, 0, n*roomCapacity)
+	for i := 0; i < n; i++ {
+		roomID := fmt.Sprintf("room-%d", i)
+		for j := 0; j < roomCapacity; j++ {
+			p := newBenchPlayer(h, fmt.Sprintf("player-%d-%d", i, j), roomID)
+			h.JoinRoom(p.client, roomID)
+			players = append(players, p)
+		}
+	}
+	if started {
+		for _, p := range players {
+			h.HandleGameAction(p.client, &protocol.GameAction{Action: protocol.ActionReady})
+		}
+		if active := h.ActiveGames(); active != n {
+			b.Fatalf("expected %d active games, got %d", n, active)
+		}
+	}
+	return players
+}
+
+// teardownBenchRooms 注销所有客户端，房间随之关闭
+func teardownBenchRooms(h *Hub, players []*benchPlayer) {
+	for _, p := range players {
+		h.Unregister <- p.client
+	}
+}
+
+// runBenchPlayers 并发地让玩家依次执行 op，相邻的操作落在不同的房间
+func runBenchPlayers(b *testing.B, players []*benchPlayer, op func(p *benchPlayer)) {
+	rooms := len(players) / roomCapacity
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := int(next.Add(1))
+			p := players[(i%rooms)*roomCapacity+(i/rooms)%roomCapacity]
+			p.mu.Lock()
+			op(p)
+			p.mu.Unlock()
+		}
+	})
+	b.StopTimer()
+}
+
+// BenchmarkRoomResync 进行中的游戏里玩家请求完整同步（编码并发送房间状态和带手牌的游戏状态）
+func BenchmarkRoomResync(b *testing.B) {
+	for _, n := range []int{1, 10, 100, 500} {
+		b.Run(fmt.Sprintf("rooms=%d", n), func(b *testing.B) {
+			h := newBenchHub()
+			players := setupBenchRooms(b, h, n, true)
+			runBenchPlayers(b, players, func(p *benchPlayer) {
+				h.Resync(p.client)
+			})
+			teardownBenchRooms(h, players)
+		})
+	}
+}
+
+// BenchmarkRoomJoinLeave 等待中的房间里玩家离开并重新加入（每次操作向房间广播多条消息）
+func BenchmarkRoomJoinLeave(b *testing.B) {
+	for _, n := range []int{1, 10, 100, 500} {
+		b.Run(fmt.Sprintf("rooms=%d", n), func(b *testing.B) {
+			h := newBenchHub()
+			players := setupBenchRooms(b, h, n, false)
+			runBenchPlayers(b, players, func(p *benchPlayer) {
+				h.LeaveRoom(p.client)
+				h.JoinRoom(p.client, p.roomID)
+			})
+			teardownBenchRooms(h, players)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package websocket
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/chenhailong/hong3/config"
+	"github.com/chenhailong/hong3/models"
+)
+
+// testMessage 客户端收到的消息，raw 为完整的 JSON
+type testMessage struct {
+	Type string `json:"type"`
+	Seq  uint64 `json:"seq"`
+	raw  []byte
+}
+
+// decode 把消息解码到 v
+func (m testMessage) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(m.raw, v); err != nil {
+		t.Fatalf("decode %s: %v", m.Type, err)
+	}
+}
+
+// testPlayer 没有 WebSocket 连接的客户端，测试直接读取它的发送队列
+type testPlayer struct {
+	t      *testing.T
+	client *Client
+}
+
+// newTestHub 创建并启动不输出日志的 Hub
+func newTestHub(t *testing.T) *Hub {
+	t.Helper()
+	h := NewHub(config.Default(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	go h.Run()
+	return h
+}
+
+// newTestPlayer 注册已验证身份的客户端
+func newTestPlayer(t *testing.T, h *Hub, id, role string) *testPlayer {
+	t.Helper()
+	return registerTestPlayer(t, h, NewClient(h, nil, id, id, role, true, h.logger))
+}
+
+// newGuestPlayer 注册未携带 token 连接的客户端
+func newGuestPlayer(t *testing.T, h *Hub, id string) *testPlayer {
+	t.Helper()
+	return registerTestPlayer(t, h, NewClient(h, nil, id, id, models.RolePlayer, false, h.logger))
+}
+
+// registerTestPlayer 注册客户端
+func registerTestPlayer(t *testing.T, h *Hub, client *Client) *testPlayer {
+	t.Helper()
+	h.Register <- client
+	return &testPlayer{t: t, client: client}
+}
+
+// testRoom 按ID查找房间
+func testRoom(h *Hub, roomID string) *room {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.rooms[roomID]
+}
+
+// messages 取出并解码所有排队的消息
+func (p *testPlayer) messages() []testMessage {
+	p.t.Helper()
+	items, _ := p.client.send.take()
+	messages := make([]testMessage, 0, len(items))
+	for _, item := range items {
+		m := testMessage{raw: item.data}
+		if err := json.Unmarshal(item.data, &m); err != nil {
+			p.t.Fatalf("decode message: %v", err)
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+// last 取出所有排队的消息，返回其中最后一条该类型的消息
+func (p *testPlayer) last(typ string) (testMessage, bool) {
+	p.t.Helper()
+	var found testMessage
+	ok := false
+	for _, m := range p.messages() {
+		if m.Type == typ {
+			found, ok = m, true
+		}
+	}
+	return found, ok
+}
+
+// TestJoinSnapshotIncludesPlayerJoined 新玩家收到的房间状态已包含自己加入的通知，之后的房间事件序号连续
+func TestJoinSnapshotIncludesPlayerJoined(t *testing.T) {
+	h := newTestHub(t)
+	alice := newTestPlayer(t, h, "alice", models.RolePlayer)
+	bob := newTestPlayer(t, h, "bob", models.RolePlayer)
+
+	h.JoinRoom(alice.client, "seq-room")
+	alice.messages()
+	h.JoinRoom(bob.client, "seq-room")
+
+	state, ok := bob.last("room_state")
+	if !ok {
+		t.Fatal("bob got no room_state")
+	}
+	joined, ok := alice.last("player_joined")
+	if !ok {
+		t.Fatal("alice got no player_joined")
+	}
+	if state.Seq != joined.Seq {
+		t.Fatalf("bob's room_state seq %d, want %d (player_joined)", state.Seq, joined.Seq)
+	}
+
+	// 下一条房间事件紧接在快照之后
+	h.LeaveRoom(alice.client)
+	left, ok := bob.last("player_left")
+	if !ok {
+		t.Fatal("bob got no player_left")
+	}
+	if left.Seq != state.Seq+1 {
+		t.Fatalf("player_left seq %d, want %d", left.Seq, state.Seq+1)
+	}
+}
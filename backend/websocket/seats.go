@@ -0,0 +1,164 @@
+package websocket
+
+import (
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/protocol"
+)
+
+// swapRequest 等待对方回复的换座位请求
+type swapRequest struct {
+	target string // 被请求的玩家ID
+
+	// 请求时双方的座位，任何一方换过座位后请求失效
+	from int
+	to   int
+}
+
+// TakeSeat 客户端换到空座位
+func (h *Hub) TakeSeat(client *Client, position int) {
+	h.inRoom(client, func(r *room) {
+		r.takeSeat(client, position)
+	})
+}
+
+// RequestSwap 客户端请求与房间内的另一名玩家交换座位
+func (h *Hub) RequestSwap(client *Client, playerID string) {
+	h.inRoom(client, func(r *room) {
+		r.requestSwap(client, playerID)
+	})
+}
+
+// AcceptSwap 客户端同意另一名玩家的换座位请求
+func (h *Hub) AcceptSwap(client *Client, playerID string) {
+	h.inRoom(client, func(r *room) {
+		r.acceptSwap(client, playerID)
+	})
+}
+
+// DeclineSwap 客户端拒绝另一名玩家的换座位请求
+func (h *Hub) DeclineSwap(client *Client, playerID string) {
+	h.inRoom(client, func(r *room) {
+		r.declineSwap(client, playerID)
+	})
+}
+
+// canChangeSeats 检查房间当前是否可以换座位，不能时回复错误
+func (r *room) canChangeSeats(client *Client) bool {
+	if r.table != nil {
+		client.sendError("比赛桌的座位不能更换")
+		return false
+	}
+	if r.game.Status != game.GameStatusWaiting {
+		client.sendError("游戏已开始，不能换座位")
+		return false
+	}
+	return true
+}
+
+// takeSeat 换到空座位
+func (r *room) takeSeat(client *Client, position int) {
+	if !r.canChangeSeats(client) {
+		return
+	}
+
+	from := r.game.SeatOf(client.playerID)
+	if err := r.game.MovePlayer(client.playerID, position); err != nil {
+		client.sendError(err.Error())
+		return
+	}
+	if from == position {
+		return
+	}
+
+	r.clientLog(client).Info("玩家换座位", "from", from, "to", position)
+	r.seatsChanged(&protocol.SeatChanged{PlayerID: client.playerID, From: from, To: position})
+}
+
+// requestSwap 记录换座位请求并通知对方，同一玩家的新请求替代之前的请求
+func (r *room) requestSwap(client *Client, playerID string) {
+	if !r.canChangeSeats(client) {
+		return
+	}
+	if playerID == client.playerID {
+		client.sendError("不能与自己交换座位")
+		return
+	}
+
+	from := r.game.SeatOf(client.playerID)
+	if from < 0 {
+		client.sendError(game.ErrPlayerNotInGame.Error())
+		return
+	}
+	to := r.game.SeatOf(playerID)
+	if to < 0 {
+		client.sendError("对方不在游戏中")
+		return
+	}
+
+	r.swaps[client.playerID] = swapRequest{target: playerID, from: from, to: to}
+	r.clientLog(client).Debug("请求交换座位", "target", playerID)
+	r.sendToPlayer(playerID, &protocol.SwapRequested{PlayerID: client.playerID, Position: from})
+}
+
+// acceptSwap 同意换座位请求，双方仍在请求时的座位上才交换
+func (r *room) acceptSwap(client *Client, requester string) {
+	if !r.canChangeSeats(client) {
+		return
+	}
+
+	req, ok := r.swaps[requester]
+	if !ok || req.target != client.playerID {
+		client.sendError("没有该玩家的换座位请求")
+		return
+	}
+	delete(r.swaps, requester)
+
+	if r.game.SeatOf(requester) != req.from || r.game.SeatOf(client.playerID) != req.to {
+		client.sendError("换座位请求已失效")
+		return
+	}
+	if err := r.game.SwapPlayers(requester, client.playerID); err != nil {
+		client.sendError(err.Error())
+		return
+	}
+
+	r.clientLog(client).Info("玩家交换座位", "with", requester, "from", req.to, "to", req.from)
+	r.seatsChanged(&protocol.SeatChanged{PlayerID: requester, From: req.from, To: req.to, SwappedWith: client.playerID})
+}
+
+// declineSwap 拒绝换座位请求并通知请求的玩家
+func (r *room) declineSwap(client *Client, requester string) {
+	req, ok := r.swaps[requester]
+	if !ok || req.target != client.playerID {
+		client.sendError("没有该玩家的换座位请求")
+		return
+	}
+	delete(r.swaps, requester)
+	r.sendToPlayer(requester, &protocol.SwapDeclined{PlayerID: client.playerID})
+}
+
+// dropSwaps 删除玩家发出的和收到的换座位请求（玩家离开房间时）
+func (r *room) dropSwaps(playerID string) {
+	for requester, req := range r.swaps {
+		if requester == playerID || req.target == playerID {
+			delete(r.swaps, requester)
+		}
+	}
+}
+
+// seatsChanged 广播座位变化并更新所有玩家的房间状态
+func (r *room) seatsChanged(change *protocol.SeatChanged) {
+	r.broadcast(change)
+	for c := range r.clients {
+		r.sendRoomState(c)
+	}
+}
+
+// sendToPlayer 向房间内该玩家的所有客户端发送消息
+func (r *room) sendToPlayer(playerID string, message protocol.Message) {
+	for c := range r.clients {
+		if c.playerID == playerID {
+			c.sendMessage(message)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/models"
+)
+
+// seatOf 玩家在房间中的座位，不在游戏中时为 -1
+func seatOf(h *Hub, roomID, playerID string) int {
+	r := testRoom(h, roomID)
+	seat := -1
+	r.do(func() {
+		seat = r.game.SeatOf(playerID)
+	})
+	return seat
+}
+
+// expectError 玩家最后收到的错误应为 want
+func (p *testPlayer) expectError(want string) {
+	p.t.Helper()
+	m, ok := p.last("error")
+	if !ok {
+		p.t.Fatalf("%s got no error, want %q", p.client.playerID, want)
+	}
+	var e struct {
+		Error string `json:"error"`
+	}
+	m.decode(p.t, &e)
+	if e.Error != want {
+		p.t.Fatalf("%s got error %q, want %q", p.client.playerID, e.Error, want)
+	}
+}
+
+// joinSeated 玩家按顺序加入房间，依次坐在 0、1、2… 号座位
+func joinSeated(t *testing.T, h *Hub, roomID string, ids ...string) []*testPlayer {
+	t.Helper()
+	players := make([]*testPlayer, 0, len(ids))
+	for i, id := range ids {
+		p := newTestPlayer(t, h, id, models.RolePlayer)
+		h.JoinRoom(p.client, roomID)
+		if seat := seatOf(h, roomID, id); seat != i {
+			t.Fatalf("%s joined in seat %d, want %d", id, seat, i)
+		}
+		players = append(players, p)
+	}
+	for _, p := range players {
+		p.messages()
+	}
+	return players
+}
+
+func TestTakeSeat(t *testing.T) {
+	h := newTestHub(t)
+	players := joinSeated(t, h, "seat-room", "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	h.TakeSeat(alice.client, 1)
+	alice.expectError(game.ErrSeatTaken.Error())
+
+	for _, seat := range []int{-1, roomCapacity} {
+		h.TakeSeat(alice.client, seat)
+		alice.expectError(game.ErrInvalidSeat.Error())
+	}
+	if seat := seatOf(h, "seat-room", "alice"); seat != 0 {
+		t.Fatalf("alice moved to seat %d after rejected requests", seat)
+	}
+	if _, ok := bob.last("seat_changed"); ok {
+		t.Fatal("bob was told about a rejected seat change")
+	}
+
+	h.TakeSeat(alice.client, 3)
+	if seat := seatOf(h, "seat-room", "alice"); seat != 3 {
+		t.Fatalf("alice in seat %d, want 3", seat)
+	}
+	if _, ok := bob.last("seat_changed"); !ok {
+		t.Fatal("bob got no seat_changed")
+	}
+}
+
+func TestSwapSeats(t *testing.T) {
+	h := newTestHub(t)
+	players := joinSeated(t, h, "swap-room", "alice", "bob")
+	alice, bob := players[0], players[1]
+
+	h.RequestSwap(alice.client, "bob")
+	if _, ok := bob.last("swap_requested"); !ok {
+		t.Fatal("bob got no swap_requested")
+	}
+	h.AcceptSwap(bob.client, "alice")
+	if a, b := seatOf(h, "swap-room", "alice"), seatOf(h, "swap-room", "bob"); a != 1 || b != 0 {
+		t.Fatalf("alice in seat %d and bob in seat %d after swap, want 1 and 0", a, b)
+	}
+
+	// 请求只能使用一次
+	h.AcceptSwap(bob.client, "alice")
+	bob.expectError("没有该玩家的换座位请求")
+}
+
+// TestSwapExpiresAfterMove 请求后任何一方换过座位，同意时请求已失效
+func TestSwapExpiresAfterMove(t *testing.T) {
+	tests := []struct {
+		name  string
+		mover string
+	}{
+		{name: "requester moved", mover: "alice"},
+		{name: "target moved", mover: "bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHub(t)
+			players := joinSeated(t, h, "swap-room", "alice", "bob")
+			alice, bob := players[0], players[1]
+			mover := alice
+			if tt.mover == "bob" {
+				mover = bob
+			}
+
+			h.RequestSwap(alice.client, "bob")
+			h.TakeSeat(mover.client, 3)
+			h.AcceptSwap(bob.client, "alice")
+			bob.expectError("换座位请求已失效")
+
+			a, b := seatOf(h, "swap-room", "alice"), seatOf(h, "swap-room", "bob")
+			if (tt.mover == "alice" && (a != 3 || b != 1)) || (tt.mover == "bob" && (a != 0 || b != 3)) {
+				t.Fatalf("alice in seat %d and bob in seat %d: the expired swap was applied", a, b)
+			}
+		})
+	}
+}
+
+// TestSwapDroppedOnLeave 玩家离开房间时删除他发出的和收到的换座位请求
+func TestSwapDroppedOnLeave(t *testing.T) {
+	tests := []struct {
+		name   string
+		leaver string
+	}{
+		{name: "requester left", leaver: "alice"},
+		{name: "target left", leaver: "bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHub(t)
+			players := joinSeated(t, h, "swap-room", "alice", "bob")
+			alice, bob := players[0], players[1]
+			leaver := alice
+			if tt.leaver == "bob" {
+				leaver = bob
+			}
+
+			h.RequestSwap(alice.client, "bob")
+			h.LeaveRoom(leaver.client)
+			h.JoinRoom(leaver.client, "swap-room")
+			h.AcceptSwap(bob.client, "alice")
+			bob.expectError("没有该玩家的换座位请求")
+		})
+	}
+}
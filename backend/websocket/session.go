@@ -0,0 +1,422 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chenhailong/hong3/config"
+	"github.com/chenhailong/hong3/metrics"
+	"github.com/chenhailong/hong3/protocol"
+)
+
+var (
+	// ErrSessionEnded 会话已结束（空闲超时、被踢出或服务器停机），需要重新加入房间
+	ErrSessionEnded = errors.New("会话已结束")
+
+	// ErrReplyTimeout 在 rest.reply_timeout 内没有收到房间的回复
+	ErrReplyTimeout = errors.New("等待服务器处理超时")
+)
+
+// CommandError 房间拒绝了命令，Message 与 WebSocket 客户端收到的 error 消息相同
+type CommandError struct {
+	Message string
+	Field   string
+}
+
+func (e *CommandError) Error() string {
+	return e.Message
+}
+
+// Event 发给会话的一条消息
+type Event struct {
+	ID   uint64          `json:"id"` // 会话内递增的事件ID
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"` // 与 WebSocket 客户端收到的消息相同
+}
+
+// EventBatch 一次取走的事件
+type EventBatch struct {
+	Events []Event `json:"events"`
+	Next   uint64  `json:"next"`             // 下次请求使用的 after
+	Missed bool    `json:"missed,omitempty"` // after 之后的部分事件已被淘汰，应重新获取状态
+}
+
+// Session 通过 REST 接口玩游戏的用户在 Hub 中的会话
+//
+// 会话是一个没有 WebSocket 连接的客户端：命令与 WebSocket 消息经过同样的校验和处理
+// （包括多实例模式下的转发），服务器发给它的消息按顺序编号后保存在事件日志中，
+// 由长轮询或 Server-Sent Events 取走。每个用户最多有一个会话，超过
+// rest.session_idle_timeout 没有请求时结束，效果与 WebSocket 断开连接相同。
+type Session struct {
+	client *Client
+	config config.RESTConfig
+
+	// 命令逐个执行，以便把回复对应到命令
+	command sync.Mutex
+
+	mu       sync.Mutex
+	events   []Event       // 最近的事件，ID 连续
+	lastID   uint64        // 最后一个事件的ID
+	changed  chan struct{} // 有新事件或会话结束时关闭并替换
+	lastSeen time.Time
+	waiters  int // 正在等待事件的请求数，期间不会因空闲而结束
+	ended    bool
+}
+
+// Session 获取用户的会话，不存在时创建并注册到 Hub
+func (h *Hub) Session(playerID, playerName, role string, logger *slog.Logger) *Session {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if s, ok := h.sessions[playerID]; ok {
+		s.touch()
+		return s
+	}
+
+	client := NewClient(h, nil, playerID, playerName, role, true, logger)
+	s := &Session{
+		client:   client,
+		config:   h.restConfig,
+		changed:  make(chan struct{}),
+		lastSeen: time.Now(),
+	}
+	h.sessions[playerID] = s
+	h.clients[client] = true
+	h.clusterRegister(client)
+	go s.pump()
+
+	client.logger.Info("REST 会话开始", "role", role)
+	return s
+}
+
+// pump 把发送队列中的消息移入事件日志，并在会话空闲时注销客户端
+func (s *Session) pump() {
+	c := s.client
+	quit := c.quit
+	ticker := time.NewTicker(s.config.SessionIdleTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.send.ready:
+			if s.drain() {
+				// 已注销，或客户端跟不上消息时队列被丢弃
+				c.hub.unregister(c)
+				s.end()
+				return
+			}
+
+		case <-quit:
+			// 被踢出或服务器停机：注销后发送队列关闭，由上面的分支结束会话
+			quit = nil
+			c.hub.unregister(c)
+
+		case <-ticker.C:
+			if s.idle() {
+				c.logger.Info("REST 会话空闲，结束会话")
+				c.hub.unregister(c)
+			}
+		}
+	}
+}
+
+// drain 把发送队列中的消息移入事件日志，返回队列是否已关闭
+func (s *Session) drain() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages, closed := s.client.send.take()
+	if len(messages) == 0 {
+		return closed
+	}
+	for _, message := range messages {
+		s.lastID++
+		s.events = append(s.events, Event{ID: s.lastID, Type: message.typ, Data: message.data})
+		countOutbound(message.typ)
+		metrics.SendLag.Observe(time.Since(message.at).Seconds())
+	}
+	if over := len(s.events) - s.config.EventLogSize; over > 0 {
+		s.events = append([]Event(nil), s.events[over:]...)
+	}
+	s.notify()
+	return closed
+}
+
+// end 结束会话，之后的请求会创建新的会话
+func (s *Session) end() {
+	h := s.client.hub
+	h.mutex.Lock()
+	if h.sessions[s.client.playerID] == s {
+		delete(h.sessions, s.client.playerID)
+	}
+	h.mutex.Unlock()
+
+	s.mu.Lock()
+	s.ended = true
+	s.notify()
+	s.mu.Unlock()
+	s.client.logger.Info("REST 会话结束")
+}
+
+// notify 唤醒等待事件的请求（需在持有锁的情况下调用）
+func (s *Session) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// touch 记录会话最近一次请求的时间
+func (s *Session) touch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastSeen = time.Now()
+}
+
+// idle 会话是否已空闲超时
+func (s *Session) idle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.waiters == 0 && time.Since(s.lastSeen) > s.config.SessionIdleTimeout
+}
+
+// since ID 大于 after 的事件（需在持有锁的情况下调用）
+//
+// after 之后的事件已被淘汰，或 after 来自之前的会话时，返回保留的所有事件和 true。
+func (s *Session) since(after uint64) ([]Event, bool) {
+	first := s.lastID - uint64(len(s.events)) + 1
+	if after > s.lastID || after+1 < first {
+		return append([]Event(nil), s.events...), true
+	}
+	if after == s.lastID {
+		return nil, false
+	}
+	return append([]Event(nil), s.events[after+1-first:]...), false
+}
+
+// Events 取走 ID 大于 after 的事件，没有新事件时等待，直到有新事件或 ctx 结束
+//
+// ctx 结束时返回空的事件列表；会话已结束且没有剩余事件时返回 ErrSessionEnded。
+func (s *Session) Events(ctx context.Context, after uint64) (*EventBatch, error) {
+	s.mu.Lock()
+	s.waiters++
+	defer func() {
+		s.waiters--
+		s.lastSeen = time.Now()
+		s.mu.Unlock()
+	}()
+
+	for {
+		events, missed := s.since(after)
+		if len(events) > 0 || missed {
+			return &EventBatch{Events: events, Next: s.lastID, Missed: missed}, nil
+		}
+		if s.ended {
+			return nil, ErrSessionEnded
+		}
+
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			s.mu.Lock()
+			return &EventBatch{Events: []Event{}, Next: s.lastID}, nil
+		}
+		s.mu.Lock()
+	}
+}
+
+// reply 回复消息中用于对应命令的字段
+type reply struct {
+	RoomID   string `json:"room_id"`
+	ActionID string `json:"action_id"`
+	Error    string `json:"error"`
+	Field    string `json:"field"`
+}
+
+// replyMatcher 判断事件是否为命令的回复，回复为 error 时返回 CommandError
+type replyMatcher func(e Event, r *reply) (bool, error)
+
+// exec 执行命令并等待回复，返回回复的事件
+//
+// 命令与 WebSocket 消息一样经过 protocol.Decode 校验，不符合协议时返回 *protocol.ValidationError。
+// 房间在本实例上时命令同步执行，执行完后回复已在发送队列中，这里直接移入事件日志，
+// 同一命令产生的多条消息（例如 room_state 和 game_state）会同时出现在日志中。
+func (s *Session) exec(ctx context.Context, msg protocol.Message, match replyMatcher) (Event, error) {
+	data, err := protocol.Marshal(msg)
+	if err != nil {
+		return Event{}, err
+	}
+	if _, err := protocol.Decode(data); err != nil {
+		return Event{}, err
+	}
+
+	s.command.Lock()
+	defer s.command.Unlock()
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return Event{}, ErrSessionEnded
+	}
+	after := s.lastID
+	s.lastSeen = time.Now()
+	s.mu.Unlock()
+
+	s.client.handleMessage(data)
+	s.drain()
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.ReplyTimeout)
+	defer cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		events, _ := s.since(after)
+		for _, e := range events {
+			var r reply
+			if err := json.Unmarshal(e.Data, &r); err != nil {
+				continue
+			}
+			if ok, err := match(e, &r); ok || err != nil {
+				return e, err
+			}
+		}
+		after = s.lastID
+		if s.ended {
+			return Event{}, ErrSessionEnded
+		}
+
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			s.mu.Lock()
+			return Event{}, ErrReplyTimeout
+		}
+		s.mu.Lock()
+	}
+}
+
+// matchError 把 error 消息转换为 CommandError
+func matchError(e Event, r *reply) (bool, error) {
+	if e.Type == protocol.TypeError {
+		return true, &CommandError{Message: r.Error, Field: r.Field}
+	}
+	return false, nil
+}
+
+// CreateRoom 创建房间并加入，返回房间ID
+func (s *Session) CreateRoom(ctx context.Context) (string, error) {
+	e, err := s.exec(ctx, &protocol.CreateRoom{}, func(e Event, r *reply) (bool, error) {
+		if e.Type == protocol.TypeRoomCreated {
+			return true, nil
+		}
+		return matchError(e, r)
+	})
+	if err != nil {
+		return "", err
+	}
+	var created protocol.RoomCreated
+	if err := json.Unmarshal(e.Data, &created); err != nil {
+		return "", err
+	}
+	return created.RoomID, nil
+}
+
+// JoinRoom 加入房间（房间不存在时创建），返回房间状态（room_state 消息）
+func (s *Session) JoinRoom(ctx context.Context, roomID string) (json.RawMessage, error) {
+	e, err := s.exec(ctx, &protocol.JoinRoom{RoomID: roomID}, func(e Event, r *reply) (bool, error) {
+		if e.Type == protocol.TypeRoomState && r.RoomID == roomID {
+			return true, nil
+		}
+		return matchError(e, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.Data, nil
+}
+
+// LeaveRoom 离开当前房间，服务器不回复
+func (s *Session) LeaveRoom() error {
+	s.command.Lock()
+	defer s.command.Unlock()
+
+	s.mu.Lock()
+	ended := s.ended
+	s.lastSeen = time.Now()
+	s.mu.Unlock()
+	if ended {
+		return ErrSessionEnded
+	}
+
+	data, err := protocol.Marshal(&protocol.LeaveRoom{})
+	if err != nil {
+		return err
+	}
+	s.client.handleMessage(data)
+	return nil
+}
+
+// Act 执行游戏动作，返回 action_ack 消息
+//
+// 没有 action_id 时自动生成；调用方重试时应使用同一个 action_id，重复的动作不会再次执行。
+func (s *Session) Act(ctx context.Context, action *protocol.GameAction) (*protocol.ActionAck, error) {
+	if action.ActionID == "" {
+		action.ActionID = newClientID()
+	}
+	e, err := s.exec(ctx, action, func(e Event, r *reply) (bool, error) {
+		switch e.Type {
+		case protocol.TypeActionAck:
+			return r.ActionID == action.ActionID, nil
+		case protocol.TypeError:
+			// 未加入房间时的错误不带 action_id
+			if r.ActionID == action.ActionID || r.ActionID == "" {
+				return matchError(e, r)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var ack protocol.ActionAck
+	if err := json.Unmarshal(e.Data, &ack); err != nil {
+		return nil, err
+	}
+	return &ack, nil
+}
+
+// State 重新获取房间状态和自己的游戏状态（room_state 和 game_state 消息）
+//
+// 游戏未开始时 game 为 nil。多实例模式下房间在其他实例上时，game_state 可能晚于
+// room_state 到达而没有包含在返回值中，此时可以从事件中获取。
+func (s *Session) State(ctx context.Context) (room, game json.RawMessage, err error) {
+	e, err := s.exec(ctx, &protocol.Resync{}, func(e Event, r *reply) (bool, error) {
+		if e.Type == protocol.TypeRoomState {
+			return true, nil
+		}
+		return matchError(e, r)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events, _ := s.since(e.ID)
+	for _, next := range events {
+		if next.Type == protocol.TypeGameState {
+			game = next.Data
+			break
+		}
+	}
+	return e.Data, game, nil
+}
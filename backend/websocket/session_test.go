@@ -0,0 +1,325 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/chenhailong/hong3/config"
+	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/protocol"
+)
+
+// newSessionHub 使用指定 REST 配置的 Hub
+func newSessionHub(t *testing.T, rest config.RESTConfig) *Hub {
+	t.Helper()
+	cfg := config.Default()
+	cfg.REST = rest
+	h := NewHub(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	go h.Run()
+	return h
+}
+
+// testRESTConfig 测试用的 REST 配置，空闲超时足够长，不会在测试中结束会话
+func testRESTConfig() config.RESTConfig {
+	return config.RESTConfig{
+		SessionIdleTimeout: time.Minute,
+		EventLogSize:       256,
+		MaxPollWait:        time.Second,
+		ReplyTimeout:       time.Second,
+	}
+}
+
+// expectCommandError 检查会话命令被房间拒绝
+func expectCommandError(t *testing.T, err error) *CommandError {
+	t.Helper()
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) {
+		t.Fatalf("error %v, want *CommandError", err)
+	}
+	return commandErr
+}
+
+// lastEventID 会话最后一个事件的ID（先把发送队列中的消息移入事件日志）
+func lastEventID(s *Session) uint64 {
+	s.drain()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastID
+}
+
+// TestSessionReplyMatching 命令的回复按类型和 action_id 对应：成功时返回 action_ack，被拒绝时返回 CommandError
+func TestSessionReplyMatching(t *testing.T) {
+	h := newSessionHub(t, testRESTConfig())
+	s := h.Session("alice", "Alice", models.RolePlayer, h.logger)
+	ctx := context.Background()
+
+	// 未加入房间时的错误不带 action_id
+	_, err := s.Act(ctx, &protocol.GameAction{Action: protocol.ActionPass})
+	if commandErr := expectCommandError(t, err); commandErr.Message != "未加入房间" {
+		t.Errorf("error %q, want 未加入房间", commandErr.Message)
+	}
+
+	roomID, err := s.CreateRoom(ctx)
+	if err != nil || roomID == "" {
+		t.Fatalf("create room: %q, %v", roomID, err)
+	}
+
+	// 其他玩家的动作不会被当作回复
+	bob := newTestPlayer(t, h, "bob", models.RolePlayer)
+	h.JoinRoom(bob.client, roomID)
+	h.HandleGameAction(bob.client, &protocol.GameAction{ActionID: "ready-1", Action: protocol.ActionReady})
+
+	ack, err := s.Act(ctx, &protocol.GameAction{ActionID: "ready-1", Action: protocol.ActionReady})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.ActionID != "ready-1" || ack.Action != protocol.ActionReady || ack.Duplicate {
+		t.Errorf("ack %+v, want a first ready-1", ack)
+	}
+
+	// 游戏还没开始，过牌被拒绝
+	_, err = s.Act(ctx, &protocol.GameAction{ActionID: "pass-1", Action: protocol.ActionPass})
+	if commandErr := expectCommandError(t, err); commandErr.Message == "" {
+		t.Error("rejected pass has no message")
+	}
+
+	// 自动生成 action_id
+	ack, err = s.Act(ctx, &protocol.GameAction{Action: protocol.ActionReady})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.ActionID == "" {
+		t.Error("ack without a generated action_id")
+	}
+
+	// 不符合协议的命令不发给房间
+	var validationErr *protocol.ValidationError
+	if _, err := s.Act(ctx, &protocol.GameAction{Action: "dance"}); !errors.As(err, &validationErr) {
+		t.Errorf("invalid action: %v, want *protocol.ValidationError", err)
+	}
+}
+
+// TestSessionActRetry 使用同一个 action_id 重试时动作不会再次执行，回复第一次的结果
+func TestSessionActRetry(t *testing.T) {
+	h := newSessionHub(t, testRESTConfig())
+	s := h.Session("alice", "Alice", models.RolePlayer, h.logger)
+	ctx := context.Background()
+	if _, err := s.CreateRoom(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, wantDuplicate := range []bool{false, true} {
+		ack, err := s.Act(ctx, &protocol.GameAction{ActionID: "ready-1", Action: protocol.ActionReady})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ack.Duplicate != wantDuplicate || ack.Action != protocol.ActionReady {
+			t.Errorf("attempt %d: ack %+v, want duplicate=%v", i+1, ack, wantDuplicate)
+		}
+	}
+
+	// 被拒绝的动作重试时返回同样的错误
+	_, err := s.Act(ctx, &protocol.GameAction{ActionID: "pass-1", Action: protocol.ActionPass})
+	first := expectCommandError(t, err)
+	_, err = s.Act(ctx, &protocol.GameAction{ActionID: "pass-1", Action: protocol.ActionPass})
+	if retried := expectCommandError(t, err); retried.Message != first.Message {
+		t.Errorf("retried error %q, want %q", retried.Message, first.Message)
+	}
+}
+
+// TestSessionEventsMissed after 之后的事件已被淘汰，或 after 来自之前的会话时返回 Missed
+func TestSessionEventsMissed(t *testing.T) {
+	rest := testRESTConfig()
+	rest.EventLogSize = 4
+	h := newSessionHub(t, rest)
+	s := h.Session("alice", "Alice", models.RolePlayer, h.logger)
+	roomID, err := s.CreateRoom(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob := newTestPlayer(t, h, "bob", models.RolePlayer)
+	for i := 0; i < 3; i++ {
+		h.JoinRoom(bob.client, roomID)
+		h.LeaveRoom(bob.client)
+	}
+	last := lastEventID(s)
+	if last <= uint64(rest.EventLogSize) {
+		t.Fatalf("only %d events, want more than the log size", last)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	batch, err := s.Events(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !batch.Missed || len(batch.Events) != rest.EventLogSize || batch.Next != last {
+		t.Fatalf("batch after evicted event: missed=%v, %d events, next %d; want missed, %d events, next %d",
+			batch.Missed, len(batch.Events), batch.Next, rest.EventLogSize, last)
+	}
+	for i, e := range batch.Events {
+		if want := last - uint64(rest.EventLogSize) + 1 + uint64(i); e.ID != want {
+			t.Errorf("event %d has ID %d, want %d", i, e.ID, want)
+		}
+	}
+
+	// 仍在日志中的事件正常返回
+	batch, err = s.Events(ctx, last-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Missed || len(batch.Events) != 1 || batch.Events[0].ID != last {
+		t.Errorf("batch after %d: %+v, want only event %d", last-1, batch, last)
+	}
+
+	// 之前的会话的事件ID大于当前会话的所有事件
+	batch, err = s.Events(ctx, last+10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !batch.Missed {
+		t.Error("batch after a future event is not missed")
+	}
+}
+
+// TestSessionEventsWait 长轮询在有新事件时立即返回，超时返回空的事件列表
+func TestSessionEventsWait(t *testing.T) {
+	h := newSessionHub(t, testRESTConfig())
+	s := h.Session("alice", "Alice", models.RolePlayer, h.logger)
+	roomID, err := s.CreateRoom(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := lastEventID(s)
+
+	type result struct {
+		batch *EventBatch
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		batch, err := s.Events(ctx, after)
+		done <- result{batch, err}
+	}()
+	eventually(t, "the poll to wait", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.waiters == 1
+	})
+
+	bob := newTestPlayer(t, h, "bob", models.RolePlayer)
+	h.JoinRoom(bob.client, roomID)
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if len(res.batch.Events) == 0 || res.batch.Events[0].Type != protocol.TypePlayerJoined {
+			t.Fatalf("woken with %+v, want player_joined", res.batch.Events)
+		}
+		after = res.batch.Next
+	case <-time.After(2 * time.Second):
+		t.Fatal("poll was not woken by the new event")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	batch, err := s.Events(ctx, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Events) != 0 || batch.Missed || batch.Next != after {
+		t.Errorf("timed out poll returned %+v, want no events and next %d", batch, after)
+	}
+}
+
+// endedSession 等待会话结束，取走剩余的事件，返回之后取事件时的错误
+//
+// 取事件本身会让会话保持活跃，所以先等待会话结束。
+func endedSession(t *testing.T, s *Session) error {
+	t.Helper()
+	eventually(t, "the session to end", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.ended
+	})
+
+	var after uint64
+	for {
+		batch, err := s.Events(context.Background(), after)
+		if err != nil {
+			return err
+		}
+		after = batch.Next
+	}
+}
+
+// TestSessionIdleTimeout 超过空闲时间没有请求时会话结束，等待事件的请求期间不会结束
+func TestSessionIdleTimeout(t *testing.T) {
+	rest := testRESTConfig()
+	rest.SessionIdleTimeout = 40 * time.Millisecond
+	h := newSessionHub(t, rest)
+	s := h.Session("alice", "Alice", models.RolePlayer, h.logger)
+	if _, err := s.CreateRoom(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 长轮询持续的时间超过空闲时间
+	ctx, cancel := context.WithTimeout(context.Background(), 3*rest.SessionIdleTimeout)
+	defer cancel()
+	if _, err := s.Events(ctx, lastEventID(s)); err != nil {
+		t.Fatal(err)
+	}
+	if s.idle() {
+		t.Fatal("session is idle right after a poll")
+	}
+
+	if err := endedSession(t, s); err != ErrSessionEnded {
+		t.Fatalf("events after idle timeout: %v, want ErrSessionEnded", err)
+	}
+	if _, err := s.CreateRoom(context.Background()); err != ErrSessionEnded {
+		t.Errorf("command after idle timeout: %v, want ErrSessionEnded", err)
+	}
+	if err := s.LeaveRoom(); err != ErrSessionEnded {
+		t.Errorf("leave after idle timeout: %v, want ErrSessionEnded", err)
+	}
+
+	// 客户端已注销，下一个请求创建新的会话
+	h.mutex.Lock()
+	registered := h.clients[s.client]
+	h.mutex.Unlock()
+	if registered {
+		t.Error("client still registered after the session ended")
+	}
+	if next := h.Session("alice", "Alice", models.RolePlayer, h.logger); next == s {
+		t.Error("ended session was reused")
+	}
+}
+
+// TestSessionKicked 被踢出后会话结束
+func TestSessionKicked(t *testing.T) {
+	h := newSessionHub(t, testRESTConfig())
+	s := h.Session("alice", "Alice", models.RolePlayer, h.logger)
+	if _, err := s.CreateRoom(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !h.KickPlayer("alice", "测试") {
+		t.Fatal("session player not found")
+	}
+	if err := endedSession(t, s); err != ErrSessionEnded {
+		t.Fatalf("events after kick: %v, want ErrSessionEnded", err)
+	}
+	if _, err := s.Act(context.Background(), &protocol.GameAction{Action: protocol.ActionReady}); err != ErrSessionEnded {
+		t.Errorf("action after kick: %v, want ErrSessionEnded", err)
+	}
+}
@@ -0,0 +1,257 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/logging"
+	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/protocol"
+	"github.com/chenhailong/hong3/redis"
+	gorilla "github.com/gorilla/websocket"
+)
+
+// errDraining 停机期间拒绝新房间和新游戏时的提示
+const errDraining = "服务器即将维护，暂不能创建房间或开始新游戏"
+
+// StartDrain 进入停机状态：不再接受新房间和新游戏，并通知所有在线客户端
+func (h *Hub) StartDrain(deadline time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.draining {
+		return
+	}
+	h.draining = true
+	h.drainDeadline = deadline
+
+	for client := range h.clients {
+		// 其他实例转发来的客户端由其所在的实例通知
+		if client.origin != "" {
+			continue
+		}
+		h.sendShutdownNotice(client)
+	}
+	h.logger.Info("hub draining", "clients", len(h.clients), "rooms", len(h.rooms), "deadline", deadline)
+}
+
+// sendShutdownNotice 通知客户端服务器即将维护（需在持有锁的情况下调用）
+func (h *Hub) sendShutdownNotice(client *Client) {
+	client.sendMessage(&protocol.ServerShutdown{
+		Message:  "服务器即将维护，进行中的游戏结束后将断开连接",
+		Deadline: h.drainDeadline.Unix(),
+	})
+}
+
+// ActiveGames 获取进行中的游戏数量
+func (h *Hub) ActiveGames() int {
+	count := 0
+	for _, r := range h.acquireRooms() {
+		r.do(func() {
+			if r.game.Status == game.GameStatusPlaying {
+				count++
+			}
+		})
+	}
+	return count
+}
+
+// SnapshotGames 获取所有进行中游戏的快照（包括房主、锁定状态等房间状态），可以用 RestoreGames 恢复
+func (h *Hub) SnapshotGames(reason string) []models.GameSnapshot {
+	snapshots := make([]models.GameSnapshot, 0)
+	for _, r := range h.acquireRooms() {
+		r.do(func() {
+			if r.game.Status != game.GameStatusPlaying {
+				return
+			}
+			state, err := r.snapshot()
+			if err != nil {
+				r.logger.Error("Error marshalling game snapshot", "error", err)
+				return
+			}
+			players := make([]models.GameSnapshotPlayer, 0, len(r.game.Players))
+			for _, p := range r.game.Players {
+				if p != nil {
+					players = append(players, models.GameSnapshotPlayer{PlayerID: p.ID})
+				}
+			}
+			snapshots = append(snapshots, models.GameSnapshot{
+				RoomID:  r.id,
+				Status:  r.game.GetStatus(),
+				State:   string(state),
+				Reason:  reason,
+				Players: players,
+			})
+		})
+	}
+	return snapshots
+}
+
+// SnapshotTournaments 获取所有比赛的状态（包括积分榜和本轮的比赛桌），可以用 RestoreTournaments 恢复
+func (h *Hub) SnapshotTournaments(reason string) []models.TournamentSnapshot {
+	h.mutex.Lock()
+	all := make([]*tournament, 0, len(h.tournaments))
+	for _, t := range h.tournaments {
+		all = append(all, t)
+	}
+	h.mutex.Unlock()
+
+	snapshots := make([]models.TournamentSnapshot, 0, len(all))
+	for _, t := range all {
+		state := t.state()
+		data, err := json.Marshal(state)
+		if err != nil {
+			h.logger.Error("Error marshalling tournament snapshot", logging.KeyTournamentID, t.id, "error", err)
+			continue
+		}
+		players := make([]models.TournamentSnapshotPlayer, 0, len(state.Entrants))
+		for _, e := range state.Entrants {
+			players = append(players, models.TournamentSnapshotPlayer{PlayerID: e.ID})
+		}
+		snapshots = append(snapshots, models.TournamentSnapshot{
+			TournamentID: state.ID,
+			Status:       state.Status,
+			State:        string(data),
+			Reason:       reason,
+			Players:      players,
+		})
+	}
+	return snapshots
+}
+
+// RestoreTournaments 重建停机时保存的比赛并登记本轮的比赛桌，需在 RestoreGames 之前调用，
+// 比赛桌上未打完的一局才能随之恢复
+//
+// 同一比赛有多个快照时只恢复最新的一个；无法解析的快照和本实例已有的比赛会被忽略。
+// 没有恢复游戏的比赛桌在玩家重新加入时创建。
+func (h *Hub) RestoreTournaments(snapshots []models.TournamentSnapshot) {
+	latest := make(map[string]models.TournamentSnapshot)
+	for _, s := range snapshots {
+		if prev, ok := latest[s.TournamentID]; ok && prev.CreatedAt.After(s.CreatedAt) {
+			continue
+		}
+		latest[s.TournamentID] = s
+	}
+
+	for id, s := range latest {
+		logger := h.logger.With(logging.KeyTournamentID, id, "snapshot", s.ID)
+		var state tournamentState
+		if err := json.Unmarshal([]byte(s.State), &state); err != nil {
+			logger.Error("invalid tournament snapshot", "error", err)
+			continue
+		}
+		t, err := restoreTournament(&state)
+		if err != nil {
+			logger.Error("invalid tournament snapshot", "error", err)
+			continue
+		}
+
+		h.mutex.Lock()
+		if _, ok := h.tournaments[t.id]; !ok {
+			h.tournaments[t.id] = t
+			for _, tbl := range t.tables {
+				h.tables[tbl.roomID] = tbl
+			}
+		}
+		h.mutex.Unlock()
+		logger.Info("tournament restored", "status", t.status, "round", t.round, "tables", len(t.tables))
+	}
+}
+
+// RestoreGames 重建停机时保存的未结束游戏，返回已处理、可以删除的快照ID
+//
+// 玩家重新加入房间后继续游戏。同一房间有多个快照时只恢复最新的一个；无法解析的快照、
+// 多实例模式下已由其他实例接管的房间以及比赛已不存在的比赛桌不会恢复，这些快照同样视为已处理。
+// 多实例模式下获取房间所有权失败时保留快照，下次启动时重试。
+func (h *Hub) RestoreGames(snapshots []models.GameSnapshot) []string {
+	latest := make(map[string]models.GameSnapshot)
+	done := make([]string, 0, len(snapshots))
+	for _, s := range snapshots {
+		if prev, ok := latest[s.RoomID]; ok {
+			if prev.CreatedAt.After(s.CreatedAt) {
+				done = append(done, s.ID)
+				continue
+			}
+			done = append(done, prev.ID)
+		}
+		latest[s.RoomID] = s
+	}
+
+	for roomID, s := range latest {
+		logger := h.logger.With(logging.KeyRoomID, roomID, "snapshot", s.ID)
+		snapshot, err := decodeRoomSnapshot([]byte(s.State))
+		if err != nil {
+			logger.Error("invalid game snapshot", "error", err)
+			done = append(done, s.ID)
+			continue
+		}
+
+		if h.cluster != nil {
+			owner, err := redis.ClaimRoom(roomID, h.cluster.id, h.cluster.leaseTTL)
+			if err != nil {
+				logger.Warn("failed to claim room for game snapshot", "error", err)
+				continue
+			}
+			if owner != h.cluster.id {
+				logger.Info("room taken over by another instance, snapshot discarded", "owner", owner)
+				done = append(done, s.ID)
+				continue
+			}
+		}
+
+		if !h.addRestoredRoom(roomID, snapshot) {
+			logger.Warn("tournament of game snapshot no longer exists", logging.KeyTournamentID, snapshot.Tournament)
+			if h.cluster != nil {
+				if err := redis.ReleaseRoom(roomID, h.cluster.id); err != nil {
+					logger.Warn("failed to release room", "error", err)
+				}
+			}
+		}
+		done = append(done, s.ID)
+	}
+	return done
+}
+
+// CloseAll 以“服务重启”关闭码断开本实例上的所有客户端，并等待它们注销或 ctx 结束
+//
+// 其他实例转发来的客户端不会被断开，它们所在的实例会把房间转移到新的 owner。
+func (h *Hub) CloseAll(ctx context.Context, reason string) {
+	h.mutex.Lock()
+	for client := range h.clients {
+		if client.origin == "" {
+			client.Disconnect(gorilla.CloseServiceRestart, reason)
+		}
+	}
+	h.mutex.Unlock()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		h.mutex.Lock()
+		remaining := h.localClients()
+		h.mutex.Unlock()
+		if remaining == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			h.logger.Warn("timed out waiting for clients to disconnect", "clients", remaining)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// localClients 本实例上的连接数（需在持有锁的情况下调用）
+func (h *Hub) localClients() int {
+	count := 0
+	for client := range h.clients {
+		if client.origin == "" {
+			count++
+		}
+	}
+	return count
+}
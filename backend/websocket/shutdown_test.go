@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/protocol"
+)
+
+// startTestGame 四名玩家加入房间并全部准备，开始游戏
+func startTestGame(t *testing.T, h *Hub, roomID string) []*testPlayer {
+	t.Helper()
+	players := joinSeated(t, h, roomID, "alice", "bob", "carol", "dave")
+	for _, p := range players {
+		h.HandleGameAction(p.client, &protocol.GameAction{Action: protocol.ActionReady})
+	}
+	if active := h.ActiveGames(); active != 1 {
+		t.Fatalf("%d active games, want 1", active)
+	}
+	for _, p := range players {
+		p.messages()
+	}
+	return players
+}
+
+// TestRestoreGames 停机时保存的游戏在新的 Hub 中恢复，玩家重新加入后继续游戏
+func TestRestoreGames(t *testing.T) {
+	old := newTestHub(t)
+	players := startTestGame(t, old, "game-room")
+	old.LockRoom(players[0].client, true)
+
+	snapshots := old.SnapshotGames("shutdown")
+	if len(snapshots) != 1 || snapshots[0].RoomID != "game-room" {
+		t.Fatalf("snapshots %+v, want one for game-room", snapshots)
+	}
+	snapshots[0].ID = "latest"
+	snapshots[0].CreatedAt = time.Now()
+	stale := snapshots[0]
+	stale.ID, stale.State = "stale", "{}"
+	stale.CreatedAt = snapshots[0].CreatedAt.Add(-time.Hour)
+	broken := models.GameSnapshot{ID: "broken", RoomID: "other-room", State: "not json"}
+
+	h := newTestHub(t)
+	done := h.RestoreGames([]models.GameSnapshot{snapshots[0], stale, broken})
+	slices.Sort(done)
+	if want := []string{"broken", "latest", "stale"}; !slices.Equal(done, want) {
+		t.Fatalf("processed snapshots %v, want %v", done, want)
+	}
+	if active := h.ActiveGames(); active != 1 {
+		t.Fatalf("%d active games after restore, want 1", active)
+	}
+	if testRoom(h, "other-room") != nil {
+		t.Fatal("restored a room from a broken snapshot")
+	}
+
+	bob := newTestPlayer(t, h, "bob", models.RolePlayer)
+	h.JoinRoom(bob.client, "game-room")
+	if _, ok := bob.last("game_state"); !ok {
+		t.Fatal("bob got no game_state after rejoining the restored game")
+	}
+	if seat := seatOf(h, "game-room", "bob"); seat != 1 {
+		t.Fatalf("bob in seat %d, want 1", seat)
+	}
+
+	// 房间状态随游戏一起恢复
+	r := testRoom(h, "game-room")
+	r.do(func() {
+		if r.host != "alice" || !r.locked {
+			t.Errorf("restored host %q locked %v, want alice and true", r.host, r.locked)
+		}
+	})
+
+	// 房间已经存在时不会重复恢复
+	if done := h.RestoreGames(snapshots); len(done) != 1 || testRoom(h, "game-room") != r {
+		t.Fatalf("restoring an existing room: processed %v", done)
+	}
+}
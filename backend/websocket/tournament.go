@@ -0,0 +1,734 @@
+package websocket
+
+// 比赛模式
+//
+// 比赛由 Hub 管理，保存在举办比赛的实例的内存中，停机时连同积分榜和比赛桌保存到数据库，
+// 下次启动时由取到快照的实例恢复并继续举办。多实例模式下比赛桌的房间由举办比赛的实例持有，
+// 房间状态中记录了所属的比赛，其他实例不会把比赛桌当作普通房间恢复；举办比赛的实例故障后比赛随之中止。开始后报名的玩家按 4 人一桌分到多张比赛桌，
+// 每张比赛桌对应一个房间，只有分到这张桌子的玩家可以加入，座位固定。每轮每桌打固定的局数，
+// 一局结束后按游戏结果计分（获胜队伍的玩家各得 winPoints 分，收集的牌数用于同分时排名），
+// 房间随即开始下一局，玩家重新准备。所有桌子打完本轮后进入下一轮：
+//   - reseat：按积分重新分桌（前 4 名一桌，依此类推），打完指定的轮数后结束；
+//   - advance：每桌本轮积分前 advancePerTable 名晋级，其余淘汰，打完只剩一桌的决赛后结束。
+//
+// 比赛桌的房间在玩家全部断开后保留，玩家重新加入后继续未打完的一局；房间被关闭或转移后，
+// 玩家重新加入同一个房间ID会重建比赛桌并重打这一局，已完成的局数和积分不受影响。
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/logging"
+	"github.com/chenhailong/hong3/protocol"
+	"github.com/chenhailong/hong3/redis"
+)
+
+// 赛制
+const (
+	TournamentReseat  = "reseat"  // 每轮按积分重新分桌
+	TournamentAdvance = "advance" // 每桌前几名晋级下一轮
+)
+
+// 比赛状态
+const (
+	tournamentRegistering = "registering"
+	tournamentPlaying     = "playing"
+	tournamentFinished    = "finished"
+)
+
+const (
+	// 获胜队伍的玩家每局得分
+	winPoints = 1
+
+	// advance 赛制每桌晋级的人数
+	advancePerTable = 2
+
+	// 未指定时每轮的局数和 reseat 赛制的轮数
+	defaultHandsPerRound = 4
+	defaultRounds        = 3
+
+	// 每轮局数和轮数的上限
+	maxHandsPerRound = 20
+	maxRounds        = 10
+)
+
+var (
+	ErrTournamentNotFound = errors.New("比赛不存在")
+	ErrTournamentStarted  = errors.New("比赛已开始")
+	ErrNotRegistered      = errors.New("未报名该比赛")
+	ErrTablesUnavailable  = errors.New("比赛桌开放失败，请稍后重试")
+)
+
+// errTableUnavailable 比赛桌不能在本实例恢复时的提示
+const errTableUnavailable = "比赛桌已失效（举办比赛的服务器不可用）"
+
+// TournamentOptions 创建比赛的参数，为零的字段使用默认值
+type TournamentOptions struct {
+	Name          string
+	Format        string
+	HandsPerRound int
+	Rounds        int // 只用于 reseat 赛制
+}
+
+// tournament 一场比赛，字段由 mu 保护
+type tournament struct {
+	id            string
+	name          string
+	format        string
+	handsPerRound int
+	rounds        int
+
+	mu     sync.Mutex
+	status string
+	round  int
+
+	// 按报名顺序排列的参赛玩家
+	entrants []*entrant
+
+	// 本轮的比赛桌
+	tables []*tournamentTable
+}
+
+// entrant 参赛玩家及其成绩
+type entrant struct {
+	id   string
+	name string
+
+	points    int
+	hands     int
+	collected int
+
+	// 本轮的成绩，用于 advance 赛制决定晋级
+	roundPoints    int
+	roundCollected int
+
+	// 在第几轮被淘汰，未淘汰时为 0
+	eliminatedIn int
+}
+
+// tournamentTable 一轮中的一张比赛桌
+//
+// 除 hands 外的字段创建后不再修改，房间可以直接读取；hands 由比赛的锁保护。
+type tournamentTable struct {
+	tournament *tournament
+	round      int
+	index      int
+	roomID     string
+	seats      [roomCapacity]*entrant
+
+	// 本轮已完成的局数
+	hands int
+}
+
+// roundChange 一轮结束后需要关闭和开放的比赛桌
+type roundChange struct {
+	closed []*tournamentTable
+	opened []*tournamentTable
+	reason string
+}
+
+// seatOf 返回玩家在这张桌子的座位，不在本桌时返回 -1
+func (tbl *tournamentTable) seatOf(playerID string) int {
+	for i, e := range tbl.seats {
+		if e != nil && e.id == playerID {
+			return i
+		}
+	}
+	return -1
+}
+
+// CreateTournament 创建比赛，创建后开始接受报名
+func (h *Hub) CreateTournament(opts TournamentOptions) (*protocol.Tournament, error) {
+	if opts.Format == "" {
+		opts.Format = TournamentReseat
+	}
+	if opts.HandsPerRound == 0 {
+		opts.HandsPerRound = defaultHandsPerRound
+	}
+	if opts.Rounds == 0 {
+		opts.Rounds = defaultRounds
+	}
+	switch {
+	case opts.Format != TournamentReseat && opts.Format != TournamentAdvance:
+		return nil, fmt.Errorf("赛制必须是 %s 或 %s", TournamentReseat, TournamentAdvance)
+	case opts.HandsPerRound < 1 || opts.HandsPerRound > maxHandsPerRound:
+		return nil, fmt.Errorf("每轮局数必须在 1 到 %d 之间", maxHandsPerRound)
+	case opts.Rounds < 1 || opts.Rounds > maxRounds:
+		return nil, fmt.Errorf("轮数必须在 1 到 %d 之间", maxRounds)
+	}
+
+	t := &tournament{
+		id:            newClientID(),
+		name:          opts.Name,
+		format:        opts.Format,
+		handsPerRound: opts.HandsPerRound,
+		rounds:        opts.Rounds,
+		status:        tournamentRegistering,
+	}
+	if t.format == TournamentAdvance {
+		// 开始时按报名人数确定
+		t.rounds = 0
+	}
+
+	h.mutex.Lock()
+	h.tournaments[t.id] = t
+	h.mutex.Unlock()
+
+	h.logger.Info("创建比赛", logging.KeyTournamentID, t.id, "format", t.format, "hands_per_round", t.handsPerRound)
+	return t.snapshot(), nil
+}
+
+// Tournaments 获取所有比赛的状态
+func (h *Hub) Tournaments() []*protocol.Tournament {
+	h.mutex.Lock()
+	all := make([]*tournament, 0, len(h.tournaments))
+	for _, t := range h.tournaments {
+		all = append(all, t)
+	}
+	h.mutex.Unlock()
+
+	views := make([]*protocol.Tournament, 0, len(all))
+	for _, t := range all {
+		views = append(views, t.snapshot())
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].ID < views[j].ID })
+	return views
+}
+
+// Tournament 获取比赛的状态（包含实时积分榜）
+func (h *Hub) Tournament(id string) (*protocol.Tournament, error) {
+	t := h.findTournament(id)
+	if t == nil {
+		return nil, ErrTournamentNotFound
+	}
+	return t.snapshot(), nil
+}
+
+// RegisterTournament 报名参加比赛，已报名时不做改变
+func (h *Hub) RegisterTournament(id, playerID, name string) (*protocol.Tournament, error) {
+	t := h.findTournament(id)
+	if t == nil {
+		return nil, ErrTournamentNotFound
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status != tournamentRegistering {
+		return nil, ErrTournamentStarted
+	}
+	if t.entrant(playerID) == nil {
+		t.entrants = append(t.entrants, &entrant{id: playerID, name: name})
+		h.logger.Info("报名比赛", logging.KeyTournamentID, t.id, logging.KeyPlayerID, playerID)
+	}
+	return t.view(), nil
+}
+
+// WithdrawTournament 退出尚未开始的比赛
+func (h *Hub) WithdrawTournament(id, playerID string) (*protocol.Tournament, error) {
+	t := h.findTournament(id)
+	if t == nil {
+		return nil, ErrTournamentNotFound
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status != tournamentRegistering {
+		return nil, ErrTournamentStarted
+	}
+	i := slices.IndexFunc(t.entrants, func(e *entrant) bool { return e.id == playerID })
+	if i < 0 {
+		return nil, ErrNotRegistered
+	}
+	t.entrants = slices.Delete(t.entrants, i, i+1)
+	h.logger.Info("退出比赛", logging.KeyTournamentID, t.id, logging.KeyPlayerID, playerID)
+	return t.view(), nil
+}
+
+// StartTournament 开始比赛：随机分桌并通知每位玩家第一轮的座位
+func (h *Hub) StartTournament(id string) (*protocol.Tournament, error) {
+	t := h.findTournament(id)
+	if t == nil {
+		return nil, ErrTournamentNotFound
+	}
+
+	t.mu.Lock()
+	if t.status != tournamentRegistering {
+		t.mu.Unlock()
+		return nil, ErrTournamentStarted
+	}
+	n := len(t.entrants)
+	if n == 0 || n%roomCapacity != 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("报名人数必须是 %d 的倍数，当前 %d 人", roomCapacity, n)
+	}
+	tables := n / roomCapacity
+	if t.format == TournamentAdvance {
+		if tables&(tables-1) != 0 {
+			t.mu.Unlock()
+			return nil, fmt.Errorf("淘汰赛的报名人数必须是 4、8、16、32…，当前 %d 人", n)
+		}
+		t.rounds = bits.Len(uint(tables))
+	}
+
+	players := slices.Clone(t.entrants)
+	rand.Shuffle(len(players), func(i, j int) { players[i], players[j] = players[j], players[i] })
+	t.status = tournamentPlaying
+	change := t.seat(players, "")
+	view := t.view()
+	t.mu.Unlock()
+
+	h.logger.Info("比赛开始", logging.KeyTournamentID, t.id, "players", n, "rounds", view.Rounds)
+	err := h.changeRound(t, change)
+	h.notifyTournament(view)
+	if err != nil {
+		return nil, ErrTablesUnavailable
+	}
+	return view, nil
+}
+
+// findTournament 查找比赛，不存在时返回 nil
+func (h *Hub) findTournament(id string) *tournament {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.tournaments[id]
+}
+
+// recordHand 记录比赛桌上一局的结果，返回这张桌子本轮是否还有下一局（由房间的 goroutine 调用）
+//
+// 所有桌子都打完本轮后进入下一轮或结束比赛，关闭旧的比赛桌在单独的 goroutine 中进行，
+// 避免房间之间互相等待。
+func (h *Hub) recordHand(tbl *tournamentTable, result *game.Result) bool {
+	t := tbl.tournament
+	t.mu.Lock()
+	// 已经结束的轮次（例如比赛桌重建前的旧房间）不再计分
+	if t.status != tournamentPlaying || tbl.round != t.round || tbl.hands >= t.handsPerRound {
+		t.mu.Unlock()
+		return false
+	}
+
+	for _, p := range result.Players {
+		if p.Position < 0 || p.Position >= roomCapacity {
+			continue
+		}
+		e := tbl.seats[p.Position]
+		if e == nil || e.id != p.ID {
+			continue
+		}
+		e.hands++
+		e.collected += p.CollectedCards
+		e.roundCollected += p.CollectedCards
+		if p.IsWinner {
+			e.points += winPoints
+			e.roundPoints += winPoints
+		}
+	}
+	tbl.hands++
+	more := tbl.hands < t.handsPerRound
+
+	var change *roundChange
+	if !more && !slices.ContainsFunc(t.tables, func(other *tournamentTable) bool { return other.hands < t.handsPerRound }) {
+		change = t.nextRound()
+	}
+	view := t.view()
+	t.mu.Unlock()
+
+	h.logger.Info("比赛局结束", logging.KeyTournamentID, t.id, logging.KeyRoomID, tbl.roomID, "round", tbl.round, "hands", tbl.hands)
+	h.notifyTournament(view)
+	if change != nil {
+		go func() {
+			h.changeRound(t, change)
+			if view.Status == tournamentFinished {
+				h.logger.Info("比赛结束", logging.KeyTournamentID, t.id)
+			}
+		}()
+	}
+	return more
+}
+
+// nextRound 本轮所有桌子都已打完，进入下一轮或结束比赛（需在持有比赛的锁时调用）
+func (t *tournament) nextRound() *roundChange {
+	var players []*entrant
+	if t.format == TournamentAdvance {
+		// 每桌本轮成绩最好的玩家晋级，按桌号依次排列；决赛只保留冠军
+		keep := advancePerTable
+		if len(t.tables) == 1 {
+			keep = 1
+		}
+		for _, tbl := range t.tables {
+			seated := slices.Clone(tbl.seats[:])
+			sort.SliceStable(seated, func(i, j int) bool {
+				a, b := seated[i], seated[j]
+				if a.roundPoints != b.roundPoints {
+					return a.roundPoints > b.roundPoints
+				}
+				if a.roundCollected != b.roundCollected {
+					return a.roundCollected > b.roundCollected
+				}
+				return a.points > b.points
+			})
+			for i, e := range seated {
+				if i < keep {
+					players = append(players, e)
+				} else {
+					e.eliminatedIn = t.round
+				}
+			}
+		}
+	} else {
+		players = t.ranked()
+	}
+
+	if t.round >= t.rounds {
+		t.status = tournamentFinished
+		change := &roundChange{closed: t.tables, reason: "比赛已结束"}
+		t.tables = nil
+		return change
+	}
+	return t.seat(players, "本轮比赛已结束")
+}
+
+// seat 开始新的一轮，按顺序每 4 名玩家一桌（需在持有比赛的锁时调用）
+func (t *tournament) seat(players []*entrant, reason string) *roundChange {
+	change := &roundChange{closed: t.tables, reason: reason}
+	t.round++
+	t.tables = make([]*tournamentTable, 0, len(players)/roomCapacity)
+	for i := 0; i+roomCapacity <= len(players); i += roomCapacity {
+		tbl := &tournamentTable{
+			tournament: t,
+			round:      t.round,
+			index:      len(t.tables),
+			roomID:     fmt.Sprintf("%s-r%d-t%d", t.id, t.round, len(t.tables)+1),
+		}
+		copy(tbl.seats[:], players[i:i+roomCapacity])
+		t.tables = append(t.tables, tbl)
+	}
+	for _, e := range players {
+		e.roundPoints = 0
+		e.roundCollected = 0
+	}
+	change.opened = t.tables
+	return change
+}
+
+// changeRound 关闭上一轮的比赛桌，开放新一轮的比赛桌并通知玩家座位
+//
+// 开放失败的比赛桌记录错误日志，不通知座位，返回所有失败的原因。
+func (h *Hub) changeRound(t *tournament, change *roundChange) error {
+	h.mutex.Lock()
+	for _, tbl := range change.closed {
+		delete(h.tables, tbl.roomID)
+	}
+	h.mutex.Unlock()
+
+	for _, tbl := range change.closed {
+		h.CloseRoom(tbl.roomID, change.reason)
+	}
+	var errs []error
+	for _, tbl := range change.opened {
+		if err := h.openTable(tbl); err != nil {
+			h.logger.Error("failed to open tournament table", logging.KeyTournamentID, t.id, logging.KeyRoomID, tbl.roomID, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		for i, e := range tbl.seats {
+			h.notifyPlayer(e.id, &protocol.TournamentSeat{
+				TournamentID: t.id,
+				Round:        tbl.round,
+				Table:        tbl.index + 1,
+				RoomID:       tbl.roomID,
+				Position:     i,
+			})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// openTable 登记比赛桌并创建对应的房间
+//
+// 多实例模式下先获取房间的所有权，失败时返回错误，不创建房间；创建后立即把房间状态写入 Redis，
+// 其他实例据此知道这是比赛桌。
+func (h *Hub) openTable(tbl *tournamentTable) error {
+	if h.cluster != nil {
+		owner, err := redis.ClaimRoom(tbl.roomID, h.cluster.id, h.cluster.leaseTTL)
+		if err != nil {
+			return fmt.Errorf("failed to claim tournament table: %w", err)
+		}
+		if owner != h.cluster.id {
+			return fmt.Errorf("tournament table is owned by instance %s", owner)
+		}
+	}
+
+	h.mutex.Lock()
+	h.tables[tbl.roomID] = tbl
+	if _, ok := h.rooms[tbl.roomID]; ok || h.draining {
+		h.mutex.Unlock()
+		return nil
+	}
+	r := newRoom(h, tbl.roomID, game.NewGame(tbl.roomID, h.logger))
+	// 房间的 goroutine 启动前可以直接读取房间的字段
+	var info *redis.RoomInfo
+	var state []byte
+	var err error
+	if h.cluster != nil {
+		info = r.info()
+		state, err = r.snapshot()
+	}
+	h.addRoom(r)
+	h.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+	// 写入失败时由之后的定期同步补上
+	if state != nil {
+		if err := redis.SaveRoom(info, state, h.cluster.leaseTTL*roomStateTTLFactor); err != nil {
+			h.logger.Warn("failed to save tournament table", logging.KeyRoomID, tbl.roomID, "error", err)
+		}
+	}
+	return nil
+}
+
+// notifyTournament 向所有参赛玩家发送比赛的最新状态
+func (h *Hub) notifyTournament(view *protocol.Tournament) {
+	update := &protocol.TournamentUpdate{Tournament: view}
+	for _, s := range view.Standings {
+		h.notifyPlayer(s.PlayerID, update)
+	}
+}
+
+// notifyPlayer 向玩家的所有连接发送消息，多实例模式下广播到所有实例
+func (h *Hub) notifyPlayer(playerID string, msg protocol.Message) {
+	data, err := protocol.Marshal(msg)
+	if err != nil {
+		h.logger.Error("Error marshalling message", "type", msg.MessageType(), "error", err)
+		return
+	}
+	if h.cluster != nil {
+		h.publish(broadcastChannel, &envelope{Kind: envNotify, PlayerID: playerID, Type: msg.MessageType(), Data: data})
+		return
+	}
+	h.deliverToPlayer(playerID, encoded{typ: msg.MessageType(), data: data})
+}
+
+// deliverToPlayer 把消息投递给本实例上该玩家的连接
+func (h *Hub) deliverToPlayer(playerID string, m encoded) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for client := range h.clients {
+		// 其他实例转发来的客户端由其所在的实例投递
+		if client.origin == "" && client.playerID == playerID {
+			client.deliver(m)
+		}
+	}
+}
+
+// tableHandFinished 比赛桌上的一局结束：记录成绩，本轮还有下一局时重新开始一局
+func (r *room) tableHandFinished(result *game.Result) {
+	if !r.hub.recordHand(r.table, result) {
+		return
+	}
+
+	r.game = game.NewGame(r.id, r.hub.logger)
+	for client := range r.clients {
+		if err := r.addPlayer(client); err != nil {
+			r.clientLog(client).Warn("下一局添加玩家失败", "error", err)
+		}
+	}
+	r.markDirty()
+	for client := range r.clients {
+		r.sendRoomState(client)
+		r.sendGameState(client)
+	}
+}
+
+// tournamentState 保存到数据库的比赛状态，停机后由 RestoreTournaments 恢复
+type tournamentState struct {
+	ID            string         `json:"id"`
+	Name          string         `json:"name"`
+	Format        string         `json:"format"`
+	HandsPerRound int            `json:"hands_per_round"`
+	Rounds        int            `json:"rounds"`
+	Status        string         `json:"status"`
+	Round         int            `json:"round"`
+	Entrants      []entrantState `json:"entrants"`
+	Tables        []tableState   `json:"tables"`
+}
+
+// entrantState 参赛玩家的成绩
+type entrantState struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Points         int    `json:"points"`
+	Hands          int    `json:"hands"`
+	Collected      int    `json:"collected"`
+	RoundPoints    int    `json:"round_points"`
+	RoundCollected int    `json:"round_collected"`
+	EliminatedIn   int    `json:"eliminated_in,omitempty"`
+}
+
+// tableState 本轮的一张比赛桌，Seats 为各座位玩家的ID
+type tableState struct {
+	Index  int      `json:"index"`
+	RoomID string   `json:"room_id"`
+	Seats  []string `json:"seats"`
+	Hands  int      `json:"hands"`
+}
+
+// state 获取需要保存的比赛状态
+func (t *tournament) state() *tournamentState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := &tournamentState{
+		ID:            t.id,
+		Name:          t.name,
+		Format:        t.format,
+		HandsPerRound: t.handsPerRound,
+		Rounds:        t.rounds,
+		Status:        t.status,
+		Round:         t.round,
+		Entrants:      make([]entrantState, 0, len(t.entrants)),
+		Tables:        make([]tableState, 0, len(t.tables)),
+	}
+	for _, e := range t.entrants {
+		s.Entrants = append(s.Entrants, entrantState{
+			ID:             e.id,
+			Name:           e.name,
+			Points:         e.points,
+			Hands:          e.hands,
+			Collected:      e.collected,
+			RoundPoints:    e.roundPoints,
+			RoundCollected: e.roundCollected,
+			EliminatedIn:   e.eliminatedIn,
+		})
+	}
+	for _, tbl := range t.tables {
+		seats := make([]string, 0, roomCapacity)
+		for _, e := range tbl.seats {
+			seats = append(seats, e.id)
+		}
+		s.Tables = append(s.Tables, tableState{Index: tbl.index, RoomID: tbl.roomID, Seats: seats, Hands: tbl.hands})
+	}
+	return s
+}
+
+// restoreTournament 按保存的状态重建比赛，比赛桌的座位必须是参赛玩家
+func restoreTournament(s *tournamentState) (*tournament, error) {
+	t := &tournament{
+		id:            s.ID,
+		name:          s.Name,
+		format:        s.Format,
+		handsPerRound: s.HandsPerRound,
+		rounds:        s.Rounds,
+		status:        s.Status,
+		round:         s.Round,
+	}
+	for _, e := range s.Entrants {
+		t.entrants = append(t.entrants, &entrant{
+			id:             e.ID,
+			name:           e.Name,
+			points:         e.Points,
+			hands:          e.Hands,
+			collected:      e.Collected,
+			roundPoints:    e.RoundPoints,
+			roundCollected: e.RoundCollected,
+			eliminatedIn:   e.EliminatedIn,
+		})
+	}
+	for _, ts := range s.Tables {
+		if len(ts.Seats) != roomCapacity {
+			return nil, fmt.Errorf("table %s has %d seats", ts.RoomID, len(ts.Seats))
+		}
+		tbl := &tournamentTable{tournament: t, round: t.round, index: ts.Index, roomID: ts.RoomID, hands: ts.Hands}
+		for i, id := range ts.Seats {
+			if tbl.seats[i] = t.entrant(id); tbl.seats[i] == nil {
+				return nil, fmt.Errorf("table %s seats unknown player %s", ts.RoomID, id)
+			}
+		}
+		t.tables = append(t.tables, tbl)
+	}
+	return t, nil
+}
+
+// entrant 查找参赛玩家（需在持有比赛的锁时调用）
+func (t *tournament) entrant(playerID string) *entrant {
+	for _, e := range t.entrants {
+		if e.id == playerID {
+			return e
+		}
+	}
+	return nil
+}
+
+// ranked 按名次排列的参赛玩家（需在持有比赛的锁时调用）
+//
+// 未淘汰的玩家在前，淘汰得越晚名次越靠前；其次按积分和收集的牌数，最后按报名顺序。
+func (t *tournament) ranked() []*entrant {
+	players := slices.Clone(t.entrants)
+	sort.SliceStable(players, func(i, j int) bool {
+		a, b := players[i], players[j]
+		if a.eliminatedIn != b.eliminatedIn {
+			return a.eliminatedIn == 0 || (b.eliminatedIn != 0 && a.eliminatedIn > b.eliminatedIn)
+		}
+		if a.points != b.points {
+			return a.points > b.points
+		}
+		return a.collected > b.collected
+	})
+	return players
+}
+
+// snapshot 获取比赛的当前状态
+func (t *tournament) snapshot() *protocol.Tournament {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.view()
+}
+
+// view 构建比赛的当前状态（需在持有比赛的锁时调用）
+func (t *tournament) view() *protocol.Tournament {
+	view := &protocol.Tournament{
+		ID:            t.id,
+		Name:          t.name,
+		Format:        t.format,
+		Status:        t.status,
+		HandsPerRound: t.handsPerRound,
+		Rounds:        t.rounds,
+		Round:         t.round,
+		Standings:     make([]protocol.TournamentStanding, 0, len(t.entrants)),
+		Tables:        make([]protocol.TournamentTable, 0, len(t.tables)),
+	}
+	for i, e := range t.ranked() {
+		view.Standings = append(view.Standings, protocol.TournamentStanding{
+			Rank:           i + 1,
+			PlayerID:       e.id,
+			Name:           e.name,
+			Points:         e.points,
+			Hands:          e.hands,
+			CollectedCards: e.collected,
+			Eliminated:     e.eliminatedIn > 0,
+		})
+	}
+	for _, tbl := range t.tables {
+		players := make([]string, 0, roomCapacity)
+		for _, e := range tbl.seats {
+			players = append(players, e.id)
+		}
+		view.Tables = append(view.Tables, protocol.TournamentTable{
+			Table:   tbl.index + 1,
+			RoomID:  tbl.roomID,
+			Players: players,
+			Hands:   tbl.hands,
+		})
+	}
+	return view
+}
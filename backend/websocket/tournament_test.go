@@ -0,0 +1,397 @@
+package websocket
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/chenhailong/hong3/game"
+	"github.com/chenhailong/hong3/models"
+	"github.com/chenhailong/hong3/protocol"
+)
+
+// newTestTournament 进行中的比赛，按报名顺序分好第一轮的桌子
+func newTestTournament(format string, players, rounds int) *tournament {
+	t := &tournament{id: "t", format: format, handsPerRound: 1, rounds: rounds, status: tournamentPlaying}
+	for i := 0; i < players; i++ {
+		t.entrants = append(t.entrants, &entrant{id: fmt.Sprintf("p%d", i+1)})
+	}
+	t.seat(t.entrants, "")
+	return t
+}
+
+// seatIDs 比赛桌上按座位排列的玩家ID
+func seatIDs(tbl *tournamentTable) []string {
+	ids := make([]string, 0, roomCapacity)
+	for _, e := range tbl.seats {
+		ids = append(ids, e.id)
+	}
+	return ids
+}
+
+// entrantIDs 按顺序排列的玩家ID
+func entrantIDs(entrants []*entrant) []string {
+	ids := make([]string, 0, len(entrants))
+	for _, e := range entrants {
+		ids = append(ids, e.id)
+	}
+	return ids
+}
+
+// scoreRound 按 points 给出玩家本轮的成绩（同时计入总成绩）
+func scoreRound(t *tournament, points map[string]int) {
+	for _, e := range t.entrants {
+		e.roundPoints = points[e.id]
+		e.points += points[e.id]
+	}
+}
+
+func TestTournamentRankedOrder(t *testing.T) {
+	tr := newTestTournament(TournamentAdvance, 4, 1)
+	p := tr.entrants
+	p[0].eliminatedIn = 1
+	p[1].eliminatedIn = 2
+	p[2].points, p[2].collected = 3, 10
+	p[3].points, p[3].collected = 3, 20
+
+	// 未淘汰的在前（同分按收集的牌数），淘汰得越晚越靠前
+	want := []string{"p4", "p3", "p2", "p1"}
+	if got := entrantIDs(tr.ranked()); !slices.Equal(got, want) {
+		t.Fatalf("ranked %v, want %v", got, want)
+	}
+}
+
+func TestTournamentReseatByStandings(t *testing.T) {
+	tr := newTestTournament(TournamentReseat, 8, 2)
+	if len(tr.tables) != 2 || tr.round != 1 {
+		t.Fatalf("round %d with %d tables, want round 1 with 2 tables", tr.round, len(tr.tables))
+	}
+
+	scoreRound(tr, map[string]int{"p8": 4, "p5": 3, "p2": 2, "p7": 1})
+	tr.entrants[0].collected = 5 // p1 在未得分的玩家中排第一
+	change := tr.nextRound()
+
+	if tr.round != 2 || tr.status != tournamentPlaying {
+		t.Fatalf("round %d status %s, want round 2 playing", tr.round, tr.status)
+	}
+	if len(change.closed) != 2 || len(change.opened) != 2 {
+		t.Fatalf("closed %d opened %d tables, want 2 and 2", len(change.closed), len(change.opened))
+	}
+	want := [][]string{{"p8", "p5", "p2", "p7"}, {"p1", "p3", "p4", "p6"}}
+	for i, tbl := range tr.tables {
+		if got := seatIDs(tbl); !slices.Equal(got, want[i]) {
+			t.Errorf("table %d seats %v, want %v", i+1, got, want[i])
+		}
+		if tbl.roomID != fmt.Sprintf("t-r2-t%d", i+1) {
+			t.Errorf("table %d room %s", i+1, tbl.roomID)
+		}
+	}
+	for _, e := range tr.entrants {
+		if e.roundPoints != 0 {
+			t.Errorf("%s round points %d not reset", e.id, e.roundPoints)
+		}
+	}
+
+	// 打完最后一轮后结束
+	change = tr.nextRound()
+	if tr.status != tournamentFinished || tr.tables != nil {
+		t.Fatalf("status %s with %d tables, want finished without tables", tr.status, len(tr.tables))
+	}
+	if len(change.closed) != 2 || len(change.opened) != 0 {
+		t.Fatalf("closed %d opened %d tables, want 2 and 0", len(change.closed), len(change.opened))
+	}
+}
+
+func TestTournamentAdvanceTwoTables(t *testing.T) {
+	tr := newTestTournament(TournamentAdvance, 8, 2)
+
+	// 第一桌 p1-p4，第二桌 p5-p8；同分时按本轮收集的牌数
+	scoreRound(tr, map[string]int{"p3": 2, "p2": 1, "p8": 2, "p6": 1, "p5": 1})
+	tr.entrants[5].roundCollected = 10 // p6 与 p5 同分，收集的牌更多
+	tr.nextRound()
+
+	if len(tr.tables) != 1 {
+		t.Fatalf("%d tables after round 1, want 1", len(tr.tables))
+	}
+	if got, want := seatIDs(tr.tables[0]), []string{"p3", "p2", "p8", "p6"}; !slices.Equal(got, want) {
+		t.Fatalf("final seats %v, want %v", got, want)
+	}
+	for _, id := range []string{"p1", "p4", "p5", "p7"} {
+		if e := tr.entrant(id); e.eliminatedIn != 1 {
+			t.Errorf("%s eliminated in round %d, want 1", id, e.eliminatedIn)
+		}
+	}
+
+	// 决赛只保留冠军
+	scoreRound(tr, map[string]int{"p6": 3, "p3": 1})
+	tr.nextRound()
+	if tr.status != tournamentFinished {
+		t.Fatalf("status %s, want finished", tr.status)
+	}
+	ranked := entrantIDs(tr.ranked())
+	if ranked[0] != "p6" {
+		t.Fatalf("champion %s, want p6 (standings %v)", ranked[0], ranked)
+	}
+	// 决赛的其他玩家排在第一轮淘汰的玩家之前
+	for _, id := range ranked[1:4] {
+		if e := tr.entrant(id); e.eliminatedIn != 2 {
+			t.Errorf("%s ranked %d but eliminated in round %d", id, slices.Index(ranked, id)+1, e.eliminatedIn)
+		}
+	}
+}
+
+func TestTournamentAdvanceFourTables(t *testing.T) {
+	tr := newTestTournament(TournamentAdvance, 16, 3)
+
+	// 每桌第一个座位的玩家得 2 分，第二个座位得 1 分
+	points := make(map[string]int)
+	for _, tbl := range tr.tables {
+		points[tbl.seats[0].id] = 2
+		points[tbl.seats[1].id] = 1
+	}
+	scoreRound(tr, points)
+	tr.nextRound()
+	if tr.round != 2 || len(tr.tables) != 2 {
+		t.Fatalf("round %d with %d tables, want round 2 with 2 tables", tr.round, len(tr.tables))
+	}
+	want := [][]string{{"p1", "p2", "p5", "p6"}, {"p9", "p10", "p13", "p14"}}
+	for i, tbl := range tr.tables {
+		if got := seatIDs(tbl); !slices.Equal(got, want[i]) {
+			t.Errorf("round 2 table %d seats %v, want %v", i+1, got, want[i])
+		}
+	}
+
+	scoreRound(tr, map[string]int{"p5": 2, "p1": 1, "p14": 2, "p9": 1})
+	tr.nextRound()
+	if tr.round != 3 || len(tr.tables) != 1 {
+		t.Fatalf("round %d with %d tables, want round 3 with 1 table", tr.round, len(tr.tables))
+	}
+	if got, want := seatIDs(tr.tables[0]), []string{"p5", "p1", "p14", "p9"}; !slices.Equal(got, want) {
+		t.Fatalf("final seats %v, want %v", got, want)
+	}
+
+	scoreRound(tr, map[string]int{"p9": 1})
+	tr.nextRound()
+	if tr.status != tournamentFinished {
+		t.Fatalf("status %s, want finished", tr.status)
+	}
+	remaining := 0
+	for _, e := range tr.entrants {
+		if e.eliminatedIn == 0 {
+			remaining++
+		}
+	}
+	if remaining != 1 || tr.ranked()[0].id != "p9" {
+		t.Fatalf("%d players not eliminated, champion %s; want only p9", remaining, tr.ranked()[0].id)
+	}
+}
+
+// handResult 一局的结果，winners 所在的队伍获胜
+func handResult(tbl *tournamentTable, winners ...string) *game.Result {
+	result := &game.Result{}
+	for i, e := range tbl.seats {
+		result.Players = append(result.Players, game.PlayerResult{
+			ID:             e.id,
+			Position:       i,
+			CollectedCards: i,
+			IsWinner:       slices.Contains(winners, e.id),
+		})
+	}
+	return result
+}
+
+func TestTournamentRecordHand(t *testing.T) {
+	h := newTestHub(t)
+	created, err := h.CreateTournament(TournamentOptions{Name: "cup", HandsPerRound: 2, Rounds: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= roomCapacity; i++ {
+		if _, err := h.RegisterTournament(created.ID, fmt.Sprintf("p%d", i), fmt.Sprintf("P%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.StartTournament(created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := h.findTournament(created.ID)
+	tbl := tr.tables[0]
+	first, second := tbl.seats[0].id, tbl.seats[2].id
+	if !h.recordHand(tbl, handResult(tbl, first, second)) {
+		t.Fatal("first hand: want another hand in this round")
+	}
+
+	// 与座位不符的结果不计分；打满 handsPerRound 局后本轮（也是最后一轮）结束
+	stray := handResult(tbl, first)
+	stray.Players[1].ID = "intruder"
+	if h.recordHand(tbl, stray) {
+		t.Fatal("second hand: want the round to end after handsPerRound hands")
+	}
+	view, err := h.Tournament(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view.Status != tournamentFinished || view.Standings[0].PlayerID != first || view.Standings[0].Points != 2 {
+		t.Fatalf("after the last hand: status %s, leader %s with %d points; want finished with %s on 2",
+			view.Status, view.Standings[0].PlayerID, view.Standings[0].Points, first)
+	}
+	for _, s := range view.Standings {
+		want := 2
+		if s.PlayerID == tbl.seats[1].id {
+			want = 1
+		}
+		if s.Hands != want {
+			t.Errorf("%s played %d hands, want %d", s.PlayerID, s.Hands, want)
+		}
+	}
+
+	// 比赛结束后的结果不再计分
+	if h.recordHand(tbl, handResult(tbl, first)) {
+		t.Fatal("hand after the tournament finished: want no further hands")
+	}
+	if view, _ := h.Tournament(created.ID); view.Standings[0].Points != 2 {
+		t.Fatalf("points changed after the tournament finished: %d", view.Standings[0].Points)
+	}
+}
+
+// TestTournamentTableSeats 比赛桌只接受分到这张桌子的玩家，座位固定
+func TestTournamentTableSeats(t *testing.T) {
+	h := newTestHub(t)
+	created, _ := h.CreateTournament(TournamentOptions{Name: "cup"})
+	for i := 1; i <= roomCapacity; i++ {
+		h.RegisterTournament(created.ID, fmt.Sprintf("p%d", i), fmt.Sprintf("P%d", i))
+	}
+	if _, err := h.StartTournament(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	tbl := h.findTournament(created.ID).tables[0]
+
+	outsider := newTestPlayer(t, h, "outsider", models.RolePlayer)
+	h.JoinRoom(outsider.client, tbl.roomID)
+	if _, ok := outsider.last("error"); !ok {
+		t.Fatal("outsider joined a tournament table")
+	}
+
+	// 未携带 token 的连接不能冒用参赛玩家的ID
+	last := tbl.seats[roomCapacity-1]
+	impostor := newGuestPlayer(t, h, last.id)
+	h.JoinRoom(impostor.client, tbl.roomID)
+	impostor.expectError("请登录后再加入比赛桌")
+
+	player := newTestPlayer(t, h, last.id, models.RolePlayer)
+	h.JoinRoom(player.client, tbl.roomID)
+	if _, ok := player.last("room_state"); !ok {
+		t.Fatal("seated player got no room_state")
+	}
+
+	h.mutex.Lock()
+	r := h.rooms[tbl.roomID]
+	h.mutex.Unlock()
+	var seated *game.Player
+	r.do(func() {
+		seated = r.game.Players[roomCapacity-1]
+	})
+	if seated == nil || seated.ID != last.id {
+		t.Fatalf("seat %d holds %+v, want %s", roomCapacity-1, seated, last.id)
+	}
+}
+
+// TestRestoreTournaments 停机时保存的比赛在新的 Hub 中恢复，比赛桌上未打完的一局随之恢复
+func TestRestoreTournaments(t *testing.T) {
+	old := newTestHub(t)
+	created, err := old.CreateTournament(TournamentOptions{Name: "cup", HandsPerRound: 2, Rounds: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= roomCapacity; i++ {
+		old.RegisterTournament(created.ID, fmt.Sprintf("p%d", i), fmt.Sprintf("P%d", i))
+	}
+	if _, err := old.StartTournament(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	open, _ := old.CreateTournament(TournamentOptions{Name: "open"})
+	old.RegisterTournament(open.ID, "p5", "P5")
+
+	// 第一局已计分，第二局正在进行
+	tbl := old.findTournament(created.ID).tables[0]
+	old.recordHand(tbl, handResult(tbl, tbl.seats[0].id, tbl.seats[2].id))
+	for _, e := range tbl.seats {
+		p := newTestPlayer(t, old, e.id, models.RolePlayer)
+		old.JoinRoom(p.client, tbl.roomID)
+		old.HandleGameAction(p.client, &protocol.GameAction{Action: protocol.ActionReady})
+	}
+	if active := old.ActiveGames(); active != 1 {
+		t.Fatalf("%d active games, want 1", active)
+	}
+
+	tournaments := old.SnapshotTournaments("shutdown")
+	games := old.SnapshotGames("shutdown")
+	if len(tournaments) != 2 || len(games) != 1 {
+		t.Fatalf("%d tournament and %d game snapshots, want 2 and 1", len(tournaments), len(games))
+	}
+	for _, s := range tournaments {
+		if s.TournamentID == created.ID && len(s.Players) != roomCapacity {
+			t.Errorf("tournament snapshot players %+v, want all entrants", s.Players)
+		}
+	}
+
+	h := newTestHub(t)
+	h.RestoreTournaments(tournaments)
+	if done := h.RestoreGames(games); len(done) != 1 {
+		t.Fatalf("processed %d game snapshots, want 1", len(done))
+	}
+
+	for _, id := range []string{created.ID, open.ID} {
+		before, _ := old.Tournament(id)
+		after, err := h.Tournament(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(before, after) {
+			t.Errorf("restored tournament %+v, want %+v", after, before)
+		}
+	}
+	if _, err := h.RegisterTournament(open.ID, "p6", "P6"); err != nil {
+		t.Errorf("registering for a restored tournament: %v", err)
+	}
+
+	// 比赛桌的房间恢复了进行中的一局，打完后计入恢复的比赛
+	r := testRoom(h, tbl.roomID)
+	if r == nil || r.table == nil {
+		t.Fatal("tournament table room not restored")
+	}
+	var status string
+	r.do(func() { status = r.game.GetStatus() })
+	if status != game.GameStatusPlaying.String() {
+		t.Fatalf("restored table status %s, want playing", status)
+	}
+	if h.recordHand(r.table, handResult(r.table, tbl.seats[0].id, tbl.seats[2].id)) {
+		t.Fatal("last hand: want the round to end")
+	}
+	view, _ := h.Tournament(created.ID)
+	if view.Status != tournamentFinished || view.Standings[0].Points != 2 {
+		t.Errorf("after the last hand: status %s, leader on %d points; want finished on 2", view.Status, view.Standings[0].Points)
+	}
+}
+
+// TestRestoreTournamentsInvalid 无法解析或座位不完整的比赛快照不会恢复
+func TestRestoreTournamentsInvalid(t *testing.T) {
+	h := newTestHub(t)
+	h.RestoreTournaments([]models.TournamentSnapshot{
+		{TournamentID: "broken", State: "{"},
+		{TournamentID: "short", State: `{"id":"short","status":"playing","entrants":[{"id":"p1"}],"tables":[{"room_id":"short-t1","seats":["p1"]}]}`},
+	})
+	for _, id := range []string{"broken", "short"} {
+		if _, err := h.Tournament(id); err == nil {
+			t.Errorf("tournament %s restored from an invalid snapshot", id)
+		}
+	}
+	h.mutex.Lock()
+	_, ok := h.tables["short-t1"]
+	h.mutex.Unlock()
+	if ok {
+		t.Error("table of an invalid snapshot registered")
+	}
+}
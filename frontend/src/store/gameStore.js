@@ -1,4 +1,5 @@
 import { reactive } from 'vue';
+import authStore from './authStore';
 
 const gameState = reactive({
   connected: false,
@@ -23,8 +24,17 @@ const gameState = reactive({
 
 const ws = {
   connection: null,
+  lastSeq: null, // 已处理的最后一个房间事件的序号
+  requestedSince: null, // 已请求补发的起始序号，避免重复请求
+  pendingAction: null, // 等待服务器确认的游戏动作 { id, key }
 };
 
+// WebSocket 协议版本，与后端 protocol.Version 一致（消息定义见 backend/protocol/schema.json）
+const PROTOCOL_VERSION = 1;
+
+// 客户端接收太慢被服务器断开时的关闭码（protocol.CloseSlowConsumer），需要重新连接
+const CLOSE_SLOW_CONSUMER = 4008;
+
 // 获取后端服务器地址（通过 nginx 代理，使用相对路径）
 const getBackendUrl = () => {
   // 使用相对路径，通过 nginx 代理到后端
@@ -47,8 +57,13 @@ const connectWebSocket = async (playerId, playerName) => {
 
   try {
     const backend = getBackendUrl();
-    const wsUrl = `${backend.ws}/ws?player_id=${playerId}&player_name=${encodeURIComponent(playerName)}`;
+    let wsUrl = `${backend.ws}/ws?player_id=${playerId}&player_name=${encodeURIComponent(playerName)}`;
+    // 日志中不能出现 token
     console.log('连接 WebSocket:', wsUrl);
+    // 携带 token，后端据此识别用户角色
+    if (authStore.state.token && authStore.state.user && authStore.state.user.id === playerId) {
+      wsUrl += `&token=${encodeURIComponent(authStore.state.token)}`;
+    }
     ws.connection = new WebSocket(wsUrl);
 
     ws.connection.onopen = () => {
@@ -81,14 +96,19 @@ const connectWebSocket = async (playerId, playerName) => {
       }
     };
 
-    ws.connection.onclose = () => {
-      console.log('WebSocket连接已关闭');
+    ws.connection.onclose = (event) => {
+      console.log('WebSocket连接已关闭', event.code);
       gameState.connected = false;
       gameState.connecting = false;
       // 注意：不在这里清除 roomId，因为可能是页面刷新导致的连接断开
       // 页面刷新时会保存 roomId 到 localStorage，重新连接后会恢复
       // 只有在明确离开房间时才清除 roomId
       gameState.roomPlayers = [];
+      resetSequence();
+      // 消息积压被断开：重新连接，连接后会自动重新加入保存的房间并获取完整状态
+      if (event.code === CLOSE_SLOW_CONSUMER) {
+        setTimeout(() => connectWebSocket(playerId, playerName), 1000);
+      }
     };
 
     ws.connection.onerror = (error) => {
@@ -104,7 +124,44 @@ const connectWebSocket = async (playerId, playerName) => {
   }
 };
 
+// 快照类消息携带的是生成快照时最后一个事件的序号
+const SNAPSHOT_TYPES = ['room_state', 'game_state'];
+
+// 检查房间事件的序号：重复的事件忽略，发现缺失时请求补发缺失的事件
+const acceptSequence = (message) => {
+  if (message.seq === undefined) {
+    return true;
+  }
+  if (SNAPSHOT_TYPES.includes(message.type) || ws.lastSeq === null) {
+    ws.lastSeq = message.seq;
+    ws.requestedSince = null;
+    return true;
+  }
+  if (message.seq <= ws.lastSeq) {
+    return false;
+  }
+  if (message.seq > ws.lastSeq + 1) {
+    if (ws.requestedSince !== ws.lastSeq) {
+      console.warn('房间事件不连续，请求补发:', ws.lastSeq, message.seq);
+      ws.requestedSince = ws.lastSeq;
+      sendMessage({ type: 'events_since', since: ws.lastSeq });
+    }
+    return false;
+  }
+  ws.lastSeq = message.seq;
+  return true;
+};
+
+// 重置房间事件序号（离开房间或断开连接时）
+const resetSequence = () => {
+  ws.lastSeq = null;
+  ws.requestedSince = null;
+};
+
 const handleMessage = (message) => {
+  if (!acceptSequence(message)) {
+    return;
+  }
   switch (message.type) {
     case 'room_state':
       updateRoomState(message);
@@ -133,7 +190,15 @@ const handleMessage = (message) => {
     case 'cards_played':
       handleCardsPlayed(message);
       break;
+    case 'player_pass':
+    case 'round_end':
+      handleTurnChanged(message);
+      break;
+    case 'action_ack':
+      settleAction(message.action_id);
+      break;
     case 'error':
+      settleAction(message.action_id);
       gameState.error = message.message || message.error;
       console.error('收到错误消息:', message);
       break;
@@ -161,11 +226,11 @@ const handlePlayerJoined = (message) => {
   if (gameState.roomId) {
     fetchRooms();
     // 也可以直接添加玩家到列表（如果消息包含完整信息）
-    if (message.playerID && message.name) {
-      const existingPlayer = gameState.roomPlayers.find(p => p.id === message.playerID);
+    if (message.player_id && message.name) {
+      const existingPlayer = gameState.roomPlayers.find(p => p.id === message.player_id);
       if (!existingPlayer) {
         gameState.roomPlayers.push({
-          id: message.playerID,
+          id: message.player_id,
           name: message.name
         });
       }
@@ -176,9 +241,9 @@ const handlePlayerJoined = (message) => {
 const handlePlayerLeft = (message) => {
   console.log('玩家离开:', message);
   // 从房间玩家列表中移除离开的玩家
-  if (gameState.roomId && message.playerID) {
+  if (gameState.roomId && message.player_id) {
     gameState.roomPlayers = gameState.roomPlayers.filter(
-      p => p.id !== message.playerID
+      p => p.id !== message.player_id
     );
     // 刷新房间列表
     fetchRooms();
@@ -193,7 +258,7 @@ const sendMessage = (message) => {
 
   try {
     console.log('发送消息:', message);
-    ws.connection.send(JSON.stringify(message));
+    ws.connection.send(JSON.stringify({ v: PROTOCOL_VERSION, ...message }));
   } catch (error) {
     console.error('发送消息错误:', error);
     gameState.error = '发送消息错误';
@@ -216,6 +281,7 @@ const joinRoom = (roomId) => {
 const leaveRoom = () => {
   if (gameState.roomId) {
     sendMessage({ type: 'leave_room' });
+    resetSequence();
     gameState.roomId = null;
     gameState.roomPlayers = [];
     gameState.gameStatus = null;
@@ -244,16 +310,38 @@ const toggleCardSelection = (index) => {
   }
 };
 
+// 发送游戏动作
+// 每个动作带有 action_id，服务器对同一 action_id 只执行一次；
+// 在收到确认前重复发送同一动作（例如连续点击）时沿用原来的 action_id
+const sendGameAction = (action, fields = {}) => {
+  const key = JSON.stringify({ action, ...fields });
+  if (!ws.pendingAction || ws.pendingAction.key !== key) {
+    const id = window.crypto && window.crypto.randomUUID
+      ? window.crypto.randomUUID()
+      : `${Date.now()}-${Math.random().toString(36).slice(2)}`;
+    ws.pendingAction = { id, key };
+  }
+  sendMessage({
+    type: 'game_action',
+    action_id: ws.pendingAction.id,
+    action,
+    ...fields,
+  });
+};
+
+// 收到动作的处理结果
+const settleAction = (actionId) => {
+  if (actionId && ws.pendingAction && ws.pendingAction.id === actionId) {
+    ws.pendingAction = null;
+  }
+};
+
 // 出牌
 const playCards = () => {
   if (!gameState.roomId || !gameState.selectedCards || gameState.selectedCards.length === 0) {
     return;
   }
-  sendMessage({
-    type: 'game_action',
-    action: 'play_cards',
-    card_indices: gameState.selectedCards,
-  });
+  sendGameAction('play_cards', { card_indices: gameState.selectedCards });
   gameState.selectedCards = [];
 };
 
@@ -262,10 +350,7 @@ const pass = () => {
   if (!gameState.roomId) {
     return;
   }
-  sendMessage({
-    type: 'game_action',
-    action: 'pass',
-  });
+  sendGameAction('pass');
 };
 
 // 提示出牌
@@ -279,17 +364,14 @@ const readyGame = () => {
     gameState.error = '未加入房间';
     return;
   }
-  sendMessage({
-    type: 'game_action',
-    action: 'ready',
-  });
+  sendGameAction('ready');
 };
 
 const handlePlayerReady = (message) => {
   console.log('玩家准备:', message);
   // 更新玩家准备状态
-  if (gameState.roomId && message.playerID) {
-    const player = gameState.roomPlayers.find(p => p.id === message.playerID);
+  if (gameState.roomId && message.player_id) {
+    const player = gameState.roomPlayers.find(p => p.id === message.player_id);
     if (player) {
       player.ready = true;
     } else {
@@ -302,8 +384,8 @@ const handlePlayerReady = (message) => {
 const handleGameStarted = (message) => {
   console.log('游戏开始:', message);
   gameState.gameStatus = 'playing';
-  if (message.currentPlayer !== undefined) {
-    gameState.currentPlayer = message.currentPlayer;
+  if (message.current_player !== undefined) {
+    gameState.currentPlayer = message.current_player;
   }
   // 触发游戏开始回调
   if (gameState.onGameStart) {
@@ -400,8 +482,8 @@ const handleCardsPlayed = (message) => {
   }
   
   // 更新其他玩家的牌数（如果出牌的玩家出完牌了）
-  if (message.playerID && gameState.otherPlayers) {
-    const player = gameState.otherPlayers.find(p => p.id === message.playerID);
+  if (message.player_id && gameState.otherPlayers) {
+    const player = gameState.otherPlayers.find(p => p.id === message.player_id);
     if (player && message.table_cards && message.table_cards.cards) {
       // 这里可以根据桌面牌数量推断玩家出牌数量，但更准确的是从 game_state 消息获取
       // 暂时不更新，等待 game_state 消息
@@ -409,6 +491,17 @@ const handleCardsPlayed = (message) => {
   }
 };
 
+// 处理过牌和一轮结束消息
+const handleTurnChanged = (message) => {
+  if (message.current_player !== undefined) {
+    gameState.currentPlayer = message.current_player;
+  }
+  // 所有人都过牌后桌面牌被清空
+  if (message.type === 'round_end') {
+    gameState.tableCards = null;
+  }
+};
+
 const fetchRooms = async () => {
   if (gameState.loadingRooms) {
     return;